@@ -1,58 +1,404 @@
 package main
 
 import (
-    "log"
+    "context"
+    "database/sql"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "os"
+    "os/signal"
+    "path/filepath"
+    "runtime/debug"
+    "syscall"
 
     "loan_service/internal/config"
+    "loan_service/internal/docgen"
     "loan_service/internal/domain"
+    "loan_service/internal/events"
     "loan_service/internal/handler"
+    "loan_service/internal/logging"
+    "loan_service/internal/metrics"
+    "loan_service/internal/migrate"
     "loan_service/internal/repository"
+    "loan_service/internal/repository/memory"
     "loan_service/internal/service"
+    "loan_service/internal/storage"
+    "loan_service/internal/telemetry"
+    "loan_service/migrations"
 
     "github.com/gin-gonic/gin"
+    "github.com/glebarez/sqlite"
+    "go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
     "gorm.io/driver/postgres"
     "gorm.io/gorm"
+    "gorm.io/plugin/dbresolver"
+    "gorm.io/plugin/opentelemetry/tracing"
 )
 
+// usage describes the subcommands understood by the binary.
+const usage = `usage: loan_service [flags] [command]
+
+commands:
+  serve                 start the HTTP server (default)
+  migrate up            apply all pending migrations
+  migrate down [steps]  revert the last applied migration, or the last steps migrations
+  migrate status        list migrations and whether they are applied
+  config                print the effective configuration with secrets masked`
+
 func main() {
-    // Load configuration from environment variables
-    cfg := config.Load()
-
-    // Initialize database connection
-    db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
-    if err != nil {
-        log.Fatalf("failed to connect database: %v", err)
-    }
-    // Enable UUID extension for Postgres so gorm can generate UUIDs
-    if err := db.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\";").Error; err != nil {
-        log.Fatalf("failed to create uuid extension: %v", err)
-    }
-    // Auto migrate the schema. This will create tables if they do not
-    // exist. In production you may want to manage migrations using
-    // dedicated tools instead of gorm's automigrate.
-    if err := db.AutoMigrate(
-        &domain.Loan{},
-        &domain.Approval{},
-        &domain.Investor{},
-        &domain.Investment{},
-        &domain.Disbursement{},
-    ); err != nil {
-        log.Fatalf("failed to migrate database: %v", err)
-    }
-
-    // Initialize repository, service and handlers
-    repo := repository.NewLoanRepository(db)
-    svc := service.NewLoanService(repo)
+    // Load configuration from the defaults, the optional YAML file,
+    // the environment and the flags.
+    cfg, args, err := config.Load(os.Args[1:])
+    if errors.Is(err, flag.ErrHelp) {
+        fmt.Fprintln(os.Stdout, usage)
+        fmt.Fprintln(os.Stdout, "\nflags:")
+        config.Usage(os.Stdout)
+        return
+    }
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(2)
+    }
+
+    level, err := logging.ParseLevel(cfg.LogLevel)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(2)
+    }
+    slog.SetDefault(logging.New(os.Stdout, level))
+
+    if len(args) == 0 {
+        args = []string{"serve"}
+    }
+    switch args[0] {
+    case "serve":
+        serve(cfg)
+    case "migrate":
+        if err := runMigrate(cfg, args[1:]); err != nil {
+            fatal("migrate failed", err)
+        }
+    case "config":
+        if err := cfg.Print(os.Stdout); err != nil {
+            fatal("failed to print configuration", err)
+        }
+    default:
+        fmt.Fprintln(os.Stderr, usage)
+        os.Exit(2)
+    }
+}
+
+// loanStore is the persistence used by the services. It is
+// implemented by repository.LoanRepository and memory.Store.
+type loanStore interface {
+    service.LoanRepo
+    service.DocumentRepo
+    service.InvestorRepo
+    service.AutoInvestRepo
+    service.ProductRepo
+    service.LedgerRepo
+    metrics.LoanStateCounter
+}
+
+// openDB opens the GORM connection to the database selected by
+// STORAGE, postgres or sqlite, and the migration runner sharing its
+// connection pool.
+func openDB(cfg config.Config) (*gorm.DB, *migrate.Runner, error) {
+    var dialector gorm.Dialector
+    switch cfg.Storage {
+    case "postgres":
+        dialector = postgres.Open(cfg.DSN())
+    case "sqlite":
+        if err := os.MkdirAll(filepath.Dir(cfg.SQLitePath), 0o750); err != nil {
+            return nil, nil, fmt.Errorf("create database directory: %w", err)
+        }
+        dialector = sqlite.Open(cfg.SQLiteDSN())
+    default:
+        return nil, nil, fmt.Errorf("storage %q has no database", cfg.Storage)
+    }
+    db, err := gorm.Open(dialector, &gorm.Config{
+        Logger: logging.NewGormLogger(slog.Default()),
+        // Report constraint violations as repository.ErrDuplicate and
+        // repository.ErrForeignKey.
+        TranslateError: true,
+    })
+    if err != nil {
+        return nil, nil, fmt.Errorf("connect database: %w", err)
+    }
+    sqlDB, err := db.DB()
+    if err != nil {
+        return nil, nil, err
+    }
+    sqlDB.SetMaxOpenConns(cfg.DBMaxOpenConns)
+    sqlDB.SetMaxIdleConns(cfg.DBMaxIdleConns)
+    sqlDB.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+    sqlDB.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+    if replicas := cfg.ReplicaDSNs(); cfg.Storage == "postgres" && len(replicas) > 0 {
+        // Reads outside a transaction go to a random replica; writes,
+        // transactions and locking reads stay on the primary.
+        dialectors := make([]gorm.Dialector, len(replicas))
+        for i, dsn := range replicas {
+            dialectors[i] = postgres.Open(dsn)
+        }
+        resolver := dbresolver.Register(dbresolver.Config{
+            Replicas: dialectors,
+            Policy:   dbresolver.RandomPolicy{},
+        }).
+            SetMaxOpenConns(cfg.DBMaxOpenConns).
+            SetMaxIdleConns(cfg.DBMaxIdleConns).
+            SetConnMaxLifetime(cfg.DBConnMaxLifetime).
+            SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+        if err := db.Use(resolver); err != nil {
+            return nil, nil, fmt.Errorf("configure read replicas: %w", err)
+        }
+    }
+    files, err := migrations.ForDialect(cfg.Storage)
+    if err != nil {
+        return nil, nil, err
+    }
+    runner, err := migrate.New(sqlDB, migrate.Dialect(cfg.Storage), files)
+    if err != nil {
+        return nil, nil, fmt.Errorf("load migrations: %w", err)
+    }
+    return db, runner, nil
+}
+
+// serve starts the HTTP server and blocks until it has shut down. It
+// refuses to start when the database schema is behind the migrations
+// embedded in the binary, unless MIGRATE_ON_START is enabled, in which
+// case pending migrations are applied first. With in-memory storage no
+// database is used.
+func serve(cfg config.Config) {
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+    go func() {
+        // Restore the default behaviour once shutdown has begun so
+        // that a second signal terminates the process immediately.
+        <-ctx.Done()
+        stop()
+    }()
+
+    shutdownTracing, err := telemetry.Setup(ctx, telemetry.Config{
+        Exporter:    cfg.TraceExporter,
+        Endpoint:    cfg.TraceEndpoint,
+        Insecure:    cfg.TraceInsecure,
+        SampleRatio: cfg.TraceSampleRatio,
+    })
+    if err != nil {
+        fatal("failed to set up tracing", err)
+    }
+    defer func() {
+        flushCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+        defer cancel()
+        if err := shutdownTracing(flushCtx); err != nil {
+            slog.Error("failed to flush traces", "error", err)
+        }
+    }()
+
+    // Open the storage and initialize the event bus. With Postgres,
+    // events are persisted and announced with NOTIFY; the listener
+    // feeds them back to the local broker so that stream subscribers
+    // on every instance receive them. The in-memory store serves a
+    // single instance and delivers events to the broker directly.
+    workers := newWorkerGroup()
+    var (
+        repo     loanStore
+        sqlDB    *sql.DB
+        runner   *migrate.Runner
+        bus      *events.Bus
+        broker   *events.Broker
+        listener *events.Listener
+    )
+    if cfg.EventsEnabled {
+        broker = events.NewBroker()
+    }
+    switch cfg.Storage {
+    case "memory":
+        slog.Warn("using in-memory storage; all data is lost when the server stops")
+        store := memory.NewStore()
+        repo = store
+        if broker != nil {
+            bus = events.NewLocalBus(store, broker)
+        }
+    default:
+        var db *gorm.DB
+        db, runner, err = openDB(cfg)
+        if err != nil {
+            fatal("failed to open database", err)
+        }
+        sqlDB, err = db.DB()
+        if err != nil {
+            fatal("failed to open database", err)
+        }
+        defer sqlDB.Close()
+        // Query variables may contain investor names and emails, so
+        // only the statements are recorded on database spans.
+        if err := db.Use(tracing.NewPlugin(tracing.WithoutMetrics(), tracing.WithoutQueryVariables())); err != nil {
+            fatal("failed to instrument database", err)
+        }
+        if cfg.MigrateOnStart {
+            applied, err := runner.Up(context.Background())
+            if err != nil {
+                fatal("failed to migrate database", err)
+            }
+            for _, m := range applied {
+                slog.Info("applied migration", "version", m.Version, "name", m.Name)
+            }
+        }
+        if err := runner.Check(context.Background()); err != nil {
+            fatal("database schema is outdated; run `loan_service migrate up` first", err)
+        }
+        repo = repository.NewLoanRepository(db)
+        switch {
+        case broker == nil:
+        case cfg.Storage == "postgres":
+            bus = events.NewBus(repository.NewEventRepository(db), broker)
+            listener = events.NewListener(cfg.DSN(), repository.LoanEventsChannel, broker)
+            workers.Go(listener.Run)
+        default:
+            // SQLite serves a single instance and cannot notify.
+            bus = events.NewLocalBus(repository.NewEventRepository(db), broker)
+        }
+    }
+
+    blobs, err := newBlobStore(cfg)
+    if err != nil {
+        fatal("failed to initialise blob store", err)
+    }
+
+    generator, err := docgen.NewGenerator()
+    if err != nil {
+        fatal("failed to load agreement templates", err)
+    }
+
+    // Initialize services and handlers
+    docSvc := service.NewDocumentService(repo, blobs)
+    ledgerSvc := service.NewLedgerService(repo)
+    opts := []service.Option{
+        service.WithLimits(service.Limits{
+            MinInvestmentAmount:      cfg.MinInvestmentAmount,
+            MaxInvestmentAmount:      cfg.MaxInvestmentAmount,
+            MaxLoanPrincipal:         cfg.MaxLoanPrincipal,
+            MaxLoanShare:             cfg.MaxLoanShare,
+            MaxInvestorExposure:      cfg.MaxInvestorExposure,
+            KYCThreshold:             cfg.KYCThreshold,
+            RequireVerifiedInvestors: cfg.RequireVerifiedInvestors,
+            FundingPeriod:            cfg.LoanFundingPeriod,
+            CancellationWindow:       cfg.InvestmentCancellationWindow,
+            ReservationTTL:           cfg.ReservationTTL,
+        }),
+        service.WithLedger(ledgerSvc),
+    }
+    if cfg.EventsEnabled {
+        opts = append(opts, service.WithEventPublisher(bus))
+    }
+    if cfg.AgreementsEnabled {
+        if !generator.Has(domain.DocumentKindBorrowerAgreement, cfg.AgreementTemplateVersion) ||
+            !generator.Has(domain.DocumentKindInvestorAgreement, cfg.AgreementTemplateVersion) {
+            fatal("unknown agreement template version", fmt.Errorf("no %s templates", cfg.AgreementTemplateVersion))
+        }
+        agreements := service.NewAgreementService(repo, docSvc, generator, cfg.AgreementTemplateVersion)
+        opts = append(opts, service.WithAgreementGenerator(agreements))
+    }
+    if cfg.AutoInvestEnabled {
+        opts = append(opts, service.WithAutoInvest(repo))
+    }
+    var appMetrics *metrics.Metrics
+    if cfg.MetricsEnabled {
+        appMetrics = metrics.New()
+        if sqlDB != nil {
+            appMetrics.RegisterDBStats(sqlDB)
+        }
+        appMetrics.RegisterLoanStates(repo)
+        opts = append(opts, service.WithMetrics(appMetrics))
+    }
+    svc := service.NewLoanService(repo, opts...)
+    if cfg.LoanFundingPeriod > 0 {
+        workers.Go(func(ctx context.Context) {
+            service.RunPeriodically(ctx, "loan_expiry", cfg.SweepInterval, func(ctx context.Context) error {
+                _, err := svc.ExpireLoans(ctx)
+                return err
+            })
+        })
+    }
+    workers.Go(func(ctx context.Context) {
+        service.RunPeriodically(ctx, "reservation_expiry", cfg.SweepInterval, func(ctx context.Context) error {
+            _, err := svc.ExpireReservations(ctx)
+            return err
+        })
+    })
+    investorSvc := service.NewInvestorService(repo, ledgerSvc)
     loanHandler := handler.NewLoanHandler(svc)
+    marketHandler := handler.NewMarketHandler(svc)
+    documentHandler := handler.NewDocumentHandler(docSvc, cfg.MaxUploadBytes)
+    healthHandler := handler.NewHealthHandler(cfg.HealthCheckTimeout)
+    registerHealthChecks(healthHandler, sqlDB, runner, listener)
 
-    // Configure Gin router
-    r := gin.Default()
+    // Configure Gin router. Request logging and panic recovery go
+    // through slog rather than Gin's text logger.
+    r := gin.New()
+    r.Use(logging.Middleware(slog.Default()))
+    r.Use(gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+        slog.ErrorContext(c.Request.Context(), "panic recovered", "panic", recovered, "stack", string(debug.Stack()))
+        c.AbortWithStatus(http.StatusInternalServerError)
+    }))
+    r.Use(otelgin.Middleware(telemetry.ServiceName))
+    if appMetrics != nil {
+        r.Use(appMetrics.Middleware())
+        r.GET("/metrics", gin.WrapH(appMetrics.Handler()))
+    }
     loanHandler.RegisterRoutes(r)
+    marketHandler.RegisterRoutes(r)
+    if bus != nil {
+        handler.NewEventHandler(bus).RegisterRoutes(r)
+    }
+    documentHandler.RegisterRoutes(r)
+    handler.NewInvestorHandler(investorSvc).RegisterRoutes(r)
+    handler.NewAutoInvestHandler(service.NewAutoInvestService(repo)).RegisterRoutes(r)
+    handler.NewProductHandler(service.NewProductService(repo, generator)).RegisterRoutes(r)
+    handler.NewLedgerHandler(ledgerSvc).RegisterRoutes(r)
+    healthHandler.RegisterRoutes(r)
+
+    // Start HTTP server. Open event streams are ended when shutdown
+    // begins, since the server only waits for them otherwise.
+    srv := newHTTPServer(cfg, r)
+    if broker != nil {
+        srv.RegisterOnShutdown(broker.Close)
+    }
+    if err := runServer(ctx, cfg, srv, workers, healthHandler.SetDraining); err != nil {
+        slog.Error("server error", "error", err)
+        if sqlDB != nil {
+            sqlDB.Close()
+        }
+        os.Exit(1)
+    }
+    slog.Info("server stopped")
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+    slog.Error(msg, "error", err)
+    os.Exit(1)
+}
 
-    // Start HTTP server
-    addr := ":" + cfg.ServerPort
-    log.Printf("starting server at %s", addr)
-    if err := r.Run(addr); err != nil {
-        log.Fatalf("server error: %v", err)
+// newBlobStore creates the blob store selected by the configuration.
+func newBlobStore(cfg config.Config) (storage.BlobStore, error) {
+    switch cfg.BlobStore {
+    case "fs":
+        return storage.NewFSStore(cfg.BlobDir)
+    case "s3":
+        return storage.NewS3Store(context.Background(), storage.S3Config{
+            Endpoint:  cfg.S3Endpoint,
+            Region:    cfg.S3Region,
+            Bucket:    cfg.S3Bucket,
+            AccessKey: cfg.S3AccessKey,
+            SecretKey: cfg.S3SecretKey,
+            UseSSL:    cfg.S3UseSSL,
+        })
+    default:
+        return nil, fmt.Errorf("unknown blob store %q", cfg.BlobStore)
     }
 }
\ No newline at end of file
@@ -0,0 +1,66 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "strconv"
+    "text/tabwriter"
+
+    "loan_service/internal/config"
+)
+
+// runMigrate implements the `migrate up|down|status` subcommands.
+func runMigrate(cfg config.Config, args []string) error {
+    if len(args) == 0 {
+        return fmt.Errorf("missing subcommand\n%s", usage)
+    }
+    if cfg.Storage == "memory" {
+        return fmt.Errorf("in-memory storage has no schema to migrate")
+    }
+    _, runner, err := openDB(cfg)
+    if err != nil {
+        return err
+    }
+    ctx := context.Background()
+    switch args[0] {
+    case "up":
+        applied, err := runner.Up(ctx)
+        for _, m := range applied {
+            fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+        }
+        if err == nil && len(applied) == 0 {
+            fmt.Println("no pending migrations")
+        }
+        return err
+    case "down":
+        steps := 1
+        if len(args) > 1 {
+            if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+                return fmt.Errorf("invalid number of steps %q", args[1])
+            }
+        }
+        reverted, err := runner.Down(ctx, steps)
+        for _, m := range reverted {
+            fmt.Printf("reverted %d_%s\n", m.Version, m.Name)
+        }
+        return err
+    case "status":
+        statuses, err := runner.Status(ctx)
+        if err != nil {
+            return err
+        }
+        w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+        fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+        for _, st := range statuses {
+            applied := "pending"
+            if st.AppliedAt != nil {
+                applied = st.AppliedAt.Format("2006-01-02 15:04:05")
+            }
+            fmt.Fprintf(w, "%d\t%s\t%s\n", st.Version, st.Name, applied)
+        }
+        return w.Flush()
+    default:
+        return fmt.Errorf("unknown subcommand %q\n%s", args[0], usage)
+    }
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "sync"
+    "time"
+
+    "loan_service/internal/config"
+    "loan_service/internal/events"
+    "loan_service/internal/handler"
+    "loan_service/internal/migrate"
+)
+
+// workerGroup runs background workers, such as the event listener,
+// under a shared context so that they can be stopped together during
+// shutdown.
+type workerGroup struct {
+    ctx    context.Context
+    cancel context.CancelFunc
+    wg     sync.WaitGroup
+}
+
+func newWorkerGroup() *workerGroup {
+    ctx, cancel := context.WithCancel(context.Background())
+    return &workerGroup{ctx: ctx, cancel: cancel}
+}
+
+// Go starts fn in a new goroutine. fn must return once its context is
+// cancelled.
+func (g *workerGroup) Go(fn func(ctx context.Context)) {
+    g.wg.Add(1)
+    go func() {
+        defer g.wg.Done()
+        fn(g.ctx)
+    }()
+}
+
+// Stop cancels the workers and waits for them to return or for ctx to
+// expire, whichever happens first.
+func (g *workerGroup) Stop(ctx context.Context) error {
+    g.cancel()
+    done := make(chan struct{})
+    go func() {
+        g.wg.Wait()
+        close(done)
+    }()
+    select {
+    case <-done:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// newHTTPServer returns a server for h using the timeouts from
+// the configuration.
+func newHTTPServer(cfg config.Config, h http.Handler) *http.Server {
+    return &http.Server{
+        Addr:              ":" + cfg.ServerPort,
+        Handler:           h,
+        ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+        ReadTimeout:       cfg.ReadTimeout,
+        WriteTimeout:      cfg.WriteTimeout,
+        IdleTimeout:       cfg.IdleTimeout,
+    }
+}
+
+// registerHealthChecks adds the readiness checks for the database
+// pool, the schema version and, when loan events are enabled, the
+// background event listener. db, runner and listener are nil with
+// in-memory storage, which has no dependencies to check.
+func registerHealthChecks(h *handler.HealthHandler, db *sql.DB, runner *migrate.Runner, listener *events.Listener) {
+    if db != nil {
+        h.AddCheck("database", db.PingContext)
+        h.AddCheck("migrations", func(ctx context.Context) error {
+            version, err := runner.Version(ctx)
+            if err != nil {
+                return err
+            }
+            if latest := runner.Latest(); version != latest {
+                return fmt.Errorf("schema version %d, expected %d", version, latest)
+            }
+            return nil
+        })
+    }
+    if listener == nil {
+        // Loan events are disabled.
+        return
+    }
+    h.AddCheck("event_listener", func(context.Context) error {
+        if !listener.Connected() {
+            return errors.New("not listening for loan events")
+        }
+        return nil
+    })
+}
+
+// runServer serves HTTP until ctx is cancelled, typically by SIGINT or
+// SIGTERM, and then shuts down gracefully. drain is called first so
+// that the readiness probe fails, and the server keeps serving for
+// cfg.ShutdownDrainDelay while load balancers notice. Then the
+// listener is closed, in-flight requests are drained and the
+// background workers are stopped, all within cfg.ShutdownTimeout. It
+// returns the error that stopped the server, if it was not a requested
+// shutdown.
+func runServer(ctx context.Context, cfg config.Config, srv *http.Server, workers *workerGroup, drain func()) error {
+    serveErr := make(chan error, 1)
+    go func() {
+        slog.Info("starting server", "addr", srv.Addr)
+        serveErr <- srv.ListenAndServe()
+    }()
+
+    var err error
+    select {
+    case err = <-serveErr:
+        // The server failed to start or stopped on its own.
+    case <-ctx.Done():
+        drain()
+        slog.Info("shutting down; serving until drain delay elapses", "drain_delay", cfg.ShutdownDrainDelay)
+        select {
+        case err = <-serveErr:
+        case <-time.After(cfg.ShutdownDrainDelay):
+        }
+    }
+
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+    defer cancel()
+    if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+        slog.Error("server shutdown", "error", shutdownErr)
+    }
+    if stopErr := workers.Stop(shutdownCtx); stopErr != nil {
+        slog.Error("background workers did not stop in time", "error", stopErr)
+    }
+    if errors.Is(err, http.ErrServerClosed) {
+        return nil
+    }
+    return err
+}
@@ -1,55 +1,506 @@
 package config
 
 import (
+    "errors"
+    "flag"
     "fmt"
+    "io"
+    "log/slog"
+    "net"
     "os"
+    "reflect"
+    "strings"
+    "time"
+
+    "gopkg.in/yaml.v3"
 )
 
 // Config holds configuration values for the application.
-// Each field can be configured using environment variables prefixed with
-// the field name (for example DB_HOST, DB_PORT, etc.).
+//
+// Values are layered: the defaults returned by Defaults are overridden
+// by a YAML file, then by environment variables and finally by command
+// line flags. Every field names its environment variable in the env
+// tag; the YAML key is the lower-case variable name (db_host) and the
+// flag is its kebab-case form (--db-host). Fields tagged secret are
+// masked when the configuration is printed and may also be read from
+// the file named by <VAR>_FILE (for example DB_PASSWORD_FILE), which
+// is how container orchestrators usually mount secrets.
 type Config struct {
-    DBHost     string
-    DBPort     string
-    DBUser     string
-    DBPassword string
-    DBName     string
-    DBSSLMode  string
-    ServerPort string
-}
-
-// Load reads configuration from environment variables and sets default
-// values when variables are not present. These defaults work well for
-// local development using docker-compose where the Postgres database
-// service is named `db` and exposes port 5432.
-func Load() Config {
-    cfg := Config{
-        DBHost:     getEnv("DB_HOST", "db"),
-        DBPort:     getEnv("DB_PORT", "5432"),
-        DBUser:     getEnv("DB_USER", "postgres"),
-        DBPassword: getEnv("DB_PASSWORD", "postgres"),
-        DBName:     getEnv("DB_NAME", "amartha"),
-        DBSSLMode:  getEnv("DB_SSLMODE", "disable"),
-        ServerPort: getEnv("SERVER_PORT", "8080"),
-    }
-    return cfg
+    // Storage selects where loans are kept: "postgres", "sqlite" or
+    // "memory". SQLite keeps everything in the single file SQLitePath,
+    // for deployments without a database server. The in-memory store
+    // needs no database and loses its data when the process exits; it
+    // is meant for demos and tests.
+    Storage    string `env:"STORAGE"`
+    SQLitePath string `env:"SQLITE_PATH"`
+
+    DBHost     string `env:"DB_HOST"`
+    DBPort     string `env:"DB_PORT"`
+    DBUser     string `env:"DB_USER"`
+    DBPassword string `env:"DB_PASSWORD" secret:"true"`
+    DBName     string `env:"DB_NAME"`
+    DBSSLMode  string `env:"DB_SSLMODE"`
+    // Connection pool of the primary database.
+    DBMaxOpenConns    int           `env:"DB_MAX_OPEN_CONNS"`
+    DBMaxIdleConns    int           `env:"DB_MAX_IDLE_CONNS"`
+    DBConnMaxLifetime time.Duration `env:"DB_CONN_MAX_LIFETIME"`
+    DBConnMaxIdleTime time.Duration `env:"DB_CONN_MAX_IDLE_TIME"`
+    // DBReplicas is a comma-separated list of read replicas as
+    // host[:port], sharing the credentials, database name and pool
+    // settings of the primary. Loan lookups and listings outside a
+    // transaction are spread across them; everything else uses the
+    // primary.
+    DBReplicas string `env:"DB_REPLICAS"`
+
+    ServerPort string `env:"SERVER_PORT"`
+    // LogLevel is the minimum level of log records written: "debug",
+    // "info", "warn" or "error".
+    LogLevel string `env:"LOG_LEVEL"`
+    // HTTP server timeouts. ReadTimeout and WriteTimeout bound a whole
+    // request and response; event streams clear their write deadline.
+    ReadHeaderTimeout time.Duration `env:"HTTP_READ_HEADER_TIMEOUT"`
+    ReadTimeout       time.Duration `env:"HTTP_READ_TIMEOUT"`
+    WriteTimeout      time.Duration `env:"HTTP_WRITE_TIMEOUT"`
+    IdleTimeout       time.Duration `env:"HTTP_IDLE_TIMEOUT"`
+    // ShutdownTimeout bounds how long in-flight requests and
+    // background workers are given to finish after SIGINT or SIGTERM.
+    ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT"`
+    // ShutdownDrainDelay is how long the server keeps serving, with
+    // the readiness probe failing, before it stops accepting
+    // connections, giving load balancers time to take the instance
+    // out of rotation.
+    ShutdownDrainDelay time.Duration `env:"SHUTDOWN_DRAIN_DELAY"`
+    // HealthCheckTimeout bounds the dependency checks of one readiness
+    // probe.
+    HealthCheckTimeout time.Duration `env:"HEALTH_CHECK_TIMEOUT"`
+    // MigrateOnStart applies pending schema migrations when the server
+    // starts. When disabled the server refuses to start until
+    // `loan_service migrate up` has been run.
+    MigrateOnStart bool `env:"MIGRATE_ON_START"`
+
+    // BlobStore selects where uploaded documents are stored: "fs"
+    // keeps them below BlobDir, "s3" uses an S3-compatible bucket.
+    BlobStore   string `env:"BLOB_STORE"`
+    BlobDir     string `env:"BLOB_DIR"`
+    S3Endpoint  string `env:"S3_ENDPOINT"`
+    S3Region    string `env:"S3_REGION"`
+    S3Bucket    string `env:"S3_BUCKET"`
+    S3AccessKey string `env:"S3_ACCESS_KEY" secret:"true"`
+    S3SecretKey string `env:"S3_SECRET_KEY" secret:"true"`
+    S3UseSSL    bool   `env:"S3_USE_SSL"`
+    // MaxUploadBytes caps the size of a single document upload.
+    MaxUploadBytes int64 `env:"MAX_UPLOAD_BYTES"`
+    // TraceExporter selects where spans are exported: "none", "stdout"
+    // or "otlp" (OTLP over HTTP to TraceEndpoint).
+    TraceExporter    string  `env:"TRACE_EXPORTER"`
+    TraceEndpoint    string  `env:"TRACE_ENDPOINT"`
+    TraceInsecure    bool    `env:"TRACE_INSECURE"`
+    TraceSampleRatio float64 `env:"TRACE_SAMPLE_RATIO"`
+    // AgreementTemplateVersion selects the template version used to
+    // render agreement letters for newly funded loans.
+    AgreementTemplateVersion string `env:"AGREEMENT_TEMPLATE_VERSION"`
+
+    // Business limits. Zero disables a limit.
+    MinInvestmentAmount float64 `env:"MIN_INVESTMENT_AMOUNT"`
+    MaxInvestmentAmount float64 `env:"MAX_INVESTMENT_AMOUNT"`
+    MaxLoanPrincipal    float64 `env:"MAX_LOAN_PRINCIPAL"`
+    // MaxLoanShare is the largest percentage of a loan's principal one
+    // investor may hold; MaxInvestorExposure the largest total one
+    // investor may have invested in loans not yet repaid.
+    MaxLoanShare        float64 `env:"MAX_LOAN_SHARE"`
+    MaxInvestorExposure float64 `env:"MAX_INVESTOR_EXPOSURE"`
+    // KYCThreshold is the most an investor whose identity has not been
+    // verified may have invested in loans not yet repaid. With
+    // RequireVerifiedInvestors only verified investors may invest and
+    // investors are no longer created from a name and email address
+    // when investing.
+    KYCThreshold             float64 `env:"KYC_THRESHOLD"`
+    RequireVerifiedInvestors bool    `env:"REQUIRE_VERIFIED_INVESTORS"`
+    // LoanFundingPeriod is how long an approved loan may take to be
+    // fully funded before it expires and its investments are refunded.
+    // SweepInterval is how often expired loans and reservations are
+    // looked for.
+    LoanFundingPeriod time.Duration `env:"LOAN_FUNDING_PERIOD"`
+    SweepInterval     time.Duration `env:"SWEEP_INTERVAL"`
+    // InvestmentCancellationWindow is the cooling-off period during
+    // which an investor may cancel an investment. Zero allows
+    // cancelling until the loan is fully funded.
+    InvestmentCancellationWindow time.Duration `env:"INVESTMENT_CANCELLATION_WINDOW"`
+    // ReservationTTL is how long a reservation holds its amount unless
+    // a shorter hold is requested, and the longest hold allowed.
+    ReservationTTL time.Duration `env:"RESERVATION_TTL"`
+
+    // Feature toggles. EventsEnabled controls the loan event stream,
+    // AgreementsEnabled the generation of agreement letters when a loan
+    // is funded, MetricsEnabled the /metrics endpoint and
+    // AutoInvestEnabled whether auto-invest rules invest in loans when
+    // they are approved.
+    EventsEnabled     bool `env:"FEATURE_EVENTS"`
+    AgreementsEnabled bool `env:"FEATURE_AGREEMENTS"`
+    MetricsEnabled    bool `env:"FEATURE_METRICS"`
+    AutoInvestEnabled bool `env:"FEATURE_AUTO_INVEST"`
+}
+
+// Defaults returns the built-in configuration. These defaults work
+// well for local development using docker-compose where the Postgres
+// database service is named `db` and exposes port 5432. There is no
+// default database password; supply DB_PASSWORD or DB_PASSWORD_FILE.
+func Defaults() Config {
+    return Config{
+        Storage:    "postgres",
+        SQLitePath: "data/loan_service.db",
+
+        DBHost:            "db",
+        DBPort:            "5432",
+        DBUser:            "postgres",
+        DBName:            "amartha",
+        DBSSLMode:         "disable",
+        DBMaxOpenConns:    25,
+        DBMaxIdleConns:    10,
+        DBConnMaxLifetime: 30 * time.Minute,
+        DBConnMaxIdleTime: 5 * time.Minute,
+
+        ServerPort: "8080",
+        LogLevel:   "info",
+
+        ReadHeaderTimeout:  5 * time.Second,
+        ReadTimeout:        30 * time.Second,
+        WriteTimeout:       30 * time.Second,
+        IdleTimeout:        120 * time.Second,
+        ShutdownTimeout:    20 * time.Second,
+        ShutdownDrainDelay: 5 * time.Second,
+        HealthCheckTimeout: 2 * time.Second,
+
+        BlobStore:      "fs",
+        BlobDir:        "data/blobs",
+        S3Endpoint:     "minio:9000",
+        S3Region:       "us-east-1",
+        S3Bucket:       "loan-documents",
+        MaxUploadBytes: 10 << 20,
+
+        TraceExporter:    "none",
+        TraceSampleRatio: 1,
+
+        AgreementTemplateVersion: "v1",
+
+        SweepInterval:  time.Minute,
+        ReservationTTL: 15 * time.Minute,
+
+        EventsEnabled:     true,
+        AgreementsEnabled: true,
+        MetricsEnabled:    true,
+        AutoInvestEnabled: true,
+    }
+}
+
+// Load builds the configuration from the defaults, the YAML file named
+// by the --config flag or the CONFIG_FILE variable, the environment
+// and the flags in args, in that order of precedence, and validates
+// the result. It returns the arguments remaining after the flags,
+// which name the subcommand to run. flag.ErrHelp is returned when
+// args ask for help.
+func Load(args []string) (Config, []string, error) {
+    cfg := Defaults()
+    fields := cfg.fields()
+
+    fs := flag.NewFlagSet("loan_service", flag.ContinueOnError)
+    fs.SetOutput(io.Discard)
+    configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path of a YAML configuration file")
+    flagValues := make(map[*field]string)
+    for _, f := range fields {
+        f := f
+        fs.Var(&flagValue{field: f, values: flagValues}, f.flag, "overrides "+f.env)
+    }
+    if err := fs.Parse(args); err != nil {
+        if errors.Is(err, flag.ErrHelp) {
+            return cfg, nil, err
+        }
+        return cfg, nil, fmt.Errorf("config: %w", err)
+    }
+
+    if *configFile != "" {
+        if err := applyFile(fields, *configFile); err != nil {
+            return cfg, nil, err
+        }
+    }
+    if err := applyEnv(fields); err != nil {
+        return cfg, nil, err
+    }
+    for _, f := range fields {
+        if v, ok := flagValues[f]; ok {
+            if err := f.set(v); err != nil {
+                return cfg, nil, fmt.Errorf("config: flag --%s: %w", f.flag, err)
+            }
+        }
+    }
+    if err := cfg.Validate(); err != nil {
+        return cfg, nil, err
+    }
+    return cfg, fs.Args(), nil
+}
+
+// Usage writes the flags understood by Load to w.
+func Usage(w io.Writer) {
+    cfg := Defaults()
+    fmt.Fprintln(w, "  --config path  YAML configuration file (or CONFIG_FILE)")
+    for _, f := range cfg.fields() {
+        fmt.Fprintf(w, "  --%s  (%s)\n", f.flag, f.env)
+    }
+}
+
+// applyFile reads a YAML mapping of keys to values. Unknown keys are
+// rejected so that typos do not go unnoticed.
+func applyFile(fields []*field, path string) error {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return fmt.Errorf("config: %w", err)
+    }
+    var raw map[string]interface{}
+    if err := yaml.Unmarshal(data, &raw); err != nil {
+        return fmt.Errorf("config: %s: %w", path, err)
+    }
+    byKey := make(map[string]*field, len(fields))
+    for _, f := range fields {
+        byKey[f.key] = f
+        if f.secret {
+            byKey[f.key+"_file"] = f
+        }
+    }
+    for key, value := range raw {
+        f, ok := byKey[key]
+        if !ok {
+            return fmt.Errorf("config: %s: unknown key %q", path, key)
+        }
+        s := ""
+        if value != nil {
+            s = fmt.Sprint(value)
+        }
+        if key != f.key {
+            if s, err = readSecret(s); err != nil {
+                return fmt.Errorf("config: %s: %s: %w", path, key, err)
+            }
+        }
+        if err := f.set(s); err != nil {
+            return fmt.Errorf("config: %s: %s: %w", path, key, err)
+        }
+    }
+    return nil
+}
+
+// applyEnv applies non-empty environment variables and, for secrets,
+// the content of the files named by <VAR>_FILE.
+func applyEnv(fields []*field) error {
+    for _, f := range fields {
+        value := os.Getenv(f.env)
+        if f.secret {
+            if path := os.Getenv(f.env + "_FILE"); path != "" {
+                if value != "" {
+                    return fmt.Errorf("config: set either %s or %s_FILE, not both", f.env, f.env)
+                }
+                secret, err := readSecret(path)
+                if err != nil {
+                    return fmt.Errorf("config: %s_FILE: %w", f.env, err)
+                }
+                if err := f.set(secret); err != nil {
+                    return fmt.Errorf("config: %s_FILE: %w", f.env, err)
+                }
+                continue
+            }
+        }
+        if value == "" {
+            continue
+        }
+        if err := f.set(value); err != nil {
+            return fmt.Errorf("config: %s: %w", f.env, err)
+        }
+    }
+    return nil
+}
+
+// readSecret returns the content of a secret file without the
+// trailing newline most editors and tools add.
+func readSecret(path string) (string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return "", err
+    }
+    return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+    var errs []error
+    check := func(ok bool, format string, args ...interface{}) {
+        if !ok {
+            errs = append(errs, fmt.Errorf(format, args...))
+        }
+    }
+    check(oneOf(c.Storage, "postgres", "sqlite", "memory"), "STORAGE must be postgres, sqlite or memory, got %q", c.Storage)
+    check(c.Storage != "sqlite" || c.SQLitePath != "", "SQLITE_PATH must not be empty when STORAGE is sqlite")
+    check(c.DBHost != "", "DB_HOST must not be empty")
+    check(validPort(c.DBPort), "DB_PORT must be a port number, got %q", c.DBPort)
+    check(c.DBUser != "", "DB_USER must not be empty")
+    check(c.DBName != "", "DB_NAME must not be empty")
+    check(oneOf(c.DBSSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full"),
+        "DB_SSLMODE must be one of disable, allow, prefer, require, verify-ca or verify-full, got %q", c.DBSSLMode)
+    check(c.DBMaxOpenConns >= 0, "DB_MAX_OPEN_CONNS must not be negative")
+    check(c.DBMaxIdleConns >= 0, "DB_MAX_IDLE_CONNS must not be negative")
+    check(c.DBMaxOpenConns == 0 || c.DBMaxIdleConns <= c.DBMaxOpenConns,
+        "DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", c.DBMaxIdleConns, c.DBMaxOpenConns)
+    check(c.DBConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME must not be negative")
+    check(c.DBConnMaxIdleTime >= 0, "DB_CONN_MAX_IDLE_TIME must not be negative")
+    for _, r := range c.replicas() {
+        host, port := splitHostPort(r, c.DBPort)
+        check(host != "" && validPort(port), "DB_REPLICAS must list host[:port] entries, got %q", r)
+    }
+
+    check(validPort(c.ServerPort), "SERVER_PORT must be a port number, got %q", c.ServerPort)
+    var level slog.Level
+    check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "LOG_LEVEL must be debug, info, warn or error, got %q", c.LogLevel)
+    check(c.ReadHeaderTimeout > 0, "HTTP_READ_HEADER_TIMEOUT must be positive")
+    check(c.ReadTimeout > 0, "HTTP_READ_TIMEOUT must be positive")
+    check(c.WriteTimeout > 0, "HTTP_WRITE_TIMEOUT must be positive")
+    check(c.IdleTimeout > 0, "HTTP_IDLE_TIMEOUT must be positive")
+    check(c.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+    check(c.HealthCheckTimeout > 0, "HEALTH_CHECK_TIMEOUT must be positive")
+    check(c.ShutdownDrainDelay >= 0, "SHUTDOWN_DRAIN_DELAY must not be negative")
+
+    switch c.BlobStore {
+    case "fs":
+        check(c.BlobDir != "", "BLOB_DIR must not be empty when BLOB_STORE is fs")
+    case "s3":
+        check(c.S3Endpoint != "", "S3_ENDPOINT must not be empty when BLOB_STORE is s3")
+        check(c.S3Bucket != "", "S3_BUCKET must not be empty when BLOB_STORE is s3")
+    default:
+        errs = append(errs, fmt.Errorf("BLOB_STORE must be fs or s3, got %q", c.BlobStore))
+    }
+    check(c.MaxUploadBytes > 0, "MAX_UPLOAD_BYTES must be positive")
+    check(oneOf(c.TraceExporter, "none", "stdout", "otlp"), "TRACE_EXPORTER must be none, stdout or otlp, got %q", c.TraceExporter)
+    check(c.TraceSampleRatio >= 0 && c.TraceSampleRatio <= 1, "TRACE_SAMPLE_RATIO must be between 0 and 1")
+    check(c.AgreementTemplateVersion != "", "AGREEMENT_TEMPLATE_VERSION must not be empty")
+
+    check(c.MinInvestmentAmount >= 0, "MIN_INVESTMENT_AMOUNT must not be negative")
+    check(c.MaxInvestmentAmount >= 0, "MAX_INVESTMENT_AMOUNT must not be negative")
+    check(c.MaxInvestmentAmount == 0 || c.MaxInvestmentAmount >= c.MinInvestmentAmount,
+        "MAX_INVESTMENT_AMOUNT must not be below MIN_INVESTMENT_AMOUNT")
+    check(c.MaxLoanPrincipal >= 0, "MAX_LOAN_PRINCIPAL must not be negative")
+    check(c.MaxLoanShare >= 0 && c.MaxLoanShare <= 100, "MAX_LOAN_SHARE must be between 0 and 100")
+    check(c.MaxInvestorExposure >= 0, "MAX_INVESTOR_EXPOSURE must not be negative")
+    check(c.KYCThreshold >= 0, "KYC_THRESHOLD must not be negative")
+    check(c.LoanFundingPeriod >= 0, "LOAN_FUNDING_PERIOD must not be negative")
+    check(c.SweepInterval > 0, "SWEEP_INTERVAL must be positive")
+    check(c.InvestmentCancellationWindow >= 0, "INVESTMENT_CANCELLATION_WINDOW must not be negative")
+    check(c.ReservationTTL > 0, "RESERVATION_TTL must be positive")
+
+    if len(errs) > 0 {
+        return fmt.Errorf("invalid configuration:\n  %w", joinLines(errs))
+    }
+    return nil
+}
+
+// Print writes the effective configuration to w as YAML, in the format
+// accepted by Load. Secrets are masked.
+func (c Config) Print(w io.Writer) error {
+    doc := &yaml.Node{Kind: yaml.MappingNode}
+    for _, f := range c.fields() {
+        value := f.String()
+        if f.secret && value != "" {
+            value = "********"
+        }
+        node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+        if f.value.Kind() == reflect.String {
+            node.Tag = "!!str"
+        }
+        doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.key}, node)
+    }
+    enc := yaml.NewEncoder(w)
+    defer enc.Close()
+    return enc.Encode(doc)
 }
 
 // DSN returns the Postgres Data Source Name constructed from the
 // configuration. This DSN is used by GORM to open a database
-// connection.
+// connection. The password is omitted when empty so that other
+// authentication methods, such as a .pgpass file, apply.
 func (c Config) DSN() string {
-    return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-        c.DBHost, c.DBPort, c.DBUser, c.DBPassword, c.DBName, c.DBSSLMode)
+    dsn := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=%s",
+        c.DBHost, c.DBPort, c.DBUser, c.DBName, c.DBSSLMode)
+    if c.DBPassword != "" {
+        dsn += " password=" + quoteDSN(c.DBPassword)
+    }
+    return dsn
+}
+
+// SQLiteDSN returns the DSN of the SQLite database at SQLitePath.
+// Foreign keys are enforced, a busy database is waited for rather than
+// failing at once, and transactions take the write lock when they
+// begin, so that concurrent read-then-write transactions such as
+// investments are serialised instead of failing on commit.
+func (c Config) SQLiteDSN() string {
+    return "file:" + c.SQLitePath +
+        "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+}
+
+// ReplicaDSNs returns the DSN of every replica in DBReplicas. A
+// replica without a port uses DBPort.
+func (c Config) ReplicaDSNs() []string {
+    var dsns []string
+    for _, r := range c.replicas() {
+        replica := c
+        replica.DBHost, replica.DBPort = splitHostPort(r, c.DBPort)
+        dsns = append(dsns, replica.DSN())
+    }
+    return dsns
+}
+
+func (c Config) replicas() []string {
+    var replicas []string
+    for _, r := range strings.Split(c.DBReplicas, ",") {
+        if r = strings.TrimSpace(r); r != "" {
+            replicas = append(replicas, r)
+        }
+    }
+    return replicas
+}
+
+// splitHostPort splits host[:port], using defaultPort when the port
+// is missing.
+func splitHostPort(hostport, defaultPort string) (string, string) {
+    host, port, err := net.SplitHostPort(hostport)
+    if err != nil {
+        return hostport, defaultPort
+    }
+    return host, port
 }
 
-// getEnv returns the value of the given environment variable if it
-// exists, otherwise it returns the provided default value. This helper
-// function centralizes environment variable lookups and avoids
-// repetitive code throughout the application.
-func getEnv(key, defaultVal string) string {
-    if value := os.Getenv(key); value != "" {
-        return value
+// quoteDSN quotes a keyword/value DSN value when it contains spaces,
+// quotes or backslashes.
+func quoteDSN(v string) string {
+    if v != "" && !strings.ContainsAny(v, ` '\`) {
+        return v
     }
-    return defaultVal
-}
\ No newline at end of file
+    return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+func validPort(p string) bool {
+    port, err := net.LookupPort("tcp", p)
+    return err == nil && port > 0
+}
+
+func oneOf(v string, allowed ...string) bool {
+    for _, a := range allowed {
+        if v == a {
+            return true
+        }
+    }
+    return false
+}
+
+// joinLines joins errors one per line, indented under the summary.
+func joinLines(errs []error) error {
+    msgs := make([]string, len(errs))
+    for i, err := range errs {
+        msgs[i] = err.Error()
+    }
+    return errors.New(strings.Join(msgs, "\n  "))
+}
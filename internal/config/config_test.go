@@ -0,0 +1,160 @@
+package config
+
+import (
+    "bytes"
+    "errors"
+    "flag"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), name)
+    require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+    return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+    cfg, args, err := Load([]string{"migrate", "up"})
+    require.NoError(t, err)
+    assert.Equal(t, Defaults(), cfg)
+    assert.Equal(t, []string{"migrate", "up"}, args)
+    assert.Empty(t, cfg.DBPassword)
+}
+
+func TestLoad_Layering(t *testing.T) {
+    path := writeFile(t, "config.yaml", `
+db_host: file-host
+db_port: 6543
+server_port: "9000"
+http_read_timeout: 10s
+trace_sample_ratio: 0.5
+feature_metrics: false
+`)
+    t.Setenv("CONFIG_FILE", path)
+    t.Setenv("DB_PORT", "7654")
+    t.Setenv("SERVER_PORT", "9100")
+
+    cfg, args, err := Load([]string{"--server-port", "9200", "--migrate-on-start", "serve"})
+    require.NoError(t, err)
+    assert.Equal(t, []string{"serve"}, args)
+    // The file overrides the defaults, the environment overrides the
+    // file and flags override the environment.
+    assert.Equal(t, "file-host", cfg.DBHost)
+    assert.Equal(t, "7654", cfg.DBPort)
+    assert.Equal(t, "9200", cfg.ServerPort)
+    assert.Equal(t, 10*time.Second, cfg.ReadTimeout)
+    assert.Equal(t, 0.5, cfg.TraceSampleRatio)
+    assert.False(t, cfg.MetricsEnabled)
+    assert.True(t, cfg.MigrateOnStart)
+}
+
+func TestLoad_SecretsFromFiles(t *testing.T) {
+    t.Setenv("DB_PASSWORD_FILE", writeFile(t, "db-password", "s3cret\n"))
+    file := writeFile(t, "config.yaml", "s3_secret_key_file: "+writeFile(t, "s3-key", "key\n")+"\n")
+
+    cfg, _, err := Load([]string{"--config", file})
+    require.NoError(t, err)
+    assert.Equal(t, "s3cret", cfg.DBPassword)
+    assert.Equal(t, "key", cfg.S3SecretKey)
+    assert.Contains(t, cfg.DSN(), "password=s3cret")
+}
+
+func TestLoad_SecretSetTwice(t *testing.T) {
+    t.Setenv("DB_PASSWORD", "a")
+    t.Setenv("DB_PASSWORD_FILE", writeFile(t, "db-password", "b"))
+
+    _, _, err := Load(nil)
+    assert.ErrorContains(t, err, "set either DB_PASSWORD or DB_PASSWORD_FILE")
+}
+
+func TestLoad_Errors(t *testing.T) {
+    t.Run("unknown file key", func(t *testing.T) {
+        _, _, err := Load([]string{"--config", writeFile(t, "c.yaml", "db_hots: x\n")})
+        assert.ErrorContains(t, err, `unknown key "db_hots"`)
+    })
+    t.Run("malformed env value", func(t *testing.T) {
+        t.Setenv("HTTP_READ_TIMEOUT", "soon")
+        _, _, err := Load(nil)
+        assert.ErrorContains(t, err, `HTTP_READ_TIMEOUT: invalid duration "soon"`)
+    })
+    t.Run("unknown flag", func(t *testing.T) {
+        _, _, err := Load([]string{"--nope"})
+        assert.Error(t, err)
+    })
+    t.Run("help", func(t *testing.T) {
+        _, _, err := Load([]string{"-h"})
+        assert.True(t, errors.Is(err, flag.ErrHelp))
+    })
+}
+
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+    cfg := Defaults()
+    cfg.ServerPort = "http-ish"
+    cfg.BlobStore = "ftp"
+    cfg.TraceSampleRatio = 2
+    cfg.DBMaxIdleConns = 50
+    cfg.Storage = "sqlite"
+    cfg.SQLitePath = ""
+    cfg.MinInvestmentAmount = 500
+    cfg.MaxInvestmentAmount = 100
+    cfg.MaxLoanShare = 150
+    cfg.KYCThreshold = -1
+
+    err := cfg.Validate()
+    require.Error(t, err)
+    assert.Contains(t, err.Error(), "SERVER_PORT must be a port number")
+    assert.Contains(t, err.Error(), "BLOB_STORE must be fs or s3")
+    assert.Contains(t, err.Error(), "TRACE_SAMPLE_RATIO must be between 0 and 1")
+    assert.Contains(t, err.Error(), "DB_MAX_IDLE_CONNS (50) must not exceed DB_MAX_OPEN_CONNS (25)")
+    assert.Contains(t, err.Error(), "SQLITE_PATH must not be empty when STORAGE is sqlite")
+    assert.Contains(t, err.Error(), "MAX_INVESTMENT_AMOUNT must not be below MIN_INVESTMENT_AMOUNT")
+    assert.Contains(t, err.Error(), "MAX_LOAN_SHARE must be between 0 and 100")
+    assert.Contains(t, err.Error(), "KYC_THRESHOLD must not be negative")
+}
+
+func TestPrint_MasksSecrets(t *testing.T) {
+    cfg := Defaults()
+    cfg.DBPassword = "hunter2"
+
+    var buf bytes.Buffer
+    require.NoError(t, cfg.Print(&buf))
+    out := buf.String()
+    assert.NotContains(t, out, "hunter2")
+    assert.Contains(t, out, "db_password: '********'")
+    assert.Contains(t, out, "s3_secret_key: \"\"")
+    assert.Contains(t, out, "http_read_timeout: 30s")
+
+    // The printed configuration can be loaded again.
+    cfg.DBPassword = ""
+    buf.Reset()
+    require.NoError(t, cfg.Print(&buf))
+    loaded, _, err := Load([]string{"--config", writeFile(t, "printed.yaml", buf.String())})
+    require.NoError(t, err)
+    assert.Equal(t, cfg, loaded)
+}
+
+func TestDSN_QuotesPassword(t *testing.T) {
+    cfg := Defaults()
+    cfg.DBPassword = `it's secret`
+    assert.Contains(t, cfg.DSN(), `password='it\'s secret'`)
+}
+
+func TestReplicaDSNs(t *testing.T) {
+    cfg := Defaults()
+    cfg.DBReplicas = "replica-1, replica-2:6432,"
+    require.NoError(t, cfg.Validate())
+    dsns := cfg.ReplicaDSNs()
+    require.Len(t, dsns, 2)
+    assert.Contains(t, dsns[0], "host=replica-1 port=5432")
+    assert.Contains(t, dsns[1], "host=replica-2 port=6432")
+
+    cfg.DBReplicas = "replica-1:http-ish"
+    assert.ErrorContains(t, cfg.Validate(), `DB_REPLICAS must list host[:port] entries, got "replica-1:http-ish"`)
+}
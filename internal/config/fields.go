@@ -0,0 +1,109 @@
+package config
+
+import (
+    "fmt"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field binds one Config field to its YAML key, environment variable
+// and flag.
+type field struct {
+    value  reflect.Value
+    env    string
+    key    string
+    flag   string
+    secret bool
+}
+
+// fields returns the settable fields of c, in declaration order.
+func (c *Config) fields() []*field {
+    v := reflect.ValueOf(c).Elem()
+    t := v.Type()
+    fields := make([]*field, 0, t.NumField())
+    for i := 0; i < t.NumField(); i++ {
+        env := t.Field(i).Tag.Get("env")
+        if env == "" {
+            continue
+        }
+        fields = append(fields, &field{
+            value:  v.Field(i),
+            env:    env,
+            key:    strings.ToLower(env),
+            flag:   strings.ReplaceAll(strings.ToLower(env), "_", "-"),
+            secret: t.Field(i).Tag.Get("secret") == "true",
+        })
+    }
+    return fields
+}
+
+// set parses s according to the field type and assigns it.
+func (f *field) set(s string) error {
+    switch {
+    case f.value.Type() == durationType:
+        d, err := time.ParseDuration(s)
+        if err != nil {
+            return fmt.Errorf("invalid duration %q", s)
+        }
+        f.value.SetInt(int64(d))
+    case f.value.Kind() == reflect.String:
+        f.value.SetString(s)
+    case f.value.Kind() == reflect.Bool:
+        b, err := strconv.ParseBool(s)
+        if err != nil {
+            return fmt.Errorf("invalid boolean %q", s)
+        }
+        f.value.SetBool(b)
+    case f.value.Kind() == reflect.Int || f.value.Kind() == reflect.Int64:
+        n, err := strconv.ParseInt(s, 10, 64)
+        if err != nil {
+            return fmt.Errorf("invalid integer %q", s)
+        }
+        f.value.SetInt(n)
+    case f.value.Kind() == reflect.Float64:
+        n, err := strconv.ParseFloat(s, 64)
+        if err != nil {
+            return fmt.Errorf("invalid number %q", s)
+        }
+        f.value.SetFloat(n)
+    default:
+        return fmt.Errorf("unsupported type %s", f.value.Type())
+    }
+    return nil
+}
+
+// String formats the current value in the syntax accepted by set.
+func (f *field) String() string {
+    if f.value.Type() == durationType {
+        return time.Duration(f.value.Int()).String()
+    }
+    return fmt.Sprint(f.value.Interface())
+}
+
+// flagValue records flag values so that they can be applied after the
+// configuration file and the environment.
+type flagValue struct {
+    field  *field
+    values map[*field]string
+}
+
+func (v *flagValue) String() string {
+    if v == nil || v.field == nil {
+        return ""
+    }
+    return v.values[v.field]
+}
+
+func (v *flagValue) Set(s string) error {
+    v.values[v.field] = s
+    return nil
+}
+
+// IsBoolFlag lets boolean fields be set with a bare --flag.
+func (v *flagValue) IsBoolFlag() bool {
+    return v != nil && v.field != nil && v.field.value.Kind() == reflect.Bool
+}
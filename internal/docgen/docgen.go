@@ -0,0 +1,158 @@
+// Package docgen renders agreement letters to PDF. Agreement texts are
+// kept as versioned text templates embedded in the binary, so that a
+// generated document can always be traced back to the exact wording
+// it was produced from. Changing the wording means adding a new
+// template version rather than editing an existing one.
+package docgen
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"loan_service/internal/domain"
+
+	"github.com/go-pdf/fpdf"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// AgreementData is the data available to agreement templates. Investor
+// and Investment are only set for investor agreements.
+type AgreementData struct {
+	Loan           domain.Loan
+	Investor       *domain.Investor
+	Investment     *domain.Investment
+	InvestorCount  int
+	TotalRepayable float64
+	Share          float64
+	ExpectedReturn float64
+	GeneratedAt    time.Time
+	// Template is filled in by the generator with the template name
+	// and version, for example "investor_agreement/v1".
+	Template string
+}
+
+// Generator renders agreement templates to PDF documents. It is safe
+// for concurrent use.
+type Generator struct {
+	templates map[string]*template.Template
+}
+
+var funcs = template.FuncMap{
+	"money": func(v float64) string { return formatMoney(v) },
+	"pct":   func(v float64) string { return fmt.Sprintf("%.2f%%", v) },
+	"date":  func(t time.Time) string { return t.Format("2 January 2006") },
+}
+
+// NewGenerator parses all embedded templates. Templates live at
+// templates/<kind>/<version>.tmpl.
+func NewGenerator() (*Generator, error) {
+	g := &Generator{templates: make(map[string]*template.Template)}
+	err := fs.WalkDir(templateFS, "templates", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".tmpl" {
+			return err
+		}
+		src, err := templateFS.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(p, "templates/"), ".tmpl")
+		t, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(string(src))
+		if err != nil {
+			return fmt.Errorf("parse template %s: %w", name, err)
+		}
+		g.templates[name] = t
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// TemplateName returns the name under which the template for kind and
+// version is registered.
+func TemplateName(kind domain.DocumentKind, version string) string {
+	return string(kind) + "/" + version
+}
+
+// Has reports whether a template exists for kind and version.
+func (g *Generator) Has(kind domain.DocumentKind, version string) bool {
+	_, ok := g.templates[TemplateName(kind, version)]
+	return ok
+}
+
+// Render executes the template for kind and version and lays the
+// result out as a PDF. Template output is interpreted line by line:
+// lines starting with "# " become the title, "## " section headings
+// and blank lines paragraph breaks.
+func (g *Generator) Render(kind domain.DocumentKind, version string, data AgreementData) ([]byte, error) {
+	name := TemplateName(kind, version)
+	t, ok := g.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("no agreement template %s", name)
+	}
+	data.Template = name
+	var text bytes.Buffer
+	if err := t.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("execute template %s: %w", name, err)
+	}
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(name, true)
+	pdf.SetCreator("Amartha loan service", true)
+	pdf.SetCreationDate(data.GeneratedAt)
+	pdf.SetModificationDate(data.GeneratedAt)
+	pdf.SetMargins(20, 20, 20)
+	pdf.AddPage()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	for _, line := range strings.Split(text.String(), "\n") {
+		switch {
+		case strings.HasPrefix(line, "# "):
+			pdf.SetFont("Helvetica", "B", 18)
+			pdf.MultiCell(0, 10, tr(strings.TrimPrefix(line, "# ")), "", "C", false)
+			pdf.Ln(4)
+		case strings.HasPrefix(line, "## "):
+			pdf.Ln(3)
+			pdf.SetFont("Helvetica", "B", 13)
+			pdf.MultiCell(0, 7, tr(strings.TrimPrefix(line, "## ")), "", "L", false)
+		case strings.TrimSpace(line) == "":
+			pdf.Ln(3)
+		default:
+			pdf.SetFont("Helvetica", "", 11)
+			pdf.MultiCell(0, 6, tr(line), "", "L", false)
+		}
+	}
+	var out bytes.Buffer
+	if err := pdf.Output(&out); err != nil {
+		return nil, fmt.Errorf("render pdf %s: %w", name, err)
+	}
+	return out.Bytes(), nil
+}
+
+// formatMoney formats v with two decimals and thousands separators.
+func formatMoney(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	intPart, frac := s[:len(s)-3], s[len(s)-3:]
+	var b strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	out := b.String() + frac
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
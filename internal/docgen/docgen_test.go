@@ -0,0 +1,48 @@
+package docgen
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"loan_service/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender_AllTemplatesProducePDF(t *testing.T) {
+	g, err := NewGenerator()
+	require.NoError(t, err)
+	data := AgreementData{
+		Loan:           domain.Loan{ID: "L1", BorrowerID: "B1", Principal: 5000000, Rate: 10, ROI: 8},
+		Investor:       &domain.Investor{ID: "I1", Name: "Alice"},
+		Investment:     &domain.Investment{ID: "INV1", Amount: 2500000},
+		InvestorCount:  2,
+		TotalRepayable: 5500000,
+		Share:          50,
+		ExpectedReturn: 200000,
+		GeneratedAt:    time.Date(2025, 8, 15, 0, 0, 0, 0, time.UTC),
+	}
+	for _, kind := range []domain.DocumentKind{domain.DocumentKindBorrowerAgreement, domain.DocumentKindInvestorAgreement} {
+		require.True(t, g.Has(kind, "v1"), kind)
+		out, err := g.Render(kind, "v1", data)
+		require.NoError(t, err, kind)
+		assert.True(t, bytes.HasPrefix(out, []byte("%PDF-")), kind)
+	}
+}
+
+func TestRender_UnknownVersion(t *testing.T) {
+	g, err := NewGenerator()
+	require.NoError(t, err)
+
+	_, err = g.Render(domain.DocumentKindBorrowerAgreement, "v999", AgreementData{})
+	assert.Error(t, err)
+}
+
+func TestFormatMoney(t *testing.T) {
+	assert.Equal(t, "0.00", formatMoney(0))
+	assert.Equal(t, "999.50", formatMoney(999.5))
+	assert.Equal(t, "5,000,000.00", formatMoney(5000000))
+	assert.Equal(t, "-1,234.56", formatMoney(-1234.56))
+}
@@ -0,0 +1,53 @@
+package domain
+
+import "time"
+
+// RiskGrade is the risk grade assessed for a borrower, from A, the
+// lowest risk, to E, the highest. Grades compare in order of risk.
+type RiskGrade string
+
+// Valid reports whether g is one of the grades A to E.
+func (g RiskGrade) Valid() bool {
+	return len(g) == 1 && g[0] >= 'A' && g[0] <= 'E'
+}
+
+// AutoInvestRule describes the loans an investor wants to invest in
+// automatically when they are approved, and how much. Each investor
+// has at most one rule.
+//
+// A loan matches when its ROI is at least MinROI, its principal at
+// most MaxPrincipal and its risk grade no worse than MaxRiskGrade;
+// loans without a risk grade do not match a rule that sets one. A
+// matching loan receives up to MaxPerLoan, as long as the investments
+// the rule placed during the current UTC day stay within DailyBudget.
+// Zero MaxPrincipal and DailyBudget are unlimited. LastPlacedAt is when
+// the rule last placed an investment; rules that have waited longest
+// are served first.
+type AutoInvestRule struct {
+	ID           string     `gorm:"type:uuid;primaryKey" json:"id"`
+	InvestorID   string     `gorm:"type:uuid;not null" json:"investor_id"`
+	MinROI       float64    `gorm:"column:min_roi;not null" json:"min_roi"`
+	MaxPrincipal float64    `gorm:"not null" json:"max_principal"`
+	MaxPerLoan   float64    `gorm:"not null" json:"max_per_loan"`
+	DailyBudget  float64    `gorm:"not null" json:"daily_budget"`
+	MaxRiskGrade RiskGrade  `gorm:"size:1" json:"max_risk_grade,omitempty"`
+	Active       bool       `gorm:"not null" json:"active"`
+	LastPlacedAt *time.Time `json:"last_placed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Matches reports whether the rule is active and the loan meets its
+// criteria.
+func (r AutoInvestRule) Matches(loan *Loan) bool {
+	if !r.Active || loan.ROI < r.MinROI {
+		return false
+	}
+	if r.MaxPrincipal > 0 && loan.Principal > r.MaxPrincipal {
+		return false
+	}
+	if r.MaxRiskGrade != "" && (loan.RiskGrade == "" || loan.RiskGrade > r.MaxRiskGrade) {
+		return false
+	}
+	return true
+}
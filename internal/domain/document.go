@@ -0,0 +1,62 @@
+package domain
+
+import "time"
+
+// DocumentKind classifies uploaded documents by the workflow step that
+// consumes them. Approvals and disbursements only accept documents of
+// the matching kind.
+type DocumentKind string
+
+const (
+	// DocumentKindApprovalProof is the picture taken by field staff as
+	// proof that the borrower has been visited.
+	DocumentKindApprovalProof DocumentKind = "approval_proof"
+	// DocumentKindSignedAgreement is the agreement letter signed by
+	// the borrower, required for disbursement.
+	DocumentKindSignedAgreement DocumentKind = "signed_agreement"
+	// DocumentKindBorrowerAgreement is the agreement letter generated
+	// for the borrower once a loan is fully funded.
+	DocumentKindBorrowerAgreement DocumentKind = "borrower_agreement"
+	// DocumentKindInvestorAgreement is the agreement letter generated
+	// for each investment once a loan is fully funded.
+	DocumentKindInvestorAgreement DocumentKind = "investor_agreement"
+	// DocumentKindIdentityDocument is the identity card or passport an
+	// investor submits for KYC verification.
+	DocumentKindIdentityDocument DocumentKind = "identity_document"
+)
+
+// Uploadable reports whether documents of kind k may be uploaded by
+// clients. Agreement letters are generated by the service and cannot
+// be uploaded.
+func (k DocumentKind) Uploadable() bool {
+	switch k {
+	case DocumentKindApprovalProof, DocumentKindSignedAgreement, DocumentKindIdentityDocument:
+		return true
+	}
+	return false
+}
+
+// Document describes a file stored in the blob store. The metadata
+// recorded at upload time (content type, size and SHA-256 checksum)
+// allows the file to be verified later independently of where the
+// bytes are kept. Template names the template and version a generated
+// document was rendered from and is empty for uploads. StorageKey is
+// the key under which the blob store holds the content and is not
+// exposed to clients.
+type Document struct {
+	ID          string       `gorm:"type:uuid;primaryKey" json:"id"`
+	Kind        DocumentKind `gorm:"size:30;not null" json:"kind"`
+	FileName    string       `gorm:"size:255" json:"file_name"`
+	ContentType string       `gorm:"size:100;not null" json:"content_type"`
+	Size        int64        `gorm:"not null" json:"size"`
+	SHA256      string       `gorm:"column:sha256;size:64;not null" json:"sha256"`
+	Template    string       `gorm:"size:100" json:"template,omitempty"`
+	StorageKey  string       `gorm:"not null" json:"-"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// ContentPath returns the API path from which the document content
+// can be downloaded.
+func (d Document) ContentPath() string {
+	return "/documents/" + d.ID + "/content"
+}
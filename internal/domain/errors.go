@@ -0,0 +1,50 @@
+package domain
+
+import "errors"
+
+// ErrLimitExceeded is wrapped by errors returned when a request falls
+// outside a configured business limit, such as the minimum investment
+// amount or the maximum loan principal. Such errors are *LimitError
+// values naming the rule that was broken.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// ErrInsufficientFunds is wrapped by errors returned when an
+// investment or withdrawal exceeds the balance of the investor's
+// wallet.
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// LimitRule identifies a business limit. Its value is the error code
+// reported to clients.
+type LimitRule string
+
+const (
+	// LimitMaxPrincipal caps the principal of a loan.
+	LimitMaxPrincipal LimitRule = "max_principal"
+	// LimitMinTicket is the smallest amount of a single investment.
+	LimitMinTicket LimitRule = "min_ticket"
+	// LimitMaxTicket is the largest amount of a single investment.
+	LimitMaxTicket LimitRule = "max_ticket"
+	// LimitMaxLoanShare caps the share of a loan's principal held by
+	// one investor.
+	LimitMaxLoanShare LimitRule = "max_loan_share"
+	// LimitMaxExposure caps the total outstanding amount one investor
+	// has invested across loans.
+	LimitMaxExposure LimitRule = "max_exposure"
+	// LimitKYCRequired restricts what investors whose identity has not
+	// been verified may invest.
+	LimitKYCRequired LimitRule = "kyc_required"
+	// LimitProductTerms requires the principal, rate, ROI and tenor of
+	// a loan to meet the terms of its product.
+	LimitProductTerms LimitRule = "product_terms"
+)
+
+// LimitError is returned when a request breaks the business limit
+// Rule. It matches ErrLimitExceeded with errors.Is.
+type LimitError struct {
+	Rule    LimitRule
+	Message string
+}
+
+func (e *LimitError) Error() string { return ErrLimitExceeded.Error() + ": " + e.Message }
+
+func (e *LimitError) Unwrap() error { return ErrLimitExceeded }
@@ -0,0 +1,44 @@
+package domain
+
+import "time"
+
+// LoanEventType identifies the kind of change recorded by a LoanEvent.
+// Event types are dotted strings so that clients can group them by
+// prefix when consuming the event stream.
+type LoanEventType string
+
+const (
+	// LoanEventStateChanged is emitted whenever a loan moves to a new
+	// state, including its creation in the `proposed` state.
+	LoanEventStateChanged LoanEventType = "loan.state_changed"
+	// LoanEventInvestmentAdded is emitted for every investment recorded
+	// against a loan and carries the updated funding totals.
+	LoanEventInvestmentAdded LoanEventType = "loan.investment_added"
+	// LoanEventInvestmentCancelled is emitted when an investor cancels
+	// an investment and carries the funding totals after the refund.
+	LoanEventInvestmentCancelled LoanEventType = "loan.investment_cancelled"
+	// LoanEventInvestmentTransferred is emitted when a position is sold
+	// on the secondary market. It names the buyer's new investment, the
+	// buyer and the principal transferred.
+	LoanEventInvestmentTransferred LoanEventType = "loan.investment_transferred"
+)
+
+// LoanEvent is an append-only record of something that happened to a
+// loan. Events are persisted so that clients reconnecting to the event
+// stream can resume from the last identifier they have seen. The
+// identifier is a monotonically increasing sequence rather than a
+// UUID, which lets consumers order events and request replays with a
+// simple "greater than" comparison.
+type LoanEvent struct {
+	ID            int64         `gorm:"primaryKey;autoIncrement" json:"id"`
+	LoanID        string        `gorm:"type:uuid;not null;index" json:"loan_id"`
+	Type          LoanEventType `gorm:"size:50;not null" json:"type"`
+	State         LoanState     `gorm:"size:20;not null" json:"state"`
+	PreviousState LoanState     `gorm:"size:20" json:"previous_state,omitempty"`
+	InvestmentID  string        `gorm:"size:36" json:"investment_id,omitempty"`
+	InvestorID    string        `gorm:"size:36" json:"investor_id,omitempty"`
+	Amount        float64       `json:"amount,omitempty"`
+	TotalInvested float64       `json:"total_invested"`
+	Principal     float64       `json:"principal"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
@@ -7,11 +7,67 @@ import "time"
 // record, capturing the invested amount and linking it to both the
 // loan and the investor. Multiple investments by the same investor
 // toward the same loan are allowed and aggregated by the service
-// layer.
+// layer. Once the loan is fully funded AgreementURL links to the
+// investor agreement generated for this investment. AutoInvestRuleID
+// is set when the investment was placed by the investor's auto-invest
+// rule.
+//
+// Investments sold on the secondary market are not modified but closed:
+// TransferredAt is set, and the buyer's position, and the seller's
+// remainder after a partial sale, are new investments whose OriginID
+// is the closed one. Investments cancelled by the investor, or
+// refunded when their loan is cancelled or expires, are closed with
+// CancelledAt. Closed investments no longer count towards the loan and
+// receive no payouts.
 type Investment struct {
-    ID         string    `gorm:"type:uuid;primaryKey" json:"id"`
-    LoanID     string    `gorm:"type:uuid;not null" json:"loan_id"`
-    InvestorID string    `gorm:"type:uuid;not null" json:"investor_id"`
-    Amount     float64   `gorm:"not null" json:"amount"`
-    CreatedAt  time.Time `json:"created_at"`
-}
\ No newline at end of file
+    ID               string     `gorm:"type:uuid;primaryKey" json:"id"`
+    LoanID           string     `gorm:"type:uuid;not null" json:"loan_id"`
+    InvestorID       string     `gorm:"type:uuid;not null" json:"investor_id"`
+    Amount           float64    `gorm:"not null" json:"amount"`
+    AgreementURL     string     `gorm:"column:agreement_url" json:"agreement_url,omitempty"`
+    AutoInvestRuleID *string    `gorm:"type:uuid" json:"auto_invest_rule_id,omitempty"`
+    OriginID         *string    `gorm:"type:uuid" json:"origin_id,omitempty"`
+    TransferredAt    *time.Time `json:"transferred_at,omitempty"`
+    CancelledAt      *time.Time `json:"cancelled_at,omitempty"`
+    CreatedAt        time.Time  `json:"created_at"`
+}
+
+// Open reports whether the investment is a current position, that is
+// it has been neither transferred nor cancelled.
+func (i Investment) Open() bool {
+    return i.TransferredAt == nil && i.CancelledAt == nil
+}
+
+// FillMode controls what happens when an investment asks for more than
+// the amount a loan still needs.
+type FillMode string
+
+const (
+    // FillModeExact rejects an investment that would exceed the
+    // principal. It is the default.
+    FillModeExact FillMode = "exact"
+    // FillModePartial accepts the remaining amount of the loan and
+    // invests that instead.
+    FillModePartial FillMode = "partial"
+)
+
+// Valid reports whether m is a known fill mode.
+func (m FillMode) Valid() bool {
+    return m == FillModeExact || m == FillModePartial
+}
+
+// Funding summarises how far a loan is funded.
+type Funding struct {
+    LoanID        string    `json:"loan_id"`
+    State         LoanState `json:"state"`
+    Principal     float64   `json:"principal"`
+    TotalInvested float64   `json:"total_invested"`
+    // Reserved is held by active reservations and not available to
+    // other investors; Remaining excludes it.
+    Reserved      float64   `json:"reserved"`
+    Remaining     float64   `json:"remaining"`
+    InvestorCount int       `json:"investor_count"`
+    // PercentFunded is TotalInvested as a percentage of Principal,
+    // rounded to two decimals.
+    PercentFunded float64 `json:"percent_funded"`
+}
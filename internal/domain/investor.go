@@ -1,6 +1,9 @@
 package domain
 
-import "time"
+import (
+    "log/slog"
+    "time"
+)
 
 // Investor represents an individual or entity that invests funds into a
 // loan. Each investor may contribute to multiple loans and each loan
@@ -10,5 +13,55 @@ type Investor struct {
     ID        string    `gorm:"type:uuid;primaryKey" json:"id"`
     Name      string    `gorm:"size:100" json:"name"`
     Email     string    `gorm:"size:100" json:"email"`
+    KYC       KYC       `gorm:"embedded;embeddedPrefix:kyc_" json:"kyc"`
     CreatedAt time.Time `json:"created_at"`
-}
\ No newline at end of file
+}
+
+// Verified reports whether the investor's identity has been verified.
+func (i Investor) Verified() bool {
+    return i.KYC.Status == KYCStatusVerified
+}
+
+// KYCStatus is the state of an investor's identity verification (know
+// your customer). Investors start pending; staff review the data they
+// submit and either verify or reject it. Rejected investors may submit
+// again.
+type KYCStatus string
+
+const (
+    KYCStatusPending  KYCStatus = "pending"
+    KYCStatusVerified KYCStatus = "verified"
+    KYCStatusRejected KYCStatus = "rejected"
+)
+
+// KYC is the identity data an investor submitted for verification and
+// the outcome of its review. DocumentID references the uploaded
+// identity_document. SubmittedAt is nil until the investor submits
+// data, and the review fields are set once staff have reviewed it.
+type KYC struct {
+    Status          KYCStatus  `gorm:"size:20;not null;default:pending" json:"status"`
+    FullName        string     `gorm:"size:200" json:"full_name,omitempty"`
+    IDNumber        string     `gorm:"size:50" json:"id_number,omitempty"`
+    DateOfBirth     *time.Time `gorm:"type:date" json:"date_of_birth,omitempty"`
+    Address         string     `json:"address,omitempty"`
+    DocumentID      *string    `gorm:"type:uuid" json:"document_id,omitempty"`
+    SubmittedAt     *time.Time `json:"submitted_at,omitempty"`
+    ReviewedBy      string     `gorm:"size:50" json:"reviewed_by,omitempty"`
+    ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+    RejectionReason string     `json:"rejection_reason,omitempty"`
+}
+
+// LogValue implements slog.LogValuer. Only the ID is logged; the name
+// and email address are personal data.
+func (i Investor) LogValue() slog.Value {
+    return slog.GroupValue(slog.String("id", i.ID))
+}
+
+
+// Wallet is the balance of an investor's wallet, the funds available
+// for investing. It is kept in the ledger as the investor's
+// investor_wallet account.
+type Wallet struct {
+    InvestorID string  `json:"investor_id"`
+    Balance    float64 `json:"balance"`
+}
@@ -0,0 +1,209 @@
+package domain
+
+import (
+	"math"
+	"time"
+)
+
+// AccountType classifies ledger accounts by the party whose money they
+// hold.
+type AccountType string
+
+const (
+	// AccountTypeExternal is the counterpart of money entering or
+	// leaving the platform, such as bank transfers. There is a single
+	// external account; its balance is the negative of all money held
+	// by the platform.
+	AccountTypeExternal AccountType = "external"
+	// AccountTypeInvestorWallet holds the uninvested funds of an
+	// investor. Owned by the investor.
+	AccountTypeInvestorWallet AccountType = "investor_wallet"
+	// AccountTypeLoanEscrow holds the funds raised for a loan until
+	// they are disbursed, and repayments until they are paid out.
+	// Owned by the loan.
+	AccountTypeLoanEscrow AccountType = "loan_escrow"
+	// AccountTypeBorrower records the net amount a borrower has
+	// received from the platform. Owned by the borrower.
+	AccountTypeBorrower AccountType = "borrower"
+	// AccountTypePlatformRevenue collects the fees earned by the
+	// platform. There is a single platform revenue account.
+	AccountTypePlatformRevenue AccountType = "platform_revenue"
+)
+
+// Valid reports whether t is a known account type.
+func (t AccountType) Valid() bool {
+	switch t {
+	case AccountTypeExternal, AccountTypeInvestorWallet, AccountTypeLoanEscrow,
+		AccountTypeBorrower, AccountTypePlatformRevenue:
+		return true
+	}
+	return false
+}
+
+// JournalKind identifies the business operation a journal entry
+// records.
+type JournalKind string
+
+const (
+	// JournalKindDeposit records investor funds entering the platform.
+	JournalKindDeposit JournalKind = "deposit"
+	// JournalKindWithdrawal records investor funds leaving the
+	// platform.
+	JournalKindWithdrawal JournalKind = "withdrawal"
+	// JournalKindInvestment records investor funds moving into the
+	// escrow of a loan.
+	JournalKindInvestment JournalKind = "investment"
+	// JournalKindDisbursement records the principal of a loan being
+	// handed over to the borrower.
+	JournalKindDisbursement JournalKind = "disbursement"
+	// JournalKindRepayment records a borrower repaying a loan.
+	JournalKindRepayment JournalKind = "repayment"
+	// JournalKindPayout records the return of principal and interest
+	// to the investors of a repaid loan.
+	JournalKindPayout JournalKind = "payout"
+	// JournalKindFee records the platform's share of the interest of a
+	// repaid loan.
+	JournalKindFee JournalKind = "fee"
+	// JournalKindRefund records investments returned to the investors'
+	// wallets because their loan did not go ahead.
+	JournalKindRefund JournalKind = "refund"
+	// JournalKindTransfer records the price of an investment bought on
+	// the secondary market moving from the buyer's wallet to the
+	// seller's.
+	JournalKindTransfer JournalKind = "investment_transfer"
+)
+
+// AccountRef names a ledger account by its type and owner. OwnerID is
+// empty for the external and platform revenue accounts.
+type AccountRef struct {
+	Type    AccountType `json:"type"`
+	OwnerID string      `json:"owner_id,omitempty"`
+}
+
+// ExternalAccount is the account money enters the platform from and
+// leaves it to.
+var ExternalAccount = AccountRef{Type: AccountTypeExternal}
+
+// PlatformRevenueAccount is the account collecting platform fees.
+var PlatformRevenueAccount = AccountRef{Type: AccountTypePlatformRevenue}
+
+// InvestorWallet returns the wallet account of an investor.
+func InvestorWallet(investorID string) AccountRef {
+	return AccountRef{Type: AccountTypeInvestorWallet, OwnerID: investorID}
+}
+
+// LoanEscrow returns the escrow account of a loan.
+func LoanEscrow(loanID string) AccountRef {
+	return AccountRef{Type: AccountTypeLoanEscrow, OwnerID: loanID}
+}
+
+// BorrowerAccount returns the account of a borrower.
+func BorrowerAccount(borrowerID string) AccountRef {
+	return AccountRef{Type: AccountTypeBorrower, OwnerID: borrowerID}
+}
+
+// Transfer moves Amount from one ledger account to another. It is
+// recorded as a debit of From and a credit of To.
+type Transfer struct {
+	From   AccountRef
+	To     AccountRef
+	Amount float64
+}
+
+// LedgerAccount is an account of the double-entry ledger. Accounts are
+// created on first use and are unique per type and owner.
+type LedgerAccount struct {
+	ID        string      `gorm:"type:uuid;primaryKey" json:"id"`
+	Type      AccountType `gorm:"size:30;not null" json:"type"`
+	OwnerID   string      `gorm:"size:50;not null" json:"owner_id,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Ref returns the type and owner of the account.
+func (a LedgerAccount) Ref() AccountRef {
+	return AccountRef{Type: a.Type, OwnerID: a.OwnerID}
+}
+
+// JournalEntry records one business operation as a set of postings
+// whose debits and credits are equal. Entries are never updated;
+// corrections are made by posting further entries. LoanID is empty for
+// entries not related to a loan.
+type JournalEntry struct {
+	ID          string      `gorm:"type:uuid;primaryKey" json:"id"`
+	Kind        JournalKind `gorm:"size:30;not null" json:"kind"`
+	LoanID      string      `gorm:"size:36;not null" json:"loan_id,omitempty"`
+	Description string      `gorm:"not null" json:"description,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Postings    []Posting   `gorm:"foreignKey:EntryID" json:"postings"`
+}
+
+// Balanced reports whether the debits of the entry equal its credits.
+func (e JournalEntry) Balanced() bool {
+	var debits, credits int64
+	for _, p := range e.Postings {
+		debits += Cents(p.Debit)
+		credits += Cents(p.Credit)
+	}
+	return debits == credits
+}
+
+// Posting moves money out of (Debit) or into (Credit) one account as
+// part of a journal entry. Exactly one of Debit and Credit is
+// positive.
+type Posting struct {
+	ID        string  `gorm:"type:uuid;primaryKey" json:"id"`
+	EntryID   string  `gorm:"type:uuid;not null" json:"entry_id"`
+	AccountID string  `gorm:"type:uuid;not null" json:"account_id"`
+	Debit     float64 `gorm:"not null" json:"debit"`
+	Credit    float64 `gorm:"not null" json:"credit"`
+}
+
+// AccountEntry is a journal entry as seen from one account: Amount is
+// the net amount the entry credited to the account, negative when it
+// was debited.
+type AccountEntry struct {
+	EntryID     string      `json:"entry_id"`
+	Kind        JournalKind `json:"kind"`
+	LoanID      string      `json:"loan_id,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Amount      float64     `json:"amount"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// AccountBalance is a ledger account with its balance, the sum of its
+// credits minus the sum of its debits. The balance is kept up to date
+// as postings are recorded, so reading it does not sum the postings.
+// The balances of all accounts add up to zero.
+type AccountBalance struct {
+	LedgerAccount
+	Balance float64 `json:"balance"`
+}
+
+// LedgerCheck is the result of verifying the ledger invariant: the
+// total of all debits equals the total of all credits, and so does
+// each journal entry on its own. MismatchedAccounts lists the accounts
+// whose stored balance differs from the sum of their postings.
+type LedgerCheck struct {
+	Debits             float64  `json:"debits"`
+	Credits            float64  `json:"credits"`
+	UnbalancedEntries  []string `json:"unbalanced_entries"`
+	MismatchedAccounts []string `json:"mismatched_accounts"`
+}
+
+// Balanced reports whether the ledger invariant holds and every stored
+// balance matches the postings.
+func (c LedgerCheck) Balanced() bool {
+	return Cents(c.Debits) == Cents(c.Credits) && len(c.UnbalancedEntries) == 0 &&
+		len(c.MismatchedAccounts) == 0
+}
+
+// Cents converts an amount to a whole number of cents, so that amounts
+// stored as floating point numbers can be compared exactly.
+func Cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// FromCents converts a whole number of cents back to an amount.
+func FromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
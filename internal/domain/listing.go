@@ -0,0 +1,42 @@
+package domain
+
+import "time"
+
+// ListingState is the state of a secondary market listing.
+type ListingState string
+
+const (
+	// ListingStateOpen is the state of a listing that may be bought.
+	ListingStateOpen ListingState = "open"
+	// ListingStateSold is the state of a listing that has been bought;
+	// the position has been transferred to the buyer.
+	ListingStateSold ListingState = "sold"
+	// ListingStateCancelled is the state of a listing withdrawn by the
+	// seller, or closed because the loan was repaid.
+	ListingStateCancelled ListingState = "cancelled"
+)
+
+// Listing offers all or part of an investment in a disbursed loan for
+// sale on the secondary market. Amount is the principal offered and
+// Price what the buyer pays the seller for it. Once sold, BuyerID and
+// BuyerInvestmentID identify the buyer and the investment holding the
+// position they bought.
+type Listing struct {
+	ID                string       `gorm:"type:uuid;primaryKey" json:"id"`
+	LoanID            string       `gorm:"type:uuid;not null" json:"loan_id"`
+	InvestmentID      string       `gorm:"type:uuid;not null" json:"investment_id"`
+	SellerID          string       `gorm:"type:uuid;not null" json:"seller_id"`
+	Amount            float64      `gorm:"not null" json:"amount"`
+	Price             float64      `gorm:"not null" json:"price"`
+	State             ListingState `gorm:"size:20;not null" json:"state"`
+	BuyerID           *string      `gorm:"type:uuid" json:"buyer_id,omitempty"`
+	BuyerInvestmentID *string      `gorm:"type:uuid" json:"buyer_investment_id,omitempty"`
+	SoldAt            *time.Time   `json:"sold_at,omitempty"`
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+}
+
+// Valid reports whether s is a known listing state.
+func (s ListingState) Valid() bool {
+	return s == ListingStateOpen || s == ListingStateSold || s == ListingStateCancelled
+}
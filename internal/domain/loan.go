@@ -22,12 +22,32 @@ const (
     // LoanStateDisbursed indicates that the loan principal has been
     // handed over to the borrower.
     LoanStateDisbursed LoanState = "disbursed"
+    // LoanStateRepaid indicates that the borrower has repaid the loan
+    // with interest and the investors have been paid out.
+    LoanStateRepaid LoanState = "repaid"
+    // LoanStateCancelled indicates that the loan was withdrawn before
+    // it was fully funded. Its investments have been refunded.
+    LoanStateCancelled LoanState = "cancelled"
+    // LoanStateExpired indicates that the loan was not fully funded
+    // within the funding period. Its investments have been refunded.
+    LoanStateExpired LoanState = "expired"
 )
 
+// OutstandingLoanStates are the states in which the investments in a
+// loan are at risk: funds are committed and have not been repaid or
+// refunded.
+var OutstandingLoanStates = []LoanState{LoanStateApproved, LoanStateInvested, LoanStateDisbursed}
+
 // Loan represents a loan offered by Amartha. It contains basic
 // information such as the borrower identifier, principal amount,
-// interest rate, return on investment, a link to the generated
-// agreement letter and the current state of the loan.
+// interest rate, return on investment, the borrower's risk grade if
+// one has been assessed, a link to the generated
+// agreement letter and the current state of the loan. Loans created
+// from the product catalog reference the product version they were
+// created under and record the tenor chosen by the borrower; loans
+// created before the catalog have neither. The agreement
+// letter is generated by the service when the loan becomes
+// `invested`; it is empty before that.
 //
 // The schema uses UUIDs as primary keys to ensure scalability when
 // operating in distributed systems where auto‑incremented integers
@@ -39,6 +59,10 @@ type Loan struct {
     Principal          float64   `gorm:"not null" json:"principal"`
     Rate               float64   `gorm:"not null" json:"rate"`
     ROI                float64   `gorm:"not null" json:"roi"`
+    RiskGrade          RiskGrade `gorm:"size:1" json:"risk_grade,omitempty"`
+    ProductID          *string   `gorm:"type:uuid" json:"product_id,omitempty"`
+    ProductCode        string    `gorm:"size:50" json:"product_code,omitempty"`
+    TenorMonths        int       `json:"tenor_months,omitempty"`
     AgreementLetterURL string    `gorm:"column:agreement_letter_url" json:"agreement_letter_url"`
     State              LoanState `gorm:"size:20;not null" json:"state"`
     CreatedAt          time.Time `json:"created_at"`
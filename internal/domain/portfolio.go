@@ -0,0 +1,66 @@
+package domain
+
+import "time"
+
+// PortfolioAmounts are the figures reported for a set of an investor's
+// positions, that is their open investments.
+type PortfolioAmounts struct {
+	// Principal is the amount invested in the positions, except those
+	// in refunded loans.
+	Principal float64 `json:"principal"`
+	// AmountPaid is what the investor paid for those positions: their
+	// investments and secondary market purchases, less the proceeds of
+	// partial sales. It differs from Principal when a position was
+	// traded at a price other than its amount.
+	AmountPaid float64 `json:"amount_paid"`
+	// ExpectedReturn is what the positions will have paid out at their
+	// loans' ROI, principal included, less AmountPaid. Positions in
+	// refunded loans earn nothing.
+	ExpectedReturn float64 `json:"expected_return"`
+	// RealizedPayouts is what repaid loans have paid out for the
+	// positions, principal included.
+	RealizedPayouts float64 `json:"realized_payouts"`
+	// OutstandingPrincipal is the principal of the positions in loans
+	// in one of OutstandingLoanStates.
+	OutstandingPrincipal float64 `json:"outstanding_principal"`
+	// Refunded is the principal of the positions in cancelled or
+	// expired loans, which has been returned to the investor's wallet.
+	Refunded float64 `json:"refunded"`
+}
+
+// PortfolioPosition is an investor's position in one loan.
+type PortfolioPosition struct {
+	LoanID string    `json:"loan_id"`
+	State  LoanState `json:"state"`
+	ROI    float64   `json:"roi"`
+	PortfolioAmounts
+}
+
+// PortfolioStateSummary totals an investor's positions in the loans in
+// one state.
+type PortfolioStateSummary struct {
+	State LoanState `json:"state"`
+	Loans int       `json:"loans"`
+	PortfolioAmounts
+}
+
+// Portfolio summarises an investor's positions across all loans at
+// AsOf. The totals cover every position, ByState breaks them down by
+// loan state and Positions lists them by loan. IRR is the
+// money-weighted annual return in percent of the money the investor
+// has moved in and out of loans, with the outstanding positions valued
+// at what the investor paid for them at AsOf; it is nil until those
+// cash flows span a day or when no return can be computed from them.
+type Portfolio struct {
+	InvestorID           string                  `json:"investor_id"`
+	PrincipalDeployed    float64                 `json:"principal_deployed"`
+	AmountPaid           float64                 `json:"amount_paid"`
+	ExpectedReturn       float64                 `json:"expected_return"`
+	RealizedPayouts      float64                 `json:"realized_payouts"`
+	OutstandingPrincipal float64                 `json:"outstanding_principal"`
+	PrincipalRefunded    float64                 `json:"principal_refunded"`
+	IRR                  *float64                `json:"irr"`
+	ByState              []PortfolioStateSummary `json:"by_state"`
+	Positions            []PortfolioPosition     `json:"positions"`
+	AsOf                 time.Time               `json:"as_of"`
+}
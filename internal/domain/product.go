@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+// RepaymentFrequency is how often the borrower of a loan repays it.
+type RepaymentFrequency string
+
+const (
+	// RepaymentWeekly loans are repaid in weekly instalments.
+	RepaymentWeekly RepaymentFrequency = "weekly"
+	// RepaymentMonthly loans are repaid in monthly instalments.
+	RepaymentMonthly RepaymentFrequency = "monthly"
+	// RepaymentBullet loans are repaid in full at the end of the tenor.
+	RepaymentBullet RepaymentFrequency = "bullet"
+)
+
+// Valid reports whether f is one of the known repayment frequencies.
+func (f RepaymentFrequency) Valid() bool {
+	switch f {
+	case RepaymentWeekly, RepaymentMonthly, RepaymentBullet:
+		return true
+	}
+	return false
+}
+
+// LoanProduct is one version of a loan product of the catalog. A
+// product sets the terms that the loans offered under it must meet:
+// the tenors in months the borrower may choose from, the principal
+// range and the bands of the borrower's rate and the investors' ROI,
+// all inclusive. OriginationFee is the share of the principal, as a
+// percentage, charged when the loan is disbursed and LateFee the flat
+// amount charged for a late repayment. AgreementTemplate is the
+// version of the agreement templates used for the product's loans;
+// when empty the configured version is used.
+//
+// Versions are never modified: changing a product publishes a new
+// version with the same Code, and loans keep referencing the version
+// they were created under.
+type LoanProduct struct {
+	ID                 string             `gorm:"type:uuid;primaryKey" json:"id"`
+	Code               string             `gorm:"size:50;not null" json:"code"`
+	Version            int                `gorm:"not null" json:"version"`
+	Name               string             `gorm:"not null" json:"name"`
+	TenorMonths        []int              `gorm:"serializer:json;not null" json:"tenor_months"`
+	RepaymentFrequency RepaymentFrequency `gorm:"size:20;not null" json:"repayment_frequency"`
+	MinPrincipal       float64            `gorm:"not null" json:"min_principal"`
+	MaxPrincipal       float64            `gorm:"not null" json:"max_principal"`
+	MinRate            float64            `gorm:"not null" json:"min_rate"`
+	MaxRate            float64            `gorm:"not null" json:"max_rate"`
+	MinROI             float64            `gorm:"column:min_roi;not null" json:"min_roi"`
+	MaxROI             float64            `gorm:"column:max_roi;not null" json:"max_roi"`
+	OriginationFee     float64            `gorm:"not null" json:"origination_fee"`
+	LateFee            float64            `gorm:"not null" json:"late_fee"`
+	AgreementTemplate  string             `gorm:"size:50" json:"agreement_template,omitempty"`
+	CreatedAt          time.Time          `json:"created_at"`
+}
+
+// OffersTenor reports whether the product offers a tenor of the given
+// number of months.
+func (p *LoanProduct) OffersTenor(months int) bool {
+	return slices.Contains(p.TenorMonths, months)
+}
@@ -0,0 +1,30 @@
+package domain
+
+import "time"
+
+// RefundReason explains why invested funds were returned to an
+// investor.
+type RefundReason string
+
+const (
+	// RefundReasonInvestmentCancelled is used when the investor
+	// cancelled the investment before the loan was fully funded.
+	RefundReasonInvestmentCancelled RefundReason = "investment_cancelled"
+	// RefundReasonLoanCancelled is used when the loan was cancelled.
+	RefundReasonLoanCancelled RefundReason = "loan_cancelled"
+	// RefundReasonLoanExpired is used when the loan was not fully
+	// funded within the funding period.
+	RefundReasonLoanExpired RefundReason = "loan_expired"
+)
+
+// Refund records the amount of an investment returned to the
+// investor's wallet.
+type Refund struct {
+	ID           string       `gorm:"type:uuid;primaryKey" json:"id"`
+	LoanID       string       `gorm:"type:uuid;not null;index" json:"loan_id"`
+	InvestmentID string       `gorm:"type:uuid;not null" json:"investment_id"`
+	InvestorID   string       `gorm:"type:uuid;not null;index" json:"investor_id"`
+	Amount       float64      `gorm:"not null" json:"amount"`
+	Reason       RefundReason `gorm:"size:30;not null" json:"reason"`
+	CreatedAt    time.Time    `json:"created_at"`
+}
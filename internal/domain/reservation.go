@@ -0,0 +1,45 @@
+package domain
+
+import "time"
+
+// ReservationState represents the lifecycle of a reservation.
+type ReservationState string
+
+const (
+	// ReservationStateHeld is the state of a reservation holding an
+	// amount of a loan until it expires.
+	ReservationStateHeld ReservationState = "held"
+	// ReservationStateConfirmed is used once the reservation was
+	// converted into an investment.
+	ReservationStateConfirmed ReservationState = "confirmed"
+	// ReservationStateReleased is used when the investor gave the
+	// amount up before the reservation expired.
+	ReservationStateReleased ReservationState = "released"
+	// ReservationStateExpired is used once an unconfirmed reservation
+	// has passed its expiry time.
+	ReservationStateExpired ReservationState = "expired"
+)
+
+// Reservation holds an amount of a loan for an investor while they
+// complete payment, so that it cannot be taken by other investments.
+// A held reservation counts against the principal until ExpiresAt;
+// confirming it creates an investment of the same amount.
+type Reservation struct {
+	ID         string           `gorm:"type:uuid;primaryKey" json:"id"`
+	LoanID     string           `gorm:"type:uuid;not null;index" json:"loan_id"`
+	InvestorID string           `gorm:"type:uuid;not null" json:"investor_id"`
+	Amount     float64          `gorm:"not null" json:"amount"`
+	State      ReservationState `gorm:"size:20;not null" json:"state"`
+	ExpiresAt  time.Time        `gorm:"not null" json:"expires_at"`
+	// InvestmentID is the investment a confirmed reservation was
+	// converted into.
+	InvestmentID *string   `gorm:"type:uuid" json:"investment_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Active reports whether the reservation still holds its amount at
+// the given time.
+func (r *Reservation) Active(at time.Time) bool {
+	return r.State == ReservationStateHeld && at.Before(r.ExpiresAt)
+}
@@ -0,0 +1,117 @@
+// Package events distributes loan events to stream subscribers. A
+// Broker fans events out to subscribers connected to this process,
+// a Bus persists events so they can be replayed after a reconnect and
+// a Listener relays events appended by other service instances via
+// Postgres LISTEN/NOTIFY.
+package events
+
+import (
+	"sync"
+
+	"loan_service/internal/domain"
+)
+
+// subscriberBuffer is the number of events buffered per subscriber.
+// A subscriber that falls further behind than this is disconnected
+// rather than blocking delivery to everyone else; the client can
+// reconnect and catch up through a replay.
+const subscriberBuffer = 64
+
+type subscriber struct {
+	loanID string
+	ch     chan domain.LoanEvent
+}
+
+// Broker is an in-process publish/subscribe hub for loan events. It
+// is safe for concurrent use.
+type Broker struct {
+	mu     sync.RWMutex
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+// NewBroker creates an empty broker.
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*subscriber]struct{})}
+}
+
+// Subscribe registers a new subscriber. When loanID is non-empty only
+// events for that loan are delivered, otherwise events for all loans
+// are. The returned cancel function must be called to release the
+// subscription. The channel is closed when the subscription is
+// cancelled or the subscriber is dropped for being too slow.
+func (b *Broker) Subscribe(loanID string) (<-chan domain.LoanEvent, func()) {
+	s := &subscriber{loanID: loanID, ch: make(chan domain.LoanEvent, subscriberBuffer)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(s.ch)
+		return s.ch, func() {}
+	}
+	b.subs[s] = struct{}{}
+	return s.ch, func() { b.remove(s) }
+}
+
+// Publish delivers the event to every matching subscriber without
+// blocking.
+func (b *Broker) Publish(ev domain.LoanEvent) {
+	var slow []*subscriber
+	b.mu.RLock()
+	for s := range b.subs {
+		if s.loanID != "" && s.loanID != ev.LoanID {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			slow = append(slow, s)
+		}
+	}
+	b.mu.RUnlock()
+	for _, s := range slow {
+		b.remove(s)
+	}
+}
+
+// Subscribers returns the number of active subscriptions.
+func (b *Broker) Subscribers() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs)
+}
+
+// Close closes every subscription so that open streams end, and makes
+// later subscriptions return an already closed channel. It is called
+// during shutdown because the HTTP server does not interrupt
+// long-lived responses on its own.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subs {
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
+
+// Disconnect closes every current subscription, like dropping a slow
+// subscriber, but keeps accepting new ones. The Listener calls it when
+// it may have missed events, so that open streams end and their
+// clients reconnect and catch up through a replay.
+func (b *Broker) Disconnect() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
+
+func (b *Broker) remove(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
@@ -0,0 +1,73 @@
+package events
+
+import (
+	"testing"
+
+	"loan_service/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker_FiltersByLoan(t *testing.T) {
+	b := NewBroker()
+	all, cancelAll := b.Subscribe("")
+	defer cancelAll()
+	one, cancelOne := b.Subscribe("L1")
+	defer cancelOne()
+
+	b.Publish(domain.LoanEvent{ID: 1, LoanID: "L1"})
+	b.Publish(domain.LoanEvent{ID: 2, LoanID: "L2"})
+
+	assert.Equal(t, int64(1), (<-all).ID)
+	assert.Equal(t, int64(2), (<-all).ID)
+	assert.Equal(t, int64(1), (<-one).ID)
+	assert.Len(t, one, 0)
+}
+
+func TestBroker_CancelClosesChannel(t *testing.T) {
+	b := NewBroker()
+	ch, cancel := b.Subscribe("")
+	require.Equal(t, 1, b.Subscribers())
+
+	cancel()
+	cancel()
+
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.Equal(t, 0, b.Subscribers())
+}
+
+func TestBroker_DropsSlowSubscriber(t *testing.T) {
+	b := NewBroker()
+	ch, cancel := b.Subscribe("")
+	defer cancel()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(domain.LoanEvent{ID: int64(i + 1), LoanID: "L1"})
+	}
+
+	assert.Equal(t, 0, b.Subscribers())
+	n := 0
+	for range ch {
+		n++
+	}
+	assert.Equal(t, subscriberBuffer, n)
+}
+
+func TestBroker_CloseEndsSubscriptions(t *testing.T) {
+	b := NewBroker()
+	ch, cancel := b.Subscribe("")
+	defer cancel()
+
+	b.Close()
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.Equal(t, 0, b.Subscribers())
+
+	late, cancelLate := b.Subscribe("L1")
+	defer cancelLate()
+	_, ok = <-late
+	assert.False(t, ok)
+	assert.Equal(t, 0, b.Subscribers())
+}
@@ -0,0 +1,93 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"loan_service/internal/domain"
+)
+
+// replayBatchSize bounds the number of events loaded per query while
+// replaying missed events to a reconnecting client.
+const replayBatchSize = 500
+
+// Store persists loan events and returns them for replay. The
+// concrete implementation is repository.EventRepository.
+type Store interface {
+	AppendEvent(ctx context.Context, ev *domain.LoanEvent) error
+	ListEventsAfter(ctx context.Context, loanID string, afterID int64, limit int) ([]domain.LoanEvent, error)
+}
+
+// Bus ties event persistence to live delivery. Published events are
+// first appended to the store, which assigns their sequence ID, and
+// then delivered to subscribers of the local broker.
+//
+// Stream clients skip events whose ID is not above the last one they
+// received, so events must reach them in ID order. A local bus appends
+// and delivers one event at a time to guarantee that; a notifying
+// store must commit events in ID order itself.
+//
+// When the store announces events to other instances (Postgres
+// NOTIFY) the local broker is fed by a Listener instead, so that
+// every instance, including the one that produced the event, delivers
+// it exactly once. Use NewBus for that setup and NewLocalBus when the
+// service runs as a single instance without a notifying store.
+type Bus struct {
+	store  Store
+	broker *Broker
+	local  bool
+	// mu serialises Publish on local buses.
+	mu sync.Mutex
+}
+
+// NewBus creates a bus whose local broker is fed by a Listener.
+func NewBus(store Store, broker *Broker) *Bus {
+	return &Bus{store: store, broker: broker}
+}
+
+// NewLocalBus creates a bus that delivers published events straight
+// to the local broker.
+func NewLocalBus(store Store, broker *Broker) *Bus {
+	return &Bus{store: store, broker: broker, local: true}
+}
+
+// Publish persists the event and, for local buses, delivers it to the
+// broker. It implements service.EventPublisher.
+func (b *Bus) Publish(ctx context.Context, ev domain.LoanEvent) error {
+	if !b.local {
+		return b.store.AppendEvent(ctx, &ev)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.store.AppendEvent(ctx, &ev); err != nil {
+		return err
+	}
+	b.broker.Publish(ev)
+	return nil
+}
+
+// Subscribe registers a live subscription on the local broker. See
+// Broker.Subscribe.
+func (b *Bus) Subscribe(loanID string) (<-chan domain.LoanEvent, func()) {
+	return b.broker.Subscribe(loanID)
+}
+
+// Replay calls fn for every stored event after afterID, in order,
+// until the store is exhausted or fn returns an error.
+func (b *Bus) Replay(ctx context.Context, loanID string, afterID int64, fn func(domain.LoanEvent) error) error {
+	for {
+		batch, err := b.store.ListEventsAfter(ctx, loanID, afterID, replayBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, ev := range batch {
+			if err := fn(ev); err != nil {
+				return err
+			}
+			afterID = ev.ID
+		}
+		if len(batch) < replayBatchSize {
+			return nil
+		}
+	}
+}
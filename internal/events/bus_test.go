@@ -0,0 +1,133 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"loan_service/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memStore is a minimal Store keeping events in a slice.
+type memStore struct{ events []domain.LoanEvent }
+
+func (s *memStore) AppendEvent(_ context.Context, ev *domain.LoanEvent) error {
+	ev.ID = int64(len(s.events) + 1)
+	s.events = append(s.events, *ev)
+	return nil
+}
+
+func (s *memStore) ListEventsAfter(_ context.Context, loanID string, afterID int64, limit int) ([]domain.LoanEvent, error) {
+	var out []domain.LoanEvent
+	for _, ev := range s.events {
+		if ev.ID > afterID && (loanID == "" || ev.LoanID == loanID) && len(out) < limit {
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
+
+func TestLocalBus_PublishDeliversWithSequenceID(t *testing.T) {
+	bus := NewLocalBus(&memStore{}, NewBroker())
+	ch, cancel := bus.Subscribe("L1")
+	defer cancel()
+
+	require.NoError(t, bus.Publish(context.Background(), domain.LoanEvent{LoanID: "L1"}))
+
+	ev := <-ch
+	assert.Equal(t, int64(1), ev.ID)
+}
+
+func TestBus_PublishLeavesDeliveryToListener(t *testing.T) {
+	broker := NewBroker()
+	bus := NewBus(&memStore{}, broker)
+	ch, cancel := bus.Subscribe("")
+	defer cancel()
+
+	require.NoError(t, bus.Publish(context.Background(), domain.LoanEvent{LoanID: "L1"}))
+
+	assert.Len(t, ch, 0)
+}
+
+func TestBus_ReplaySpansBatches(t *testing.T) {
+	store := &memStore{}
+	bus := NewLocalBus(store, NewBroker())
+	for i := 0; i < replayBatchSize+10; i++ {
+		loanID := "L1"
+		if i%2 == 1 {
+			loanID = "L2"
+		}
+		require.NoError(t, bus.Publish(context.Background(), domain.LoanEvent{LoanID: loanID}))
+	}
+
+	var got []int64
+	err := bus.Replay(context.Background(), "", 5, func(ev domain.LoanEvent) error {
+		got = append(got, ev.ID)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, got, replayBatchSize+5)
+	assert.Equal(t, int64(6), got[0])
+
+	got = got[:0]
+	err = bus.Replay(context.Background(), "L2", 0, func(ev domain.LoanEvent) error {
+		got = append(got, ev.ID)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, got, (replayBatchSize+10)/2)
+}
+
+// stallingStore assigns IDs on entry, like a database sequence, and
+// holds the first append until release is closed.
+type stallingStore struct {
+	memStore
+	mu      sync.Mutex
+	next    atomic.Int64
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *stallingStore) AppendEvent(ctx context.Context, ev *domain.LoanEvent) error {
+	ev.ID = s.next.Add(1)
+	if ev.ID == 1 {
+		close(s.entered)
+		<-s.release
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, *ev)
+	return nil
+}
+
+func TestLocalBus_ConcurrentPublishesDeliverInIDOrder(t *testing.T) {
+	store := &stallingStore{entered: make(chan struct{}), release: make(chan struct{})}
+	bus := NewLocalBus(store, NewBroker())
+	ch, cancel := bus.Subscribe("")
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, bus.Publish(context.Background(), domain.LoanEvent{LoanID: "L1"}))
+	}()
+	<-store.entered
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, bus.Publish(context.Background(), domain.LoanEvent{LoanID: "L2"}))
+	}()
+	// Give the second publish the chance to overtake the first one.
+	time.Sleep(20 * time.Millisecond)
+	close(store.release)
+	wg.Wait()
+
+	require.Len(t, ch, 2)
+	assert.Equal(t, int64(1), (<-ch).ID)
+	assert.Equal(t, int64(2), (<-ch).ID)
+}
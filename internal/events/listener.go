@@ -0,0 +1,112 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"loan_service/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// reconnectDelay is how long the listener waits before reconnecting
+// after losing its database connection.
+const reconnectDelay = 2 * time.Second
+
+// notificationConn is a LISTEN session. *pgx.Conn implements it.
+type notificationConn interface {
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+	Close(ctx context.Context) error
+}
+
+// Listener relays loan events announced on a Postgres NOTIFY channel
+// to the local broker. LISTEN requires a dedicated session, so the
+// listener holds its own connection outside of the GORM pool and
+// re-establishes it whenever it is lost.
+//
+// Events committed while the session is down are never announced to
+// this instance. After every reconnect the listener therefore
+// disconnects the broker's subscribers, whose clients reconnect and
+// replay what they missed from the event table.
+type Listener struct {
+	dsn       string
+	channel   string
+	broker    *Broker
+	connect   func(ctx context.Context) (notificationConn, error)
+	delay     time.Duration
+	listened  bool
+	connected atomic.Bool
+}
+
+// NewListener creates a listener for the given channel. The DSN uses
+// the same keyword/value format as config.Config.DSN.
+func NewListener(dsn, channel string, broker *Broker) *Listener {
+	l := &Listener{dsn: dsn, channel: channel, broker: broker, delay: reconnectDelay}
+	l.connect = l.dial
+	return l
+}
+
+// Connected reports whether the listener currently holds a LISTEN
+// session.
+func (l *Listener) Connected() bool { return l.connected.Load() }
+
+// Run listens for notifications until ctx is cancelled. Connection
+// failures are logged and retried.
+func (l *Listener) Run(ctx context.Context) {
+	for {
+		err := l.listen(ctx)
+		l.connected.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("event listener disconnected; reconnecting", "error", err, "delay", l.delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(l.delay):
+		}
+	}
+}
+
+// dial opens a connection and starts listening on the channel.
+func (l *Listener) dial(ctx context.Context) (notificationConn, error) {
+	conn, err := pgx.Connect(ctx, l.dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{l.channel}.Sanitize()); err != nil {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (l *Listener) listen(ctx context.Context) error {
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if l.listened {
+		slog.Info("event listener reconnected; disconnecting stream subscribers", "subscribers", l.broker.Subscribers())
+		l.broker.Disconnect()
+	}
+	l.listened = true
+	l.connected.Store(true)
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var ev domain.LoanEvent
+		if err := json.Unmarshal([]byte(n.Payload), &ev); err != nil {
+			slog.Warn("event listener discarding malformed payload", "error", err)
+			continue
+		}
+		l.broker.Publish(ev)
+	}
+}
@@ -0,0 +1,82 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"loan_service/internal/domain"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSession is a LISTEN session delivering the queued notifications
+// and then failing with err, or blocking until the context ends when
+// err is nil.
+type fakeSession struct {
+	events []domain.LoanEvent
+	err    error
+}
+
+func (s *fakeSession) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	if len(s.events) > 0 {
+		payload, _ := json.Marshal(s.events[0])
+		s.events = s.events[1:]
+		return &pgconn.Notification{Payload: string(payload)}, nil
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (s *fakeSession) Close(context.Context) error { return nil }
+
+func TestListener_ReconnectDisconnectsSubscribers(t *testing.T) {
+	broker := NewBroker()
+	stale, cancelStale := broker.Subscribe("")
+	defer cancelStale()
+
+	sessions := []*fakeSession{
+		{events: []domain.LoanEvent{{ID: 1, LoanID: "L1"}}, err: errors.New("connection reset")},
+		{events: []domain.LoanEvent{{ID: 3, LoanID: "L1"}}},
+	}
+	reconnected := make(chan struct{})
+	l := NewListener("", "loan_events", broker)
+	l.delay = time.Millisecond
+	l.connect = func(context.Context) (notificationConn, error) {
+		s := sessions[0]
+		sessions = sessions[1:]
+		if len(sessions) == 0 {
+			close(reconnected)
+		}
+		return s, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Event 2 was committed while the session was down; the stream
+	// that saw event 1 must end so that its client replays it.
+	assert.Equal(t, int64(1), (<-stale).ID)
+	<-reconnected
+	select {
+	case ev, ok := <-stale:
+		assert.False(t, ok, "unexpected event %d", ev.ID)
+	case <-time.After(time.Second):
+		t.Fatal("subscription was not closed after the reconnect")
+	}
+	require.Eventually(t, l.Connected, time.Second, time.Millisecond)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/repository"
+	"loan_service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AutoInvestUsecase abstracts the auto-invest service for the handler.
+type AutoInvestUsecase interface {
+	SetRule(ctx context.Context, rule domain.AutoInvestRule) (*domain.AutoInvestRule, error)
+	GetRule(ctx context.Context, investorID string) (*domain.AutoInvestRule, error)
+	DisableRule(ctx context.Context, investorID string) (*domain.AutoInvestRule, error)
+}
+
+// AutoInvestHandler defines HTTP handlers for managing the auto-invest
+// rules of investors.
+type AutoInvestHandler struct {
+	svc AutoInvestUsecase
+}
+
+// NewAutoInvestHandler constructs a new AutoInvestHandler.
+func NewAutoInvestHandler(svc AutoInvestUsecase) *AutoInvestHandler {
+	return &AutoInvestHandler{svc: svc}
+}
+
+// RegisterRoutes registers the auto-invest routes on the given Gin
+// engine.
+func (h *AutoInvestHandler) RegisterRoutes(r *gin.Engine) {
+	r.PUT("/investors/:id/auto-invest", h.setRule)
+	r.GET("/investors/:id/auto-invest", h.getRule)
+	r.DELETE("/investors/:id/auto-invest", h.disableRule)
+}
+
+// setRule handles PUT /investors/:id/auto-invest. It creates or
+// replaces the investor's rule and activates it. Only max_per_loan is
+// required; zero max_principal and daily_budget are unlimited.
+func (h *AutoInvestHandler) setRule(c *gin.Context) {
+	var req struct {
+		MinROI       float64          `json:"min_roi"`
+		MaxPrincipal float64          `json:"max_principal"`
+		MaxPerLoan   float64          `json:"max_per_loan" binding:"required"`
+		DailyBudget  float64          `json:"daily_budget"`
+		MaxRiskGrade domain.RiskGrade `json:"max_risk_grade" binding:"omitempty,oneof=A B C D E"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rule, err := h.svc.SetRule(c.Request.Context(), domain.AutoInvestRule{
+		InvestorID:   c.Param("id"),
+		MinROI:       req.MinROI,
+		MaxPrincipal: req.MaxPrincipal,
+		MaxPerLoan:   req.MaxPerLoan,
+		DailyBudget:  req.DailyBudget,
+		MaxRiskGrade: req.MaxRiskGrade,
+	})
+	if err != nil {
+		autoInvestError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// getRule handles GET /investors/:id/auto-invest.
+func (h *AutoInvestHandler) getRule(c *gin.Context) {
+	rule, err := h.svc.GetRule(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		autoInvestError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// disableRule handles DELETE /investors/:id/auto-invest. The rule is
+// deactivated rather than deleted and returned.
+func (h *AutoInvestHandler) disableRule(c *gin.Context) {
+	rule, err := h.svc.DisableRule(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		autoInvestError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// autoInvestError writes the response for an error of an auto-invest
+// operation: 404 for an unknown investor or a missing rule and 400 for
+// a rejected request.
+func autoInvestError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "investor not found"})
+	case errors.Is(err, service.ErrAutoInvestRuleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/repository"
+	"loan_service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// multipartMemory is the part of a multipart upload kept in memory;
+// larger files are spooled to temporary files while parsing.
+const multipartMemory = 8 << 20
+
+// DocumentUsecase abstracts the document service for the handler.
+type DocumentUsecase interface {
+	Upload(ctx context.Context, kind domain.DocumentKind, fileName string, r io.Reader, size int64) (*domain.Document, error)
+	GetDocument(ctx context.Context, id string) (*domain.Document, error)
+	OpenDocument(ctx context.Context, id string) (*domain.Document, io.ReadCloser, error)
+}
+
+// DocumentHandler defines HTTP handlers for uploading and downloading
+// approval proofs and signed agreements.
+type DocumentHandler struct {
+	svc            DocumentUsecase
+	maxUploadBytes int64
+}
+
+// NewDocumentHandler constructs a new DocumentHandler. Request bodies
+// larger than maxUploadBytes are rejected.
+func NewDocumentHandler(svc DocumentUsecase, maxUploadBytes int64) *DocumentHandler {
+	return &DocumentHandler{svc: svc, maxUploadBytes: maxUploadBytes}
+}
+
+// RegisterRoutes registers the document routes on the given Gin
+// engine.
+func (h *DocumentHandler) RegisterRoutes(r *gin.Engine) {
+	r.POST("/documents", h.uploadDocument)
+	r.GET("/documents/:id", h.getDocument)
+	r.GET("/documents/:id/content", h.downloadDocument)
+}
+
+// uploadDocument handles POST /documents. It expects a multipart form
+// with a `kind` field (approval_proof, signed_agreement or
+// identity_document) and the file in a `file` field. The response
+// contains the document ID to pass to the approve, disburse or KYC
+// endpoints.
+func (h *DocumentHandler) uploadDocument(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxUploadBytes)
+	if err := c.Request.ParseMultipartForm(multipartMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "upload exceeds " + strconv.FormatInt(h.maxUploadBytes, 10) + " bytes"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	kind := domain.DocumentKind(c.PostForm("kind"))
+	if !kind.Uploadable() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be approval_proof, signed_agreement or identity_document"})
+		return
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+	doc, err := h.svc.Upload(c.Request.Context(), kind, fh.Filename, f, fh.Size)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidDocument) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, doc)
+}
+
+// getDocument handles GET /documents/:id. It returns the document
+// metadata.
+func (h *DocumentHandler) getDocument(c *gin.Context) {
+	doc, err := h.svc.GetDocument(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+// downloadDocument handles GET /documents/:id/content. It streams the
+// stored content with its recorded content type, and exposes the
+// SHA-256 checksum as the ETag. Uploaded files are served as
+// attachments and browsers are told not to sniff their type, so that
+// an uploaded HTML or SVG file cannot run in the service's origin.
+func (h *DocumentHandler) downloadDocument(c *gin.Context) {
+	doc, rc, err := h.svc.OpenDocument(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rc.Close()
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": doc.FileName})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	c.Header("ETag", `"`+doc.SHA256+`"`)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, doc.Size, doc.ContentType, rc, map[string]string{
+		"Content-Disposition": disposition,
+	})
+}
@@ -0,0 +1,184 @@
+package handler_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/handler"
+	mock_loan_service "loan_service/internal/handler/mocks"
+	"loan_service/internal/repository"
+	"loan_service/internal/service"
+)
+
+func multipartBody(t *testing.T, kind, fileName string, content []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if kind != "" {
+		require.NoError(t, mw.WriteField("kind", kind))
+	}
+	if fileName != "" {
+		fw, err := mw.CreateFormFile("file", fileName)
+		require.NoError(t, err)
+		_, _ = fw.Write(content)
+	}
+	require.NoError(t, mw.Close())
+	return &buf, mw.FormDataContentType()
+}
+
+func TestUploadDocument_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ms := new(mock_loan_service.MockDocumentService)
+	created := &domain.Document{ID: "DOC1", Kind: domain.DocumentKindApprovalProof}
+	ms.On("Upload", mock.Anything, domain.DocumentKindApprovalProof, "proof.png", mock.Anything, int64(3)).Return(created, nil).Once()
+
+	r := gin.New()
+	handler.NewDocumentHandler(ms, 1<<20).RegisterRoutes(r)
+
+	body, ct := multipartBody(t, "approval_proof", "proof.png", []byte("png"))
+	req, _ := http.NewRequest("POST", "/documents", body)
+	req.Header.Set("Content-Type", ct)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":"DOC1"`)
+	ms.AssertExpectations(t)
+}
+
+func TestUploadDocument_InvalidKind(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ms := new(mock_loan_service.MockDocumentService)
+	r := gin.New()
+	handler.NewDocumentHandler(ms, 1<<20).RegisterRoutes(r)
+
+	body, ct := multipartBody(t, "selfie", "proof.png", []byte("png"))
+	req, _ := http.NewRequest("POST", "/documents", body)
+	req.Header.Set("Content-Type", ct)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestUploadDocument_ErrorStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := map[string]struct {
+		err  error
+		want int
+	}{
+		"rejected content": {fmt.Errorf("%w: content type text/plain is not allowed", service.ErrInvalidDocument), http.StatusBadRequest},
+		"storage failure":  {errors.New("store document: connection reset"), http.StatusInternalServerError},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ms := new(mock_loan_service.MockDocumentService)
+			ms.On("Upload", mock.Anything, domain.DocumentKindApprovalProof, "proof.png", mock.Anything, int64(3)).Return(nil, tc.err).Once()
+			r := gin.New()
+			handler.NewDocumentHandler(ms, 1<<20).RegisterRoutes(r)
+
+			body, ct := multipartBody(t, "approval_proof", "proof.png", []byte("png"))
+			req, _ := http.NewRequest("POST", "/documents", body)
+			req.Header.Set("Content-Type", ct)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.want, w.Code)
+			ms.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUploadDocument_TooLarge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ms := new(mock_loan_service.MockDocumentService)
+	r := gin.New()
+	handler.NewDocumentHandler(ms, 1024).RegisterRoutes(r)
+
+	body, ct := multipartBody(t, "approval_proof", "proof.png", bytes.Repeat([]byte("x"), 4096))
+	req, _ := http.NewRequest("POST", "/documents", body)
+	req.Header.Set("Content-Type", ct)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestDownloadDocument_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ms := new(mock_loan_service.MockDocumentService)
+	doc := &domain.Document{ID: "DOC1", FileName: "signed.pdf", ContentType: "application/pdf", Size: 8, SHA256: "abc"}
+	ms.On("OpenDocument", mock.Anything, "DOC1").Return(doc, io.NopCloser(strings.NewReader("%PDF-1.4")), nil).Once()
+
+	r := gin.New()
+	handler.NewDocumentHandler(ms, 1<<20).RegisterRoutes(r)
+
+	req, _ := http.NewRequest("GET", "/documents/DOC1/content", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Equal(t, `"abc"`, w.Header().Get("ETag"))
+	assert.Equal(t, "%PDF-1.4", w.Body.String())
+	ms.AssertExpectations(t)
+}
+
+func TestDownloadDocument_ServesUploadsAsAttachments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ms := new(mock_loan_service.MockDocumentService)
+	name := `proof"; filename="x.html`
+	doc := &domain.Document{ID: "DOC1", FileName: name, ContentType: "text/html", Size: 6, SHA256: "abc"}
+	ms.On("OpenDocument", mock.Anything, "DOC1").Return(doc, io.NopCloser(strings.NewReader("<html>")), nil).Once()
+
+	r := gin.New()
+	handler.NewDocumentHandler(ms, 1<<20).RegisterRoutes(r)
+
+	req, _ := http.NewRequest("GET", "/documents/DOC1/content", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	disposition, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+	require.NoError(t, err)
+	assert.Equal(t, "attachment", disposition)
+	assert.Equal(t, name, params["filename"])
+}
+
+func TestGetDocument_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ms := new(mock_loan_service.MockDocumentService)
+	ms.On("GetDocument", mock.Anything, "DOC404").Return(nil, repository.ErrNotFound).Once()
+
+	r := gin.New()
+	handler.NewDocumentHandler(ms, 1<<20).RegisterRoutes(r)
+
+	req, _ := http.NewRequest("GET", "/documents/DOC404", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	ms.AssertExpectations(t)
+}
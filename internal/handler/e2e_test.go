@@ -0,0 +1,612 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/handler"
+	"loan_service/internal/repository/memory"
+	"loan_service/internal/service"
+	"loan_service/internal/storage"
+)
+
+// pngHeader is enough content for an upload to be sniffed as a PNG.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n0000")
+
+// newMemoryRouter wires the real services to the in-memory store. The
+// catalog holds the product "STD", offering loans of 100 to 100000 at
+// rates and ROIs of up to 50% over 6 or 12 months.
+func newMemoryRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	blobs, err := storage.NewFSStore(t.TempDir())
+	require.NoError(t, err)
+	store := memory.NewStore()
+	docs := service.NewDocumentService(store, blobs)
+	ledger := service.NewLedgerService(store)
+
+	loans := service.NewLoanService(store, service.WithLedger(ledger), service.WithAutoInvest(store))
+	products := service.NewProductService(store, nil)
+	_, err = products.CreateProduct(context.Background(), domain.LoanProduct{
+		Code: "STD", Name: "Standard", TenorMonths: []int{6, 12}, RepaymentFrequency: domain.RepaymentMonthly,
+		MinPrincipal: 100, MaxPrincipal: 100000, MaxRate: 50, MaxROI: 50,
+	})
+	require.NoError(t, err)
+
+	r := gin.New()
+	handler.NewLoanHandler(loans).RegisterRoutes(r)
+	handler.NewMarketHandler(loans).RegisterRoutes(r)
+	handler.NewDocumentHandler(docs, 1<<20).RegisterRoutes(r)
+	handler.NewInvestorHandler(service.NewInvestorService(store, ledger)).RegisterRoutes(r)
+	handler.NewAutoInvestHandler(service.NewAutoInvestService(store)).RegisterRoutes(r)
+	handler.NewLedgerHandler(ledger).RegisterRoutes(r)
+	handler.NewProductHandler(products).RegisterRoutes(r)
+	return r
+}
+
+func doJSON(t *testing.T, r http.Handler, method, path string, body any, out any) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if out != nil {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), out), w.Body.String())
+	}
+	return w.Code
+}
+
+func upload(t *testing.T, r http.Handler, kind string) string {
+	t.Helper()
+	body, ct := multipartBody(t, kind, "file.png", pngHeader)
+	req := httptest.NewRequest(http.MethodPost, "/documents", body)
+	req.Header.Set("Content-Type", ct)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var doc domain.Document
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	return doc.ID
+}
+
+func TestLoanLifecycle_InMemory(t *testing.T) {
+	r := newMemoryRouter(t)
+
+	var loan domain.Loan
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/loans",
+		map[string]any{"borrower_id": "BRW", "principal": 1000, "rate": 10, "roi": 8, "product_code": "STD", "tenor_months": 12}, &loan))
+	path := "/loans/" + loan.ID
+
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/approve", map[string]any{
+		"picture_document_id": upload(t, r, "approval_proof"),
+		"employee_id":         "EMP1",
+		"approval_date":       "2024-01-02T00:00:00Z",
+	}, &loan))
+	assert.Equal(t, domain.LoanStateApproved, loan.State)
+
+	var ann domain.Investor
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/investors",
+		map[string]any{"name": "Ann", "email": "ann@example.com"}, &ann))
+	assert.Equal(t, http.StatusConflict, doJSON(t, r, http.MethodPost, "/investors",
+		map[string]any{"name": "Ann", "email": "ann@example.com"}, nil))
+	var wallet domain.Wallet
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, "/investors/"+ann.ID+"/wallet/top-ups",
+		map[string]any{"amount": 1000, "reference": "TRX-1"}, &wallet))
+	assert.Equal(t, 1000.0, wallet.Balance)
+
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_id": ann.ID, "amount": 600}, nil))
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_name": "Bob", "investor_email": "bob@example.com", "amount": 400}, nil),
+		"a new investor has no funds")
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_email": "ann@example.com", "amount": 400}, &loan))
+	assert.Equal(t, domain.LoanStateInvested, loan.State)
+	require.Len(t, loan.Investments, 2)
+	assert.Equal(t, loan.Investments[0].InvestorID, loan.Investments[1].InvestorID)
+
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/disburse", map[string]any{
+		"agreement_document_id": upload(t, r, "signed_agreement"),
+		"employee_id":           "EMP2",
+		"disbursement_date":     "2024-02-01T00:00:00Z",
+	}, nil))
+
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, path, nil, &loan))
+	assert.Equal(t, domain.LoanStateDisbursed, loan.State)
+	require.NotNil(t, loan.Approval)
+	require.NotNil(t, loan.Disbursement)
+	assert.Equal(t, "EMP2", loan.Disbursement.EmployeeID)
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, path+"/repay", map[string]any{"amount": 1000}, nil))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/repay", map[string]any{"amount": 1100}, &loan))
+	assert.Equal(t, domain.LoanStateRepaid, loan.State)
+
+	// The investor got their 1000 back with 8% and the platform kept
+	// the remaining 20 of interest; the escrow is empty.
+	balances := map[domain.AccountType]float64{}
+	var accounts []domain.AccountBalance
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, "/ledger/accounts", nil, &accounts))
+	for _, a := range accounts {
+		balances[a.Type] += a.Balance
+	}
+	assert.Equal(t, map[domain.AccountType]float64{
+		domain.AccountTypeExternal:        -1000,
+		domain.AccountTypeInvestorWallet:  1080,
+		domain.AccountTypeLoanEscrow:      0,
+		domain.AccountTypeBorrower:        -100,
+		domain.AccountTypePlatformRevenue: 20,
+	}, balances)
+	var check struct {
+		Balanced bool    `json:"balanced"`
+		Debits   float64 `json:"debits"`
+	}
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, "/ledger/check", nil, &check))
+	assert.True(t, check.Balanced)
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodGet, "/ledger/accounts?type=bogus", nil, nil))
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodGet, "/ledger/accounts/missing", nil, nil))
+
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, "/investors/"+ann.ID+"/wallet", nil, &wallet))
+	assert.Equal(t, 1080.0, wallet.Balance)
+	var history []domain.AccountEntry
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, "/investors/"+ann.ID+"/wallet/transactions?limit=2", nil, &history))
+	require.Len(t, history, 2)
+	assert.Equal(t, domain.JournalKindPayout, history[0].Kind)
+	assert.Equal(t, 1080.0, history[0].Amount)
+
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodGet, "/loans/missing", nil, nil))
+}
+
+func TestWallet_InMemory(t *testing.T) {
+	r := newMemoryRouter(t)
+
+	var ann domain.Investor
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/investors",
+		map[string]any{"name": "Ann", "email": "ann@example.com"}, &ann))
+	wallet := "/investors/" + ann.ID + "/wallet"
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, wallet+"/top-ups", map[string]any{"amount": 500}, nil))
+
+	var loan domain.Loan
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/loans",
+		map[string]any{"borrower_id": "BRW", "principal": 1000, "rate": 10, "roi": 8, "product_code": "STD", "tenor_months": 12}, &loan))
+	path := "/loans/" + loan.ID
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/approve", map[string]any{
+		"picture_document_id": upload(t, r, "approval_proof"),
+		"employee_id":         "EMP1",
+		"approval_date":       "2024-01-02T00:00:00Z",
+	}, nil))
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_id": ann.ID, "amount": 600}, nil))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_id": ann.ID, "amount": 300}, nil))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_id": ann.ID, "amount": 100}, &loan))
+	require.Len(t, loan.Investments, 2)
+
+	var balance domain.Wallet
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, wallet+"/withdrawals", map[string]any{"amount": 250}, nil))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, wallet+"/withdrawals", map[string]any{"amount": 50}, &balance))
+	assert.Equal(t, 50.0, balance.Balance)
+
+	// Cancelling an investment refunds it and frees the amount.
+	var refund domain.Refund
+	investment := path + "/investments/" + loan.Investments[1].ID
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodDelete, investment, nil, &refund))
+	assert.Equal(t, 100.0, refund.Amount)
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodDelete, investment, nil, nil))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, wallet, nil, &balance))
+	assert.Equal(t, 150.0, balance.Balance)
+
+	// Cancelling the loan refunds the remaining investment.
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/cancel", nil, &loan))
+	assert.Equal(t, domain.LoanStateCancelled, loan.State)
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, path+"/cancel", nil, nil))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, wallet, nil, &balance))
+	assert.Equal(t, 450.0, balance.Balance)
+	var refunds []domain.Refund
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, path+"/refunds", nil, &refunds))
+	require.Len(t, refunds, 2)
+	assert.Equal(t, domain.RefundReasonInvestmentCancelled, refunds[0].Reason)
+	assert.Equal(t, domain.RefundReasonLoanCancelled, refunds[1].Reason)
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodDelete, path+"/investments/"+loan.Investments[0].ID, nil, nil),
+		"a closed loan's investments cannot be cancelled")
+
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodGet, "/investors/missing/wallet", nil, nil))
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodGet, wallet+"/transactions?limit=0", nil, nil))
+}
+
+func TestPartialFill_InMemory(t *testing.T) {
+	r := newMemoryRouter(t)
+
+	var ann domain.Investor
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/investors",
+		map[string]any{"name": "Ann", "email": "ann@example.com"}, &ann))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, "/investors/"+ann.ID+"/wallet/top-ups",
+		map[string]any{"amount": 2000}, nil))
+
+	var loan domain.Loan
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/loans",
+		map[string]any{"borrower_id": "BRW", "principal": 1000, "rate": 10, "roi": 8, "product_code": "STD", "tenor_months": 12}, &loan))
+	path := "/loans/" + loan.ID
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/approve", map[string]any{
+		"picture_document_id": upload(t, r, "approval_proof"),
+		"employee_id":         "EMP1",
+		"approval_date":       "2024-01-02T00:00:00Z",
+	}, nil))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_id": ann.ID, "amount": 700}, nil))
+
+	var funding domain.Funding
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, path+"/funding", nil, &funding))
+	assert.Equal(t, domain.Funding{
+		LoanID:        loan.ID,
+		State:         domain.LoanStateApproved,
+		Principal:     1000,
+		TotalInvested: 700,
+		Remaining:     300,
+		InvestorCount: 1,
+		PercentFunded: 70,
+	}, funding)
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_id": ann.ID, "amount": 500}, nil), "exact is the default")
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_id": ann.ID, "amount": 500, "fill_mode": "most"}, nil))
+	var res struct {
+		domain.Loan
+		Investment      domain.Investment `json:"investment"`
+		RequestedAmount float64           `json:"requested_amount"`
+		AcceptedAmount  float64           `json:"accepted_amount"`
+	}
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_id": ann.ID, "amount": 500, "fill_mode": "partial"}, &res))
+	assert.Equal(t, 500.0, res.RequestedAmount)
+	assert.Equal(t, 300.0, res.AcceptedAmount)
+	assert.Equal(t, 300.0, res.Investment.Amount)
+	assert.Equal(t, domain.LoanStateInvested, res.State)
+
+	var wallet domain.Wallet
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, "/investors/"+ann.ID+"/wallet", nil, &wallet))
+	assert.Equal(t, 1000.0, wallet.Balance, "only the accepted amount is spent")
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, path+"/funding", nil, &funding))
+	assert.Equal(t, 0.0, funding.Remaining)
+	assert.Equal(t, 100.0, funding.PercentFunded)
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_id": ann.ID, "amount": 100, "fill_mode": "partial"}, nil),
+		"a funded loan takes no partial fill")
+
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodGet, "/loans/missing/funding", nil, nil))
+}
+
+func TestReservations_InMemory(t *testing.T) {
+	r := newMemoryRouter(t)
+
+	var ann, bob domain.Investor
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/investors",
+		map[string]any{"name": "Ann", "email": "ann@example.com"}, &ann))
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/investors",
+		map[string]any{"name": "Bob", "email": "bob@example.com"}, &bob))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, "/investors/"+bob.ID+"/wallet/top-ups",
+		map[string]any{"amount": 1000}, nil))
+
+	var loan domain.Loan
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/loans",
+		map[string]any{"borrower_id": "BRW", "principal": 1000, "rate": 10, "roi": 8, "product_code": "STD", "tenor_months": 12}, &loan))
+	path := "/loans/" + loan.ID
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/approve", map[string]any{
+		"picture_document_id": upload(t, r, "approval_proof"),
+		"employee_id":         "EMP1",
+		"approval_date":       "2024-01-02T00:00:00Z",
+	}, nil))
+
+	// Ann holds 600 while she pays; Bob can only take what is left.
+	var held domain.Reservation
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, path+"/reservations",
+		map[string]any{"investor_id": ann.ID, "amount": 600, "ttl_minutes": 5}, &held))
+	assert.Equal(t, domain.ReservationStateHeld, held.State)
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, path+"/reservations",
+		map[string]any{"investor_id": ann.ID, "amount": 100, "ttl_minutes": 600}, nil), "longer than RESERVATION_TTL")
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodPost, path+"/reservations",
+		map[string]any{"investor_id": "missing", "amount": 100}, nil))
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_id": bob.ID, "amount": 500}, nil))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_id": bob.ID, "amount": 400}, nil))
+	var funding domain.Funding
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, path+"/funding", nil, &funding))
+	assert.Equal(t, 600.0, funding.Reserved)
+	assert.Zero(t, funding.Remaining)
+
+	reservation := path + "/reservations/" + held.ID
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, reservation+"/confirm", nil, nil),
+		"Ann's wallet is still empty")
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, "/investors/"+ann.ID+"/wallet/top-ups",
+		map[string]any{"amount": 600}, nil))
+	var res struct {
+		domain.Loan
+		Investment     domain.Investment `json:"investment"`
+		AcceptedAmount float64           `json:"accepted_amount"`
+	}
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, reservation+"/confirm", nil, &res))
+	assert.Equal(t, 600.0, res.AcceptedAmount)
+	assert.Equal(t, ann.ID, res.Investment.InvestorID)
+	assert.Equal(t, domain.LoanStateInvested, res.State)
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, reservation+"/confirm", nil, nil))
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodDelete, reservation, nil, nil))
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodPost, path+"/reservations/missing/confirm", nil, nil))
+}
+
+func TestKYC_InMemory(t *testing.T) {
+	r := newMemoryRouter(t)
+
+	var ann domain.Investor
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/investors",
+		map[string]any{"name": "Ann", "email": "ann@example.com"}, &ann))
+	assert.Equal(t, domain.KYCStatusPending, ann.KYC.Status)
+	kyc := "/investors/" + ann.ID + "/kyc"
+	submission := map[string]any{
+		"full_name":     "Ann Smith",
+		"id_number":     "3171234567890001",
+		"date_of_birth": "1990-05-17",
+		"address":       "Jl. Sudirman 1, Jakarta",
+		"document_id":   upload(t, r, "identity_document"),
+	}
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, kyc+"/review",
+		map[string]any{"status": "verified", "employee_id": "EMP1"}, nil), "nothing submitted yet")
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, kyc, submission, &ann))
+	require.NotNil(t, ann.KYC.DateOfBirth)
+	assert.Equal(t, "1990-05-17", ann.KYC.DateOfBirth.Format(time.DateOnly))
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, kyc+"/review",
+		map[string]any{"status": "approved", "employee_id": "EMP1"}, nil))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, kyc+"/review",
+		map[string]any{"status": "verified", "employee_id": "EMP1"}, &ann))
+	assert.Equal(t, domain.KYCStatusVerified, ann.KYC.Status)
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, "/investors/"+ann.ID, nil, &ann))
+	assert.True(t, ann.Verified())
+
+	submission["date_of_birth"] = "17/05/1990"
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, kyc, submission, nil))
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodPost, "/investors/missing/kyc/review",
+		map[string]any{"status": "verified", "employee_id": "EMP1"}, nil))
+}
+
+func TestAutoInvest_InMemory(t *testing.T) {
+	r := newMemoryRouter(t)
+
+	var ann domain.Investor
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/investors",
+		map[string]any{"name": "Ann", "email": "ann@example.com"}, &ann))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, "/investors/"+ann.ID+"/wallet/top-ups", map[string]any{"amount": 1000}, nil))
+	rules := "/investors/" + ann.ID + "/auto-invest"
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodGet, rules, nil, nil))
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPut, rules,
+		map[string]any{"max_per_loan": 300, "max_risk_grade": "Z"}, nil))
+	var rule domain.AutoInvestRule
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPut, rules,
+		map[string]any{"min_roi": 8, "max_per_loan": 300, "daily_budget": 500, "max_risk_grade": "B"}, &rule))
+	assert.True(t, rule.Active)
+
+	approve := func(grade string) domain.Loan {
+		var loan domain.Loan
+		require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/loans",
+			map[string]any{"borrower_id": "BRW", "principal": 1000, "rate": 12, "roi": 10, "risk_grade": grade, "product_code": "STD", "tenor_months": 12}, &loan))
+		require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, "/loans/"+loan.ID+"/approve", map[string]any{
+			"picture_document_id": upload(t, r, "approval_proof"),
+			"employee_id":         "EMP1",
+			"approval_date":       "2024-01-02T00:00:00Z",
+		}, &loan))
+		return loan
+	}
+	loan := approve("A")
+	require.Len(t, loan.Investments, 1)
+	assert.Equal(t, 300.0, loan.Investments[0].Amount)
+	assert.Equal(t, rule.ID, *loan.Investments[0].AutoInvestRuleID)
+	assert.Empty(t, approve("C").Investments, "the risk grade is worse than the rule allows")
+	loan = approve("B")
+	require.Len(t, loan.Investments, 1)
+	assert.Equal(t, 200.0, loan.Investments[0].Amount, "limited by the daily budget")
+
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodDelete, rules, nil, &rule))
+	assert.False(t, rule.Active)
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, "/loans",
+		map[string]any{"borrower_id": "BRW", "principal": 1000, "rate": 12, "roi": 10, "risk_grade": "F", "product_code": "STD", "tenor_months": 12}, nil))
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodDelete, "/investors/missing/auto-invest", nil, nil))
+}
+
+func TestSecondaryMarket_InMemory(t *testing.T) {
+	r := newMemoryRouter(t)
+
+	investor := func(name string) domain.Investor {
+		var inv domain.Investor
+		require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/investors",
+			map[string]any{"name": name, "email": name + "@example.com"}, &inv))
+		require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, "/investors/"+inv.ID+"/wallet/top-ups", map[string]any{"amount": 1000}, nil))
+		return inv
+	}
+	ann, bob := investor("ann"), investor("bob")
+	var loan domain.Loan
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/loans",
+		map[string]any{"borrower_id": "BRW", "principal": 1000, "rate": 10, "roi": 8, "product_code": "STD", "tenor_months": 12}, &loan))
+	path := "/loans/" + loan.ID
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/approve", map[string]any{
+		"picture_document_id": upload(t, r, "approval_proof"),
+		"employee_id":         "EMP1",
+		"approval_date":       "2024-01-02T00:00:00Z",
+	}, nil))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/invest",
+		map[string]any{"investor_id": ann.ID, "amount": 1000}, &loan))
+	listings := path + "/investments/" + loan.Investments[0].ID + "/listings"
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, listings, map[string]any{"amount": 500, "price": 480}, nil))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/disburse", map[string]any{
+		"agreement_document_id": upload(t, r, "signed_agreement"),
+		"employee_id":           "EMP2",
+		"disbursement_date":     "2024-02-01T00:00:00Z",
+	}, nil))
+
+	var listing domain.Listing
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, listings, map[string]any{"amount": 500, "price": 480}, &listing))
+	var open []domain.Listing
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, "/listings?state=open&loan_id="+loan.ID, nil, &open))
+	require.Len(t, open, 1)
+	assert.Equal(t, listing.ID, open[0].ID)
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodGet, "/listings?state=closed", nil, nil))
+
+	buy := "/listings/" + listing.ID + "/buy"
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodPost, buy, map[string]any{"investor_id": "missing"}, nil))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, buy, map[string]any{"investor_id": bob.ID}, &listing))
+	assert.Equal(t, domain.ListingStateSold, listing.State)
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodDelete, "/listings/"+listing.ID, nil, nil))
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodGet, "/listings/missing", nil, nil))
+
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, path, nil, &loan))
+	require.Len(t, loan.Investments, 2)
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, path+"/repay", map[string]any{"amount": 1100}, nil))
+	for inv, want := range map[string]float64{ann.ID: 1000 - 1000 + 480 + 540, bob.ID: 1000 - 480 + 540} {
+		var wallet domain.Wallet
+		require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, "/investors/"+inv+"/wallet", nil, &wallet))
+		assert.Equal(t, want, wallet.Balance)
+	}
+}
+
+func TestPortfolio_InMemory(t *testing.T) {
+	r := newMemoryRouter(t)
+
+	var ann domain.Investor
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/investors",
+		map[string]any{"name": "Ann", "email": "ann@example.com"}, &ann))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, "/investors/"+ann.ID+"/wallet/top-ups", map[string]any{"amount": 1000}, nil))
+	var loan domain.Loan
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/loans",
+		map[string]any{"borrower_id": "BRW", "principal": 1000, "rate": 10, "roi": 8, "product_code": "STD", "tenor_months": 12}, &loan))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, "/loans/"+loan.ID+"/approve", map[string]any{
+		"picture_document_id": upload(t, r, "approval_proof"),
+		"employee_id":         "EMP1",
+		"approval_date":       "2024-01-02T00:00:00Z",
+	}, nil))
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, "/loans/"+loan.ID+"/invest",
+		map[string]any{"investor_id": ann.ID, "amount": 250}, nil))
+
+	path := "/investors/" + ann.ID + "/portfolio"
+	var p domain.Portfolio
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, path, nil, &p))
+	assert.Equal(t, 250.0, p.PrincipalDeployed)
+	assert.Equal(t, 20.0, p.ExpectedReturn)
+	assert.Equal(t, 250.0, p.OutstandingPrincipal)
+	require.Len(t, p.ByState, 1)
+	assert.Equal(t, domain.LoanStateApproved, p.ByState[0].State)
+
+	req := httptest.NewRequest(http.MethodGet, path+"?format=csv", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	assert.Equal(t, "loan_id,state,roi,principal,amount_paid,expected_return,realized_payouts,outstanding_principal,refunded\n"+
+		loan.ID+",approved,8,250.00,250.00,20.00,0.00,250.00,0.00\n", w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodGet, path+"?format=xml", nil, nil))
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodGet, "/investors/missing/portfolio", nil, nil))
+}
+
+func TestProducts_InMemory(t *testing.T) {
+	r := newMemoryRouter(t)
+	terms := map[string]any{
+		"name": "Micro loan", "tenor_months": []int{6, 12}, "repayment_frequency": "weekly",
+		"min_principal": 500, "max_principal": 5000, "min_rate": 8, "max_rate": 15, "min_roi": 6, "max_roi": 12,
+		"origination_fee": 2, "late_fee": 10,
+	}
+
+	create := map[string]any{"code": "MICRO"}
+	for k, v := range terms {
+		create[k] = v
+	}
+	var v1 domain.LoanProduct
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/admin/products", create, &v1))
+	assert.Equal(t, 1, v1.Version)
+	assert.Equal(t, http.StatusConflict, doJSON(t, r, http.MethodPost, "/admin/products", create, nil))
+	create["repayment_frequency"] = "daily"
+	create["code"] = "OTHER"
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, "/admin/products", create, nil))
+
+	loanBody := func(principal float64, tenor int) map[string]any {
+		return map[string]any{"borrower_id": "BRW", "principal": principal, "rate": 10, "roi": 8, "product_code": "MICRO", "tenor_months": tenor}
+	}
+	var loan domain.Loan
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/loans", loanBody(1000, 6), &loan))
+	require.NotNil(t, loan.ProductID)
+	assert.Equal(t, v1.ID, *loan.ProductID)
+	assert.Equal(t, "MICRO", loan.ProductCode)
+	assert.Equal(t, 6, loan.TenorMonths)
+
+	var body map[string]any
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, "/loans", loanBody(8000, 6), &body))
+	assert.Equal(t, "product_terms", body["code"])
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, "/loans", loanBody(1000, 9), nil))
+	unknown := loanBody(1000, 6)
+	unknown["product_code"] = "NONE"
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, "/loans", unknown, nil))
+	delete(unknown, "product_code")
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, "/loans", unknown, nil))
+
+	// A new version applies to new loans only.
+	terms["max_principal"] = 10000
+	terms["tenor_months"] = []int{9}
+	var v2 domain.LoanProduct
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/admin/products/MICRO/versions", terms, &v2))
+	assert.Equal(t, 2, v2.Version)
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodPost, "/admin/products/NONE/versions", terms, nil))
+	var second domain.Loan
+	require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/loans", loanBody(8000, 9), &second))
+	assert.Equal(t, v2.ID, *second.ProductID)
+	var first domain.Loan
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, "/loans/"+loan.ID, nil, &first))
+	assert.Equal(t, v1.ID, *first.ProductID)
+
+	var latest domain.LoanProduct
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, "/products/MICRO", nil, &latest))
+	assert.Equal(t, 2, latest.Version)
+	var old domain.LoanProduct
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, "/products/MICRO/versions/1", nil, &old))
+	assert.Equal(t, []int{6, 12}, old.TenorMonths)
+	var versions []domain.LoanProduct
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, "/products/MICRO/versions", nil, &versions))
+	assert.Len(t, versions, 2)
+	var products []domain.LoanProduct
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodGet, "/products", nil, &products))
+	require.Len(t, products, 2)
+	assert.Equal(t, "MICRO", products[0].Code)
+	assert.Equal(t, "STD", products[1].Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodGet, "/products/NONE", nil, nil))
+	assert.Equal(t, http.StatusNotFound, doJSON(t, r, http.MethodGet, "/products/MICRO/versions/3", nil, nil))
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodGet, "/products/MICRO/versions/x", nil, nil))
+}
+
+func TestDocumentAttachedOnce_InMemory(t *testing.T) {
+	r := newMemoryRouter(t)
+	proof := upload(t, r, "approval_proof")
+	approve := map[string]any{"picture_document_id": proof, "employee_id": "EMP1", "approval_date": "2024-01-02T00:00:00Z"}
+
+	var first, second domain.Loan
+	for _, loan := range []*domain.Loan{&first, &second} {
+		require.Equal(t, http.StatusCreated, doJSON(t, r, http.MethodPost, "/loans",
+			map[string]any{"borrower_id": "BRW", "principal": 1000, "rate": 10, "roi": 8, "product_code": "STD", "tenor_months": 12}, loan))
+	}
+	require.Equal(t, http.StatusOK, doJSON(t, r, http.MethodPost, "/loans/"+first.ID+"/approve", approve, nil))
+	var body map[string]any
+	assert.Equal(t, http.StatusBadRequest, doJSON(t, r, http.MethodPost, "/loans/"+second.ID+"/approve", approve, &body))
+	assert.Contains(t, body["error"], "already attached to a loan")
+}
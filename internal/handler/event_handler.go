@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"loan_service/internal/domain"
+
+	"github.com/gin-gonic/gin"
+)
+
+// heartbeatInterval is how often an SSE comment is written to idle
+// streams so that proxies and load balancers keep the connection open.
+const heartbeatInterval = 15 * time.Second
+
+// EventStream abstracts the event bus for the SSE handler. The
+// concrete implementation is events.Bus.
+type EventStream interface {
+	Subscribe(loanID string) (<-chan domain.LoanEvent, func())
+	Replay(ctx context.Context, loanID string, afterID int64, fn func(domain.LoanEvent) error) error
+}
+
+// EventHandler streams loan events to clients using Server-Sent
+// Events.
+type EventHandler struct {
+	stream EventStream
+}
+
+// NewEventHandler constructs a new EventHandler.
+func NewEventHandler(stream EventStream) *EventHandler { return &EventHandler{stream: stream} }
+
+// RegisterRoutes registers the event stream routes on the given Gin
+// engine.
+func (h *EventHandler) RegisterRoutes(r *gin.Engine) {
+	r.GET("/events", h.streamAll)
+	r.GET("/loans/:id/events", h.streamLoan)
+}
+
+// streamAll handles GET /events. It streams events for every loan.
+func (h *EventHandler) streamAll(c *gin.Context) { h.serve(c, "") }
+
+// streamLoan handles GET /loans/:id/events. It streams events for a
+// single loan.
+func (h *EventHandler) streamLoan(c *gin.Context) { h.serve(c, c.Param("id")) }
+
+// serve writes the event stream for loanID. Clients resuming a stream
+// send the last event ID they received either in the standard
+// Last-Event-ID header or, because browsers cannot set headers on the
+// initial EventSource request, in the last_event_id query parameter.
+// Missed events are replayed from storage before live delivery
+// continues.
+func (h *EventHandler) serve(c *gin.Context, loanID string) {
+	lastID, err := lastEventID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID; must be an integer"})
+		return
+	}
+	ctx := c.Request.Context()
+
+	// Subscribe before replaying so that events appended while the
+	// replay runs are buffered rather than lost. Events already sent
+	// during the replay are skipped by comparing sequence IDs, which
+	// the bus guarantees are committed and delivered in ascending
+	// order.
+	live, cancel := h.stream.Subscribe(loanID)
+	defer cancel()
+
+	// Streams are meant to outlive the server's write timeout. The
+	// error is ignored for writers that do not support deadlines.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	send := func(ev domain.LoanEvent) error {
+		if ev.ID <= lastID {
+			return nil
+		}
+		if err := writeEvent(c.Writer, ev); err != nil {
+			return err
+		}
+		lastID = ev.ID
+		return nil
+	}
+	if lastID > 0 {
+		if err := h.stream.Replay(ctx, loanID, lastID, send); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-live:
+			if !ok {
+				return
+			}
+			if err := send(ev); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// writeEvent writes a single SSE frame and flushes it to the client.
+func writeEvent(w gin.ResponseWriter, ev domain.LoanEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
+
+// lastEventID returns the sequence ID the client has already seen or
+// zero for a fresh stream.
+func lastEventID(c *gin.Context) (int64, error) {
+	v := c.GetHeader("Last-Event-ID")
+	if v == "" {
+		v = c.Query("last_event_id")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
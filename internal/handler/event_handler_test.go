@@ -0,0 +1,114 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/handler"
+)
+
+// fakeStream serves a fixed replay log and a pre-filled live channel
+// that is closed once drained, which ends the SSE response.
+type fakeStream struct {
+	stored     []domain.LoanEvent
+	live       []domain.LoanEvent
+	subscribed string
+	replayedAt int64
+}
+
+func (f *fakeStream) Subscribe(loanID string) (<-chan domain.LoanEvent, func()) {
+	f.subscribed = loanID
+	ch := make(chan domain.LoanEvent, len(f.live))
+	for _, ev := range f.live {
+		ch <- ev
+	}
+	close(ch)
+	return ch, func() {}
+}
+
+func (f *fakeStream) Replay(_ context.Context, loanID string, afterID int64, fn func(domain.LoanEvent) error) error {
+	f.replayedAt = afterID
+	for _, ev := range f.stored {
+		if ev.ID > afterID && ev.LoanID == loanID {
+			if err := fn(ev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestStreamLoanEvents_ReplaysThenStreamsLive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	stream := &fakeStream{
+		stored: []domain.LoanEvent{
+			{ID: 3, LoanID: "L1", Type: domain.LoanEventInvestmentAdded},
+			{ID: 4, LoanID: "L1", Type: domain.LoanEventStateChanged},
+		},
+		// Event 4 is also delivered live because it was published
+		// while the replay ran; it must only be written once.
+		live: []domain.LoanEvent{
+			{ID: 4, LoanID: "L1", Type: domain.LoanEventStateChanged},
+			{ID: 5, LoanID: "L1", Type: domain.LoanEventInvestmentAdded},
+		},
+	}
+	r := gin.New()
+	handler.NewEventHandler(stream).RegisterRoutes(r)
+
+	req, _ := http.NewRequest("GET", "/loans/L1/events", nil)
+	req.Header.Set("Last-Event-ID", "2")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "L1", stream.subscribed)
+	assert.Equal(t, int64(2), stream.replayedAt)
+	body := w.Body.String()
+	assert.Equal(t, 3, strings.Count(body, "id: "))
+	assert.Equal(t, 1, strings.Count(body, "id: 4\n"))
+	assert.Contains(t, body, "id: 3\nevent: loan.investment_added\ndata: {")
+	assert.Less(t, strings.Index(body, "id: 3\n"), strings.Index(body, "id: 5\n"))
+}
+
+func TestStreamAllEvents_WithoutLastEventIDSkipsReplay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	stream := &fakeStream{
+		stored: []domain.LoanEvent{{ID: 1, LoanID: "L1"}},
+		live:   []domain.LoanEvent{{ID: 2, LoanID: "L2", Type: domain.LoanEventStateChanged}},
+	}
+	r := gin.New()
+	handler.NewEventHandler(stream).RegisterRoutes(r)
+
+	req, _ := http.NewRequest("GET", "/events", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", stream.subscribed)
+	assert.NotContains(t, w.Body.String(), "id: 1\n")
+	assert.Contains(t, w.Body.String(), "id: 2\n")
+}
+
+func TestStreamEvents_InvalidLastEventID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	handler.NewEventHandler(&fakeStream{}).RegisterRoutes(r)
+
+	req, _ := http.NewRequest("GET", "/events?last_event_id=abc", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthCheck reports whether a dependency is usable. It returns nil
+// when the dependency is healthy.
+type HealthCheck func(ctx context.Context) error
+
+// CheckResult is the outcome of a single readiness check.
+type CheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// HealthResponse is the body returned by the health routes.
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// HealthHandler serves the liveness and readiness probes. Liveness
+// only reports that the process is able to serve requests; readiness
+// additionally runs every registered dependency check and fails while
+// the server is shutting down, so that load balancers stop routing
+// traffic to the instance before it closes its listener.
+type HealthHandler struct {
+	timeout  time.Duration
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+// NewHealthHandler constructs a new HealthHandler. timeout bounds the
+// total time spent on the readiness checks of a single probe.
+func NewHealthHandler(timeout time.Duration) *HealthHandler {
+	return &HealthHandler{timeout: timeout}
+}
+
+// AddCheck registers a readiness check under the given name. Checks
+// must be registered before the routes serve traffic.
+func (h *HealthHandler) AddCheck(name string, check HealthCheck) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// SetDraining marks the instance as shutting down. From then on the
+// readiness probe fails regardless of the dependency checks.
+func (h *HealthHandler) SetDraining() { h.draining.Store(true) }
+
+// RegisterRoutes registers the probe routes on the given Gin engine.
+func (h *HealthHandler) RegisterRoutes(r *gin.Engine) {
+	r.GET("/healthz", h.liveness)
+	r.GET("/readyz", h.readiness)
+}
+
+// liveness handles GET /healthz.
+func (h *HealthHandler) liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// readiness handles GET /readyz. The checks run concurrently and the
+// response lists the result of each one.
+func (h *HealthHandler) readiness(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, HealthResponse{Status: "shutting_down"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+
+	results := make(map[string]CheckResult, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range h.checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := nc.check(ctx)
+			res := CheckResult{Status: "ok", Duration: time.Since(start).String()}
+			if err != nil {
+				res.Status = "error"
+				res.Error = err.Error()
+			}
+			mu.Lock()
+			results[nc.name] = res
+			mu.Unlock()
+		}(nc)
+	}
+	wg.Wait()
+
+	resp := HealthResponse{Status: "ok", Checks: results}
+	code := http.StatusOK
+	for _, res := range results {
+		if res.Status != "ok" {
+			resp.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+			break
+		}
+	}
+	c.JSON(code, resp)
+}
@@ -0,0 +1,83 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"loan_service/internal/handler"
+)
+
+func probe(t *testing.T, h *handler.HealthHandler, path string) (int, handler.HealthResponse) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h.RegisterRoutes(r)
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp handler.HealthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, resp
+}
+
+func TestReadiness_AllChecksPass(t *testing.T) {
+	h := handler.NewHealthHandler(time.Second)
+	h.AddCheck("database", func(context.Context) error { return nil })
+	h.AddCheck("migrations", func(context.Context) error { return nil })
+
+	code, resp := probe(t, h, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", resp.Status)
+	assert.Equal(t, "ok", resp.Checks["database"].Status)
+	assert.Equal(t, "ok", resp.Checks["migrations"].Status)
+}
+
+func TestReadiness_FailingCheckReportsDetail(t *testing.T) {
+	h := handler.NewHealthHandler(time.Second)
+	h.AddCheck("database", func(context.Context) error { return nil })
+	h.AddCheck("event_listener", func(context.Context) error { return errors.New("not connected") })
+
+	code, resp := probe(t, h, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", resp.Status)
+	assert.Equal(t, "ok", resp.Checks["database"].Status)
+	assert.Equal(t, "error", resp.Checks["event_listener"].Status)
+	assert.Equal(t, "not connected", resp.Checks["event_listener"].Error)
+}
+
+func TestReadiness_CheckTimesOut(t *testing.T) {
+	h := handler.NewHealthHandler(10 * time.Millisecond)
+	h.AddCheck("database", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	code, resp := probe(t, h, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, context.DeadlineExceeded.Error(), resp.Checks["database"].Error)
+}
+
+func TestReadiness_FailsWhileDraining(t *testing.T) {
+	h := handler.NewHealthHandler(time.Second)
+	h.AddCheck("database", func(context.Context) error { return nil })
+	h.SetDraining()
+
+	code, resp := probe(t, h, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "shutting_down", resp.Status)
+
+	// Liveness is unaffected so that the process is not restarted
+	// while it drains.
+	code, resp = probe(t, h, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", resp.Status)
+}
@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/repository"
+	"loan_service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultHistoryLimit and maxHistoryLimit bound the number of
+	// wallet movements returned by one request.
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// InvestorUsecase abstracts the investor service for the handler.
+type InvestorUsecase interface {
+	CreateInvestor(ctx context.Context, name, email string) (*domain.Investor, error)
+	GetInvestor(ctx context.Context, id string) (*domain.Investor, error)
+	SubmitKYC(ctx context.Context, investorID string, sub service.KYCSubmission) (*domain.Investor, error)
+	ReviewKYC(ctx context.Context, investorID string, status domain.KYCStatus, reviewerID, reason string) (*domain.Investor, error)
+	Wallet(ctx context.Context, investorID string) (*domain.Wallet, error)
+	TopUp(ctx context.Context, investorID string, amount float64, reference string) (*domain.Wallet, error)
+	Withdraw(ctx context.Context, investorID string, amount float64, reference string) (*domain.Wallet, error)
+	WalletHistory(ctx context.Context, investorID string, limit int) ([]domain.AccountEntry, error)
+	Portfolio(ctx context.Context, investorID string) (*domain.Portfolio, error)
+}
+
+// InvestorHandler defines HTTP handlers for registering investors and
+// managing their wallets.
+type InvestorHandler struct {
+	svc InvestorUsecase
+}
+
+// NewInvestorHandler constructs a new InvestorHandler.
+func NewInvestorHandler(svc InvestorUsecase) *InvestorHandler { return &InvestorHandler{svc: svc} }
+
+// RegisterRoutes registers the investor routes on the given Gin
+// engine.
+func (h *InvestorHandler) RegisterRoutes(r *gin.Engine) {
+	r.POST("/investors", h.createInvestor)
+	r.GET("/investors/:id", h.getInvestor)
+	r.POST("/investors/:id/kyc", h.submitKYC)
+	r.POST("/investors/:id/kyc/review", h.reviewKYC)
+	r.GET("/investors/:id/wallet", h.getWallet)
+	r.POST("/investors/:id/wallet/top-ups", h.topUp)
+	r.POST("/investors/:id/wallet/withdrawals", h.withdraw)
+	r.GET("/investors/:id/wallet/transactions", h.walletHistory)
+	r.GET("/investors/:id/portfolio", h.portfolio)
+}
+
+// createInvestor handles POST /investors. It expects the investor's
+// name and email address.
+func (h *InvestorHandler) createInvestor(c *gin.Context) {
+	var req struct {
+		Name  string `json:"name" binding:"required"`
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	inv, err := h.svc.CreateInvestor(c.Request.Context(), req.Name, req.Email)
+	if err != nil {
+		if errors.Is(err, service.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, inv)
+}
+
+// getInvestor handles GET /investors/:id.
+func (h *InvestorHandler) getInvestor(c *gin.Context) {
+	inv, err := h.svc.GetInvestor(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		investorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, inv)
+}
+
+// submitKYC handles POST /investors/:id/kyc. It expects the
+// investor's identity data, with the date of birth as YYYY-MM-DD, and
+// the ID of an identity_document uploaded via POST /documents, and
+// returns the investor with the KYC status pending.
+func (h *InvestorHandler) submitKYC(c *gin.Context) {
+	var req struct {
+		FullName    string `json:"full_name" binding:"required"`
+		IDNumber    string `json:"id_number" binding:"required"`
+		DateOfBirth string `json:"date_of_birth" binding:"required"`
+		Address     string `json:"address" binding:"required"`
+		DocumentID  string `json:"document_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	dob, err := time.Parse(time.DateOnly, req.DateOfBirth)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date_of_birth; must be YYYY-MM-DD"})
+		return
+	}
+	inv, err := h.svc.SubmitKYC(c.Request.Context(), c.Param("id"), service.KYCSubmission{
+		FullName:    req.FullName,
+		IDNumber:    req.IDNumber,
+		DateOfBirth: dob,
+		Address:     req.Address,
+		DocumentID:  req.DocumentID,
+	})
+	if err != nil {
+		investorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, inv)
+}
+
+// reviewKYC handles POST /investors/:id/kyc/review. Staff verify or
+// reject the submitted identity data; a rejection requires a reason.
+func (h *InvestorHandler) reviewKYC(c *gin.Context) {
+	var req struct {
+		Status     domain.KYCStatus `json:"status" binding:"required"`
+		EmployeeID string           `json:"employee_id" binding:"required"`
+		Reason     string           `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	inv, err := h.svc.ReviewKYC(c.Request.Context(), c.Param("id"), req.Status, req.EmployeeID, req.Reason)
+	if err != nil {
+		investorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, inv)
+}
+
+// getWallet handles GET /investors/:id/wallet. It returns the balance
+// available for investing.
+func (h *InvestorHandler) getWallet(c *gin.Context) {
+	wallet, err := h.svc.Wallet(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		investorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, wallet)
+}
+
+// walletRequest is the body of top-up and withdrawal requests.
+// Reference identifies the payment outside the platform, such as a
+// bank transfer ID.
+type walletRequest struct {
+	Amount    float64 `json:"amount" binding:"required"`
+	Reference string  `json:"reference"`
+}
+
+// topUp handles POST /investors/:id/wallet/top-ups. It credits the
+// wallet with funds received from the investor and returns the new
+// balance.
+func (h *InvestorHandler) topUp(c *gin.Context) {
+	var req walletRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	wallet, err := h.svc.TopUp(c.Request.Context(), c.Param("id"), req.Amount, req.Reference)
+	if err != nil {
+		investorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, wallet)
+}
+
+// withdraw handles POST /investors/:id/wallet/withdrawals. It pays
+// funds out of the wallet and returns the new balance.
+func (h *InvestorHandler) withdraw(c *gin.Context) {
+	var req walletRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	wallet, err := h.svc.Withdraw(c.Request.Context(), c.Param("id"), req.Amount, req.Reference)
+	if err != nil {
+		investorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, wallet)
+}
+
+// walletHistory handles GET /investors/:id/wallet/transactions. It
+// returns the most recent wallet movements, newest first; the optional
+// limit query parameter caps their number.
+func (h *InvestorHandler) walletHistory(c *gin.Context) {
+	limit := defaultHistoryLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxHistoryLimit)})
+			return
+		}
+		limit = n
+	}
+	entries, err := h.svc.WalletHistory(c.Request.Context(), c.Param("id"), limit)
+	if err != nil {
+		investorError(c, err)
+		return
+	}
+	if entries == nil {
+		entries = []domain.AccountEntry{}
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// portfolio handles GET /investors/:id/portfolio. It returns the
+// investor's portfolio summary, or with format=csv downloads their
+// positions as CSV, one row per loan.
+func (h *InvestorHandler) portfolio(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+	p, err := h.svc.Portfolio(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		investorError(c, err)
+		return
+	}
+	if format == "json" {
+		c.JSON(http.StatusOK, p)
+		return
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"loan_id", "state", "roi", "principal", "amount_paid", "expected_return", "realized_payouts", "outstanding_principal", "refunded"})
+	for _, pos := range p.Positions {
+		_ = w.Write([]string{
+			pos.LoanID,
+			string(pos.State),
+			strconv.FormatFloat(pos.ROI, 'f', -1, 64),
+			formatAmount(pos.Principal),
+			formatAmount(pos.AmountPaid),
+			formatAmount(pos.ExpectedReturn),
+			formatAmount(pos.RealizedPayouts),
+			formatAmount(pos.OutstandingPrincipal),
+			formatAmount(pos.Refunded),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="portfolio-`+p.InvestorID+`.csv"`)
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// formatAmount formats an amount of money with two decimals.
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// investorError writes the response for an error of an investor
+// operation: 404 for an unknown investor, 400 for a rejected request,
+// including one referencing an unknown document, and 500 for any other
+// failure.
+func investorError(c *gin.Context, err error) {
+	switch {
+	case err == repository.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "investor not found"})
+	case errors.Is(err, repository.ErrNotFound),
+		errors.Is(err, domain.ErrInsufficientFunds),
+		errors.Is(err, domain.ErrLimitExceeded),
+		errors.Is(err, service.ErrInvalidAmount),
+		errors.Is(err, service.ErrInvalidKYC):
+		c.JSON(http.StatusBadRequest, errorBody(err))
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
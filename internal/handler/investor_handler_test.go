@@ -0,0 +1,82 @@
+package handler_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/handler"
+	mock_loan_service "loan_service/internal/handler/mocks"
+	"loan_service/internal/repository"
+	"loan_service/internal/service"
+)
+
+func TestWithdraw_ErrorStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := map[string]struct {
+		err  error
+		want int
+	}{
+		"unknown investor":   {repository.ErrNotFound, http.StatusNotFound},
+		"insufficient funds": {fmt.Errorf("%w: wallet balance 10.00 is less than 50.00", domain.ErrInsufficientFunds), http.StatusBadRequest},
+		"invalid amount":     {service.ErrInvalidAmount, http.StatusBadRequest},
+		"database failure":   {errors.New("connection reset"), http.StatusInternalServerError},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ms := new(mock_loan_service.MockInvestorService)
+			ms.On("Withdraw", mock.Anything, "INV1", 50.0, "").Return(nil, tc.err).Once()
+
+			r := gin.New()
+			handler.NewInvestorHandler(ms).RegisterRoutes(r)
+
+			req, _ := http.NewRequest("POST", "/investors/INV1/wallet/withdrawals", strings.NewReader(`{"amount":50}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.want, w.Code)
+			ms.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSubmitKYC_ErrorStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := map[string]struct {
+		err  error
+		want int
+	}{
+		"rejected submission": {fmt.Errorf("%w: investor is already verified", service.ErrInvalidKYC), http.StatusBadRequest},
+		"unknown document":    {fmt.Errorf("identity document DOC1: %w", repository.ErrNotFound), http.StatusBadRequest},
+		"database failure":    {errors.New("connection reset"), http.StatusInternalServerError},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ms := new(mock_loan_service.MockInvestorService)
+			ms.On("SubmitKYC", mock.Anything, "INV1", mock.Anything).Return(nil, tc.err).Once()
+
+			r := gin.New()
+			handler.NewInvestorHandler(ms).RegisterRoutes(r)
+
+			body := `{"full_name":"Ann Smith","id_number":"X1","date_of_birth":"1990-05-17","address":"Main St 1","document_id":"DOC1"}`
+			req, _ := http.NewRequest("POST", "/investors/INV1/kyc", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.want, w.Code)
+			ms.AssertExpectations(t)
+		})
+	}
+}
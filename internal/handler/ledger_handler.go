@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LedgerUsecase abstracts the ledger service for the handler.
+type LedgerUsecase interface {
+	GetAccount(ctx context.Context, id string) (*domain.AccountBalance, error)
+	ListBalances(ctx context.Context, filter domain.AccountRef) ([]domain.AccountBalance, error)
+	Check(ctx context.Context) (*domain.LedgerCheck, error)
+}
+
+// LedgerHandler defines HTTP handlers for inspecting ledger account
+// balances and verifying the ledger.
+type LedgerHandler struct {
+	svc LedgerUsecase
+}
+
+// NewLedgerHandler constructs a new LedgerHandler.
+func NewLedgerHandler(svc LedgerUsecase) *LedgerHandler { return &LedgerHandler{svc: svc} }
+
+// RegisterRoutes registers the ledger routes on the given Gin engine.
+func (h *LedgerHandler) RegisterRoutes(r *gin.Engine) {
+	r.GET("/ledger/accounts", h.listAccounts)
+	r.GET("/ledger/accounts/:id", h.getAccount)
+	r.GET("/ledger/check", h.check)
+}
+
+// listAccounts handles GET /ledger/accounts. The optional type and
+// owner_id query parameters filter the accounts returned.
+func (h *LedgerHandler) listAccounts(c *gin.Context) {
+	filter := domain.AccountRef{
+		Type:    domain.AccountType(c.Query("type")),
+		OwnerID: c.Query("owner_id"),
+	}
+	if filter.Type != "" && !filter.Type.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown account type " + string(filter.Type)})
+		return
+	}
+	accounts, err := h.svc.ListBalances(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if accounts == nil {
+		accounts = []domain.AccountBalance{}
+	}
+	c.JSON(http.StatusOK, accounts)
+}
+
+// getAccount handles GET /ledger/accounts/:id. It returns the account
+// with its balance.
+func (h *LedgerHandler) getAccount(c *gin.Context) {
+	account, err := h.svc.GetAccount(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "account not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// check handles GET /ledger/check. It responds with 200 when debits
+// equal credits, in total and within every journal entry, and every
+// account balance matches its postings, and with 500 otherwise, so
+// that it can be polled by monitoring.
+func (h *LedgerHandler) check(c *gin.Context) {
+	check, err := h.svc.Check(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	status := http.StatusOK
+	if !check.Balanced() {
+		status = http.StatusInternalServerError
+	}
+	c.JSON(status, gin.H{
+		"balanced":            check.Balanced(),
+		"debits":              check.Debits,
+		"credits":             check.Credits,
+		"unbalanced_entries":  check.UnbalancedEntries,
+		"mismatched_accounts": check.MismatchedAccounts,
+	})
+}
@@ -2,11 +2,13 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	"loan_service/internal/domain"
 	"loan_service/internal/repository"
+	"loan_service/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,9 +24,18 @@ type LoanHandler struct {
 // to allow mocking in HTTP tests and to decouple layers.
 type LoanUsecase interface {
 	CreateLoan(ctx context.Context, input domain.Loan) (*domain.Loan, error)
-	ApproveLoan(ctx context.Context, loanID, pictureURL, employeeID string, approvalDate time.Time) (*domain.Loan, error)
-	InvestInLoan(ctx context.Context, loanID, investorID, investorName, investorEmail string, amount float64) (*domain.Loan, error)
-	DisburseLoan(ctx context.Context, loanID, agreementURL, employeeID string, disbursementDate time.Time) (*domain.Loan, error)
+	ApproveLoan(ctx context.Context, loanID, pictureDocumentID, employeeID string, approvalDate time.Time) (*domain.Loan, error)
+	Invest(ctx context.Context, req service.InvestRequest) (*service.InvestResult, error)
+	GetFunding(ctx context.Context, loanID string) (*domain.Funding, error)
+	Reserve(ctx context.Context, loanID, investorID string, amount float64, ttl time.Duration) (*domain.Reservation, error)
+	ConfirmReservation(ctx context.Context, loanID, reservationID string) (*service.InvestResult, error)
+	ReleaseReservation(ctx context.Context, loanID, reservationID string) (*domain.Reservation, error)
+	DisburseLoan(ctx context.Context, loanID, agreementDocumentID, employeeID string, disbursementDate time.Time) (*domain.Loan, error)
+	RepayLoan(ctx context.Context, loanID string, amount float64) (*domain.Loan, error)
+	CancelLoan(ctx context.Context, loanID string) (*domain.Loan, error)
+	CancelInvestment(ctx context.Context, loanID, investmentID string) (*domain.Refund, error)
+	ListRefunds(ctx context.Context, loanID string) ([]domain.Refund, error)
+	RegenerateAgreements(ctx context.Context, loanID string) (*domain.Loan, error)
 	GetLoanByID(ctx context.Context, id string) (*domain.Loan, error)
 	ListLoans(ctx context.Context) ([]domain.Loan, error)
 }
@@ -39,33 +50,55 @@ func (h *LoanHandler) RegisterRoutes(r *gin.Engine) {
 	r.GET("/loans/:id", h.getLoan)
 	r.POST("/loans/:id/approve", h.approveLoan)
 	r.POST("/loans/:id/invest", h.investInLoan)
+	r.GET("/loans/:id/funding", h.getFunding)
+	r.POST("/loans/:id/reservations", h.reserve)
+	r.POST("/loans/:id/reservations/:reservationId/confirm", h.confirmReservation)
+	r.DELETE("/loans/:id/reservations/:reservationId", h.releaseReservation)
+	r.DELETE("/loans/:id/investments/:investmentId", h.cancelInvestment)
+	r.GET("/loans/:id/refunds", h.listRefunds)
 	r.POST("/loans/:id/disburse", h.disburseLoan)
+	r.POST("/loans/:id/repay", h.repayLoan)
+	r.POST("/loans/:id/cancel", h.cancelLoan)
+	r.POST("/loans/:id/agreements", h.regenerateAgreements)
 }
 
 // createLoan handles POST /loans. It expects a JSON payload
-// containing borrower_id, principal, rate, roi and optionally
-// agreement_letter_url.
+// containing borrower_id, principal, rate, roi, the product_code of the
+// product the loan is offered under and the tenor_months chosen by the
+// borrower, and optionally the borrower's risk_grade. The terms are
+// validated against the latest version of the product; an unknown
+// product is rejected with 400. The agreement
+// letter is generated by the service once the loan is fully funded.
 func (h *LoanHandler) createLoan(c *gin.Context) {
 	var req struct {
-		BorrowerID         string  `json:"borrower_id" binding:"required"`
-		Principal          float64 `json:"principal" binding:"required"`
-		Rate               float64 `json:"rate" binding:"required"`
-		ROI                float64 `json:"roi" binding:"required"`
-		AgreementLetterURL string  `json:"agreement_letter_url"`
+		BorrowerID string  `json:"borrower_id" binding:"required"`
+		Principal  float64 `json:"principal" binding:"required"`
+		Rate       float64 `json:"rate" binding:"required"`
+		ROI        float64 `json:"roi" binding:"required"`
+		// RiskGrade is the borrower's risk grade, if assessed.
+		RiskGrade   domain.RiskGrade `json:"risk_grade" binding:"omitempty,oneof=A B C D E"`
+		ProductCode string           `json:"product_code" binding:"required"`
+		TenorMonths int              `json:"tenor_months" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	loan := domain.Loan{
-		BorrowerID:         req.BorrowerID,
-		Principal:          req.Principal,
-		Rate:               req.Rate,
-		ROI:                req.ROI,
-		AgreementLetterURL: req.AgreementLetterURL,
+		BorrowerID:  req.BorrowerID,
+		Principal:   req.Principal,
+		Rate:        req.Rate,
+		ROI:         req.ROI,
+		RiskGrade:   req.RiskGrade,
+		ProductCode: req.ProductCode,
+		TenorMonths: req.TenorMonths,
 	}
-	created, err := h.svc.CreateLoan(context.Background(), loan)
+	created, err := h.svc.CreateLoan(c.Request.Context(), loan)
 	if err != nil {
+		if errors.Is(err, domain.ErrLimitExceeded) || errors.Is(err, service.ErrProductNotFound) {
+			c.JSON(http.StatusBadRequest, errorBody(err))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -76,7 +109,7 @@ func (h *LoanHandler) createLoan(c *gin.Context) {
 // pagination. In a real system pagination parameters should be
 // supported.
 func (h *LoanHandler) listLoans(c *gin.Context) {
-	loans, err := h.svc.ListLoans(context.Background())
+	loans, err := h.svc.ListLoans(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -88,7 +121,7 @@ func (h *LoanHandler) listLoans(c *gin.Context) {
 // nested approval, investments and disbursement information.
 func (h *LoanHandler) getLoan(c *gin.Context) {
 	id := c.Param("id")
-	loan, err := h.svc.GetLoanByID(context.Background(), id)
+	loan, err := h.svc.GetLoanByID(c.Request.Context(), id)
 	if err != nil {
 		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "loan not found"})
@@ -101,14 +134,16 @@ func (h *LoanHandler) getLoan(c *gin.Context) {
 }
 
 // approveLoan handles POST /loans/:id/approve. It expects
-// picture_url, employee_id and approval_date in the body. The
-// approval_date must be a valid RFC3339 timestamp.
+// picture_document_id, employee_id and approval_date in the body. The
+// picture must have been uploaded through POST /documents as an
+// approval_proof and the approval_date must be a valid RFC3339
+// timestamp.
 func (h *LoanHandler) approveLoan(c *gin.Context) {
 	id := c.Param("id")
 	var req struct {
-		PictureURL   string `json:"picture_url" binding:"required"`
-		EmployeeID   string `json:"employee_id" binding:"required"`
-		ApprovalDate string `json:"approval_date" binding:"required"`
+		PictureDocumentID string `json:"picture_document_id" binding:"required"`
+		EmployeeID        string `json:"employee_id" binding:"required"`
+		ApprovalDate      string `json:"approval_date" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -119,7 +154,7 @@ func (h *LoanHandler) approveLoan(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid approval_date; must be RFC3339"})
 		return
 	}
-	loan, err := h.svc.ApproveLoan(context.Background(), id, req.PictureURL, req.EmployeeID, date)
+	loan, err := h.svc.ApproveLoan(c.Request.Context(), id, req.PictureDocumentID, req.EmployeeID, date)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -127,8 +162,20 @@ func (h *LoanHandler) approveLoan(c *gin.Context) {
 	c.JSON(http.StatusOK, loan)
 }
 
+// investResponse is the loan after an investment, with the
+// investment made and the amount accepted, which is less than the
+// amount requested when a partial fill completed the loan.
+type investResponse struct {
+	*domain.Loan
+	Investment      *domain.Investment `json:"investment"`
+	RequestedAmount float64            `json:"requested_amount"`
+	AcceptedAmount  float64            `json:"accepted_amount"`
+}
+
 // investInLoan handles POST /loans/:id/invest. It accepts optional
-// investor_id or name/email to identify or create an investor.
+// investor_id or name/email to identify or create an investor, and an
+// optional fill_mode: "exact", the default, rejects an amount larger
+// than the loan still needs, while "partial" invests what remains.
 func (h *LoanHandler) investInLoan(c *gin.Context) {
 	id := c.Param("id")
 	var req struct {
@@ -136,28 +183,200 @@ func (h *LoanHandler) investInLoan(c *gin.Context) {
 		InvestorName  string  `json:"investor_name"`
 		InvestorEmail string  `json:"investor_email"`
 		Amount        float64 `json:"amount" binding:"required"`
+		FillMode      string  `json:"fill_mode"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	loan, err := h.svc.InvestInLoan(context.Background(), id, req.InvestorID, req.InvestorName, req.InvestorEmail, req.Amount)
+	fill := domain.FillMode(req.FillMode)
+	if fill != "" && !fill.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fill_mode must be exact or partial"})
+		return
+	}
+	res, err := h.svc.Invest(c.Request.Context(), service.InvestRequest{
+		LoanID:        id,
+		InvestorID:    req.InvestorID,
+		InvestorName:  req.InvestorName,
+		InvestorEmail: req.InvestorEmail,
+		Amount:        req.Amount,
+		FillMode:      fill,
+	})
+	if err != nil {
+		investError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newInvestResponse(res))
+}
+
+// investError writes the response for an error of an investment: 404
+// for an unknown loan or investor, 400 for an investment the loan's
+// state, the amount or a business limit rules out, and 500 for any
+// other failure, such as a ledger or database error.
+func investError(c *gin.Context, err error) {
+	switch {
+	case err == repository.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "loan not found"})
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvestmentRejected),
+		errors.Is(err, domain.ErrInsufficientFunds),
+		errors.Is(err, domain.ErrLimitExceeded):
+		c.JSON(http.StatusBadRequest, errorBody(err))
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// newInvestResponse returns the response to an accepted investment.
+func newInvestResponse(res *service.InvestResult) investResponse {
+	return investResponse{
+		Loan:            res.Loan,
+		Investment:      res.Investment,
+		RequestedAmount: res.RequestedAmount,
+		AcceptedAmount:  res.AcceptedAmount,
+	}
+}
+
+// getFunding handles GET /loans/:id/funding. It returns the total
+// invested, the amount remaining, the number of investors and the
+// percentage funded.
+func (h *LoanHandler) getFunding(c *gin.Context) {
+	funding, err := h.svc.GetFunding(c.Request.Context(), c.Param("id"))
 	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "loan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, funding)
+}
+
+// reserve handles POST /loans/:id/reservations. It holds amount of the
+// loan for investor_id while they complete payment, for ttl_minutes or
+// the configured reservation TTL.
+func (h *LoanHandler) reserve(c *gin.Context) {
+	var req struct {
+		InvestorID string  `json:"investor_id" binding:"required"`
+		Amount     float64 `json:"amount" binding:"required"`
+		TTLMinutes int     `json:"ttl_minutes" binding:"min=0"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, loan)
+	res, err := h.svc.Reserve(c.Request.Context(), c.Param("id"), req.InvestorID, req.Amount, time.Duration(req.TTLMinutes)*time.Minute)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "loan or investor not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, errorBody(err))
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+// confirmReservation handles POST
+// /loans/:id/reservations/:reservationId/confirm. It converts the
+// reservation into an investment and responds like POST
+// /loans/:id/invest.
+func (h *LoanHandler) confirmReservation(c *gin.Context) {
+	res, err := h.svc.ConfirmReservation(c.Request.Context(), c.Param("id"), c.Param("reservationId"))
+	if err != nil {
+		reservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newInvestResponse(res))
+}
+
+// releaseReservation handles DELETE
+// /loans/:id/reservations/:reservationId. It gives the held amount up
+// before the reservation expires.
+func (h *LoanHandler) releaseReservation(c *gin.Context) {
+	res, err := h.svc.ReleaseReservation(c.Request.Context(), c.Param("id"), c.Param("reservationId"))
+	if err != nil {
+		reservationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// reservationError writes the response for an error of a reservation
+// operation: 404 for an unknown loan or reservation and 400 for a
+// reservation that is no longer held or a rejected investment.
+func reservationError(c *gin.Context, err error) {
+	switch {
+	case err == repository.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "loan not found"})
+	case errors.Is(err, service.ErrReservationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, errorBody(err))
+	}
+}
+
+// errorBody returns the body of an error response. An error caused by
+// a business limit carries the limit's rule as its code, so that
+// clients can tell the limits apart.
+func errorBody(err error) gin.H {
+	body := gin.H{"error": err.Error()}
+	var limit *domain.LimitError
+	if errors.As(err, &limit) {
+		body["code"] = limit.Rule
+	}
+	return body
+}
+
+// cancelInvestment handles DELETE /loans/:id/investments/:investmentId.
+// The investment is closed and its amount refunded to the investor's
+// wallet; the response is the refund record.
+func (h *LoanHandler) cancelInvestment(c *gin.Context) {
+	refund, err := h.svc.CancelInvestment(c.Request.Context(), c.Param("id"), c.Param("investmentId"))
+	if err != nil {
+		switch {
+		case err == repository.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "loan not found"})
+		case errors.Is(err, service.ErrInvestmentNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, refund)
+}
+
+// listRefunds handles GET /loans/:id/refunds. It returns the refunds
+// made from the loan, oldest first.
+func (h *LoanHandler) listRefunds(c *gin.Context) {
+	refunds, err := h.svc.ListRefunds(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "loan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if refunds == nil {
+		refunds = []domain.Refund{}
+	}
+	c.JSON(http.StatusOK, refunds)
 }
 
 // disburseLoan handles POST /loans/:id/disburse. It expects
-// agreement_url, employee_id and disbursement_date in RFC3339
-// format.
+// agreement_document_id, employee_id and disbursement_date in RFC3339
+// format. The agreement must have been uploaded through POST
+// /documents as a signed_agreement.
 func (h *LoanHandler) disburseLoan(c *gin.Context) {
 	id := c.Param("id")
 	var req struct {
-		AgreementURL     string `json:"agreement_url" binding:"required"`
-		EmployeeID       string `json:"employee_id" binding:"required"`
-		DisbursementDate string `json:"disbursement_date" binding:"required"`
+		AgreementDocumentID string `json:"agreement_document_id" binding:"required"`
+		EmployeeID          string `json:"employee_id" binding:"required"`
+		DisbursementDate    string `json:"disbursement_date" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -168,10 +387,64 @@ func (h *LoanHandler) disburseLoan(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid disbursement_date; must be RFC3339"})
 		return
 	}
-	loan, err := h.svc.DisburseLoan(context.Background(), id, req.AgreementURL, req.EmployeeID, date)
+	loan, err := h.svc.DisburseLoan(c.Request.Context(), id, req.AgreementDocumentID, req.EmployeeID, date)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, loan)
 }
+
+// repayLoan handles POST /loans/:id/repay. It expects the repaid
+// amount, which must equal the principal plus interest, in the body.
+func (h *LoanHandler) repayLoan(c *gin.Context) {
+	var req struct {
+		Amount float64 `json:"amount" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	loan, err := h.svc.RepayLoan(c.Request.Context(), c.Param("id"), req.Amount)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "loan not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, loan)
+}
+
+// cancelLoan handles POST /loans/:id/cancel. A loan can be cancelled
+// until it is fully funded; the amounts invested so far are refunded
+// to the investors' wallets.
+func (h *LoanHandler) cancelLoan(c *gin.Context) {
+	loan, err := h.svc.CancelLoan(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "loan not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, loan)
+}
+
+// regenerateAgreements handles POST /loans/:id/agreements. It renders
+// the borrower and investor agreement letters of a funded loan again,
+// for example after a failed generation.
+func (h *LoanHandler) regenerateAgreements(c *gin.Context) {
+	loan, err := h.svc.RegenerateAgreements(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "loan not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, loan)
+}
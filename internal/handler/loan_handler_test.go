@@ -3,6 +3,8 @@ package handler_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -17,6 +19,7 @@ import (
 	"loan_service/internal/handler"
 	mock_loan_service "loan_service/internal/handler/mocks"
 	"loan_service/internal/repository"
+	"loan_service/internal/service"
 )
 
 func TestCreateLoan_WithMockService(t *testing.T) {
@@ -30,7 +33,7 @@ func TestCreateLoan_WithMockService(t *testing.T) {
 	r := gin.Default()
 	h.RegisterRoutes(r)
 
-	body := map[string]any{"borrower_id": "BRW", "principal": 1000, "rate": 0.1, "roi": 0.12}
+	body := map[string]any{"borrower_id": "BRW", "principal": 1000, "rate": 0.1, "roi": 0.12, "product_code": "STD", "tenor_months": 12}
 	b, _ := json.Marshal(body)
 	req, _ := http.NewRequest("POST", "/loans", bytes.NewReader(b))
 	req.Header.Set("Content-Type", "application/json")
@@ -51,7 +54,13 @@ func TestInvestInLoan_Success(t *testing.T) {
 	amount := 500.0
 	expected := &domain.Loan{ID: loanID}
 
-	ms.On("InvestInLoan", mock.Anything, loanID, investorID, investorName, investorEmail, amount).Return(expected, nil).Once()
+	ms.On("Invest", mock.Anything, service.InvestRequest{
+		LoanID:        loanID,
+		InvestorID:    investorID,
+		InvestorName:  investorName,
+		InvestorEmail: investorEmail,
+		Amount:        amount,
+	}).Return(&service.InvestResult{Loan: expected, RequestedAmount: amount, AcceptedAmount: amount}, nil).Once()
 
 	h := handler.NewLoanHandler(ms)
 	r := gin.Default()
@@ -73,6 +82,48 @@ func TestInvestInLoan_Success(t *testing.T) {
 	ms.AssertExpectations(t)
 }
 
+func TestInvestInLoan_PartialFill(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ms := new(mock_loan_service.MockLoanService)
+	investment := &domain.Investment{ID: "V1", LoanID: "L123", Amount: 300}
+	ms.On("Invest", mock.Anything, service.InvestRequest{LoanID: "L123", InvestorID: "INV1", Amount: 500, FillMode: domain.FillModePartial}).
+		Return(&service.InvestResult{Loan: &domain.Loan{ID: "L123", State: domain.LoanStateInvested}, Investment: investment, RequestedAmount: 500, AcceptedAmount: 300}, nil).Once()
+
+	h := handler.NewLoanHandler(ms)
+	r := gin.Default()
+	h.RegisterRoutes(r)
+
+	b, _ := json.Marshal(map[string]any{"investor_id": "INV1", "amount": 500, "fill_mode": "partial"})
+	req, _ := http.NewRequest("POST", "/loans/L123/invest", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		ID              string            `json:"id"`
+		State           domain.LoanState  `json:"state"`
+		Investment      domain.Investment `json:"investment"`
+		RequestedAmount float64           `json:"requested_amount"`
+		AcceptedAmount  float64           `json:"accepted_amount"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "L123", resp.ID, "the loan's fields are at the top level")
+	assert.Equal(t, domain.LoanStateInvested, resp.State)
+	assert.Equal(t, "V1", resp.Investment.ID)
+	assert.Equal(t, 500.0, resp.RequestedAmount)
+	assert.Equal(t, 300.0, resp.AcceptedAmount)
+	ms.AssertExpectations(t)
+
+	b, _ = json.Marshal(map[string]any{"amount": 500, "fill_mode": "most"})
+	req, _ = http.NewRequest("POST", "/loans/L123/invest", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 func TestInvestInLoan_BadRequest_InvalidJSON(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -115,26 +166,66 @@ func TestInvestInLoan_BadRequest_MissingAmount(t *testing.T) {
 func TestInvestInLoan_ServiceError(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
+	cases := map[string]struct {
+		err  error
+		want int
+	}{
+		"unknown loan":       {repository.ErrNotFound, http.StatusNotFound},
+		"unknown investor":   {fmt.Errorf("investor INV1: %w", repository.ErrNotFound), http.StatusNotFound},
+		"rejected":           {fmt.Errorf("%w: loan already fully funded", service.ErrInvestmentRejected), http.StatusBadRequest},
+		"insufficient funds": {fmt.Errorf("%w: wallet balance 0.00 is less than 100.00", domain.ErrInsufficientFunds), http.StatusBadRequest},
+		"ledger failure":     {assert.AnError, http.StatusInternalServerError},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ms := new(mock_loan_service.MockLoanService)
+			loanID := "L123"
+			ms.On("Invest", mock.Anything, service.InvestRequest{LoanID: loanID, Amount: 100.0}).Return(nil, tc.err).Once()
+
+			h := handler.NewLoanHandler(ms)
+			r := gin.Default()
+			h.RegisterRoutes(r)
+
+			body := map[string]any{
+				"amount": 100.0,
+			}
+			b, _ := json.Marshal(body)
+			req, _ := http.NewRequest("POST", "/loans/"+loanID+"/invest", bytes.NewReader(b))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, tc.want, w.Code)
+			ms.AssertExpectations(t)
+		})
+	}
+}
+
+func TestInvestInLoan_LimitErrorCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
 	ms := new(mock_loan_service.MockLoanService)
-	loanID := "L123"
-	ms.On("InvestInLoan", mock.Anything, loanID, "", "", "", 100.0).Return(nil, assert.AnError).Once()
+	limit := &domain.LimitError{Rule: domain.LimitMaxLoanShare, Message: "holding 600.00 of the loan would exceed the maximum share of 50%, 500.00"}
+	ms.On("Invest", mock.Anything, service.InvestRequest{LoanID: "L123", InvestorID: "INV1", Amount: 200}).Return(nil, limit).Once()
 
 	h := handler.NewLoanHandler(ms)
 	r := gin.Default()
 	h.RegisterRoutes(r)
 
-	body := map[string]any{
-		"amount": 100.0,
-	}
-	b, _ := json.Marshal(body)
-	req, _ := http.NewRequest("POST", "/loans/"+loanID+"/invest", bytes.NewReader(b))
+	b, _ := json.Marshal(map[string]any{"investor_id": "INV1", "amount": 200})
+	req, _ := http.NewRequest("POST", "/loans/L123/invest", bytes.NewReader(b))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
 	require.Equal(t, http.StatusBadRequest, w.Code)
+	var resp map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "max_loan_share", resp["code"])
+	assert.Equal(t, limit.Error(), resp["error"])
 	ms.AssertExpectations(t)
 }
+
 func TestListLoans_Success(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -246,22 +337,22 @@ func TestApproveLoan_Success(t *testing.T) {
 
 	ms := new(mock_loan_service.MockLoanService)
 	loanID := "L123"
-	pictureURL := "http://pic"
+	pictureDocumentID := "DOC1"
 	employeeID := "EMP1"
 	approvalDate := "2023-01-01T10:00:00Z"
 	parsedDate, _ := time.Parse(time.RFC3339, approvalDate)
 	expected := &domain.Loan{ID: loanID}
 
-	ms.On("ApproveLoan", mock.Anything, loanID, pictureURL, employeeID, parsedDate).Return(expected, nil).Once()
+	ms.On("ApproveLoan", mock.Anything, loanID, pictureDocumentID, employeeID, parsedDate).Return(expected, nil).Once()
 
 	h := handler.NewLoanHandler(ms)
 	r := gin.Default()
 	h.RegisterRoutes(r)
 
 	body := map[string]any{
-		"picture_url":   pictureURL,
-		"employee_id":   employeeID,
-		"approval_date": approvalDate,
+		"picture_document_id": pictureDocumentID,
+		"employee_id":         employeeID,
+		"approval_date":       approvalDate,
 	}
 	b, _ := json.Marshal(body)
 	req, _ := http.NewRequest("POST", "/loans/"+loanID+"/approve", bytes.NewReader(b))
@@ -298,9 +389,9 @@ func TestApproveLoan_BadRequest_InvalidDate(t *testing.T) {
 	h.RegisterRoutes(r)
 
 	body := map[string]any{
-		"picture_url":   "http://pic",
-		"employee_id":   "EMP1",
-		"approval_date": "not-a-date",
+		"picture_document_id": "DOC1",
+		"employee_id":         "EMP1",
+		"approval_date":       "not-a-date",
 	}
 	b, _ := json.Marshal(body)
 	req, _ := http.NewRequest("POST", "/loans/L123/approve", bytes.NewReader(b))
@@ -316,21 +407,21 @@ func TestApproveLoan_ServiceError(t *testing.T) {
 
 	ms := new(mock_loan_service.MockLoanService)
 	loanID := "L123"
-	pictureURL := "http://pic"
+	pictureDocumentID := "DOC1"
 	employeeID := "EMP1"
 	approvalDate := "2023-01-01T10:00:00Z"
 	parsedDate, _ := time.Parse(time.RFC3339, approvalDate)
 
-	ms.On("ApproveLoan", mock.Anything, loanID, pictureURL, employeeID, parsedDate).Return(nil, assert.AnError).Once()
+	ms.On("ApproveLoan", mock.Anything, loanID, pictureDocumentID, employeeID, parsedDate).Return(nil, assert.AnError).Once()
 
 	h := handler.NewLoanHandler(ms)
 	r := gin.Default()
 	h.RegisterRoutes(r)
 
 	body := map[string]any{
-		"picture_url":   pictureURL,
-		"employee_id":   employeeID,
-		"approval_date": approvalDate,
+		"picture_document_id": pictureDocumentID,
+		"employee_id":         employeeID,
+		"approval_date":       approvalDate,
 	}
 	b, _ := json.Marshal(body)
 	req, _ := http.NewRequest("POST", "/loans/"+loanID+"/approve", bytes.NewReader(b))
@@ -347,22 +438,22 @@ func TestDisburseLoan_Success(t *testing.T) {
 
 	ms := new(mock_loan_service.MockLoanService)
 	loanID := "L123"
-	agreementURL := "http://agreement"
+	agreementDocumentID := "DOC2"
 	employeeID := "EMP1"
 	disbursementDate := "2023-01-01T10:00:00Z"
 	parsedDate, _ := time.Parse(time.RFC3339, disbursementDate)
 	expected := &domain.Loan{ID: loanID}
 
-	ms.On("DisburseLoan", mock.Anything, loanID, agreementURL, employeeID, parsedDate).Return(expected, nil).Once()
+	ms.On("DisburseLoan", mock.Anything, loanID, agreementDocumentID, employeeID, parsedDate).Return(expected, nil).Once()
 
 	h := handler.NewLoanHandler(ms)
 	r := gin.Default()
 	h.RegisterRoutes(r)
 
 	body := map[string]any{
-		"agreement_url":     agreementURL,
-		"employee_id":       employeeID,
-		"disbursement_date": disbursementDate,
+		"agreement_document_id": agreementDocumentID,
+		"employee_id":           employeeID,
+		"disbursement_date":     disbursementDate,
 	}
 	b, _ := json.Marshal(body)
 	req, _ := http.NewRequest("POST", "/loans/"+loanID+"/disburse", bytes.NewReader(b))
@@ -399,9 +490,9 @@ func TestDisburseLoan_BadRequest_InvalidDate(t *testing.T) {
 	h.RegisterRoutes(r)
 
 	body := map[string]any{
-		"agreement_url":     "http://agreement",
-		"employee_id":       "EMP1",
-		"disbursement_date": "not-a-date",
+		"agreement_document_id": "DOC2",
+		"employee_id":           "EMP1",
+		"disbursement_date":     "not-a-date",
 	}
 	b, _ := json.Marshal(body)
 	req, _ := http.NewRequest("POST", "/loans/L123/disburse", bytes.NewReader(b))
@@ -417,21 +508,21 @@ func TestDisburseLoan_ServiceError(t *testing.T) {
 
 	ms := new(mock_loan_service.MockLoanService)
 	loanID := "L123"
-	agreementURL := "http://agreement"
+	agreementDocumentID := "DOC2"
 	employeeID := "EMP1"
 	disbursementDate := "2023-01-01T10:00:00Z"
 	parsedDate, _ := time.Parse(time.RFC3339, disbursementDate)
 
-	ms.On("DisburseLoan", mock.Anything, loanID, agreementURL, employeeID, parsedDate).Return(nil, assert.AnError).Once()
+	ms.On("DisburseLoan", mock.Anything, loanID, agreementDocumentID, employeeID, parsedDate).Return(nil, assert.AnError).Once()
 
 	h := handler.NewLoanHandler(ms)
 	r := gin.Default()
 	h.RegisterRoutes(r)
 
 	body := map[string]any{
-		"agreement_url":     agreementURL,
-		"employee_id":       employeeID,
-		"disbursement_date": disbursementDate,
+		"agreement_document_id": agreementDocumentID,
+		"employee_id":           employeeID,
+		"disbursement_date":     disbursementDate,
 	}
 	b, _ := json.Marshal(body)
 	req, _ := http.NewRequest("POST", "/loans/"+loanID+"/disburse", bytes.NewReader(b))
@@ -442,3 +533,82 @@ func TestDisburseLoan_ServiceError(t *testing.T) {
 	require.Equal(t, http.StatusBadRequest, w.Code)
 	ms.AssertExpectations(t)
 }
+
+func TestRegenerateAgreements_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ms := new(mock_loan_service.MockLoanService)
+	expected := &domain.Loan{ID: "L123", AgreementLetterURL: "/documents/DOC1/content"}
+	ms.On("RegenerateAgreements", mock.Anything, "L123").Return(expected, nil).Once()
+
+	h := handler.NewLoanHandler(ms)
+	r := gin.Default()
+	h.RegisterRoutes(r)
+
+	req, _ := http.NewRequest("POST", "/loans/L123/agreements", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "/documents/DOC1/content")
+	ms.AssertExpectations(t)
+}
+
+func TestRegenerateAgreements_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ms := new(mock_loan_service.MockLoanService)
+	ms.On("RegenerateAgreements", mock.Anything, "L404").Return(nil, repository.ErrNotFound).Once()
+
+	h := handler.NewLoanHandler(ms)
+	r := gin.Default()
+	h.RegisterRoutes(r)
+
+	req, _ := http.NewRequest("POST", "/loans/L404/agreements", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	ms.AssertExpectations(t)
+}
+
+func TestReservations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	ms := new(mock_loan_service.MockLoanService)
+	held := &domain.Reservation{ID: "R1", LoanID: "L123", InvestorID: "INV1", Amount: 500, State: domain.ReservationStateHeld}
+	ms.On("Reserve", mock.Anything, "L123", "INV1", 500.0, 5*time.Minute).Return(held, nil).Once()
+	ms.On("ConfirmReservation", mock.Anything, "L123", "R1").
+		Return(&service.InvestResult{Loan: &domain.Loan{ID: "L123"}, Investment: &domain.Investment{ID: "V1"}, RequestedAmount: 500, AcceptedAmount: 500}, nil).Once()
+	ms.On("ConfirmReservation", mock.Anything, "L123", "R2").Return(nil, service.ErrReservationNotFound).Once()
+	ms.On("ReleaseReservation", mock.Anything, "L123", "R3").Return(nil, errors.New("reservation is confirmed")).Once()
+
+	h := handler.NewLoanHandler(ms)
+	r := gin.Default()
+	h.RegisterRoutes(r)
+
+	b, _ := json.Marshal(map[string]any{"investor_id": "INV1", "amount": 500, "ttl_minutes": 5})
+	req, _ := http.NewRequest("POST", "/loans/L123/reservations", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"state":"held"`)
+
+	req, _ = http.NewRequest("POST", "/loans/L123/reservations/R1/confirm", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"accepted_amount":500`)
+
+	req, _ = http.NewRequest("POST", "/loans/L123/reservations/R2/confirm", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req, _ = http.NewRequest("DELETE", "/loans/L123/reservations/R3", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	ms.AssertExpectations(t)
+}
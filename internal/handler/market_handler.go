@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/repository"
+	"loan_service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MarketUsecase abstracts the secondary market operations of the loan
+// service for the handler.
+type MarketUsecase interface {
+	ListInvestment(ctx context.Context, loanID, investmentID string, amount, price float64) (*domain.Listing, error)
+	BuyListing(ctx context.Context, listingID, buyerID string) (*domain.Listing, error)
+	CancelListing(ctx context.Context, listingID string) (*domain.Listing, error)
+	GetListing(ctx context.Context, listingID string) (*domain.Listing, error)
+	ListListings(ctx context.Context, loanID string, state domain.ListingState) ([]domain.Listing, error)
+}
+
+// MarketHandler defines HTTP handlers for the secondary market, where
+// investors sell positions in disbursed loans to other investors.
+type MarketHandler struct {
+	svc MarketUsecase
+}
+
+// NewMarketHandler constructs a new MarketHandler.
+func NewMarketHandler(svc MarketUsecase) *MarketHandler {
+	return &MarketHandler{svc: svc}
+}
+
+// RegisterRoutes registers the secondary market routes on the given
+// Gin engine.
+func (h *MarketHandler) RegisterRoutes(r *gin.Engine) {
+	r.POST("/loans/:id/investments/:investmentId/listings", h.listInvestment)
+	r.GET("/listings", h.listListings)
+	r.GET("/listings/:id", h.getListing)
+	r.POST("/listings/:id/buy", h.buyListing)
+	r.DELETE("/listings/:id", h.cancelListing)
+}
+
+// listInvestment handles POST
+// /loans/:id/investments/:investmentId/listings. It offers amount of
+// the investment for sale at price.
+func (h *MarketHandler) listInvestment(c *gin.Context) {
+	var req struct {
+		Amount float64 `json:"amount" binding:"required"`
+		Price  float64 `json:"price" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	listing, err := h.svc.ListInvestment(c.Request.Context(), c.Param("id"), c.Param("investmentId"), req.Amount, req.Price)
+	if err != nil {
+		marketError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, listing)
+}
+
+// listListings handles GET /listings. The optional loan_id and state
+// query parameters filter the listings, which are returned oldest
+// first.
+func (h *MarketHandler) listListings(c *gin.Context) {
+	listings, err := h.svc.ListListings(c.Request.Context(), c.Query("loan_id"), domain.ListingState(c.Query("state")))
+	if err != nil {
+		marketError(c, err)
+		return
+	}
+	if listings == nil {
+		listings = []domain.Listing{}
+	}
+	c.JSON(http.StatusOK, listings)
+}
+
+// getListing handles GET /listings/:id.
+func (h *MarketHandler) getListing(c *gin.Context) {
+	listing, err := h.svc.GetListing(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		marketError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, listing)
+}
+
+// buyListing handles POST /listings/:id/buy. It expects the buying
+// investor_id; the price is paid from their wallet and the response is
+// the sold listing, naming the buyer's new investment.
+func (h *MarketHandler) buyListing(c *gin.Context) {
+	var req struct {
+		InvestorID string `json:"investor_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	listing, err := h.svc.BuyListing(c.Request.Context(), c.Param("id"), req.InvestorID)
+	if err != nil {
+		marketError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, listing)
+}
+
+// cancelListing handles DELETE /listings/:id. The listing is
+// cancelled rather than deleted and returned.
+func (h *MarketHandler) cancelListing(c *gin.Context) {
+	listing, err := h.svc.CancelListing(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		marketError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, listing)
+}
+
+// marketError writes the response for an error of a secondary market
+// operation: 404 for an unknown loan, investor, investment or listing
+// and 400 for a rejected request.
+func marketError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "loan or investor not found"})
+	case errors.Is(err, service.ErrListingNotFound), errors.Is(err, service.ErrInvestmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, errorBody(err))
+	}
+}
@@ -0,0 +1,29 @@
+package mocks
+
+import (
+	"context"
+	"io"
+	"loan_service/internal/domain"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// --- Mock service implementing handler.DocumentUsecase ---
+type MockDocumentService struct{ mock.Mock }
+
+func (m *MockDocumentService) Upload(ctx context.Context, kind domain.DocumentKind, fileName string, r io.Reader, size int64) (*domain.Document, error) {
+	args := m.Called(ctx, kind, fileName, r, size)
+	doc, _ := args.Get(0).(*domain.Document)
+	return doc, args.Error(1)
+}
+func (m *MockDocumentService) GetDocument(ctx context.Context, id string) (*domain.Document, error) {
+	args := m.Called(ctx, id)
+	doc, _ := args.Get(0).(*domain.Document)
+	return doc, args.Error(1)
+}
+func (m *MockDocumentService) OpenDocument(ctx context.Context, id string) (*domain.Document, io.ReadCloser, error) {
+	args := m.Called(ctx, id)
+	doc, _ := args.Get(0).(*domain.Document)
+	rc, _ := args.Get(1).(io.ReadCloser)
+	return doc, rc, args.Error(2)
+}
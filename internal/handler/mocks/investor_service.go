@@ -0,0 +1,58 @@
+package mocks
+
+import (
+	"context"
+	"loan_service/internal/domain"
+	"loan_service/internal/service"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// --- Mock service implementing handler.InvestorUsecase ---
+type MockInvestorService struct{ mock.Mock }
+
+func (m *MockInvestorService) CreateInvestor(ctx context.Context, name, email string) (*domain.Investor, error) {
+	args := m.Called(ctx, name, email)
+	inv, _ := args.Get(0).(*domain.Investor)
+	return inv, args.Error(1)
+}
+func (m *MockInvestorService) GetInvestor(ctx context.Context, id string) (*domain.Investor, error) {
+	args := m.Called(ctx, id)
+	inv, _ := args.Get(0).(*domain.Investor)
+	return inv, args.Error(1)
+}
+func (m *MockInvestorService) SubmitKYC(ctx context.Context, investorID string, sub service.KYCSubmission) (*domain.Investor, error) {
+	args := m.Called(ctx, investorID, sub)
+	inv, _ := args.Get(0).(*domain.Investor)
+	return inv, args.Error(1)
+}
+func (m *MockInvestorService) ReviewKYC(ctx context.Context, investorID string, status domain.KYCStatus, reviewerID, reason string) (*domain.Investor, error) {
+	args := m.Called(ctx, investorID, status, reviewerID, reason)
+	inv, _ := args.Get(0).(*domain.Investor)
+	return inv, args.Error(1)
+}
+func (m *MockInvestorService) Wallet(ctx context.Context, investorID string) (*domain.Wallet, error) {
+	args := m.Called(ctx, investorID)
+	wallet, _ := args.Get(0).(*domain.Wallet)
+	return wallet, args.Error(1)
+}
+func (m *MockInvestorService) TopUp(ctx context.Context, investorID string, amount float64, reference string) (*domain.Wallet, error) {
+	args := m.Called(ctx, investorID, amount, reference)
+	wallet, _ := args.Get(0).(*domain.Wallet)
+	return wallet, args.Error(1)
+}
+func (m *MockInvestorService) Withdraw(ctx context.Context, investorID string, amount float64, reference string) (*domain.Wallet, error) {
+	args := m.Called(ctx, investorID, amount, reference)
+	wallet, _ := args.Get(0).(*domain.Wallet)
+	return wallet, args.Error(1)
+}
+func (m *MockInvestorService) WalletHistory(ctx context.Context, investorID string, limit int) ([]domain.AccountEntry, error) {
+	args := m.Called(ctx, investorID, limit)
+	entries, _ := args.Get(0).([]domain.AccountEntry)
+	return entries, args.Error(1)
+}
+func (m *MockInvestorService) Portfolio(ctx context.Context, investorID string) (*domain.Portfolio, error) {
+	args := m.Called(ctx, investorID)
+	p, _ := args.Get(0).(*domain.Portfolio)
+	return p, args.Error(1)
+}
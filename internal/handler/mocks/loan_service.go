@@ -3,6 +3,7 @@ package mocks
 import (
 	"context"
 	"loan_service/internal/domain"
+	"loan_service/internal/service"
 	"time"
 
 	"github.com/stretchr/testify/mock"
@@ -16,18 +17,63 @@ func (m *MockLoanService) CreateLoan(ctx context.Context, input domain.Loan) (*d
 	loan, _ := args.Get(0).(*domain.Loan)
 	return loan, args.Error(1)
 }
-func (m *MockLoanService) ApproveLoan(ctx context.Context, loanID, pictureURL, employeeID string, approvalDate time.Time) (*domain.Loan, error) {
-	args := m.Called(ctx, loanID, pictureURL, employeeID, approvalDate)
+func (m *MockLoanService) ApproveLoan(ctx context.Context, loanID, pictureDocumentID, employeeID string, approvalDate time.Time) (*domain.Loan, error) {
+	args := m.Called(ctx, loanID, pictureDocumentID, employeeID, approvalDate)
 	loan, _ := args.Get(0).(*domain.Loan)
 	return loan, args.Error(1)
 }
-func (m *MockLoanService) InvestInLoan(ctx context.Context, loanID, investorID, investorName, investorEmail string, amount float64) (*domain.Loan, error) {
-	args := m.Called(ctx, loanID, investorID, investorName, investorEmail, amount)
+func (m *MockLoanService) Invest(ctx context.Context, req service.InvestRequest) (*service.InvestResult, error) {
+	args := m.Called(ctx, req)
+	res, _ := args.Get(0).(*service.InvestResult)
+	return res, args.Error(1)
+}
+func (m *MockLoanService) GetFunding(ctx context.Context, loanID string) (*domain.Funding, error) {
+	args := m.Called(ctx, loanID)
+	funding, _ := args.Get(0).(*domain.Funding)
+	return funding, args.Error(1)
+}
+func (m *MockLoanService) DisburseLoan(ctx context.Context, loanID, agreementDocumentID, employeeID string, disbursementDate time.Time) (*domain.Loan, error) {
+	args := m.Called(ctx, loanID, agreementDocumentID, employeeID, disbursementDate)
 	loan, _ := args.Get(0).(*domain.Loan)
 	return loan, args.Error(1)
 }
-func (m *MockLoanService) DisburseLoan(ctx context.Context, loanID, agreementURL, employeeID string, disbursementDate time.Time) (*domain.Loan, error) {
-	args := m.Called(ctx, loanID, agreementURL, employeeID, disbursementDate)
+func (m *MockLoanService) RepayLoan(ctx context.Context, loanID string, amount float64) (*domain.Loan, error) {
+	args := m.Called(ctx, loanID, amount)
+	loan, _ := args.Get(0).(*domain.Loan)
+	return loan, args.Error(1)
+}
+func (m *MockLoanService) CancelLoan(ctx context.Context, loanID string) (*domain.Loan, error) {
+	args := m.Called(ctx, loanID)
+	loan, _ := args.Get(0).(*domain.Loan)
+	return loan, args.Error(1)
+}
+func (m *MockLoanService) Reserve(ctx context.Context, loanID, investorID string, amount float64, ttl time.Duration) (*domain.Reservation, error) {
+	args := m.Called(ctx, loanID, investorID, amount, ttl)
+	res, _ := args.Get(0).(*domain.Reservation)
+	return res, args.Error(1)
+}
+func (m *MockLoanService) ConfirmReservation(ctx context.Context, loanID, reservationID string) (*service.InvestResult, error) {
+	args := m.Called(ctx, loanID, reservationID)
+	res, _ := args.Get(0).(*service.InvestResult)
+	return res, args.Error(1)
+}
+func (m *MockLoanService) ReleaseReservation(ctx context.Context, loanID, reservationID string) (*domain.Reservation, error) {
+	args := m.Called(ctx, loanID, reservationID)
+	res, _ := args.Get(0).(*domain.Reservation)
+	return res, args.Error(1)
+}
+func (m *MockLoanService) CancelInvestment(ctx context.Context, loanID, investmentID string) (*domain.Refund, error) {
+	args := m.Called(ctx, loanID, investmentID)
+	refund, _ := args.Get(0).(*domain.Refund)
+	return refund, args.Error(1)
+}
+func (m *MockLoanService) ListRefunds(ctx context.Context, loanID string) ([]domain.Refund, error) {
+	args := m.Called(ctx, loanID)
+	refunds, _ := args.Get(0).([]domain.Refund)
+	return refunds, args.Error(1)
+}
+func (m *MockLoanService) RegenerateAgreements(ctx context.Context, loanID string) (*domain.Loan, error) {
+	args := m.Called(ctx, loanID)
 	loan, _ := args.Get(0).(*domain.Loan)
 	return loan, args.Error(1)
 }
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/repository"
+	"loan_service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProductUsecase abstracts the product service for the handler.
+type ProductUsecase interface {
+	CreateProduct(ctx context.Context, product domain.LoanProduct) (*domain.LoanProduct, error)
+	PublishVersion(ctx context.Context, code string, product domain.LoanProduct) (*domain.LoanProduct, error)
+	GetProduct(ctx context.Context, code string, version int) (*domain.LoanProduct, error)
+	ListProducts(ctx context.Context) ([]domain.LoanProduct, error)
+	ListVersions(ctx context.Context, code string) ([]domain.LoanProduct, error)
+}
+
+// ProductHandler defines HTTP handlers for the loan product catalog.
+// Products are read by everyone and changed through the admin routes.
+type ProductHandler struct {
+	svc ProductUsecase
+}
+
+// NewProductHandler constructs a new ProductHandler.
+func NewProductHandler(svc ProductUsecase) *ProductHandler {
+	return &ProductHandler{svc: svc}
+}
+
+// RegisterRoutes registers the product routes on the given Gin engine.
+func (h *ProductHandler) RegisterRoutes(r *gin.Engine) {
+	r.POST("/admin/products", h.createProduct)
+	r.POST("/admin/products/:code/versions", h.publishVersion)
+	r.GET("/products", h.listProducts)
+	r.GET("/products/:code", h.getProduct)
+	r.GET("/products/:code/versions", h.listVersions)
+	r.GET("/products/:code/versions/:version", h.getVersion)
+}
+
+// productTerms is the request body describing the terms of a product
+// version.
+type productTerms struct {
+	Name               string                    `json:"name" binding:"required"`
+	TenorMonths        []int                     `json:"tenor_months" binding:"required,min=1"`
+	RepaymentFrequency domain.RepaymentFrequency `json:"repayment_frequency" binding:"required,oneof=weekly monthly bullet"`
+	MinPrincipal       float64                   `json:"min_principal" binding:"required"`
+	MaxPrincipal       float64                   `json:"max_principal" binding:"required"`
+	MinRate            float64                   `json:"min_rate"`
+	MaxRate            float64                   `json:"max_rate"`
+	MinROI             float64                   `json:"min_roi"`
+	MaxROI             float64                   `json:"max_roi"`
+	OriginationFee     float64                   `json:"origination_fee"`
+	LateFee            float64                   `json:"late_fee"`
+	AgreementTemplate  string                    `json:"agreement_template"`
+}
+
+func (t productTerms) product(code string) domain.LoanProduct {
+	return domain.LoanProduct{
+		Code:               code,
+		Name:               t.Name,
+		TenorMonths:        t.TenorMonths,
+		RepaymentFrequency: t.RepaymentFrequency,
+		MinPrincipal:       t.MinPrincipal,
+		MaxPrincipal:       t.MaxPrincipal,
+		MinRate:            t.MinRate,
+		MaxRate:            t.MaxRate,
+		MinROI:             t.MinROI,
+		MaxROI:             t.MaxROI,
+		OriginationFee:     t.OriginationFee,
+		LateFee:            t.LateFee,
+		AgreementTemplate:  t.AgreementTemplate,
+	}
+}
+
+// createProduct handles POST /admin/products. It creates version 1 of
+// a product from its code and terms.
+func (h *ProductHandler) createProduct(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+		productTerms
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	product, err := h.svc.CreateProduct(c.Request.Context(), req.product(req.Code))
+	if err != nil {
+		productError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, product)
+}
+
+// publishVersion handles POST /admin/products/:code/versions. The terms
+// in the body become the next version of the product, used by the
+// loans created from then on. Existing loans are not changed.
+func (h *ProductHandler) publishVersion(c *gin.Context) {
+	var req productTerms
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	product, err := h.svc.PublishVersion(c.Request.Context(), c.Param("code"), req.product(""))
+	if err != nil {
+		productError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, product)
+}
+
+// listProducts handles GET /products. It returns the latest version of
+// every product.
+func (h *ProductHandler) listProducts(c *gin.Context) {
+	products, err := h.svc.ListProducts(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, products)
+}
+
+// getProduct handles GET /products/:code. It returns the latest version
+// of the product.
+func (h *ProductHandler) getProduct(c *gin.Context) {
+	product, err := h.svc.GetProduct(c.Request.Context(), c.Param("code"), 0)
+	if err != nil {
+		productError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+// listVersions handles GET /products/:code/versions. It returns every
+// version of the product, oldest first.
+func (h *ProductHandler) listVersions(c *gin.Context) {
+	versions, err := h.svc.ListVersions(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		productError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, versions)
+}
+
+// getVersion handles GET /products/:code/versions/:version.
+func (h *ProductHandler) getVersion(c *gin.Context) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version must be a positive integer"})
+		return
+	}
+	product, err := h.svc.GetProduct(c.Request.Context(), c.Param("code"), version)
+	if err != nil {
+		productError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+// productError writes the response for an error of a product
+// operation: 404 for an unknown product or version, 409 when the
+// product or version already exists and 400 for rejected terms.
+func productError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrProductExists), errors.Is(err, repository.ErrDuplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
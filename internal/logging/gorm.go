@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// slowQueryThreshold is the duration above which queries are logged
+// as warnings.
+const slowQueryThreshold = 200 * time.Millisecond
+
+// GormLogger writes GORM's log output through slog, so that database
+// errors and slow queries carry the request ID of the request that
+// issued them. Query parameters are never logged; only the statement
+// with placeholders is.
+type GormLogger struct {
+	logger *slog.Logger
+}
+
+// NewGormLogger returns a GORM logger writing to logger.
+func NewGormLogger(logger *slog.Logger) *GormLogger {
+	return &GormLogger{logger: logger}
+}
+
+// LogMode implements gormlogger.Interface. The level is controlled by
+// the slog handler instead.
+func (l *GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface { return l }
+
+// Info implements gormlogger.Interface.
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.InfoContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+// Warn implements gormlogger.Interface.
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.WarnContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+// Error implements gormlogger.Interface.
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.logger.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+// Trace implements gormlogger.Interface. Failed queries are logged as
+// errors, slow queries as warnings and everything else at debug
+// level. Missing records are expected by callers and not treated as
+// failures.
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	level := slog.LevelDebug
+	msg := "query"
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, msg = slog.LevelError, "query failed"
+	case elapsed > slowQueryThreshold:
+		level, msg = slog.LevelWarn, "slow query"
+	}
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Duration("duration", elapsed),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	l.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// ParamsFilter drops the query parameters, which may contain personal
+// data, so that Trace receives statements with placeholders only.
+func (l *GormLogger) ParamsFilter(_ context.Context, sql string, _ ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
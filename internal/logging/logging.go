@@ -0,0 +1,114 @@
+// Package logging configures the structured JSON logger of the
+// service. Every record logged with a context carries the request ID
+// of the HTTP request it belongs to, and personal data such as
+// investor names and email addresses is redacted before records are
+// written.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the value of sensitive attributes.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys lists attribute keys whose values are always
+// redacted, wherever they appear in a record. Personal data must be
+// logged under one of these keys; generic keys such as "name" are not
+// redacted because they also label migrations, sweeps and products.
+var sensitiveKeys = map[string]bool{
+	"email":          true,
+	"investor_name":  true,
+	"investor_email": true,
+	"borrower_name":  true,
+	"password":       true,
+}
+
+// emailPattern matches email addresses embedded in free text, such as
+// error messages or SQL statements.
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// ParseLevel parses a level name such as "debug", "info", "warn" or
+// "error".
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", s)
+	}
+	return level, nil
+}
+
+// New returns a logger writing JSON records at or above level to w.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	h := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	})
+	return slog.New(&contextHandler{Handler: h})
+}
+
+// redact implements slog.HandlerOptions.ReplaceAttr.
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, Redacted)
+	}
+	if a.Value.Kind() == slog.KindString {
+		return slog.String(a.Key, RedactText(a.Value.String()))
+	}
+	if a.Value.Kind() == slog.KindAny {
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, RedactText(err.Error()))
+		}
+	}
+	return a
+}
+
+// RedactText masks email addresses in s.
+func RedactText(s string) string {
+	if !strings.Contains(s, "@") {
+		return s
+	}
+	return emailPattern.ReplaceAllString(s, Redacted)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID from the record's context to
+// every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if id := RequestID(ctx); id != "" {
+			r.AddAttrs(slog.String("request_id", id))
+		}
+	}
+	r.Message = RedactText(r.Message)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
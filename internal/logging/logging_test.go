@@ -0,0 +1,143 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"loan_service/internal/domain"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestNew_RedactsPersonalData(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	logger.Info("notifying alice@example.com",
+		"investor_email", "alice@example.com",
+		"investor_name", "Alice",
+		"investor", domain.Investor{ID: "inv-1", Name: "Alice", Email: "alice@example.com"},
+		"error", errors.New("duplicate key alice@example.com"),
+		"loan_id", "L1",
+		"name", "0001_init",
+	)
+
+	out := buf.String()
+	assert.NotContains(t, out, "alice@example.com")
+	assert.NotContains(t, out, "Alice")
+	rec := decode(t, &buf)[0]
+	assert.Equal(t, "notifying "+Redacted, rec["msg"])
+	assert.Equal(t, Redacted, rec["investor_email"])
+	assert.Equal(t, map[string]any{"id": "inv-1"}, rec["investor"])
+	assert.Equal(t, "duplicate key "+Redacted, rec["error"])
+	assert.Equal(t, "L1", rec["loan_id"])
+	assert.Equal(t, "0001_init", rec["name"], "only personal data keys are redacted")
+}
+
+func TestNew_AddsRequestIDAndFiltersLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelWarn)
+	ctx := WithRequestID(context.Background(), "req-1")
+
+	logger.InfoContext(ctx, "dropped")
+	logger.WarnContext(ctx, "kept")
+	logger.Warn("no context")
+
+	records := decode(t, &buf)
+	require.Len(t, records, 2)
+	assert.Equal(t, "kept", records[0]["msg"])
+	assert.Equal(t, "req-1", records[0]["request_id"])
+	assert.NotContains(t, records[1], "request_id")
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("debug")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, level)
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestMiddleware_PropagatesRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+	r := gin.New()
+	r.Use(Middleware(logger))
+	var seen string
+	r.GET("/loans/:id", func(c *gin.Context) {
+		seen = RequestID(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/loans/L1", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, "abc-123", seen)
+	assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+	rec := decode(t, &buf)[0]
+	assert.Equal(t, "abc-123", rec["request_id"])
+	assert.Equal(t, "/loans/:id", rec["route"])
+	assert.Equal(t, float64(http.StatusOK), rec["status"])
+}
+
+func TestMiddleware_GeneratesInvalidOrMissingRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Middleware(New(&bytes.Buffer{}, slog.LevelInfo)))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, id := range []string{"", "has space", strings.Repeat("x", maxRequestIDLength+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, id)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		got := w.Header().Get(RequestIDHeader)
+		assert.Len(t, got, 36, "id %q", id)
+		assert.NotEqual(t, id, got)
+	}
+}
+
+func TestGormLogger_LogsFailedQueriesWithoutParameters(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewGormLogger(New(&buf, slog.LevelInfo))
+	ctx := WithRequestID(context.Background(), "req-9")
+	sql, vars := l.ParamsFilter(ctx, "SELECT * FROM investors WHERE email = $1", "bob@example.com")
+	assert.Nil(t, vars)
+
+	l.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, nil)
+	l.Trace(ctx, time.Now(), func() (string, int64) { return sql, 0 }, errors.New("boom"))
+
+	records := decode(t, &buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, "query failed", records[0]["msg"])
+	assert.Equal(t, "SELECT * FROM investors WHERE email = $1", records[0]["sql"])
+	assert.Equal(t, "req-9", records[0]["request_id"])
+}
@@ -0,0 +1,194 @@
+// Package metrics exposes Prometheus metrics for HTTP traffic, the
+// database connection pool and loan business events. Labels are
+// limited to values from small fixed sets, such as route templates
+// and loan states, so that series cardinality stays bounded; loan and
+// investor IDs are never used as labels.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"loan_service/internal/domain"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "loan_service"
+
+// unmatchedRoute labels requests that did not match any route, so
+// that probing for random paths cannot create new series.
+const unmatchedRoute = "unmatched"
+
+// Metrics holds the collectors of the service. It implements
+// service.Metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpDuration      *prometheus.HistogramVec
+	stateTransitions  *prometheus.CounterVec
+	investments       prometheus.Counter
+	investedAmount    prometheus.Counter
+	overfundingChecks prometheus.Counter
+	timeToFunded      prometheus.Histogram
+}
+
+// New creates the service metrics together with the standard Go
+// runtime and process collectors in a dedicated registry.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by method, route template and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		stateTransitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "loan_state_transitions_total",
+			Help:      "Loan state transitions; from is empty for newly created loans.",
+		}, []string{"from", "to"}),
+		investments: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "investments_total",
+			Help:      "Investments accepted.",
+		}),
+		investedAmount: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "invested_amount_total",
+			Help:      "Sum of the amounts of accepted investments.",
+		}),
+		overfundingChecks: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "investments_overfunding_rejected_total",
+			Help:      "Investments rejected because they would exceed the loan principal.",
+		}),
+		timeToFunded: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "loan_time_to_funded_seconds",
+			Help:      "Time from loan approval until the loan is fully funded.",
+			// One minute up to roughly six months.
+			Buckets: prometheus.ExponentialBuckets(60, 4, 10),
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpDuration,
+		m.stateTransitions,
+		m.investments,
+		m.investedAmount,
+		m.overfundingChecks,
+		m.timeToFunded,
+	)
+	return m
+}
+
+// RegisterDBStats adds gauges and counters describing the connection
+// pool of db, such as open, in-use and idle connections and wait
+// time.
+func (m *Metrics) RegisterDBStats(db *sql.DB) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// RegisterLoanStates adds a gauge reporting the number of loans per
+// state, read from src at scrape time.
+func (m *Metrics) RegisterLoanStates(src LoanStateCounter) {
+	m.registry.MustRegister(&loanStateCollector{src: src, desc: loansDesc})
+}
+
+// Handler returns the HTTP handler serving the metrics in the
+// Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware returns Gin middleware observing the duration of every
+// request. Requests are labelled with the route template, for example
+// /loans/:id, rather than the concrete path.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		m.httpDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// LoanStateChanged implements service.Metrics.
+func (m *Metrics) LoanStateChanged(from, to domain.LoanState) {
+	m.stateTransitions.WithLabelValues(string(from), string(to)).Inc()
+}
+
+// InvestmentAccepted implements service.Metrics.
+func (m *Metrics) InvestmentAccepted(amount float64) {
+	m.investments.Inc()
+	m.investedAmount.Add(amount)
+}
+
+// OverfundingRejected implements service.Metrics.
+func (m *Metrics) OverfundingRejected() { m.overfundingChecks.Inc() }
+
+// LoanFunded implements service.Metrics.
+func (m *Metrics) LoanFunded(elapsed time.Duration) {
+	m.timeToFunded.Observe(elapsed.Seconds())
+}
+
+// LoanStateCounter counts loans per state. The concrete implementation
+// is repository.LoanRepository.
+type LoanStateCounter interface {
+	CountLoansByState(ctx context.Context) (map[domain.LoanState]int64, error)
+}
+
+// loanStateScrapeTimeout bounds the query run for each scrape.
+const loanStateScrapeTimeout = 2 * time.Second
+
+var loansDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "loans"),
+	"Number of loans by state.",
+	[]string{"state"}, nil,
+)
+
+// loanStateCollector queries the loan counts whenever it is scraped,
+// so the gauge reflects loans created by every instance.
+type loanStateCollector struct {
+	src  LoanStateCounter
+	desc *prometheus.Desc
+}
+
+func (c *loanStateCollector) Describe(ch chan<- *prometheus.Desc) { ch <- c.desc }
+
+func (c *loanStateCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), loanStateScrapeTimeout)
+	defer cancel()
+	counts, err := c.src.CountLoansByState(ctx)
+	if err != nil {
+		slog.Error("failed to count loans by state for metrics", "error", err)
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for _, state := range []domain.LoanState{
+		domain.LoanStateProposed,
+		domain.LoanStateApproved,
+		domain.LoanStateInvested,
+		domain.LoanStateDisbursed,
+		domain.LoanStateRepaid,
+		domain.LoanStateCancelled,
+		domain.LoanStateExpired,
+	} {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(counts[state]), string(state))
+	}
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"loan_service/internal/domain"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware_LabelsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New()
+	r := gin.New()
+	r.Use(m.Middleware())
+	r.GET("/loans/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/loans/a", "/loans/b", "/nope/x", "/nope/y"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	families, err := m.registry.Gather()
+	require.NoError(t, err)
+	counts := map[string]uint64{}
+	for _, mf := range families {
+		if mf.GetName() != "loan_service_http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, lp := range metric.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			counts[labels["route"]+" "+labels["status"]] = metric.GetHistogram().GetSampleCount()
+		}
+	}
+	assert.Equal(t, map[string]uint64{
+		"/loans/:id 200": 2,
+		"unmatched 404":  2,
+	}, counts)
+}
+
+func TestBusinessMetrics(t *testing.T) {
+	m := New()
+	m.LoanStateChanged("", domain.LoanStateProposed)
+	m.LoanStateChanged(domain.LoanStateProposed, domain.LoanStateApproved)
+	m.LoanStateChanged(domain.LoanStateProposed, domain.LoanStateApproved)
+	m.InvestmentAccepted(400)
+	m.InvestmentAccepted(600)
+	m.OverfundingRejected()
+	m.LoanFunded(2 * time.Hour)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.stateTransitions.WithLabelValues("proposed", "approved")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.stateTransitions.WithLabelValues("", "proposed")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.investments))
+	assert.Equal(t, 1000.0, testutil.ToFloat64(m.investedAmount))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.overfundingChecks))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.timeToFunded))
+}
+
+type fakeStateCounter map[domain.LoanState]int64
+
+func (f fakeStateCounter) CountLoansByState(context.Context) (map[domain.LoanState]int64, error) {
+	return f, nil
+}
+
+func TestLoanStateCollector(t *testing.T) {
+	c := &loanStateCollector{
+		src:  fakeStateCounter{domain.LoanStateApproved: 3, domain.LoanStateDisbursed: 1},
+		desc: loansDesc,
+	}
+	expected := `
+# HELP loan_service_loans Number of loans by state.
+# TYPE loan_service_loans gauge
+loan_service_loans{state="approved"} 3
+loan_service_loans{state="cancelled"} 0
+loan_service_loans{state="disbursed"} 1
+loan_service_loans{state="expired"} 0
+loan_service_loans{state="invested"} 0
+loan_service_loans{state="proposed"} 0
+loan_service_loans{state="repaid"} 0
+`
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
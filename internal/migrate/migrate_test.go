@@ -0,0 +1,120 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"loan_service/migrations"
+
+	_ "github.com/glebarez/go-sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_OrdersAndPairsScripts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_add_column.up.sql":      {Data: []byte("ALTER 2")},
+		"002_add_column.down.sql":    {Data: []byte("REVERT 2")},
+		"001_create_tables.up.sql":   {Data: []byte("CREATE 1")},
+		"001_create_tables.down.sql": {Data: []byte("DROP 1")},
+		"migrations.go":              {Data: []byte("package migrations")},
+	}
+
+	got, err := Load(fsys)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, Migration{Version: 1, Name: "create_tables", Up: "CREATE 1", Down: "DROP 1"}, got[0])
+	assert.Equal(t, int64(2), got[1].Version)
+	assert.Equal(t, "REVERT 2", got[1].Down)
+}
+
+func TestLoad_RejectsInvalidSets(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"missing down": {
+			"001_create.up.sql": {Data: []byte("x")},
+		},
+		"no direction": {
+			"001_create.sql": {Data: []byte("x")},
+		},
+		"bad version": {
+			"one_create.up.sql":   {Data: []byte("x")},
+			"one_create.down.sql": {Data: []byte("x")},
+		},
+		"duplicate version": {
+			"001_a.up.sql":   {Data: []byte("x")},
+			"001_a.down.sql": {Data: []byte("x")},
+			"001_b.up.sql":   {Data: []byte("x")},
+			"001_b.down.sql": {Data: []byte("x")},
+		},
+	}
+	for name, fsys := range cases {
+		_, err := Load(fsys)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestLoad_EmbeddedMigrations(t *testing.T) {
+	got, err := Load(migrations.FS)
+	require.NoError(t, err)
+	require.NotEmpty(t, got)
+	for i, m := range got {
+		assert.Equal(t, int64(i+1), m.Version, "migration versions must be contiguous")
+	}
+
+	// Every Postgres migration has a SQLite counterpart.
+	files, err := migrations.ForDialect("sqlite")
+	require.NoError(t, err)
+	sqlite, err := Load(files)
+	require.NoError(t, err)
+	require.Len(t, sqlite, len(got))
+	for i := range got {
+		assert.Equal(t, got[i].Version, sqlite[i].Version)
+		assert.Equal(t, got[i].Name, sqlite[i].Name)
+	}
+}
+
+func TestRunner_SQLite(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "test.db")+"?_pragma=foreign_keys(1)")
+	require.NoError(t, err)
+	defer db.Close()
+	files, err := migrations.ForDialect("sqlite")
+	require.NoError(t, err)
+	r, err := New(db, SQLite, files)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, r.Check(ctx), ErrSchemaOutdated)
+	version, err := r.Version(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, version)
+	// Checking the schema must not create anything.
+	var tables int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'").Scan(&tables))
+	assert.Zero(t, tables)
+
+	applied, err := r.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, int(r.Latest()))
+	require.NoError(t, r.Check(ctx))
+	version, err = r.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, r.Latest(), version)
+
+	// Every migration can be reverted and applied again.
+	reverted, err := r.Down(ctx, len(applied))
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(applied))
+	version, err = r.Version(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, version)
+	_, err = r.Up(ctx)
+	require.NoError(t, err)
+	statuses, err := r.Status(ctx)
+	require.NoError(t, err)
+	for _, st := range statuses {
+		assert.NotNil(t, st.AppliedAt, st.Name)
+	}
+}
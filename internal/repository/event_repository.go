@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+
+	"loan_service/internal/domain"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// LoanEventsChannel is the Postgres NOTIFY channel on which newly
+// appended loan events are announced. Every service instance listens
+// on this channel so that events produced by one instance reach the
+// stream subscribers connected to any other instance.
+const LoanEventsChannel = "loan_events"
+
+// loanEventsLock is the key of the Postgres advisory lock serialising
+// event appends.
+const loanEventsLock = 0x6c6f616e // "loan"
+
+// EventRepository persists loan events and announces them to other
+// service instances through Postgres LISTEN/NOTIFY.
+type EventRepository struct {
+	db *gorm.DB
+}
+
+// NewEventRepository instantiates a new event repository bound to the
+// given GORM database handle.
+func NewEventRepository(db *gorm.DB) *EventRepository {
+	return &EventRepository{db: db}
+}
+
+// AppendEvent inserts the event and issues a pg_notify carrying the
+// JSON encoded event in the same transaction. Postgres only delivers
+// the notification once the transaction commits, so listeners never
+// observe an event that is not yet readable from the table. The
+// sequence identifier is populated on the passed event.
+//
+// BIGSERIAL values are assigned on insert, not on commit, so two
+// concurrent appends could commit, and notify, out of ID order, and a
+// stream client that had already seen the higher ID would skip the
+// lower one for good. Appends therefore take a transaction-scoped
+// advisory lock before inserting, which makes IDs commit in ascending
+// order.
+//
+// On SQLite, which has no notifications, the event is only inserted;
+// writers are serialised by the database, so IDs commit in order. Use
+// the repository with events.NewLocalBus there.
+func (r *EventRepository) AppendEvent(ctx context.Context, ev *domain.LoanEvent) error {
+	if r.db.Dialector.Name() != "postgres" {
+		return r.db.WithContext(ctx).Create(ev).Error
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", loanEventsLock).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(ev).Error; err != nil {
+			return err
+		}
+		payload, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		return tx.Exec("SELECT pg_notify(?, ?)", LoanEventsChannel, string(payload)).Error
+	})
+}
+
+// ListEventsAfter returns up to limit events with an identifier
+// greater than afterID in ascending order. When loanID is empty events
+// for all loans are returned. It is used to replay events a client
+// missed while disconnected.
+//
+// The query always reads from the primary. Stream handlers subscribe
+// before replaying and drop live events they have already replayed,
+// so a replica lagging behind would make them skip an event for good.
+func (r *EventRepository) ListEventsAfter(ctx context.Context, loanID string, afterID int64, limit int) ([]domain.LoanEvent, error) {
+	var events []domain.LoanEvent
+	q := r.db.WithContext(ctx).Clauses(dbresolver.Write).Where("id > ?", afterID)
+	if loanID != "" {
+		q = q.Where("loan_id = ?", loanID)
+	}
+	if err := q.Order("id ASC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,568 @@
+//go:build integration
+
+// The integration suite runs the repositories against a real Postgres
+// with the embedded migrations applied:
+//
+//	go test -tags integration ./internal/repository/
+//
+// By default an ephemeral Postgres is downloaded once into the user
+// cache directory and started on a free port. Postgres refuses to run
+// as root; set TEST_DATABASE_URL to use an existing, empty database
+// instead, for example a service container in CI.
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/migrate"
+	"loan_service/internal/repository"
+	"loan_service/internal/service"
+	"loan_service/migrations"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// pg is the migrated database shared by the integration tests and
+// pgDSN its connection URL.
+var (
+	pg    *gorm.DB
+	pgDSN string
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runIntegration(m))
+}
+
+func runIntegration(m *testing.M) int {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		stop, url, err := startPostgres()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "start postgres:", err)
+			return 1
+		}
+		defer stop()
+		dsn = url
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger:         logger.Discard,
+		TranslateError: true,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "connect postgres:", err)
+		return 1
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer sqlDB.Close()
+	if err := migrateUp(sqlDB); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	pg, pgDSN = db, dsn
+	return m.Run()
+}
+
+// startPostgres starts an ephemeral Postgres on a free port and
+// returns a function stopping it and its connection URL.
+func startPostgres() (func(), string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", err
+	}
+	port := uint32(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+
+	runtime, err := os.MkdirTemp("", "loan-service-pg-")
+	if err != nil {
+		return nil, "", err
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		cache = os.TempDir()
+	}
+	cfg := embeddedpostgres.DefaultConfig().
+		Version(embeddedpostgres.V16).
+		Port(port).
+		Database("loan_service_test").
+		RuntimePath(runtime).
+		CachePath(filepath.Join(cache, "embedded-postgres")).
+		Logger(nil).
+		StartTimeout(time.Minute)
+	db := embeddedpostgres.NewDatabase(cfg)
+	if err := db.Start(); err != nil {
+		os.RemoveAll(runtime)
+		return nil, "", err
+	}
+	stop := func() {
+		if err := db.Stop(); err != nil {
+			fmt.Fprintln(os.Stderr, "stop postgres:", err)
+		}
+		os.RemoveAll(runtime)
+	}
+	return stop, cfg.GetConnectionURL() + "?sslmode=disable", nil
+}
+
+func migrateUp(db *sql.DB) error {
+	runner, err := migrate.New(db, migrate.Postgres, migrations.FS)
+	if err != nil {
+		return err
+	}
+	_, err = runner.Up(context.Background())
+	return err
+}
+
+// resetDB empties every table so that each test starts from scratch.
+func resetDB(t *testing.T) {
+	t.Helper()
+	require.NoError(t, pg.Exec("TRUNCATE loans, investors, documents, loan_events, journal_entries, postings, ledger_accounts CASCADE").Error)
+}
+
+func newLoan(t *testing.T, repo *repository.LoanRepository, principal float64, state domain.LoanState) *domain.Loan {
+	t.Helper()
+	now := time.Now().UTC()
+	loan := &domain.Loan{BorrowerID: "BRW", Principal: principal, Rate: 10, ROI: 8, State: state, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, repo.CreateLoan(context.Background(), loan))
+	return loan
+}
+
+func newInvestor(t *testing.T, repo *repository.LoanRepository, email string) *domain.Investor {
+	t.Helper()
+	inv := &domain.Investor{Name: "Investor", Email: email, CreatedAt: time.Now().UTC()}
+	require.NoError(t, repo.CreateInvestor(context.Background(), inv))
+	return inv
+}
+
+func TestIntegration_LoanPreloadShapes(t *testing.T) {
+	resetDB(t)
+	repo := repository.NewLoanRepository(pg)
+	ctx := context.Background()
+
+	loan := newLoan(t, repo, 1000, domain.LoanStateProposed)
+	assert.Len(t, loan.ID, 36, "IDs are generated in Go")
+
+	// A new loan has no associations.
+	got, err := repo.GetLoanByID(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got.Approval)
+	assert.Nil(t, got.Disbursement)
+	assert.Empty(t, got.Investments)
+	assert.Equal(t, 1000.0, got.Principal)
+
+	now := time.Now().UTC()
+	require.NoError(t, repo.CreateApproval(ctx, &domain.Approval{LoanID: loan.ID, PictureURL: "/p", EmployeeID: "E1", ApprovalDate: now, CreatedAt: now}))
+	investor := newInvestor(t, repo, "ann@example.com")
+	inv := &domain.Investment{LoanID: loan.ID, InvestorID: investor.ID, Amount: 400, CreatedAt: now}
+	require.NoError(t, repo.CreateInvestment(ctx, inv))
+	require.NoError(t, repo.CreateDisbursement(ctx, &domain.Disbursement{LoanID: loan.ID, AgreementURL: "/a", EmployeeID: "E2", DisbursementDate: now, CreatedAt: now}))
+
+	for name, load := range map[string]func(context.Context, string) (*domain.Loan, error){
+		"GetLoanByID":      repo.GetLoanByID,
+		"GetLoanForUpdate": repo.GetLoanForUpdate,
+	} {
+		var got *domain.Loan
+		err := repo.Transaction(ctx, func(ctx context.Context) (err error) {
+			got, err = load(ctx, loan.ID)
+			return err
+		})
+		require.NoError(t, err, name)
+		require.NotNil(t, got.Approval, name)
+		assert.Equal(t, "E1", got.Approval.EmployeeID, name)
+		require.NotNil(t, got.Disbursement, name)
+		assert.Equal(t, "E2", got.Disbursement.EmployeeID, name)
+		require.Len(t, got.Investments, 1, name)
+		assert.Equal(t, inv.ID, got.Investments[0].ID, name)
+		assert.Equal(t, "BRW", got.BorrowerID, name)
+	}
+
+	loans, err := repo.ListLoans(ctx)
+	require.NoError(t, err)
+	require.Len(t, loans, 1)
+	assert.NotNil(t, loans[0].Approval)
+	assert.Len(t, loans[0].Investments, 1)
+
+	_, err = repo.GetLoanByID(ctx, uuid.NewString())
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestIntegration_ConstraintViolations(t *testing.T) {
+	resetDB(t)
+	repo := repository.NewLoanRepository(pg)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	loan := newLoan(t, repo, 1000, domain.LoanStateApproved)
+	investor := newInvestor(t, repo, "ann@example.com")
+
+	require.NoError(t, repo.CreateApproval(ctx, &domain.Approval{LoanID: loan.ID, PictureURL: "/p", EmployeeID: "E1", ApprovalDate: now, CreatedAt: now}))
+	err := repo.CreateApproval(ctx, &domain.Approval{LoanID: loan.ID, PictureURL: "/p", EmployeeID: "E2", ApprovalDate: now, CreatedAt: now})
+	assert.ErrorIs(t, err, repository.ErrDuplicate, "one approval per loan")
+
+	require.NoError(t, repo.CreateDisbursement(ctx, &domain.Disbursement{LoanID: loan.ID, AgreementURL: "/a", EmployeeID: "E1", DisbursementDate: now, CreatedAt: now}))
+	err = repo.CreateDisbursement(ctx, &domain.Disbursement{LoanID: loan.ID, AgreementURL: "/a", EmployeeID: "E2", DisbursementDate: now, CreatedAt: now})
+	assert.ErrorIs(t, err, repository.ErrDuplicate, "one disbursement per loan")
+
+	err = repo.CreateLoan(ctx, &domain.Loan{ID: loan.ID, BorrowerID: "BRW", State: domain.LoanStateProposed, CreatedAt: now, UpdatedAt: now})
+	assert.ErrorIs(t, err, repository.ErrDuplicate, "duplicate primary key")
+
+	err = repo.CreateInvestment(ctx, &domain.Investment{LoanID: uuid.NewString(), InvestorID: investor.ID, Amount: 1, CreatedAt: now})
+	assert.ErrorIs(t, err, repository.ErrForeignKey, "unknown loan")
+	err = repo.CreateInvestment(ctx, &domain.Investment{LoanID: loan.ID, InvestorID: uuid.NewString(), Amount: 1, CreatedAt: now})
+	assert.ErrorIs(t, err, repository.ErrForeignKey, "unknown investor")
+	err = repo.CreateApproval(ctx, &domain.Approval{LoanID: uuid.NewString(), PictureURL: "/p", EmployeeID: "E1", ApprovalDate: now, CreatedAt: now})
+	assert.ErrorIs(t, err, repository.ErrForeignKey, "approval of unknown loan")
+	err = repo.CreateApproval(ctx, &domain.Approval{LoanID: loan.ID, PictureDocumentID: uuid.NewString(), PictureURL: "/p", EmployeeID: "E1", ApprovalDate: now, CreatedAt: now})
+	assert.Error(t, err, "unknown picture document")
+}
+
+func TestIntegration_TotalInvested(t *testing.T) {
+	resetDB(t)
+	repo := repository.NewLoanRepository(pg)
+	ctx := context.Background()
+	loan := newLoan(t, repo, 1000, domain.LoanStateApproved)
+	other := newLoan(t, repo, 1000, domain.LoanStateApproved)
+	investor := newInvestor(t, repo, "ann@example.com")
+
+	// COALESCE turns the NULL sum of no rows into zero.
+	total, err := repo.GetTotalInvested(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+
+	for _, amount := range []float64{100.25, 200.50, 0.25} {
+		require.NoError(t, repo.CreateInvestment(ctx, &domain.Investment{LoanID: loan.ID, InvestorID: investor.ID, Amount: amount, CreatedAt: time.Now().UTC()}))
+	}
+	require.NoError(t, repo.CreateInvestment(ctx, &domain.Investment{LoanID: other.ID, InvestorID: investor.ID, Amount: 999, CreatedAt: time.Now().UTC()}))
+
+	total, err = repo.GetTotalInvested(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 301.0, total)
+}
+
+func TestIntegration_UpdatesAndLookups(t *testing.T) {
+	resetDB(t)
+	repo := repository.NewLoanRepository(pg)
+	ctx := context.Background()
+	loan := newLoan(t, repo, 1000, domain.LoanStateApproved)
+	investor := newInvestor(t, repo, "ann@example.com")
+
+	loan.State = domain.LoanStateInvested
+	loan.AgreementLetterURL = "/documents/x/content"
+	require.NoError(t, repo.UpdateLoan(ctx, loan))
+	got, err := repo.GetLoanByID(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.LoanStateInvested, got.State)
+	assert.Equal(t, "/documents/x/content", got.AgreementLetterURL)
+
+	inv := &domain.Investment{LoanID: loan.ID, InvestorID: investor.ID, Amount: 1000, CreatedAt: time.Now().UTC()}
+	require.NoError(t, repo.CreateInvestment(ctx, inv))
+	inv.AgreementURL = "/documents/y/content"
+	require.NoError(t, repo.UpdateInvestment(ctx, inv))
+	got, err = repo.GetLoanByID(ctx, loan.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Investments, 1)
+	assert.Equal(t, "/documents/y/content", got.Investments[0].AgreementURL)
+
+	found, err := repo.GetInvestorByID(ctx, investor.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "ann@example.com", found.Email)
+	_, err = repo.GetInvestorByID(ctx, uuid.NewString())
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	found, err = repo.FindInvestorByEmail(ctx, "ann@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, investor.ID, found.ID)
+	found, err = repo.FindInvestorByEmail(ctx, "nobody@example.com")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+
+	doc := &domain.Document{Kind: domain.DocumentKindApprovalProof, FileName: "p.png", ContentType: "image/png", Size: 3, SHA256: "00", StorageKey: "k", CreatedAt: time.Now().UTC()}
+	require.NoError(t, repo.CreateDocument(ctx, doc))
+	gotDoc, err := repo.GetDocumentByID(ctx, doc.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "p.png", gotDoc.FileName)
+	_, err = repo.GetDocumentByID(ctx, uuid.NewString())
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	newLoan(t, repo, 500, domain.LoanStateProposed)
+	counts, err := repo.CountLoansByState(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[domain.LoanState]int64{domain.LoanStateInvested: 1, domain.LoanStateProposed: 1}, counts)
+}
+
+func TestIntegration_TransactionRollsBack(t *testing.T) {
+	resetDB(t)
+	repo := repository.NewLoanRepository(pg)
+	ctx := context.Background()
+	loan := newLoan(t, repo, 1000, domain.LoanStateApproved)
+	investor := newInvestor(t, repo, "ann@example.com")
+
+	err := repo.Transaction(ctx, func(ctx context.Context) error {
+		if err := repo.CreateInvestment(ctx, &domain.Investment{LoanID: loan.ID, InvestorID: investor.ID, Amount: 100, CreatedAt: time.Now().UTC()}); err != nil {
+			return err
+		}
+		return fmt.Errorf("abort")
+	})
+	require.Error(t, err)
+	total, err := repo.GetTotalInvested(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+}
+
+// TestIntegration_ConcurrentInvestments invests in one loan from many
+// goroutines through the service. The row lock taken by
+// GetLoanForUpdate must keep the loan from being over-funded, and
+// only the accepted investments may reach the ledger.
+func TestIntegration_ConcurrentInvestments(t *testing.T) {
+	resetDB(t)
+	repo := repository.NewLoanRepository(pg)
+	ledger := service.NewLedgerService(repo)
+	svc := service.NewLoanService(repo, service.WithLedger(ledger))
+	ctx := context.Background()
+	loan := newLoan(t, repo, 1000, domain.LoanStateApproved)
+	investor := newInvestor(t, repo, "ann@example.com")
+	_, err := ledger.Post(ctx, domain.JournalKindDeposit, "", "top-up",
+		domain.Transfer{From: domain.ExternalAccount, To: domain.InvestorWallet(investor.ID), Amount: 5000})
+	require.NoError(t, err)
+
+	const attempts = 25
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		accepted int
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := svc.InvestInLoan(ctx, loan.ID, investor.ID, "", "", 100); err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, accepted)
+	total, err := repo.GetTotalInvested(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1000.0, total)
+	got, err := repo.GetLoanByID(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.LoanStateInvested, got.State)
+	assert.Len(t, got.Investments, 10)
+
+	escrow, err := ledger.Balance(ctx, domain.LoanEscrow(loan.ID))
+	require.NoError(t, err)
+	assert.Equal(t, 1000.0, escrow)
+	check, err := ledger.Check(ctx)
+	require.NoError(t, err)
+	assert.True(t, check.Balanced())
+	assert.Equal(t, 6000.0, check.Debits, "the top-up and one investment per accepted investment")
+	wallet, err := ledger.Balance(ctx, domain.InvestorWallet(investor.ID))
+	require.NoError(t, err)
+	assert.Equal(t, 4000.0, wallet)
+}
+
+// TestIntegration_ConcurrentWalletSpending invests from one wallet in
+// two loans at once. The wallet lock must keep the investor from
+// spending more than the balance, even though the loans are locked
+// independently.
+func TestIntegration_ConcurrentWalletSpending(t *testing.T) {
+	resetDB(t)
+	repo := repository.NewLoanRepository(pg)
+	ledger := service.NewLedgerService(repo)
+	svc := service.NewLoanService(repo, service.WithLedger(ledger))
+	ctx := context.Background()
+	loans := []*domain.Loan{newLoan(t, repo, 1000, domain.LoanStateApproved), newLoan(t, repo, 1000, domain.LoanStateApproved)}
+	investor := newInvestor(t, repo, "ann@example.com")
+	_, err := ledger.Post(ctx, domain.JournalKindDeposit, "", "top-up",
+		domain.Transfer{From: domain.ExternalAccount, To: domain.InvestorWallet(investor.ID), Amount: 500})
+	require.NoError(t, err)
+
+	const attempts = 20
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		accepted int
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(loan *domain.Loan) {
+			defer wg.Done()
+			if _, err := svc.InvestInLoan(ctx, loan.ID, investor.ID, "", "", 100); err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}(loans[i%2])
+	}
+	wg.Wait()
+
+	assert.Equal(t, 5, accepted)
+	wallet, err := ledger.Balance(ctx, domain.InvestorWallet(investor.ID))
+	require.NoError(t, err)
+	assert.Zero(t, wallet)
+}
+
+// TestIntegration_ConcurrentExposure invests from one wallet in two
+// loans at once with an exposure limit. The wallet lock must make the
+// investments see each other, so that together they stay within the
+// limit.
+func TestIntegration_ConcurrentExposure(t *testing.T) {
+	resetDB(t)
+	repo := repository.NewLoanRepository(pg)
+	ledger := service.NewLedgerService(repo)
+	svc := service.NewLoanService(repo, service.WithLedger(ledger), service.WithLimits(service.Limits{MaxInvestorExposure: 500}))
+	ctx := context.Background()
+	loans := []*domain.Loan{newLoan(t, repo, 1000, domain.LoanStateApproved), newLoan(t, repo, 1000, domain.LoanStateApproved)}
+	investor := newInvestor(t, repo, "ann@example.com")
+	_, err := ledger.Post(ctx, domain.JournalKindDeposit, "", "top-up",
+		domain.Transfer{From: domain.ExternalAccount, To: domain.InvestorWallet(investor.ID), Amount: 5000})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(loan *domain.Loan) {
+			defer wg.Done()
+			_, _ = svc.InvestInLoan(ctx, loan.ID, investor.ID, "", "", 100)
+		}(loans[i%2])
+	}
+	wg.Wait()
+
+	exposure, err := repo.GetInvestorExposure(ctx, investor.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 500.0, exposure)
+}
+
+// TestIntegration_ConcurrentReservations reserves and invests in one
+// loan at once. Holds and investments together must never exceed the
+// principal.
+func TestIntegration_ConcurrentReservations(t *testing.T) {
+	resetDB(t)
+	repo := repository.NewLoanRepository(pg)
+	svc := service.NewLoanService(repo)
+	ctx := context.Background()
+	loan := newLoan(t, repo, 1000, domain.LoanStateApproved)
+	investor := newInvestor(t, repo, "ann@example.com")
+
+	const attempts = 20
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				_, _ = svc.Reserve(ctx, loan.ID, investor.ID, 100, time.Minute)
+			} else {
+				_, _ = svc.InvestInLoan(ctx, loan.ID, investor.ID, "", "", 100)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	invested, err := repo.GetTotalInvested(ctx, loan.ID)
+	require.NoError(t, err)
+	reserved, err := repo.GetTotalReserved(ctx, loan.ID, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1000.0, invested+reserved)
+}
+
+func TestIntegration_Events(t *testing.T) {
+	resetDB(t)
+	repo := repository.NewLoanRepository(pg)
+	events := repository.NewEventRepository(pg)
+	ctx := context.Background()
+	loan := newLoan(t, repo, 1000, domain.LoanStateProposed)
+	other := newLoan(t, repo, 1000, domain.LoanStateProposed)
+
+	var ids []int64
+	for _, id := range []string{loan.ID, other.ID, loan.ID} {
+		ev := &domain.LoanEvent{LoanID: id, Type: domain.LoanEventStateChanged, State: domain.LoanStateProposed}
+		require.NoError(t, events.AppendEvent(ctx, ev))
+		ids = append(ids, ev.ID)
+	}
+	assert.Less(t, ids[0], ids[1])
+	assert.Less(t, ids[1], ids[2])
+
+	got, err := events.ListEventsAfter(ctx, loan.ID, ids[0], 10)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, ids[2], got[0].ID)
+
+	got, err = events.ListEventsAfter(ctx, "", 0, 2)
+	require.NoError(t, err)
+	assert.Len(t, got, 2)
+
+	err = events.AppendEvent(ctx, &domain.LoanEvent{LoanID: uuid.NewString(), Type: domain.LoanEventStateChanged, State: domain.LoanStateProposed})
+	assert.ErrorIs(t, err, repository.ErrForeignKey)
+}
+
+// TestIntegration_EventsNotifyInIDOrder interleaves two appends: the
+// first gets its ID and then waits on a lock held by another
+// transaction, while the second starts afterwards. Listeners must
+// still receive them in ID order, or stream clients would skip the
+// first.
+func TestIntegration_EventsNotifyInIDOrder(t *testing.T) {
+	resetDB(t)
+	repo := repository.NewLoanRepository(pg)
+	events := repository.NewEventRepository(pg)
+	ctx := context.Background()
+	first := newLoan(t, repo, 1000, domain.LoanStateProposed)
+	second := newLoan(t, repo, 1000, domain.LoanStateProposed)
+
+	listener, err := pgx.Connect(ctx, pgDSN)
+	require.NoError(t, err)
+	defer listener.Close(ctx)
+	_, err = listener.Exec(ctx, "LISTEN "+repository.LoanEventsChannel)
+	require.NoError(t, err)
+
+	// Locking the first loan blocks the foreign key check of its
+	// event after the event's ID has been assigned.
+	blocker := pg.Begin()
+	require.NoError(t, blocker.Exec("SELECT id FROM loans WHERE id = ? FOR UPDATE", first.ID).Error)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for _, id := range []string{first.ID, second.ID} {
+		go func(id string) {
+			defer wg.Done()
+			assert.NoError(t, events.AppendEvent(ctx, &domain.LoanEvent{LoanID: id, Type: domain.LoanEventStateChanged, State: domain.LoanStateProposed}))
+		}(id)
+		time.Sleep(200 * time.Millisecond)
+	}
+	require.NoError(t, blocker.Commit().Error)
+	wg.Wait()
+
+	var got []domain.LoanEvent
+	for len(got) < 2 {
+		waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		n, err := listener.WaitForNotification(waitCtx)
+		cancel()
+		require.NoError(t, err)
+		var ev domain.LoanEvent
+		require.NoError(t, json.Unmarshal([]byte(n.Payload), &ev))
+		got = append(got, ev)
+	}
+	assert.Equal(t, first.ID, got[0].LoanID)
+	assert.Less(t, got[0].ID, got[1].ID)
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"loan_service/internal/domain"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+// The ledger is stored alongside the loans and accessed through
+// LoanRepository, so that journal entries are written in the same
+// transaction as the loan operation they record.
+
+// EnsureAccount returns the ledger account with the given type and
+// owner, creating it if it does not exist yet. Concurrent calls for
+// the same account return the same row.
+func (r *LoanRepository) EnsureAccount(ctx context.Context, ref domain.AccountRef) (*domain.LedgerAccount, error) {
+	acct := domain.LedgerAccount{Type: ref.Type, OwnerID: ref.OwnerID}
+	ensureID(&acct.ID)
+	if err := r.conn(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&acct).Error; err != nil {
+		return nil, err
+	}
+	var found domain.LedgerAccount
+	if err := r.conn(ctx).Clauses(dbresolver.Write).
+		First(&found, "type = ? AND owner_id = ?", ref.Type, ref.OwnerID).Error; err != nil {
+		return nil, err
+	}
+	return &found, nil
+}
+
+// LockAccount returns the ledger account like EnsureAccount and locks
+// it until the surrounding transaction ends, so that a balance read
+// afterwards cannot be spent concurrently. It must be called within
+// Transaction. As with GetLoanForUpdate, SQLite ignores the lock and
+// relies on immediate transactions instead.
+func (r *LoanRepository) LockAccount(ctx context.Context, ref domain.AccountRef) (*domain.LedgerAccount, error) {
+	acct, err := r.EnsureAccount(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.conn(ctx).Clauses(dbresolver.Write, clause.Locking{Strength: "UPDATE"}).
+		Take(acct, "id = ?", acct.ID).Error; err != nil {
+		return nil, err
+	}
+	return acct, nil
+}
+
+// CreateJournalEntry inserts a journal entry and its postings and
+// adds the postings to the balances of their accounts in the same
+// transaction. Empty IDs are filled with new UUIDs and the postings
+// are linked to the entry. The caller is responsible for the entry
+// being balanced.
+func (r *LoanRepository) CreateJournalEntry(ctx context.Context, entry *domain.JournalEntry) error {
+	ensureID(&entry.ID)
+	for i := range entry.Postings {
+		ensureID(&entry.Postings[i].ID)
+		entry.Postings[i].EntryID = entry.ID
+	}
+	return r.Transaction(ctx, func(ctx context.Context) error {
+		if err := r.conn(ctx).Omit(clause.Associations).Create(entry).Error; err != nil {
+			return err
+		}
+		if len(entry.Postings) == 0 {
+			return nil
+		}
+		if err := r.conn(ctx).Create(&entry.Postings).Error; err != nil {
+			return err
+		}
+		// Accounts are updated in ID order so that concurrent entries
+		// touching the same accounts cannot deadlock.
+		changes := make(map[string]int64)
+		for _, p := range entry.Postings {
+			changes[p.AccountID] += domain.Cents(p.Credit) - domain.Cents(p.Debit)
+		}
+		ids := make([]string, 0, len(changes))
+		for id := range changes {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			if err := r.conn(ctx).Model(&domain.LedgerAccount{}).Where("id = ?", id).
+				Update("balance", gorm.Expr("balance + ?", domain.FromCents(changes[id]))).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// balances returns a query over ledger accounts selecting each
+// account's stored balance alongside its columns.
+func (r *LoanRepository) balances(ctx context.Context) *gorm.DB {
+	return r.conn(ctx).Model(&domain.LedgerAccount{}).Select("ledger_accounts.*")
+}
+
+// GetAccountBalance returns the ledger account with the given ID and
+// its balance. Returns ErrNotFound if the account does not exist.
+func (r *LoanRepository) GetAccountBalance(ctx context.Context, id string) (*domain.AccountBalance, error) {
+	var rows []domain.AccountBalance
+	if err := r.balances(ctx).Where("ledger_accounts.id = ?", id).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	rows[0].Balance = roundCents(rows[0].Balance)
+	return &rows[0], nil
+}
+
+// ListAccountBalances returns the ledger accounts matching filter with
+// their balances, oldest first. An empty filter type or owner matches
+// any.
+func (r *LoanRepository) ListAccountBalances(ctx context.Context, filter domain.AccountRef) ([]domain.AccountBalance, error) {
+	q := r.balances(ctx)
+	if filter.Type != "" {
+		q = q.Where("ledger_accounts.type = ?", filter.Type)
+	}
+	if filter.OwnerID != "" {
+		q = q.Where("ledger_accounts.owner_id = ?", filter.OwnerID)
+	}
+	var rows []domain.AccountBalance
+	if err := q.Order("ledger_accounts.created_at, ledger_accounts.id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].Balance = roundCents(rows[i].Balance)
+	}
+	return rows, nil
+}
+
+// ListAccountEntries returns up to limit journal entries that moved
+// money in or out of the account, newest first, with the net amount
+// credited to the account by each. A limit of zero or less returns
+// every entry.
+func (r *LoanRepository) ListAccountEntries(ctx context.Context, accountID string, limit int) ([]domain.AccountEntry, error) {
+	if limit <= 0 {
+		limit = -1 // no limit
+	}
+	var rows []domain.AccountEntry
+	if err := r.conn(ctx).Model(&domain.Posting{}).
+		Select("journal_entries.id AS entry_id, journal_entries.kind, journal_entries.loan_id, journal_entries.description, journal_entries.created_at, "+
+			r.sum("postings.credit")+" - "+r.sum("postings.debit")+" AS amount").
+		Joins("JOIN journal_entries ON journal_entries.id = postings.entry_id").
+		Where("postings.account_id = ?", accountID).
+		Group("journal_entries.id").
+		Order("journal_entries.created_at DESC, journal_entries.id DESC").
+		Limit(limit).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].Amount = roundCents(rows[i].Amount)
+	}
+	return rows, nil
+}
+
+// CheckLedger verifies that the total of all debits equals the total
+// of all credits and lists the journal entries whose own postings do
+// not balance and the accounts whose stored balance differs from the
+// sum of their postings.
+func (r *LoanRepository) CheckLedger(ctx context.Context) (*domain.LedgerCheck, error) {
+	var totals struct {
+		Debits  float64
+		Credits float64
+	}
+	if err := r.conn(ctx).Model(&domain.Posting{}).
+		Select(r.sum("debit") + " AS debits, " + r.sum("credit") + " AS credits").
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	check := &domain.LedgerCheck{
+		Debits:            roundCents(totals.Debits),
+		Credits:           roundCents(totals.Credits),
+		UnbalancedEntries: []string{},
+	}
+	if err := r.conn(ctx).Model(&domain.Posting{}).
+		Group("entry_id").
+		Having("ROUND("+r.sum("debit")+" - "+r.sum("credit")+", 2) <> 0").
+		Order("entry_id").
+		Pluck("entry_id", &check.UnbalancedEntries).Error; err != nil {
+		return nil, err
+	}
+	check.MismatchedAccounts = []string{}
+	if err := r.conn(ctx).Model(&domain.LedgerAccount{}).
+		Joins("LEFT JOIN postings ON postings.account_id = ledger_accounts.id").
+		Group("ledger_accounts.id").
+		Having("ROUND(ledger_accounts.balance - ("+r.sum("postings.credit")+" - "+r.sum("postings.debit")+"), 2) <> 0").
+		Order("ledger_accounts.id").
+		Pluck("ledger_accounts.id", &check.MismatchedAccounts).Error; err != nil {
+		return nil, err
+	}
+	return check, nil
+}
+
+// roundCents rounds an amount summed by the database to whole cents.
+func roundCents(amount float64) float64 {
+	return domain.FromCents(domain.Cents(amount))
+}
@@ -3,10 +3,14 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"loan_service/internal/domain"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
 )
 
 // LoanRepository provides persistence methods for loans and their
@@ -23,22 +27,88 @@ func NewLoanRepository(db *gorm.DB) *LoanRepository {
 	return &LoanRepository{db: db}
 }
 
+// ensureID sets *id to a new UUID when it is empty. IDs are generated
+// in Go rather than by the database, since SQLite has no UUID
+// function.
+func ensureID(id *string) {
+	if *id == "" {
+		*id = uuid.NewString()
+	}
+}
+
+// txKey is the context key under which Transaction stores the
+// transaction handle.
+type txKey struct{}
+
+// conn returns the transaction started by Transaction when ctx carries
+// one and the shared handle otherwise. Outside of a transaction reads
+// may be served by a read replica; inside one every statement runs on
+// the primary.
+func (r *LoanRepository) conn(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+	return r.db.WithContext(ctx)
+}
+
+// Transaction runs fn in a database transaction on the primary. The
+// repository methods called with the context passed to fn take part
+// in the transaction, which is committed when fn returns nil and
+// rolled back otherwise. Nested calls use savepoints.
+func (r *LoanRepository) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
 // CreateLoan inserts a new loan record into the database. The caller
 // should set all required fields on the loan before invoking this
-// method. The ID will be generated automatically via a database
-// function in the migration.
+// method. An empty ID is filled with a new UUID.
 func (r *LoanRepository) CreateLoan(ctx context.Context, loan *domain.Loan) error {
-	return r.db.WithContext(ctx).Create(loan).Error
+	ensureID(&loan.ID)
+	return r.conn(ctx).Create(loan).Error
 }
 
+// openInvestments selects the investments that have been neither
+// transferred on the secondary market nor cancelled. Loans are loaded
+// with their open investments only, and only those count towards their
+// totals.
+const openInvestments = "investments.transferred_at IS NULL AND investments.cancelled_at IS NULL"
+
 // GetLoanByID retrieves a loan by its ID. It preloads related
-// Approval, Investments and Disbursement records. If the loan is not
+// Approval, open Investments and Disbursement records. If the loan is not
 // found a gorm.ErrRecordNotFound is returned.
 func (r *LoanRepository) GetLoanByID(ctx context.Context, id string) (*domain.Loan, error) {
 	var loan domain.Loan
-	if err := r.db.WithContext(ctx).
+	if err := r.conn(ctx).
 		Preload("Approval").
-		Preload("Investments").
+		Preload("Investments", openInvestments).
+		Preload("Disbursement").
+		First(&loan, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+// GetLoanForUpdate retrieves a loan like GetLoanByID but always reads
+// from the primary and locks the loan row until the surrounding
+// transaction ends, so that concurrent state transitions and
+// investments on the same loan are serialised. It must be called
+// within Transaction.
+//
+// SQLite has no row locks and ignores the locking clause; there the
+// database is opened with immediate transactions, which serialise
+// writers as a whole.
+func (r *LoanRepository) GetLoanForUpdate(ctx context.Context, id string) (*domain.Loan, error) {
+	if err := r.conn(ctx).Clauses(dbresolver.Write, clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		Take(&domain.Loan{}, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	var loan domain.Loan
+	if err := r.conn(ctx).Clauses(dbresolver.Write).
+		Preload("Approval").
+		Preload("Investments", openInvestments).
 		Preload("Disbursement").
 		First(&loan, "id = ?", id).Error; err != nil {
 		return nil, err
@@ -51,7 +121,7 @@ func (r *LoanRepository) GetLoanByID(ctx context.Context, id string) (*domain.Lo
 // method when modifying the state or other top level fields of the
 // loan. It returns an error if the update fails.
 func (r *LoanRepository) UpdateLoan(ctx context.Context, loan *domain.Loan) error {
-	return r.db.WithContext(ctx).Save(loan).Error
+	return r.conn(ctx).Save(loan).Error
 }
 
 // ListLoans returns all loans in the database. It preloads
@@ -59,8 +129,42 @@ func (r *LoanRepository) UpdateLoan(ctx context.Context, loan *domain.Loan) erro
 // production system this method should support pagination.
 func (r *LoanRepository) ListLoans(ctx context.Context) ([]domain.Loan, error) {
 	var loans []domain.Loan
-	if err := r.db.WithContext(ctx).
-		Preload("Approval").Preload("Investments").Preload("Disbursement").
+	if err := r.conn(ctx).
+		Preload("Approval").Preload("Investments", openInvestments).Preload("Disbursement").
+		Find(&loans).Error; err != nil {
+		return nil, err
+	}
+	return loans, nil
+}
+
+// ListLoansByState returns the loans in the given state, oldest first,
+// with their relationships preloaded.
+func (r *LoanRepository) ListLoansByState(ctx context.Context, state domain.LoanState) ([]domain.Loan, error) {
+	var loans []domain.Loan
+	if err := r.conn(ctx).
+		Preload("Approval").Preload("Investments", openInvestments).Preload("Disbursement").
+		Where("state = ?", state).
+		Order("created_at, id").
+		Find(&loans).Error; err != nil {
+		return nil, err
+	}
+	return loans, nil
+}
+
+// ListInvestorLoans returns the loans the investor has invested in,
+// including those whose investments they have since sold or had
+// refunded when the loan was cancelled or expired, but not those they
+// have cancelled every investment in, oldest first.
+func (r *LoanRepository) ListInvestorLoans(ctx context.Context, investorID string) ([]domain.Loan, error) {
+	closedWithLoan := r.conn(ctx).Model(&domain.Refund{}).Select("investment_id").
+		Where("reason <> ?", domain.RefundReasonInvestmentCancelled)
+	invested := r.conn(ctx).Model(&domain.Investment{}).Select("loan_id").
+		Where("investor_id = ? AND (cancelled_at IS NULL OR id IN (?))", investorID, closedWithLoan)
+	var loans []domain.Loan
+	if err := r.conn(ctx).
+		Preload("Approval").Preload("Investments", openInvestments).Preload("Disbursement").
+		Where("id IN (?)", invested).
+		Order("created_at, id").
 		Find(&loans).Error; err != nil {
 		return nil, err
 	}
@@ -72,7 +176,8 @@ func (r *LoanRepository) ListLoans(ctx context.Context) ([]domain.Loan, error) {
 // delegating uniqueness constraints to the database schema. If the
 // insert fails due to a uniqueness violation, an error is returned.
 func (r *LoanRepository) CreateApproval(ctx context.Context, approval *domain.Approval) error {
-	return r.db.WithContext(ctx).Create(approval).Error
+	ensureID(&approval.ID)
+	return r.conn(ctx).Create(approval).Error
 }
 
 // CreateInvestment inserts a new investment record into the
@@ -80,7 +185,185 @@ func (r *LoanRepository) CreateApproval(ctx context.Context, approval *domain.Ap
 // loan are allowed and aggregated at query time. It returns any
 // resulting error.
 func (r *LoanRepository) CreateInvestment(ctx context.Context, investment *domain.Investment) error {
-	return r.db.WithContext(ctx).Create(investment).Error
+	ensureID(&investment.ID)
+	return r.conn(ctx).Create(investment).Error
+}
+
+// CreateRefund inserts a refund record.
+func (r *LoanRepository) CreateRefund(ctx context.Context, refund *domain.Refund) error {
+	ensureID(&refund.ID)
+	return r.conn(ctx).Create(refund).Error
+}
+
+// ListRefunds returns the refunds of the given loan, oldest first.
+func (r *LoanRepository) ListRefunds(ctx context.Context, loanID string) ([]domain.Refund, error) {
+	var refunds []domain.Refund
+	if err := r.conn(ctx).Where("loan_id = ?", loanID).Order("created_at, id").Find(&refunds).Error; err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+// CreateReservation inserts a reservation.
+func (r *LoanRepository) CreateReservation(ctx context.Context, res *domain.Reservation) error {
+	ensureID(&res.ID)
+	return r.conn(ctx).Create(res).Error
+}
+
+// FindReservation returns the reservation with the given ID, or nil
+// and a nil error if there is none.
+func (r *LoanRepository) FindReservation(ctx context.Context, id string) (*domain.Reservation, error) {
+	var res domain.Reservation
+	if err := r.conn(ctx).First(&res, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &res, nil
+}
+
+// UpdateReservation saves the reservation.
+func (r *LoanRepository) UpdateReservation(ctx context.Context, res *domain.Reservation) error {
+	return r.conn(ctx).Save(res).Error
+}
+
+// GetTotalReserved returns the sum of the reservations of the loan
+// that are held and have not expired at the given time.
+func (r *LoanRepository) GetTotalReserved(ctx context.Context, loanID string, at time.Time) (float64, error) {
+	var total float64
+	if err := r.conn(ctx).
+		Model(&domain.Reservation{}).
+		Where("loan_id = ? AND state = ? AND expires_at > ?", loanID, domain.ReservationStateHeld, at.UTC()).
+		Select(r.sum("amount")).
+		Scan(&total).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// ExpireReservations moves the held reservations that expired at or
+// before the given time to the expired state and returns their
+// number.
+func (r *LoanRepository) ExpireReservations(ctx context.Context, at time.Time) (int, error) {
+	res := r.conn(ctx).
+		Model(&domain.Reservation{}).
+		Where("state = ? AND expires_at <= ?", domain.ReservationStateHeld, at.UTC()).
+		Updates(map[string]any{"state": domain.ReservationStateExpired, "updated_at": at.UTC()})
+	return int(res.RowsAffected), res.Error
+}
+
+// CreateListing inserts a secondary market listing. It fails with
+// ErrDuplicate when the investment already has an open listing.
+func (r *LoanRepository) CreateListing(ctx context.Context, listing *domain.Listing) error {
+	ensureID(&listing.ID)
+	return r.conn(ctx).Create(listing).Error
+}
+
+// FindListing returns the listing with the given ID, or nil and a nil
+// error if there is none.
+func (r *LoanRepository) FindListing(ctx context.Context, id string) (*domain.Listing, error) {
+	var listing domain.Listing
+	if err := r.conn(ctx).First(&listing, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &listing, nil
+}
+
+// UpdateListing saves the listing.
+func (r *LoanRepository) UpdateListing(ctx context.Context, listing *domain.Listing) error {
+	return r.conn(ctx).Save(listing).Error
+}
+
+// ListListings returns the listings of the loan in the given state,
+// oldest first. An empty loan ID or state matches every loan or
+// state.
+func (r *LoanRepository) ListListings(ctx context.Context, loanID string, state domain.ListingState) ([]domain.Listing, error) {
+	q := r.conn(ctx).Order("created_at, id")
+	if loanID != "" {
+		q = q.Where("loan_id = ?", loanID)
+	}
+	if state != "" {
+		q = q.Where("state = ?", state)
+	}
+	var listings []domain.Listing
+	if err := q.Find(&listings).Error; err != nil {
+		return nil, err
+	}
+	return listings, nil
+}
+
+// CancelOpenListings cancels the open listings of the loan and returns
+// their number.
+func (r *LoanRepository) CancelOpenListings(ctx context.Context, loanID string, at time.Time) (int, error) {
+	res := r.conn(ctx).
+		Model(&domain.Listing{}).
+		Where("loan_id = ? AND state = ?", loanID, domain.ListingStateOpen).
+		Updates(map[string]any{"state": domain.ListingStateCancelled, "updated_at": at.UTC()})
+	return int(res.RowsAffected), res.Error
+}
+
+// CreateProduct inserts a version of a loan product. It fails with
+// ErrDuplicate when the product already has a version with the same
+// number.
+func (r *LoanRepository) CreateProduct(ctx context.Context, product *domain.LoanProduct) error {
+	ensureID(&product.ID)
+	return r.conn(ctx).Create(product).Error
+}
+
+// GetProductByID fetches a product version by primary key. Returns
+// ErrNotFound if it does not exist.
+func (r *LoanRepository) GetProductByID(ctx context.Context, id string) (*domain.LoanProduct, error) {
+	var product domain.LoanProduct
+	if err := r.conn(ctx).First(&product, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// FindProduct returns the given version of the product with the given
+// code, or its latest version when version is zero. It returns nil and
+// a nil error if there is no such version.
+func (r *LoanRepository) FindProduct(ctx context.Context, code string, version int) (*domain.LoanProduct, error) {
+	q := r.conn(ctx).Where("code = ?", code)
+	if version != 0 {
+		q = q.Where("version = ?", version)
+	}
+	var product domain.LoanProduct
+	if err := q.Order("version DESC").First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &product, nil
+}
+
+// ListProducts returns the latest version of every product, ordered by
+// code.
+func (r *LoanRepository) ListProducts(ctx context.Context) ([]domain.LoanProduct, error) {
+	latest := r.conn(ctx).Model(&domain.LoanProduct{}).Select("code, MAX(version)").Group("code")
+	var products []domain.LoanProduct
+	if err := r.conn(ctx).
+		Where("(code, version) IN (?)", latest).
+		Order("code").
+		Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// ListProductVersions returns the versions of the product with the
+// given code, oldest first.
+func (r *LoanRepository) ListProductVersions(ctx context.Context, code string) ([]domain.LoanProduct, error) {
+	var products []domain.LoanProduct
+	if err := r.conn(ctx).Where("code = ?", code).Order("version").Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
 }
 
 // CreateDisbursement inserts a new disbursement record into the
@@ -88,53 +371,98 @@ func (r *LoanRepository) CreateInvestment(ctx context.Context, investment *domai
 // should be enforced by the database schema. An error is returned if
 // the insert fails.
 func (r *LoanRepository) CreateDisbursement(ctx context.Context, d *domain.Disbursement) error {
-	return r.db.WithContext(ctx).Create(d).Error
+	ensureID(&d.ID)
+	return r.conn(ctx).Create(d).Error
 }
 
-// GetTotalInvested returns the sum of all investments for the given
-// loan ID. If no investments exist the returned total will be zero.
+// GetTotalInvested returns the sum of the open investments for the
+// given loan ID. If no investments exist the returned total will be
+// zero.
 func (r *LoanRepository) GetTotalInvested(ctx context.Context, loanID string) (float64, error) {
 	var total float64
-	if err := r.db.WithContext(ctx).
+	if err := r.conn(ctx).
 		Model(&domain.Investment{}).
 		Where("loan_id = ?", loanID).
-		Select("COALESCE(SUM(amount),0)").
+		Where(openInvestments).
+		Select(r.sum("amount")).
 		Scan(&total).Error; err != nil {
 		return 0, err
 	}
 	return total, nil
 }
 
+// GetInvestorExposure returns the sum of the investor's open
+// investments in loans in one of domain.OutstandingLoanStates.
+func (r *LoanRepository) GetInvestorExposure(ctx context.Context, investorID string) (float64, error) {
+	var total float64
+	if err := r.conn(ctx).
+		Model(&domain.Investment{}).
+		Joins("JOIN loans ON loans.id = investments.loan_id").
+		Where("investments.investor_id = ? AND loans.state IN ?", investorID, domain.OutstandingLoanStates).
+		Where(openInvestments).
+		Select(r.sum("investments.amount")).
+		Scan(&total).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// sum returns the SQL expression summing column, yielding zero rather
+// than NULL when there are no rows. SUM over a NUMERIC column yields
+// NUMERIC on Postgres. On SQLite SUM yields an integer when every
+// amount is integral and NULL for no rows, while TOTAL always yields a
+// float.
+func (r *LoanRepository) sum(column string) string {
+	if r.db.Dialector.Name() == "sqlite" {
+		return "TOTAL(" + column + ")"
+	}
+	return "COALESCE(SUM(" + column + "),0)"
+}
+
 // ErrNotFound wraps gorm.ErrRecordNotFound to decouple the service
 // layer from the underlying ORM implementation. It can be used to
 // differentiate between not found and other errors in handlers.
 var ErrNotFound = gorm.ErrRecordNotFound
 
+// ErrDuplicate is returned when an insert violates a uniqueness
+// constraint, for example a second approval for the same loan.
+var ErrDuplicate = gorm.ErrDuplicatedKey
+
+// ErrForeignKey is returned when a record references a loan or
+// investor that does not exist.
+var ErrForeignKey = gorm.ErrForeignKeyViolated
+
 // CreateInvestor inserts a new investor record into the database. If
 // the insert fails (for example due to a unique constraint
 // violation) the error is returned. Investors can be created
 // separately or on the fly when investing in a loan.
 func (r *LoanRepository) CreateInvestor(ctx context.Context, inv *domain.Investor) error {
-	return r.db.WithContext(ctx).Create(inv).Error
+	ensureID(&inv.ID)
+	return r.conn(ctx).Create(inv).Error
 }
 
 // GetInvestorByID fetches an investor by primary key. Returns
 // ErrNotFound if the investor does not exist.
 func (r *LoanRepository) GetInvestorByID(ctx context.Context, id string) (*domain.Investor, error) {
 	var inv domain.Investor
-	if err := r.db.WithContext(ctx).First(&inv, "id = ?", id).Error; err != nil {
+	if err := r.conn(ctx).First(&inv, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return &inv, nil
 }
 
+// UpdateInvestor saves an existing investor, including its KYC data.
+func (r *LoanRepository) UpdateInvestor(ctx context.Context, inv *domain.Investor) error {
+	return r.conn(ctx).Save(inv).Error
+}
+
 // FindInvestorByEmail returns the investor with the given email
 // address if one exists. It returns nil and nil error if no investor
 // matches the email. This can be used to look up an investor when
 // performing an investment based on email rather than ID.
 func (r *LoanRepository) FindInvestorByEmail(ctx context.Context, email string) (*domain.Investor, error) {
 	var inv domain.Investor
-	if err := r.db.WithContext(ctx).Where("email = ?", email).First(&inv).Error; err != nil {
+	if err := r.conn(ctx).Where("email = ?", email).First(&inv).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -142,3 +470,106 @@ func (r *LoanRepository) FindInvestorByEmail(ctx context.Context, email string)
 	}
 	return &inv, nil
 }
+
+// CreateAutoInvestRule inserts an auto-invest rule. It fails with
+// ErrDuplicate when the investor already has one.
+func (r *LoanRepository) CreateAutoInvestRule(ctx context.Context, rule *domain.AutoInvestRule) error {
+	ensureID(&rule.ID)
+	return r.conn(ctx).Create(rule).Error
+}
+
+// UpdateAutoInvestRule saves an existing auto-invest rule.
+func (r *LoanRepository) UpdateAutoInvestRule(ctx context.Context, rule *domain.AutoInvestRule) error {
+	return r.conn(ctx).Save(rule).Error
+}
+
+// FindAutoInvestRule returns the auto-invest rule of the investor, or
+// nil and a nil error if they have none.
+func (r *LoanRepository) FindAutoInvestRule(ctx context.Context, investorID string) (*domain.AutoInvestRule, error) {
+	var rule domain.AutoInvestRule
+	if err := r.conn(ctx).Where("investor_id = ?", investorID).First(&rule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// ListActiveAutoInvestRules returns the active auto-invest rules in
+// the order they were created.
+func (r *LoanRepository) ListActiveAutoInvestRules(ctx context.Context) ([]domain.AutoInvestRule, error) {
+	var rules []domain.AutoInvestRule
+	if err := r.conn(ctx).Where("active = ?", true).Order("created_at, id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// GetAutoInvestedSince returns the sum of the investments placed by
+// the auto-invest rule at or after the given time, except cancelled
+// ones.
+func (r *LoanRepository) GetAutoInvestedSince(ctx context.Context, ruleID string, since time.Time) (float64, error) {
+	var total float64
+	if err := r.conn(ctx).
+		Model(&domain.Investment{}).
+		Where("auto_invest_rule_id = ? AND created_at >= ? AND cancelled_at IS NULL", ruleID, since.UTC()).
+		Select(r.sum("amount")).
+		Scan(&total).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// CreateDocument inserts the metadata of an uploaded document. The
+// content itself lives in the blob store.
+func (r *LoanRepository) CreateDocument(ctx context.Context, doc *domain.Document) error {
+	ensureID(&doc.ID)
+	return r.conn(ctx).Create(doc).Error
+}
+
+// GetDocumentByID fetches document metadata by primary key. Returns
+// ErrNotFound if the document does not exist.
+func (r *LoanRepository) GetDocumentByID(ctx context.Context, id string) (*domain.Document, error) {
+	var doc domain.Document
+	if err := r.conn(ctx).First(&doc, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// DocumentAttached reports whether an approval or a disbursement
+// references the document.
+func (r *LoanRepository) DocumentAttached(ctx context.Context, id string) (bool, error) {
+	var n int64
+	err := r.conn(ctx).
+		Raw("SELECT (SELECT COUNT(*) FROM approvals WHERE picture_document_id = ?) + (SELECT COUNT(*) FROM disbursements WHERE agreement_document_id = ?)", id, id).
+		Scan(&n).Error
+	return n > 0, err
+}
+
+// UpdateInvestment saves the given investment record, for example to
+// link its generated agreement letter or to close it.
+func (r *LoanRepository) UpdateInvestment(ctx context.Context, investment *domain.Investment) error {
+	return r.conn(ctx).Save(investment).Error
+}
+
+// CountLoansByState returns the number of loans in each state. States
+// without loans are absent from the result.
+func (r *LoanRepository) CountLoansByState(ctx context.Context) (map[domain.LoanState]int64, error) {
+	var rows []struct {
+		State domain.LoanState
+		Count int64
+	}
+	if err := r.conn(ctx).Model(&domain.Loan{}).
+		Select("state, COUNT(*) AS count").
+		Group("state").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[domain.LoanState]int64, len(rows))
+	for _, row := range rows {
+		counts[row.State] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,468 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/migrate"
+	"loan_service/internal/repository"
+	"loan_service/migrations"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+// openSQLite returns a migrated SQLite database in a temporary
+// directory.
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_pragma=foreign_keys(1)&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger:         logger.Discard,
+		TranslateError: true,
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	files, err := migrations.ForDialect("sqlite")
+	require.NoError(t, err)
+	runner, err := migrate.New(sqlDB, migrate.SQLite, files)
+	require.NoError(t, err)
+	_, err = runner.Up(context.Background())
+	require.NoError(t, err)
+	return db
+}
+
+func TestLoanRepository_SQLite(t *testing.T) {
+	repo := repository.NewLoanRepository(openSQLite(t))
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	loan := &domain.Loan{BorrowerID: "BRW", Principal: 1000, Rate: 10, ROI: 8, State: domain.LoanStateApproved, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, repo.CreateLoan(ctx, loan))
+	assert.Len(t, loan.ID, 36, "IDs are generated in Go")
+
+	total, err := repo.GetTotalInvested(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+
+	investor := &domain.Investor{Name: "Ann", Email: "ann@example.com", CreatedAt: now}
+	require.NoError(t, repo.CreateInvestor(ctx, investor))
+	dob := time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC)
+	investor.KYC = domain.KYC{Status: domain.KYCStatusVerified, FullName: "Ann Smith", DateOfBirth: &dob, SubmittedAt: &now, ReviewedBy: "E1"}
+	require.NoError(t, repo.UpdateInvestor(ctx, investor))
+	stored, err := repo.GetInvestorByID(ctx, investor.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Verified())
+	assert.Equal(t, "Ann Smith", stored.KYC.FullName)
+	require.NotNil(t, stored.KYC.DateOfBirth)
+	assert.True(t, dob.Equal(*stored.KYC.DateOfBirth))
+	for _, amount := range []float64{250, 100.5} {
+		require.NoError(t, repo.CreateInvestment(ctx, &domain.Investment{LoanID: loan.ID, InvestorID: investor.ID, Amount: amount, CreatedAt: now}))
+	}
+	total, err = repo.GetTotalInvested(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 350.5, total)
+
+	approval := &domain.Approval{LoanID: loan.ID, PictureURL: "/p", EmployeeID: "E1", ApprovalDate: now, CreatedAt: now}
+	require.NoError(t, repo.CreateApproval(ctx, approval))
+	err = repo.CreateApproval(ctx, &domain.Approval{LoanID: loan.ID, PictureURL: "/p", EmployeeID: "E2", ApprovalDate: now, CreatedAt: now})
+	assert.ErrorIs(t, err, repository.ErrDuplicate)
+	proof := &domain.Document{Kind: domain.DocumentKindApprovalProof, FileName: "p.png", ContentType: "image/png", StorageKey: "p", CreatedAt: now}
+	require.NoError(t, repo.CreateDocument(ctx, proof))
+	attached, err := repo.DocumentAttached(ctx, proof.ID)
+	require.NoError(t, err)
+	assert.False(t, attached)
+	other := &domain.Loan{BorrowerID: "B2", Principal: 100, State: domain.LoanStateProposed, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, repo.CreateLoan(ctx, other))
+	require.NoError(t, repo.CreateApproval(ctx, &domain.Approval{LoanID: other.ID, PictureDocumentID: proof.ID, EmployeeID: "E1", ApprovalDate: now, CreatedAt: now}))
+	attached, err = repo.DocumentAttached(ctx, proof.ID)
+	require.NoError(t, err)
+	assert.True(t, attached)
+	third := &domain.Loan{BorrowerID: "B3", Principal: 100, State: domain.LoanStateProposed, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, repo.CreateLoan(ctx, third))
+	err = repo.CreateApproval(ctx, &domain.Approval{LoanID: third.ID, PictureDocumentID: proof.ID, EmployeeID: "E1", ApprovalDate: now, CreatedAt: now})
+	assert.ErrorIs(t, err, repository.ErrDuplicate, "a proof belongs to one loan")
+	err = repo.CreateInvestment(ctx, &domain.Investment{LoanID: loan.ID, InvestorID: "missing", Amount: 1, CreatedAt: now})
+	assert.ErrorIs(t, err, repository.ErrForeignKey)
+
+	err = repo.Transaction(ctx, func(ctx context.Context) error {
+		locked, err := repo.GetLoanForUpdate(ctx, loan.ID)
+		require.NoError(t, err)
+		assert.Equal(t, domain.LoanStateApproved, locked.State)
+		assert.Equal(t, "BRW", locked.BorrowerID)
+		assert.Len(t, locked.Investments, 2)
+		require.NotNil(t, locked.Approval)
+
+		locked.State = domain.LoanStateInvested
+		require.NoError(t, repo.UpdateLoan(ctx, locked))
+		return errors.New("roll back")
+	})
+	require.Error(t, err)
+	got, err := repo.GetLoanByID(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.LoanStateApproved, got.State)
+
+	approved, err := repo.ListLoansByState(ctx, domain.LoanStateApproved)
+	require.NoError(t, err)
+	require.Len(t, approved, 1)
+	require.NotNil(t, approved[0].Approval)
+	invested, err := repo.ListLoansByState(ctx, domain.LoanStateInvested)
+	require.NoError(t, err)
+	assert.Empty(t, invested)
+
+	cancelled := got.Investments[0]
+	cancelled.CancelledAt = &now
+	require.NoError(t, repo.UpdateInvestment(ctx, &cancelled))
+	total, err = repo.GetTotalInvested(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 350.5-cancelled.Amount, total)
+	got, err = repo.GetLoanByID(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Len(t, got.Investments, 1, "cancelled investments are closed")
+	refund := &domain.Refund{LoanID: loan.ID, InvestmentID: cancelled.ID, InvestorID: investor.ID, Amount: cancelled.Amount,
+		Reason: domain.RefundReasonInvestmentCancelled, CreatedAt: now}
+	require.NoError(t, repo.CreateRefund(ctx, refund))
+	refunds, err := repo.ListRefunds(ctx, loan.ID)
+	require.NoError(t, err)
+	require.Len(t, refunds, 1)
+	assert.Equal(t, cancelled.ID, refunds[0].InvestmentID)
+	assert.Equal(t, domain.RefundReasonInvestmentCancelled, refunds[0].Reason)
+	err = repo.CreateRefund(ctx, &domain.Refund{LoanID: loan.ID, InvestmentID: "00000000-0000-0000-0000-000000000000", InvestorID: investor.ID, Amount: 1,
+		Reason: domain.RefundReasonInvestmentCancelled, CreatedAt: now})
+	assert.ErrorIs(t, err, repository.ErrForeignKey)
+
+	for i, ttl := range []time.Duration{-time.Minute, time.Minute, time.Hour} {
+		res := &domain.Reservation{LoanID: loan.ID, InvestorID: investor.ID, Amount: float64(100 * (i + 1)),
+			State: domain.ReservationStateHeld, ExpiresAt: now.Add(ttl), CreatedAt: now, UpdatedAt: now}
+		require.NoError(t, repo.CreateReservation(ctx, res))
+	}
+	reserved, err := repo.GetTotalReserved(ctx, loan.ID, now)
+	require.NoError(t, err)
+	assert.Equal(t, 500.0, reserved, "the expired reservation does not count")
+	expired, err := repo.ExpireReservations(ctx, now.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, expired)
+	reserved, err = repo.GetTotalReserved(ctx, loan.ID, now)
+	require.NoError(t, err)
+	assert.Equal(t, 300.0, reserved)
+	exposure, err := repo.GetInvestorExposure(ctx, investor.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 350.5-cancelled.Amount, exposure)
+	repaid := domain.Loan{ID: loan.ID, BorrowerID: loan.BorrowerID, Principal: loan.Principal, State: domain.LoanStateRepaid, CreatedAt: now}
+	require.NoError(t, repo.UpdateLoan(ctx, &repaid))
+	exposure, err = repo.GetInvestorExposure(ctx, investor.ID)
+	require.NoError(t, err)
+	assert.Zero(t, exposure, "repaid loans are not outstanding")
+	repaid.State = domain.LoanStateApproved
+	require.NoError(t, repo.UpdateLoan(ctx, &repaid))
+
+	missing, err := repo.FindReservation(ctx, "missing")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	_, err = repo.GetLoanByID(ctx, "missing")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestAutoInvestRepository_SQLite(t *testing.T) {
+	repo := repository.NewLoanRepository(openSQLite(t))
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	investor := &domain.Investor{Name: "Ann", Email: "ann@example.com", CreatedAt: now}
+	require.NoError(t, repo.CreateInvestor(ctx, investor))
+	missing, err := repo.FindAutoInvestRule(ctx, investor.ID)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	rule := &domain.AutoInvestRule{InvestorID: investor.ID, MinROI: 8.5, MaxPerLoan: 400, DailyBudget: 1000,
+		MaxRiskGrade: "B", Active: true, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, repo.CreateAutoInvestRule(ctx, rule))
+	err = repo.CreateAutoInvestRule(ctx, &domain.AutoInvestRule{InvestorID: investor.ID, MaxPerLoan: 1, CreatedAt: now, UpdatedAt: now})
+	assert.ErrorIs(t, err, repository.ErrDuplicate, "one rule per investor")
+
+	rule.LastPlacedAt = &now
+	require.NoError(t, repo.UpdateAutoInvestRule(ctx, rule))
+	found, err := repo.FindAutoInvestRule(ctx, investor.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 8.5, found.MinROI)
+	assert.Equal(t, domain.RiskGrade("B"), found.MaxRiskGrade)
+	require.NotNil(t, found.LastPlacedAt)
+	active, err := repo.ListActiveAutoInvestRules(ctx)
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+
+	loan := &domain.Loan{BorrowerID: "B1", Principal: 1000, Rate: 10, ROI: 8, RiskGrade: "C", State: domain.LoanStateApproved, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, repo.CreateLoan(ctx, loan))
+	require.NoError(t, repo.CreateInvestment(ctx, &domain.Investment{LoanID: loan.ID, InvestorID: investor.ID, Amount: 300, AutoInvestRuleID: &rule.ID, CreatedAt: now}))
+	require.NoError(t, repo.CreateInvestment(ctx, &domain.Investment{LoanID: loan.ID, InvestorID: investor.ID, Amount: 200, AutoInvestRuleID: &rule.ID, CreatedAt: now.Add(-48 * time.Hour)}))
+	require.NoError(t, repo.CreateInvestment(ctx, &domain.Investment{LoanID: loan.ID, InvestorID: investor.ID, Amount: 100, CreatedAt: now}))
+	spent, err := repo.GetAutoInvestedSince(ctx, rule.ID, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 300.0, spent)
+	stored, err := repo.GetLoanByID(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.RiskGrade("C"), stored.RiskGrade)
+
+	rule.Active = false
+	require.NoError(t, repo.UpdateAutoInvestRule(ctx, rule))
+	active, err = repo.ListActiveAutoInvestRules(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+}
+
+func TestListingRepository_SQLite(t *testing.T) {
+	repo := repository.NewLoanRepository(openSQLite(t))
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	investor := &domain.Investor{Name: "Ann", Email: "ann@example.com", CreatedAt: now}
+	require.NoError(t, repo.CreateInvestor(ctx, investor))
+	loan := &domain.Loan{BorrowerID: "B1", Principal: 1000, State: domain.LoanStateDisbursed, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, repo.CreateLoan(ctx, loan))
+	sold := &domain.Investment{LoanID: loan.ID, InvestorID: investor.ID, Amount: 600, CreatedAt: now}
+	require.NoError(t, repo.CreateInvestment(ctx, sold))
+	require.NoError(t, repo.CreateInvestment(ctx, &domain.Investment{LoanID: loan.ID, InvestorID: investor.ID, Amount: 400, CreatedAt: now}))
+
+	listing := &domain.Listing{LoanID: loan.ID, InvestmentID: sold.ID, SellerID: investor.ID, Amount: 600, Price: 590,
+		State: domain.ListingStateOpen, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, repo.CreateListing(ctx, listing))
+	err := repo.CreateListing(ctx, &domain.Listing{LoanID: loan.ID, InvestmentID: sold.ID, SellerID: investor.ID, Amount: 1, Price: 1,
+		State: domain.ListingStateOpen, CreatedAt: now, UpdatedAt: now})
+	assert.ErrorIs(t, err, repository.ErrDuplicate, "one open listing per investment")
+	missing, err := repo.FindListing(ctx, "00000000-0000-0000-0000-000000000000")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	// Transferring the investment closes it.
+	sold.TransferredAt = &now
+	require.NoError(t, repo.UpdateInvestment(ctx, sold))
+	stored, err := repo.GetLoanByID(ctx, loan.ID)
+	require.NoError(t, err)
+	require.Len(t, stored.Investments, 1)
+	assert.Equal(t, 400.0, stored.Investments[0].Amount)
+	total, err := repo.GetTotalInvested(ctx, loan.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 400.0, total)
+	exposure, err := repo.GetInvestorExposure(ctx, investor.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 400.0, exposure)
+
+	open, err := repo.ListListings(ctx, loan.ID, domain.ListingStateOpen)
+	require.NoError(t, err)
+	require.Len(t, open, 1)
+	n, err := repo.CancelOpenListings(ctx, loan.ID, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	found, err := repo.FindListing(ctx, listing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ListingStateCancelled, found.State)
+	open, err = repo.ListListings(ctx, "", domain.ListingStateOpen)
+	require.NoError(t, err)
+	assert.Empty(t, open)
+
+	other := &domain.Loan{BorrowerID: "B1", Principal: 1000, State: domain.LoanStateApproved, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, repo.CreateLoan(ctx, other))
+	loans, err := repo.ListInvestorLoans(ctx, investor.ID)
+	require.NoError(t, err)
+	require.Len(t, loans, 1, "only the loans invested in")
+	assert.Equal(t, loan.ID, loans[0].ID)
+	assert.Len(t, loans[0].Investments, 1)
+
+	// A loan the investor cancelled their investment in is left out, one
+	// whose closure refunded it is kept.
+	cancelled := &domain.Investment{LoanID: other.ID, InvestorID: investor.ID, Amount: 100, CancelledAt: &now, CreatedAt: now}
+	require.NoError(t, repo.CreateInvestment(ctx, cancelled))
+	require.NoError(t, repo.CreateRefund(ctx, &domain.Refund{LoanID: other.ID, InvestmentID: cancelled.ID, InvestorID: investor.ID,
+		Amount: 100, Reason: domain.RefundReasonInvestmentCancelled, CreatedAt: now}))
+	loans, err = repo.ListInvestorLoans(ctx, investor.ID)
+	require.NoError(t, err)
+	assert.Len(t, loans, 1)
+	refunded := &domain.Investment{LoanID: other.ID, InvestorID: investor.ID, Amount: 100, CancelledAt: &now, CreatedAt: now}
+	require.NoError(t, repo.CreateInvestment(ctx, refunded))
+	require.NoError(t, repo.CreateRefund(ctx, &domain.Refund{LoanID: other.ID, InvestmentID: refunded.ID, InvestorID: investor.ID,
+		Amount: 100, Reason: domain.RefundReasonLoanCancelled, CreatedAt: now}))
+	loans, err = repo.ListInvestorLoans(ctx, investor.ID)
+	require.NoError(t, err)
+	assert.Len(t, loans, 2)
+}
+
+func TestEventRepository_SQLite(t *testing.T) {
+	db := openSQLite(t)
+	ctx := context.Background()
+	loan := &domain.Loan{BorrowerID: "BRW", Principal: 1000, State: domain.LoanStateProposed}
+	require.NoError(t, repository.NewLoanRepository(db).CreateLoan(ctx, loan))
+
+	events := repository.NewEventRepository(db)
+	for _, typ := range []domain.LoanEventType{domain.LoanEventStateChanged, domain.LoanEventInvestmentAdded} {
+		ev := &domain.LoanEvent{LoanID: loan.ID, Type: typ, State: domain.LoanStateProposed}
+		require.NoError(t, events.AppendEvent(ctx, ev))
+		assert.NotZero(t, ev.ID)
+	}
+	got, err := events.ListEventsAfter(ctx, loan.ID, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, domain.LoanEventInvestmentAdded, got[1].Type)
+}
+
+// TestEventRepository_ReplayReadsPrimary registers an empty replica,
+// standing in for one that lags behind, and checks that replays still
+// see every event committed on the primary.
+func TestEventRepository_ReplayReadsPrimary(t *testing.T) {
+	db := openSQLite(t)
+	ctx := context.Background()
+	loan := &domain.Loan{BorrowerID: "BRW", Principal: 1000, State: domain.LoanStateProposed}
+	require.NoError(t, repository.NewLoanRepository(db).CreateLoan(ctx, loan))
+
+	replica := filepath.Join(t.TempDir(), "replica.db")
+	require.NoError(t, db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: []gorm.Dialector{sqlite.Open("file:" + replica)},
+	})))
+
+	events := repository.NewEventRepository(db)
+	require.NoError(t, events.AppendEvent(ctx, &domain.LoanEvent{LoanID: loan.ID, Type: domain.LoanEventStateChanged, State: domain.LoanStateProposed}))
+	got, err := events.ListEventsAfter(ctx, loan.ID, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, got, 1)
+}
+
+func TestLedgerRepository_SQLite(t *testing.T) {
+	db := openSQLite(t)
+	repo := repository.NewLoanRepository(db)
+	ctx := context.Background()
+
+	wallet, err := repo.EnsureAccount(ctx, domain.InvestorWallet("I1"))
+	require.NoError(t, err)
+	again, err := repo.EnsureAccount(ctx, domain.InvestorWallet("I1"))
+	require.NoError(t, err)
+	assert.Equal(t, wallet.ID, again.ID, "accounts are unique per type and owner")
+	external, err := repo.EnsureAccount(ctx, domain.ExternalAccount)
+	require.NoError(t, err)
+
+	for _, amount := range []float64{100.1, 0.2} {
+		require.NoError(t, repo.CreateJournalEntry(ctx, &domain.JournalEntry{
+			Kind: domain.JournalKindDeposit,
+			Postings: []domain.Posting{
+				{AccountID: external.ID, Debit: amount},
+				{AccountID: wallet.ID, Credit: amount},
+			},
+		}))
+	}
+	got, err := repo.GetAccountBalance(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 100.3, got.Balance)
+	assert.Equal(t, domain.AccountTypeInvestorWallet, got.Type)
+	_, err = repo.GetAccountBalance(ctx, "missing")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	accounts, err := repo.ListAccountBalances(ctx, domain.AccountRef{Type: domain.AccountTypeExternal})
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, -100.3, accounts[0].Balance)
+
+	entries, err := repo.ListAccountEntries(ctx, wallet.ID, 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 0.2, entries[0].Amount, "newest first")
+	assert.Equal(t, domain.JournalKindDeposit, entries[0].Kind)
+	entries, err = repo.ListAccountEntries(ctx, wallet.ID, 0)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "no limit")
+
+	require.NoError(t, repo.Transaction(ctx, func(ctx context.Context) error {
+		locked, err := repo.LockAccount(ctx, domain.InvestorWallet("I1"))
+		require.NoError(t, err)
+		assert.Equal(t, wallet.ID, locked.ID)
+		return nil
+	}))
+
+	check, err := repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, check.Balanced())
+	assert.Equal(t, 100.3, check.Credits)
+
+	// The schema accepts an unbalanced entry; the check reports it.
+	unbalanced := &domain.JournalEntry{Kind: domain.JournalKindFee, Postings: []domain.Posting{{AccountID: wallet.ID, Credit: 5}}}
+	require.NoError(t, repo.CreateJournalEntry(ctx, unbalanced))
+	check, err = repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.False(t, check.Balanced())
+	assert.Equal(t, []string{unbalanced.ID}, check.UnbalancedEntries)
+	assert.Empty(t, check.MismatchedAccounts)
+
+	// A stored balance that drifted from the postings is reported.
+	require.NoError(t, db.Exec("UPDATE ledger_accounts SET balance = balance + 1 WHERE id = ?", external.ID).Error)
+	check, err = repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.False(t, check.Balanced())
+	assert.Equal(t, []string{external.ID}, check.MismatchedAccounts)
+
+	err = repo.CreateJournalEntry(ctx, &domain.JournalEntry{Kind: domain.JournalKindFee, Postings: []domain.Posting{{AccountID: "missing", Credit: 5}}})
+	assert.ErrorIs(t, err, repository.ErrForeignKey)
+}
+
+func TestProductRepository_SQLite(t *testing.T) {
+	repo := repository.NewLoanRepository(openSQLite(t))
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	product := func(code string, version int, tenors ...int) *domain.LoanProduct {
+		return &domain.LoanProduct{Code: code, Version: version, Name: code, TenorMonths: tenors,
+			RepaymentFrequency: domain.RepaymentMonthly, MinPrincipal: 100, MaxPrincipal: 1000, CreatedAt: now}
+	}
+	v1 := product("MICRO", 1, 6, 12)
+	require.NoError(t, repo.CreateProduct(ctx, v1))
+	require.NoError(t, repo.CreateProduct(ctx, product("MICRO", 2, 24)))
+	require.NoError(t, repo.CreateProduct(ctx, product("AGRI", 1, 3)))
+	assert.ErrorIs(t, repo.CreateProduct(ctx, product("MICRO", 2, 6)), repository.ErrDuplicate)
+
+	got, err := repo.GetProductByID(ctx, v1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int{6, 12}, got.TenorMonths)
+	latest, err := repo.FindProduct(ctx, "MICRO", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, latest.Version)
+	first, err := repo.FindProduct(ctx, "MICRO", 1)
+	require.NoError(t, err)
+	assert.Equal(t, v1.ID, first.ID)
+	missing, err := repo.FindProduct(ctx, "MICRO", 3)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	products, err := repo.ListProducts(ctx)
+	require.NoError(t, err)
+	require.Len(t, products, 2)
+	assert.Equal(t, "AGRI", products[0].Code)
+	assert.Equal(t, 2, products[1].Version)
+	versions, err := repo.ListProductVersions(ctx, "MICRO")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, 1, versions[0].Version)
+
+	// Loans reference the version they were created under; loans from
+	// before the catalog have none.
+	loan := &domain.Loan{BorrowerID: "B1", Principal: 500, State: domain.LoanStateProposed,
+		ProductID: &v1.ID, ProductCode: "MICRO", TenorMonths: 6, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, repo.CreateLoan(ctx, loan))
+	legacy := &domain.Loan{BorrowerID: "B2", Principal: 500, State: domain.LoanStateProposed, CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, repo.CreateLoan(ctx, legacy))
+	stored, err := repo.GetLoanByID(ctx, loan.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.ProductID)
+	assert.Equal(t, v1.ID, *stored.ProductID)
+	assert.Equal(t, 6, stored.TenorMonths)
+	stored, err = repo.GetLoanByID(ctx, legacy.ID)
+	require.NoError(t, err)
+	assert.Nil(t, stored.ProductID)
+	assert.Empty(t, stored.ProductCode)
+}
@@ -0,0 +1,198 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// EnsureAccount returns the ledger account with the given type and
+// owner, creating it if it does not exist yet.
+func (s *Store) EnsureAccount(ctx context.Context, ref domain.AccountRef) (*domain.LedgerAccount, error) {
+	var acct domain.LedgerAccount
+	err := s.write(ctx, func(d *data) error {
+		if id, ok := d.accountIDs[ref]; ok {
+			acct = d.accounts[id]
+			return nil
+		}
+		acct = domain.LedgerAccount{
+			ID:        uuid.NewString(),
+			Type:      ref.Type,
+			OwnerID:   ref.OwnerID,
+			CreatedAt: time.Now().UTC(),
+		}
+		d.accounts[acct.ID] = acct
+		d.accountIDs[ref] = acct.ID
+		d.accountOrder = append(d.accountOrder, acct.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &acct, nil
+}
+
+// LockAccount returns the ledger account like EnsureAccount. Within a
+// transaction no other writer can run, so the account is effectively
+// locked until the transaction ends.
+func (s *Store) LockAccount(ctx context.Context, ref domain.AccountRef) (*domain.LedgerAccount, error) {
+	return s.EnsureAccount(ctx, ref)
+}
+
+// CreateJournalEntry inserts a journal entry and its postings, which
+// must reference existing accounts, and adds the postings to the
+// balances of their accounts. Empty IDs are filled with new UUIDs.
+func (s *Store) CreateJournalEntry(ctx context.Context, entry *domain.JournalEntry) error {
+	return s.write(ctx, func(d *data) error {
+		if entry.ID == "" {
+			entry.ID = uuid.NewString()
+		}
+		for _, e := range d.entries {
+			if e.ID == entry.ID {
+				return fmt.Errorf("%w: journal entry %s", repository.ErrDuplicate, entry.ID)
+			}
+		}
+		for i := range entry.Postings {
+			p := &entry.Postings[i]
+			if _, ok := d.accounts[p.AccountID]; !ok {
+				return fmt.Errorf("%w: ledger account %s does not exist", repository.ErrForeignKey, p.AccountID)
+			}
+			if p.ID == "" {
+				p.ID = uuid.NewString()
+			}
+			p.EntryID = entry.ID
+		}
+		if entry.CreatedAt.IsZero() {
+			entry.CreatedAt = time.Now().UTC()
+		}
+		stored := *entry
+		stored.Postings = append([]domain.Posting(nil), entry.Postings...)
+		d.entries = append(d.entries, stored)
+		for _, p := range entry.Postings {
+			d.balances[p.AccountID] += domain.Cents(p.Credit) - domain.Cents(p.Debit)
+		}
+		return nil
+	})
+}
+
+// postedBalances returns the balance of every account in cents summed
+// from the postings.
+func (d *data) postedBalances() map[string]int64 {
+	balances := make(map[string]int64, len(d.accounts))
+	for _, e := range d.entries {
+		for _, p := range e.Postings {
+			balances[p.AccountID] += domain.Cents(p.Credit) - domain.Cents(p.Debit)
+		}
+	}
+	return balances
+}
+
+// GetAccountBalance returns the ledger account and its balance, or
+// repository.ErrNotFound.
+func (s *Store) GetAccountBalance(ctx context.Context, id string) (*domain.AccountBalance, error) {
+	var bal domain.AccountBalance
+	err := s.read(ctx, func(d *data) error {
+		acct, ok := d.accounts[id]
+		if !ok {
+			return repository.ErrNotFound
+		}
+		bal = domain.AccountBalance{LedgerAccount: acct, Balance: domain.FromCents(d.balances[id])}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &bal, nil
+}
+
+// ListAccountBalances returns the ledger accounts matching filter with
+// their balances in creation order. An empty filter type or owner
+// matches any.
+func (s *Store) ListAccountBalances(ctx context.Context, filter domain.AccountRef) ([]domain.AccountBalance, error) {
+	var rows []domain.AccountBalance
+	err := s.read(ctx, func(d *data) error {
+		for _, id := range d.accountOrder {
+			acct := d.accounts[id]
+			if filter.Type != "" && acct.Type != filter.Type {
+				continue
+			}
+			if filter.OwnerID != "" && acct.OwnerID != filter.OwnerID {
+				continue
+			}
+			rows = append(rows, domain.AccountBalance{LedgerAccount: acct, Balance: domain.FromCents(d.balances[id])})
+		}
+		return nil
+	})
+	return rows, err
+}
+
+// ListAccountEntries returns up to limit journal entries that moved
+// money in or out of the account, newest first, with the net amount
+// credited to the account by each. A limit of zero or less returns
+// every entry.
+func (s *Store) ListAccountEntries(ctx context.Context, accountID string, limit int) ([]domain.AccountEntry, error) {
+	var rows []domain.AccountEntry
+	err := s.read(ctx, func(d *data) error {
+		for i := len(d.entries) - 1; i >= 0 && (limit <= 0 || len(rows) < limit); i-- {
+			e := d.entries[i]
+			var cents int64
+			found := false
+			for _, p := range e.Postings {
+				if p.AccountID == accountID {
+					cents += domain.Cents(p.Credit) - domain.Cents(p.Debit)
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+			rows = append(rows, domain.AccountEntry{
+				EntryID:     e.ID,
+				Kind:        e.Kind,
+				LoanID:      e.LoanID,
+				Description: e.Description,
+				Amount:      domain.FromCents(cents),
+				CreatedAt:   e.CreatedAt,
+			})
+		}
+		return nil
+	})
+	return rows, err
+}
+
+// CheckLedger verifies that the total of all debits equals the total
+// of all credits and lists the journal entries that do not balance and
+// the accounts whose running balance differs from their postings.
+func (s *Store) CheckLedger(ctx context.Context) (*domain.LedgerCheck, error) {
+	check := &domain.LedgerCheck{UnbalancedEntries: []string{}, MismatchedAccounts: []string{}}
+	err := s.read(ctx, func(d *data) error {
+		var debits, credits int64
+		for _, e := range d.entries {
+			if !e.Balanced() {
+				check.UnbalancedEntries = append(check.UnbalancedEntries, e.ID)
+			}
+			for _, p := range e.Postings {
+				debits += domain.Cents(p.Debit)
+				credits += domain.Cents(p.Credit)
+			}
+		}
+		check.Debits = domain.FromCents(debits)
+		check.Credits = domain.FromCents(credits)
+		posted := d.postedBalances()
+		for id := range d.accounts {
+			if d.balances[id] != posted[id] {
+				check.MismatchedAccounts = append(check.MismatchedAccounts, id)
+			}
+		}
+		return nil
+	})
+	sort.Strings(check.UnbalancedEntries)
+	sort.Strings(check.MismatchedAccounts)
+	return check, err
+}
@@ -0,0 +1,1021 @@
+// Package memory provides an in-memory implementation of the loan
+// repository, used to run the service without a database for demos
+// and in end-to-end tests. Data is lost when the process exits.
+//
+// The store keeps the constraints of the SQL schema that the service
+// relies on: primary keys are unique, a loan has at most one approval
+// and one disbursement, and records must reference existing loans and
+// investors. Violations return repository.ErrDuplicate and
+// repository.ErrForeignKey, and missing records
+// repository.ErrNotFound, like the database implementation.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/repository"
+)
+
+// Store is a concurrency-safe in-memory loan repository. It implements
+// service.LoanRepo, service.DocumentRepo, service.LedgerRepo and
+// events.Store.
+//
+// Writes are serialised. A transaction works on a copy of the data,
+// which replaces the committed data when the transaction succeeds, so
+// other readers never observe uncommitted changes and a failed
+// transaction leaves no trace. Copying makes transactions O(n) in the
+// size of the store, which is fine for the data sets of a demo.
+type Store struct {
+	// writeMu is held by every write and for the whole of a
+	// transaction.
+	writeMu sync.Mutex
+	// mu guards committed.
+	mu        sync.RWMutex
+	committed *data
+}
+
+// NewStore returns an empty store.
+func NewStore() *Store {
+	return &Store{committed: newData()}
+}
+
+// data holds the records of a store. Loans are stored without their
+// associations, which are assembled on read.
+type data struct {
+	loans         map[string]domain.Loan
+	loanOrder     []string
+	approvals     map[string]domain.Approval     // by loan ID
+	disbursements map[string]domain.Disbursement // by loan ID
+	investments   map[string]domain.Investment
+	// investmentOrder lists investment IDs in insertion order.
+	investmentOrder []string
+	investors       map[string]domain.Investor
+	investorOrder   []string
+	refunds         []domain.Refund
+	reservations    map[string]domain.Reservation
+	// reservationOrder lists reservation IDs in insertion order.
+	reservationOrder []string
+	autoInvestRules  map[string]domain.AutoInvestRule
+	// autoInvestRuleOrder lists auto-invest rule IDs in insertion
+	// order.
+	autoInvestRuleOrder []string
+	listings            map[string]domain.Listing
+	// listingOrder lists listing IDs in insertion order.
+	listingOrder []string
+	// products holds the product versions, which are never modified.
+	products map[string]domain.LoanProduct
+	// productOrder lists product version IDs in insertion order.
+	productOrder []string
+	documents    map[string]domain.Document
+	events       []domain.LoanEvent
+	accounts     map[string]domain.LedgerAccount
+	accountIDs   map[domain.AccountRef]string
+	accountOrder []string
+	// balances holds the running balance of each account in cents.
+	balances map[string]int64
+	// entries holds the journal entries in insertion order. Their
+	// postings are never modified and may be shared between copies.
+	entries []domain.JournalEntry
+}
+
+func newData() *data {
+	return &data{
+		loans:           make(map[string]domain.Loan),
+		approvals:       make(map[string]domain.Approval),
+		disbursements:   make(map[string]domain.Disbursement),
+		investments:     make(map[string]domain.Investment),
+		investors:       make(map[string]domain.Investor),
+		reservations:    make(map[string]domain.Reservation),
+		autoInvestRules: make(map[string]domain.AutoInvestRule),
+		listings:        make(map[string]domain.Listing),
+		products:        make(map[string]domain.LoanProduct),
+		documents:       make(map[string]domain.Document),
+		accounts:        make(map[string]domain.LedgerAccount),
+		accountIDs:      make(map[domain.AccountRef]string),
+		balances:        make(map[string]int64),
+	}
+}
+
+// clone returns a copy of d sharing no mutable state with it. The
+// records themselves are values and are copied by assignment.
+func (d *data) clone() *data {
+	c := &data{
+		loans:               make(map[string]domain.Loan, len(d.loans)),
+		loanOrder:           append([]string(nil), d.loanOrder...),
+		approvals:           make(map[string]domain.Approval, len(d.approvals)),
+		disbursements:       make(map[string]domain.Disbursement, len(d.disbursements)),
+		investments:         make(map[string]domain.Investment, len(d.investments)),
+		investmentOrder:     append([]string(nil), d.investmentOrder...),
+		investors:           make(map[string]domain.Investor, len(d.investors)),
+		investorOrder:       append([]string(nil), d.investorOrder...),
+		refunds:             append([]domain.Refund(nil), d.refunds...),
+		reservations:        make(map[string]domain.Reservation, len(d.reservations)),
+		reservationOrder:    append([]string(nil), d.reservationOrder...),
+		autoInvestRules:     make(map[string]domain.AutoInvestRule, len(d.autoInvestRules)),
+		autoInvestRuleOrder: append([]string(nil), d.autoInvestRuleOrder...),
+		listings:            make(map[string]domain.Listing, len(d.listings)),
+		listingOrder:        append([]string(nil), d.listingOrder...),
+		products:            make(map[string]domain.LoanProduct, len(d.products)),
+		productOrder:        append([]string(nil), d.productOrder...),
+		documents:           make(map[string]domain.Document, len(d.documents)),
+		events:              append([]domain.LoanEvent(nil), d.events...),
+		accounts:            make(map[string]domain.LedgerAccount, len(d.accounts)),
+		accountIDs:          make(map[domain.AccountRef]string, len(d.accountIDs)),
+		accountOrder:        append([]string(nil), d.accountOrder...),
+		balances:            make(map[string]int64, len(d.balances)),
+		entries:             append([]domain.JournalEntry(nil), d.entries...),
+	}
+	for k, v := range d.loans {
+		c.loans[k] = v
+	}
+	for k, v := range d.approvals {
+		c.approvals[k] = v
+	}
+	for k, v := range d.disbursements {
+		c.disbursements[k] = v
+	}
+	for k, v := range d.investments {
+		c.investments[k] = v
+	}
+	for k, v := range d.investors {
+		c.investors[k] = v
+	}
+	for k, v := range d.reservations {
+		c.reservations[k] = v
+	}
+	for k, v := range d.autoInvestRules {
+		c.autoInvestRules[k] = v
+	}
+	for k, v := range d.listings {
+		c.listings[k] = v
+	}
+	for k, v := range d.products {
+		c.products[k] = v
+	}
+	for k, v := range d.documents {
+		c.documents[k] = v
+	}
+	for k, v := range d.accounts {
+		c.accounts[k] = v
+	}
+	for k, v := range d.accountIDs {
+		c.accountIDs[k] = v
+	}
+	for k, v := range d.balances {
+		c.balances[k] = v
+	}
+	return c
+}
+
+// txKey is the context key under which Transaction stores the
+// transaction.
+type txKey struct{}
+
+// tx is a transaction of a store in progress.
+type tx struct {
+	store *Store
+	data  *data
+}
+
+// inTx returns the transaction of s carried by ctx, if any.
+func (s *Store) inTx(ctx context.Context) *tx {
+	if t, ok := ctx.Value(txKey{}).(*tx); ok && t.store == s {
+		return t
+	}
+	return nil
+}
+
+// Transaction runs fn in a transaction. The store methods called with
+// the context passed to fn see its uncommitted changes, which are
+// committed when fn returns nil and discarded otherwise. Nested calls
+// behave like savepoints.
+func (s *Store) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if parent := s.inTx(ctx); parent != nil {
+		child := &tx{store: s, data: parent.data.clone()}
+		if err := fn(context.WithValue(ctx, txKey{}, child)); err != nil {
+			return err
+		}
+		parent.data = child.data
+		return nil
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.mu.RLock()
+	t := &tx{store: s, data: s.committed.clone()}
+	s.mu.RUnlock()
+	if err := fn(context.WithValue(ctx, txKey{}, t)); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.committed = t.data
+	s.mu.Unlock()
+	return nil
+}
+
+// read calls fn with the data visible to ctx.
+func (s *Store) read(ctx context.Context, fn func(d *data) error) error {
+	if t := s.inTx(ctx); t != nil {
+		return fn(t.data)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(s.committed)
+}
+
+// write calls fn with the data visible to ctx for modification. fn
+// must check every constraint before changing anything, so that a
+// failed write outside a transaction leaves the data unchanged.
+func (s *Store) write(ctx context.Context, fn func(d *data) error) error {
+	if t := s.inTx(ctx); t != nil {
+		return fn(t.data)
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(s.committed)
+}
+
+// loan assembles the loan with the given ID and its associations.
+func (d *data) loan(id string) (*domain.Loan, error) {
+	l, ok := d.loans[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	if a, ok := d.approvals[id]; ok {
+		l.Approval = &a
+	}
+	if disb, ok := d.disbursements[id]; ok {
+		l.Disbursement = &disb
+	}
+	for _, invID := range d.investmentOrder {
+		if inv := d.investments[invID]; inv.LoanID == id && inv.Open() {
+			l.Investments = append(l.Investments, inv)
+		}
+	}
+	return &l, nil
+}
+
+func (d *data) requireLoan(id string) error {
+	if _, ok := d.loans[id]; !ok {
+		return fmt.Errorf("%w: loan %s does not exist", repository.ErrForeignKey, id)
+	}
+	return nil
+}
+
+// stripLoan returns the loan without its associations, as stored.
+func stripLoan(l domain.Loan) domain.Loan {
+	l.Approval = nil
+	l.Investments = nil
+	l.Disbursement = nil
+	return l
+}
+
+// CreateLoan inserts a new loan. The ID must be set by the caller.
+func (s *Store) CreateLoan(ctx context.Context, loan *domain.Loan) error {
+	return s.write(ctx, func(d *data) error {
+		if _, ok := d.loans[loan.ID]; ok {
+			return fmt.Errorf("%w: loan %s", repository.ErrDuplicate, loan.ID)
+		}
+		if loan.ProductID != nil {
+			if _, ok := d.products[*loan.ProductID]; !ok {
+				return fmt.Errorf("%w: product %s does not exist", repository.ErrForeignKey, *loan.ProductID)
+			}
+		}
+		d.loans[loan.ID] = stripLoan(*loan)
+		d.loanOrder = append(d.loanOrder, loan.ID)
+		return nil
+	})
+}
+
+// GetLoanByID returns the loan with its approval, investments and
+// disbursement, or repository.ErrNotFound.
+func (s *Store) GetLoanByID(ctx context.Context, id string) (*domain.Loan, error) {
+	var loan *domain.Loan
+	err := s.read(ctx, func(d *data) (err error) {
+		loan, err = d.loan(id)
+		return err
+	})
+	return loan, err
+}
+
+// GetLoanForUpdate returns the loan like GetLoanByID. Within a
+// transaction no other writer can run, so the loan is effectively
+// locked until the transaction ends.
+func (s *Store) GetLoanForUpdate(ctx context.Context, id string) (*domain.Loan, error) {
+	return s.GetLoanByID(ctx, id)
+}
+
+// UpdateLoan saves the top level fields of the loan, inserting it if
+// it does not exist. Associations are left untouched.
+func (s *Store) UpdateLoan(ctx context.Context, loan *domain.Loan) error {
+	return s.write(ctx, func(d *data) error {
+		if _, ok := d.loans[loan.ID]; !ok {
+			d.loanOrder = append(d.loanOrder, loan.ID)
+		}
+		d.loans[loan.ID] = stripLoan(*loan)
+		return nil
+	})
+}
+
+// ListLoans returns all loans in creation order.
+func (s *Store) ListLoans(ctx context.Context) ([]domain.Loan, error) {
+	var loans []domain.Loan
+	err := s.read(ctx, func(d *data) error {
+		loans = make([]domain.Loan, 0, len(d.loanOrder))
+		for _, id := range d.loanOrder {
+			l, err := d.loan(id)
+			if err != nil {
+				return err
+			}
+			loans = append(loans, *l)
+		}
+		return nil
+	})
+	return loans, err
+}
+
+// ListLoansByState returns the loans in the given state in creation
+// order.
+func (s *Store) ListLoansByState(ctx context.Context, state domain.LoanState) ([]domain.Loan, error) {
+	var loans []domain.Loan
+	err := s.read(ctx, func(d *data) error {
+		for _, id := range d.loanOrder {
+			if d.loans[id].State != state {
+				continue
+			}
+			l, err := d.loan(id)
+			if err != nil {
+				return err
+			}
+			loans = append(loans, *l)
+		}
+		return nil
+	})
+	return loans, err
+}
+
+// ListInvestorLoans returns the loans the investor has invested in,
+// including those whose investments they have since sold or had
+// refunded when the loan was cancelled or expired, but not those they
+// have cancelled every investment in, in creation order.
+func (s *Store) ListInvestorLoans(ctx context.Context, investorID string) ([]domain.Loan, error) {
+	var loans []domain.Loan
+	err := s.read(ctx, func(d *data) error {
+		closedWithLoan := make(map[string]bool)
+		for _, r := range d.refunds {
+			if r.Reason != domain.RefundReasonInvestmentCancelled {
+				closedWithLoan[r.InvestmentID] = true
+			}
+		}
+		invested := make(map[string]bool)
+		for _, inv := range d.investments {
+			if inv.InvestorID == investorID && (inv.CancelledAt == nil || closedWithLoan[inv.ID]) {
+				invested[inv.LoanID] = true
+			}
+		}
+		for _, id := range d.loanOrder {
+			if !invested[id] {
+				continue
+			}
+			l, err := d.loan(id)
+			if err != nil {
+				return err
+			}
+			loans = append(loans, *l)
+		}
+		return nil
+	})
+	return loans, err
+}
+
+// CountLoansByState returns the number of loans in each state. States
+// without loans are absent from the result.
+func (s *Store) CountLoansByState(ctx context.Context) (map[domain.LoanState]int64, error) {
+	counts := make(map[domain.LoanState]int64)
+	err := s.read(ctx, func(d *data) error {
+		for _, l := range d.loans {
+			counts[l.State]++
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// CreateApproval inserts an approval. A loan may have only one.
+func (s *Store) CreateApproval(ctx context.Context, approval *domain.Approval) error {
+	return s.write(ctx, func(d *data) error {
+		if err := d.requireLoan(approval.LoanID); err != nil {
+			return err
+		}
+		if _, ok := d.approvals[approval.LoanID]; ok {
+			return fmt.Errorf("%w: loan %s is already approved", repository.ErrDuplicate, approval.LoanID)
+		}
+		if approval.PictureDocumentID != "" && d.documentAttached(approval.PictureDocumentID) {
+			return fmt.Errorf("%w: document %s is attached to another loan", repository.ErrDuplicate, approval.PictureDocumentID)
+		}
+		d.approvals[approval.LoanID] = *approval
+		return nil
+	})
+}
+
+// CreateDisbursement inserts a disbursement. A loan may have only one.
+func (s *Store) CreateDisbursement(ctx context.Context, disb *domain.Disbursement) error {
+	return s.write(ctx, func(d *data) error {
+		if err := d.requireLoan(disb.LoanID); err != nil {
+			return err
+		}
+		if _, ok := d.disbursements[disb.LoanID]; ok {
+			return fmt.Errorf("%w: loan %s is already disbursed", repository.ErrDuplicate, disb.LoanID)
+		}
+		if disb.AgreementDocumentID != "" && d.documentAttached(disb.AgreementDocumentID) {
+			return fmt.Errorf("%w: document %s is attached to another loan", repository.ErrDuplicate, disb.AgreementDocumentID)
+		}
+		d.disbursements[disb.LoanID] = *disb
+		return nil
+	})
+}
+
+// CreateInvestment inserts an investment in an existing loan by an
+// existing investor.
+func (s *Store) CreateInvestment(ctx context.Context, inv *domain.Investment) error {
+	return s.write(ctx, func(d *data) error {
+		if _, ok := d.investments[inv.ID]; ok {
+			return fmt.Errorf("%w: investment %s", repository.ErrDuplicate, inv.ID)
+		}
+		if err := d.requireLoan(inv.LoanID); err != nil {
+			return err
+		}
+		if _, ok := d.investors[inv.InvestorID]; !ok {
+			return fmt.Errorf("%w: investor %s does not exist", repository.ErrForeignKey, inv.InvestorID)
+		}
+		d.investments[inv.ID] = *inv
+		d.investmentOrder = append(d.investmentOrder, inv.ID)
+		return nil
+	})
+}
+
+// UpdateInvestment saves the investment, inserting it if it does not
+// exist.
+func (s *Store) UpdateInvestment(ctx context.Context, inv *domain.Investment) error {
+	return s.write(ctx, func(d *data) error {
+		if _, ok := d.investments[inv.ID]; !ok {
+			if err := d.requireLoan(inv.LoanID); err != nil {
+				return err
+			}
+			d.investmentOrder = append(d.investmentOrder, inv.ID)
+		}
+		d.investments[inv.ID] = *inv
+		return nil
+	})
+}
+
+// CreateRefund inserts a refund of an existing investment in an
+// existing loan to an existing investor.
+func (s *Store) CreateRefund(ctx context.Context, refund *domain.Refund) error {
+	return s.write(ctx, func(d *data) error {
+		for _, r := range d.refunds {
+			if r.ID == refund.ID {
+				return fmt.Errorf("%w: refund %s", repository.ErrDuplicate, refund.ID)
+			}
+		}
+		if err := d.requireLoan(refund.LoanID); err != nil {
+			return err
+		}
+		if _, ok := d.investors[refund.InvestorID]; !ok {
+			return fmt.Errorf("%w: investor %s does not exist", repository.ErrForeignKey, refund.InvestorID)
+		}
+		if _, ok := d.investments[refund.InvestmentID]; !ok {
+			return fmt.Errorf("%w: investment %s does not exist", repository.ErrForeignKey, refund.InvestmentID)
+		}
+		d.refunds = append(d.refunds, *refund)
+		return nil
+	})
+}
+
+// ListRefunds returns the refunds of the loan in insertion order.
+func (s *Store) ListRefunds(ctx context.Context, loanID string) ([]domain.Refund, error) {
+	var refunds []domain.Refund
+	err := s.read(ctx, func(d *data) error {
+		for _, r := range d.refunds {
+			if r.LoanID == loanID {
+				refunds = append(refunds, r)
+			}
+		}
+		return nil
+	})
+	return refunds, err
+}
+
+// CreateReservation inserts a reservation of an existing loan by an
+// existing investor.
+func (s *Store) CreateReservation(ctx context.Context, res *domain.Reservation) error {
+	return s.write(ctx, func(d *data) error {
+		if _, ok := d.reservations[res.ID]; ok {
+			return fmt.Errorf("%w: reservation %s", repository.ErrDuplicate, res.ID)
+		}
+		if err := d.requireLoan(res.LoanID); err != nil {
+			return err
+		}
+		if _, ok := d.investors[res.InvestorID]; !ok {
+			return fmt.Errorf("%w: investor %s does not exist", repository.ErrForeignKey, res.InvestorID)
+		}
+		d.reservations[res.ID] = *res
+		d.reservationOrder = append(d.reservationOrder, res.ID)
+		return nil
+	})
+}
+
+// FindReservation returns the reservation, or nil and a nil error if
+// there is none.
+func (s *Store) FindReservation(ctx context.Context, id string) (*domain.Reservation, error) {
+	var found *domain.Reservation
+	err := s.read(ctx, func(d *data) error {
+		if res, ok := d.reservations[id]; ok {
+			found = &res
+		}
+		return nil
+	})
+	return found, err
+}
+
+// UpdateReservation saves an existing reservation.
+func (s *Store) UpdateReservation(ctx context.Context, res *domain.Reservation) error {
+	return s.write(ctx, func(d *data) error {
+		if _, ok := d.reservations[res.ID]; !ok {
+			return repository.ErrNotFound
+		}
+		d.reservations[res.ID] = *res
+		return nil
+	})
+}
+
+// GetTotalReserved returns the sum of the reservations of the loan
+// that are active at the given time.
+func (s *Store) GetTotalReserved(ctx context.Context, loanID string, at time.Time) (float64, error) {
+	var total float64
+	err := s.read(ctx, func(d *data) error {
+		for _, id := range d.reservationOrder {
+			if res := d.reservations[id]; res.LoanID == loanID && res.Active(at) {
+				total += res.Amount
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+// ExpireReservations moves the held reservations that expired at or
+// before the given time to the expired state and returns their
+// number.
+func (s *Store) ExpireReservations(ctx context.Context, at time.Time) (int, error) {
+	var expired int
+	err := s.write(ctx, func(d *data) error {
+		for id, res := range d.reservations {
+			if res.State == domain.ReservationStateHeld && !at.Before(res.ExpiresAt) {
+				res.State = domain.ReservationStateExpired
+				res.UpdatedAt = at
+				d.reservations[id] = res
+				expired++
+			}
+		}
+		return nil
+	})
+	return expired, err
+}
+
+// GetTotalInvested returns the sum of the open investments in the
+// loan.
+func (s *Store) GetTotalInvested(ctx context.Context, loanID string) (float64, error) {
+	var total float64
+	err := s.read(ctx, func(d *data) error {
+		for _, id := range d.investmentOrder {
+			if inv := d.investments[id]; inv.LoanID == loanID && inv.Open() {
+				total += inv.Amount
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+// GetInvestorExposure returns the sum of the investor's open
+// investments in loans in one of domain.OutstandingLoanStates.
+func (s *Store) GetInvestorExposure(ctx context.Context, investorID string) (float64, error) {
+	var total float64
+	err := s.read(ctx, func(d *data) error {
+		for _, id := range d.investmentOrder {
+			inv := d.investments[id]
+			if inv.InvestorID == investorID && inv.Open() && slices.Contains(domain.OutstandingLoanStates, d.loans[inv.LoanID].State) {
+				total += inv.Amount
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+// CreateInvestor inserts an investor.
+func (s *Store) CreateInvestor(ctx context.Context, inv *domain.Investor) error {
+	return s.write(ctx, func(d *data) error {
+		if _, ok := d.investors[inv.ID]; ok {
+			return fmt.Errorf("%w: investor %s", repository.ErrDuplicate, inv.ID)
+		}
+		d.investors[inv.ID] = *inv
+		d.investorOrder = append(d.investorOrder, inv.ID)
+		return nil
+	})
+}
+
+// GetInvestorByID returns the investor or repository.ErrNotFound.
+func (s *Store) GetInvestorByID(ctx context.Context, id string) (*domain.Investor, error) {
+	var inv domain.Investor
+	err := s.read(ctx, func(d *data) error {
+		var ok bool
+		if inv, ok = d.investors[id]; !ok {
+			return repository.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// UpdateInvestor saves an existing investor.
+func (s *Store) UpdateInvestor(ctx context.Context, inv *domain.Investor) error {
+	return s.write(ctx, func(d *data) error {
+		if _, ok := d.investors[inv.ID]; !ok {
+			return repository.ErrNotFound
+		}
+		d.investors[inv.ID] = *inv
+		return nil
+	})
+}
+
+// FindInvestorByEmail returns the first investor created with the
+// given email address, or nil and a nil error if there is none.
+func (s *Store) FindInvestorByEmail(ctx context.Context, email string) (*domain.Investor, error) {
+	var found *domain.Investor
+	err := s.read(ctx, func(d *data) error {
+		for _, id := range d.investorOrder {
+			if inv := d.investors[id]; inv.Email == email {
+				found = &inv
+				return nil
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// CreateListing inserts a listing. An investment may have only one
+// open listing.
+func (s *Store) CreateListing(ctx context.Context, listing *domain.Listing) error {
+	return s.write(ctx, func(d *data) error {
+		if err := d.requireLoan(listing.LoanID); err != nil {
+			return err
+		}
+		if _, ok := d.investments[listing.InvestmentID]; !ok {
+			return fmt.Errorf("%w: investment %s does not exist", repository.ErrForeignKey, listing.InvestmentID)
+		}
+		if _, ok := d.investors[listing.SellerID]; !ok {
+			return fmt.Errorf("%w: investor %s does not exist", repository.ErrForeignKey, listing.SellerID)
+		}
+		for _, existing := range d.listings {
+			if existing.ID == listing.ID ||
+				(existing.InvestmentID == listing.InvestmentID && existing.State == domain.ListingStateOpen && listing.State == domain.ListingStateOpen) {
+				return fmt.Errorf("%w: listing of investment %s", repository.ErrDuplicate, listing.InvestmentID)
+			}
+		}
+		d.listings[listing.ID] = *listing
+		d.listingOrder = append(d.listingOrder, listing.ID)
+		return nil
+	})
+}
+
+// FindListing returns the listing, or nil and a nil error if there is
+// none.
+func (s *Store) FindListing(ctx context.Context, id string) (*domain.Listing, error) {
+	var found *domain.Listing
+	err := s.read(ctx, func(d *data) error {
+		if listing, ok := d.listings[id]; ok {
+			found = &listing
+		}
+		return nil
+	})
+	return found, err
+}
+
+// UpdateListing saves an existing listing.
+func (s *Store) UpdateListing(ctx context.Context, listing *domain.Listing) error {
+	return s.write(ctx, func(d *data) error {
+		if _, ok := d.listings[listing.ID]; !ok {
+			return repository.ErrNotFound
+		}
+		d.listings[listing.ID] = *listing
+		return nil
+	})
+}
+
+// ListListings returns the listings of the loan in the given state in
+// insertion order. An empty loan ID or state matches every loan or
+// state.
+func (s *Store) ListListings(ctx context.Context, loanID string, state domain.ListingState) ([]domain.Listing, error) {
+	var listings []domain.Listing
+	err := s.read(ctx, func(d *data) error {
+		for _, id := range d.listingOrder {
+			listing := d.listings[id]
+			if (loanID == "" || listing.LoanID == loanID) && (state == "" || listing.State == state) {
+				listings = append(listings, listing)
+			}
+		}
+		return nil
+	})
+	return listings, err
+}
+
+// CancelOpenListings cancels the open listings of the loan and returns
+// their number.
+func (s *Store) CancelOpenListings(ctx context.Context, loanID string, at time.Time) (int, error) {
+	var n int
+	err := s.write(ctx, func(d *data) error {
+		for id, listing := range d.listings {
+			if listing.LoanID == loanID && listing.State == domain.ListingStateOpen {
+				listing.State = domain.ListingStateCancelled
+				listing.UpdatedAt = at
+				d.listings[id] = listing
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// CreateProduct inserts a version of a loan product. A product may
+// have only one version with a given number.
+func (s *Store) CreateProduct(ctx context.Context, product *domain.LoanProduct) error {
+	return s.write(ctx, func(d *data) error {
+		for _, existing := range d.products {
+			if existing.ID == product.ID || (existing.Code == product.Code && existing.Version == product.Version) {
+				return fmt.Errorf("%w: version %d of product %s", repository.ErrDuplicate, product.Version, product.Code)
+			}
+		}
+		p := *product
+		p.TenorMonths = slices.Clone(p.TenorMonths)
+		d.products[p.ID] = p
+		d.productOrder = append(d.productOrder, p.ID)
+		return nil
+	})
+}
+
+// GetProductByID returns the product version with the given ID, or
+// repository.ErrNotFound.
+func (s *Store) GetProductByID(ctx context.Context, id string) (*domain.LoanProduct, error) {
+	var found *domain.LoanProduct
+	err := s.read(ctx, func(d *data) error {
+		product, ok := d.products[id]
+		if !ok {
+			return repository.ErrNotFound
+		}
+		found = copyProduct(product)
+		return nil
+	})
+	return found, err
+}
+
+// FindProduct returns the given version of the product with the given
+// code, or its latest version when version is zero. It returns nil and
+// a nil error if there is no such version.
+func (s *Store) FindProduct(ctx context.Context, code string, version int) (*domain.LoanProduct, error) {
+	var found *domain.LoanProduct
+	err := s.read(ctx, func(d *data) error {
+		for _, id := range d.productOrder {
+			product := d.products[id]
+			if product.Code != code || (version != 0 && product.Version != version) {
+				continue
+			}
+			if found == nil || product.Version > found.Version {
+				found = copyProduct(product)
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// ListProducts returns the latest version of every product, ordered by
+// code.
+func (s *Store) ListProducts(ctx context.Context) ([]domain.LoanProduct, error) {
+	var products []domain.LoanProduct
+	err := s.read(ctx, func(d *data) error {
+		latest := make(map[string]domain.LoanProduct)
+		for _, product := range d.products {
+			if l, ok := latest[product.Code]; !ok || product.Version > l.Version {
+				latest[product.Code] = product
+			}
+		}
+		for _, product := range latest {
+			products = append(products, *copyProduct(product))
+		}
+		sort.Slice(products, func(i, j int) bool { return products[i].Code < products[j].Code })
+		return nil
+	})
+	return products, err
+}
+
+// ListProductVersions returns the versions of the product with the
+// given code, oldest first.
+func (s *Store) ListProductVersions(ctx context.Context, code string) ([]domain.LoanProduct, error) {
+	var products []domain.LoanProduct
+	err := s.read(ctx, func(d *data) error {
+		for _, id := range d.productOrder {
+			if product := d.products[id]; product.Code == code {
+				products = append(products, *copyProduct(product))
+			}
+		}
+		sort.SliceStable(products, func(i, j int) bool { return products[i].Version < products[j].Version })
+		return nil
+	})
+	return products, err
+}
+
+// copyProduct returns a copy of p that shares no slice with the store.
+func copyProduct(p domain.LoanProduct) *domain.LoanProduct {
+	p.TenorMonths = slices.Clone(p.TenorMonths)
+	return &p
+}
+
+// CreateAutoInvestRule inserts an auto-invest rule. An investor may
+// have only one.
+func (s *Store) CreateAutoInvestRule(ctx context.Context, rule *domain.AutoInvestRule) error {
+	return s.write(ctx, func(d *data) error {
+		if _, ok := d.investors[rule.InvestorID]; !ok {
+			return fmt.Errorf("%w: investor %s does not exist", repository.ErrForeignKey, rule.InvestorID)
+		}
+		for _, existing := range d.autoInvestRules {
+			if existing.ID == rule.ID || existing.InvestorID == rule.InvestorID {
+				return fmt.Errorf("%w: auto-invest rule of investor %s", repository.ErrDuplicate, rule.InvestorID)
+			}
+		}
+		d.autoInvestRules[rule.ID] = *rule
+		d.autoInvestRuleOrder = append(d.autoInvestRuleOrder, rule.ID)
+		return nil
+	})
+}
+
+// UpdateAutoInvestRule saves an existing auto-invest rule.
+func (s *Store) UpdateAutoInvestRule(ctx context.Context, rule *domain.AutoInvestRule) error {
+	return s.write(ctx, func(d *data) error {
+		if _, ok := d.autoInvestRules[rule.ID]; !ok {
+			return repository.ErrNotFound
+		}
+		d.autoInvestRules[rule.ID] = *rule
+		return nil
+	})
+}
+
+// FindAutoInvestRule returns the auto-invest rule of the investor, or
+// nil and a nil error if they have none.
+func (s *Store) FindAutoInvestRule(ctx context.Context, investorID string) (*domain.AutoInvestRule, error) {
+	var found *domain.AutoInvestRule
+	err := s.read(ctx, func(d *data) error {
+		for _, id := range d.autoInvestRuleOrder {
+			if rule := d.autoInvestRules[id]; rule.InvestorID == investorID {
+				found = &rule
+				return nil
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// ListActiveAutoInvestRules returns the active auto-invest rules in
+// insertion order.
+func (s *Store) ListActiveAutoInvestRules(ctx context.Context) ([]domain.AutoInvestRule, error) {
+	var rules []domain.AutoInvestRule
+	err := s.read(ctx, func(d *data) error {
+		for _, id := range d.autoInvestRuleOrder {
+			if rule := d.autoInvestRules[id]; rule.Active {
+				rules = append(rules, rule)
+			}
+		}
+		return nil
+	})
+	return rules, err
+}
+
+// GetAutoInvestedSince returns the sum of the investments placed by
+// the auto-invest rule at or after the given time, except cancelled
+// ones.
+func (s *Store) GetAutoInvestedSince(ctx context.Context, ruleID string, since time.Time) (float64, error) {
+	var total float64
+	err := s.read(ctx, func(d *data) error {
+		for _, id := range d.investmentOrder {
+			inv, ok := d.investments[id]
+			if ok && inv.AutoInvestRuleID != nil && *inv.AutoInvestRuleID == ruleID && !inv.CreatedAt.Before(since) && inv.CancelledAt == nil {
+				total += inv.Amount
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+// CreateDocument inserts document metadata.
+func (s *Store) CreateDocument(ctx context.Context, doc *domain.Document) error {
+	return s.write(ctx, func(d *data) error {
+		if _, ok := d.documents[doc.ID]; ok {
+			return fmt.Errorf("%w: document %s", repository.ErrDuplicate, doc.ID)
+		}
+		d.documents[doc.ID] = *doc
+		return nil
+	})
+}
+
+// DocumentAttached reports whether an approval or a disbursement
+// references the document.
+func (s *Store) DocumentAttached(ctx context.Context, id string) (bool, error) {
+	var attached bool
+	err := s.read(ctx, func(d *data) error {
+		attached = d.documentAttached(id)
+		return nil
+	})
+	return attached, err
+}
+
+func (d *data) documentAttached(id string) bool {
+	for _, a := range d.approvals {
+		if a.PictureDocumentID == id {
+			return true
+		}
+	}
+	for _, disb := range d.disbursements {
+		if disb.AgreementDocumentID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDocumentByID returns document metadata or repository.ErrNotFound.
+func (s *Store) GetDocumentByID(ctx context.Context, id string) (*domain.Document, error) {
+	var doc domain.Document
+	err := s.read(ctx, func(d *data) error {
+		var ok bool
+		if doc, ok = d.documents[id]; !ok {
+			return repository.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// AppendEvent stores the event and assigns its sequence ID. The store
+// does not notify other processes, so it is used with
+// events.NewLocalBus.
+func (s *Store) AppendEvent(ctx context.Context, ev *domain.LoanEvent) error {
+	return s.write(ctx, func(d *data) error {
+		if err := d.requireLoan(ev.LoanID); err != nil {
+			return err
+		}
+		ev.ID = int64(len(d.events)) + 1
+		if ev.CreatedAt.IsZero() {
+			ev.CreatedAt = time.Now().UTC()
+		}
+		d.events = append(d.events, *ev)
+		return nil
+	})
+}
+
+// ListEventsAfter returns up to limit events with an ID greater than
+// afterID in ascending order, for all loans when loanID is empty.
+func (s *Store) ListEventsAfter(ctx context.Context, loanID string, afterID int64, limit int) ([]domain.LoanEvent, error) {
+	var events []domain.LoanEvent
+	err := s.read(ctx, func(d *data) error {
+		start := sort.Search(len(d.events), func(i int) bool { return d.events[i].ID > afterID })
+		for _, ev := range d.events[start:] {
+			if len(events) == limit {
+				break
+			}
+			if loanID == "" || ev.LoanID == loanID {
+				events = append(events, ev)
+			}
+		}
+		return nil
+	})
+	return events, err
+}
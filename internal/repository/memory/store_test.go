@@ -0,0 +1,397 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seed(t *testing.T, s *Store) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, s.CreateLoan(ctx, &domain.Loan{ID: "L1", Principal: 1000, State: domain.LoanStateApproved}))
+	require.NoError(t, s.CreateInvestor(ctx, &domain.Investor{ID: "I1", Email: "a@example.com"}))
+}
+
+func TestStore_Uniqueness(t *testing.T) {
+	s := NewStore()
+	seed(t, s)
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateApproval(ctx, &domain.Approval{ID: "A1", LoanID: "L1"}))
+	assert.ErrorIs(t, s.CreateApproval(ctx, &domain.Approval{ID: "A2", LoanID: "L1"}), repository.ErrDuplicate)
+	require.NoError(t, s.CreateDisbursement(ctx, &domain.Disbursement{ID: "D1", LoanID: "L1"}))
+	assert.ErrorIs(t, s.CreateDisbursement(ctx, &domain.Disbursement{ID: "D2", LoanID: "L1"}), repository.ErrDuplicate)
+	assert.ErrorIs(t, s.CreateLoan(ctx, &domain.Loan{ID: "L1"}), repository.ErrDuplicate)
+	assert.ErrorIs(t, s.CreateApproval(ctx, &domain.Approval{ID: "A3", LoanID: "L2"}), repository.ErrForeignKey)
+	assert.ErrorIs(t, s.CreateInvestment(ctx, &domain.Investment{ID: "V1", LoanID: "L1", InvestorID: "I2"}), repository.ErrForeignKey)
+
+	loan, err := s.GetLoanByID(ctx, "L1")
+	require.NoError(t, err)
+	assert.Equal(t, "A1", loan.Approval.ID)
+	assert.Equal(t, "D1", loan.Disbursement.ID)
+
+	_, err = s.GetLoanByID(ctx, "L2")
+	assert.Equal(t, repository.ErrNotFound, err)
+	inv, err := s.FindInvestorByEmail(ctx, "b@example.com")
+	assert.NoError(t, err)
+	assert.Nil(t, inv)
+	assert.Equal(t, repository.ErrNotFound, s.UpdateInvestor(ctx, &domain.Investor{ID: "I2"}))
+}
+
+func TestStore_CancelledInvestments(t *testing.T) {
+	s := NewStore()
+	seed(t, s)
+	ctx := context.Background()
+
+	for _, id := range []string{"V1", "V2", "V3"} {
+		require.NoError(t, s.CreateInvestment(ctx, &domain.Investment{ID: id, LoanID: "L1", InvestorID: "I1", Amount: 100}))
+	}
+	now := time.Now().UTC()
+	require.NoError(t, s.UpdateInvestment(ctx, &domain.Investment{ID: "V2", LoanID: "L1", InvestorID: "I1", Amount: 100, CancelledAt: &now}))
+	loan, err := s.GetLoanByID(ctx, "L1")
+	require.NoError(t, err)
+	require.Len(t, loan.Investments, 2)
+	assert.Equal(t, "V3", loan.Investments[1].ID)
+	total, err := s.GetTotalInvested(ctx, "L1")
+	require.NoError(t, err)
+	assert.Equal(t, 200.0, total)
+
+	require.NoError(t, s.CreateRefund(ctx, &domain.Refund{ID: "R1", LoanID: "L1", InvestmentID: "V2", InvestorID: "I1", Amount: 100}))
+	assert.ErrorIs(t, s.CreateRefund(ctx, &domain.Refund{ID: "R1", LoanID: "L1", InvestorID: "I1"}), repository.ErrDuplicate)
+	assert.ErrorIs(t, s.CreateRefund(ctx, &domain.Refund{ID: "R2", LoanID: "L1", InvestorID: "I2"}), repository.ErrForeignKey)
+	assert.ErrorIs(t, s.CreateRefund(ctx, &domain.Refund{ID: "R3", LoanID: "L1", InvestmentID: "missing", InvestorID: "I1"}), repository.ErrForeignKey)
+	refunds, err := s.ListRefunds(ctx, "L1")
+	require.NoError(t, err)
+	require.Len(t, refunds, 1)
+	assert.Equal(t, "V2", refunds[0].InvestmentID)
+}
+
+func TestStore_Reservations(t *testing.T) {
+	s := NewStore()
+	seed(t, s)
+	ctx := context.Background()
+	now := time.Now()
+
+	require.NoError(t, s.CreateReservation(ctx, &domain.Reservation{ID: "R1", LoanID: "L1", InvestorID: "I1", Amount: 100,
+		State: domain.ReservationStateHeld, ExpiresAt: now.Add(time.Minute)}))
+	require.NoError(t, s.CreateReservation(ctx, &domain.Reservation{ID: "R2", LoanID: "L1", InvestorID: "I1", Amount: 200,
+		State: domain.ReservationStateHeld, ExpiresAt: now.Add(time.Hour)}))
+	assert.ErrorIs(t, s.CreateReservation(ctx, &domain.Reservation{ID: "R1", LoanID: "L1", InvestorID: "I1"}), repository.ErrDuplicate)
+	assert.ErrorIs(t, s.CreateReservation(ctx, &domain.Reservation{ID: "R3", LoanID: "L1", InvestorID: "I2"}), repository.ErrForeignKey)
+
+	reserved, err := s.GetTotalReserved(ctx, "L1", now)
+	require.NoError(t, err)
+	assert.Equal(t, 300.0, reserved)
+	expired, err := s.ExpireReservations(ctx, now.Add(2*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	res, err := s.FindReservation(ctx, "R1")
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReservationStateExpired, res.State)
+	reserved, err = s.GetTotalReserved(ctx, "L1", now)
+	require.NoError(t, err)
+	assert.Equal(t, 200.0, reserved)
+	res, err = s.FindReservation(ctx, "R3")
+	require.NoError(t, err)
+	assert.Nil(t, res)
+}
+
+func TestStore_AutoInvestRules(t *testing.T) {
+	s := NewStore()
+	seed(t, s)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	assert.ErrorIs(t, s.CreateAutoInvestRule(ctx, &domain.AutoInvestRule{ID: "A1", InvestorID: "I2"}), repository.ErrForeignKey)
+	require.NoError(t, s.CreateAutoInvestRule(ctx, &domain.AutoInvestRule{ID: "A1", InvestorID: "I1", MaxPerLoan: 100, Active: true}))
+	assert.ErrorIs(t, s.CreateAutoInvestRule(ctx, &domain.AutoInvestRule{ID: "A2", InvestorID: "I1"}), repository.ErrDuplicate)
+	assert.Equal(t, repository.ErrNotFound, s.UpdateAutoInvestRule(ctx, &domain.AutoInvestRule{ID: "A2"}))
+
+	rule := "A1"
+	require.NoError(t, s.CreateInvestment(ctx, &domain.Investment{ID: "V1", LoanID: "L1", InvestorID: "I1", Amount: 100, AutoInvestRuleID: &rule, CreatedAt: now}))
+	require.NoError(t, s.CreateInvestment(ctx, &domain.Investment{ID: "V2", LoanID: "L1", InvestorID: "I1", Amount: 50, CreatedAt: now}))
+	spent, err := s.GetAutoInvestedSince(ctx, "A1", now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, spent)
+	spent, err = s.GetAutoInvestedSince(ctx, "A1", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, spent)
+
+	require.NoError(t, s.UpdateAutoInvestRule(ctx, &domain.AutoInvestRule{ID: "A1", InvestorID: "I1", MaxPerLoan: 100}))
+	active, err := s.ListActiveAutoInvestRules(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+	found, err := s.FindAutoInvestRule(ctx, "I1")
+	require.NoError(t, err)
+	assert.Equal(t, "A1", found.ID)
+}
+
+func TestStore_Listings(t *testing.T) {
+	s := NewStore()
+	seed(t, s)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	require.NoError(t, s.CreateInvestment(ctx, &domain.Investment{ID: "V1", LoanID: "L1", InvestorID: "I1", Amount: 600}))
+	require.NoError(t, s.CreateInvestment(ctx, &domain.Investment{ID: "V2", LoanID: "L1", InvestorID: "I1", Amount: 400}))
+	assert.ErrorIs(t, s.CreateListing(ctx, &domain.Listing{ID: "S1", LoanID: "L1", InvestmentID: "V3", SellerID: "I1"}), repository.ErrForeignKey)
+	require.NoError(t, s.CreateListing(ctx, &domain.Listing{ID: "S1", LoanID: "L1", InvestmentID: "V1", SellerID: "I1", State: domain.ListingStateOpen}))
+	assert.ErrorIs(t, s.CreateListing(ctx, &domain.Listing{ID: "S2", LoanID: "L1", InvestmentID: "V1", SellerID: "I1", State: domain.ListingStateOpen}), repository.ErrDuplicate)
+	assert.Equal(t, repository.ErrNotFound, s.UpdateListing(ctx, &domain.Listing{ID: "S2"}))
+
+	require.NoError(t, s.UpdateInvestment(ctx, &domain.Investment{ID: "V1", LoanID: "L1", InvestorID: "I1", Amount: 600, TransferredAt: &now}))
+	loan, err := s.GetLoanByID(ctx, "L1")
+	require.NoError(t, err)
+	require.Len(t, loan.Investments, 1)
+	total, err := s.GetTotalInvested(ctx, "L1")
+	require.NoError(t, err)
+	assert.Equal(t, 400.0, total)
+
+	n, err := s.CancelOpenListings(ctx, "L1", now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	listings, err := s.ListListings(ctx, "L1", "")
+	require.NoError(t, err)
+	require.Len(t, listings, 1)
+	assert.Equal(t, domain.ListingStateCancelled, listings[0].State)
+	missing, err := s.FindListing(ctx, "S2")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+
+	require.NoError(t, s.CreateLoan(ctx, &domain.Loan{ID: "L2", Principal: 1000, State: domain.LoanStateApproved}))
+	loans, err := s.ListInvestorLoans(ctx, "I1")
+	require.NoError(t, err)
+	require.Len(t, loans, 1)
+	assert.Equal(t, "L1", loans[0].ID)
+
+	// A loan the investor cancelled their investment in is left out, one
+	// whose closure refunded it is kept.
+	require.NoError(t, s.CreateInvestment(ctx, &domain.Investment{ID: "V3", LoanID: "L2", InvestorID: "I1", Amount: 100, CancelledAt: &now}))
+	require.NoError(t, s.CreateRefund(ctx, &domain.Refund{ID: "R1", LoanID: "L2", InvestmentID: "V3", InvestorID: "I1", Amount: 100, Reason: domain.RefundReasonInvestmentCancelled}))
+	loans, err = s.ListInvestorLoans(ctx, "I1")
+	require.NoError(t, err)
+	assert.Len(t, loans, 1)
+	require.NoError(t, s.CreateInvestment(ctx, &domain.Investment{ID: "V4", LoanID: "L2", InvestorID: "I1", Amount: 100, CancelledAt: &now}))
+	require.NoError(t, s.CreateRefund(ctx, &domain.Refund{ID: "R2", LoanID: "L2", InvestmentID: "V4", InvestorID: "I1", Amount: 100, Reason: domain.RefundReasonLoanCancelled}))
+	loans, err = s.ListInvestorLoans(ctx, "I1")
+	require.NoError(t, err)
+	assert.Len(t, loans, 2)
+}
+
+func TestStore_ReturnsCopies(t *testing.T) {
+	s := NewStore()
+	seed(t, s)
+	ctx := context.Background()
+
+	loan, err := s.GetLoanByID(ctx, "L1")
+	require.NoError(t, err)
+	loan.State = domain.LoanStateDisbursed
+	loan.Investments = append(loan.Investments, domain.Investment{ID: "V1"})
+
+	again, err := s.GetLoanByID(ctx, "L1")
+	require.NoError(t, err)
+	assert.Equal(t, domain.LoanStateApproved, again.State)
+	assert.Empty(t, again.Investments)
+}
+
+func TestStore_TransactionRollsBack(t *testing.T) {
+	s := NewStore()
+	seed(t, s)
+	ctx := context.Background()
+	boom := errors.New("boom")
+
+	err := s.Transaction(ctx, func(ctx context.Context) error {
+		require.NoError(t, s.CreateInvestment(ctx, &domain.Investment{ID: "V1", LoanID: "L1", InvestorID: "I1", Amount: 400}))
+		total, err := s.GetTotalInvested(ctx, "L1")
+		require.NoError(t, err)
+		assert.Equal(t, 400.0, total)
+
+		// Changes are invisible outside the transaction until commit.
+		outside, err := s.GetTotalInvested(context.Background(), "L1")
+		require.NoError(t, err)
+		assert.Zero(t, outside)
+
+		// A failed nested transaction is rolled back on its own.
+		nestedErr := s.Transaction(ctx, func(ctx context.Context) error {
+			require.NoError(t, s.CreateInvestment(ctx, &domain.Investment{ID: "V2", LoanID: "L1", InvestorID: "I1", Amount: 100}))
+			return boom
+		})
+		assert.ErrorIs(t, nestedErr, boom)
+		total, err = s.GetTotalInvested(ctx, "L1")
+		require.NoError(t, err)
+		assert.Equal(t, 400.0, total)
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+
+	total, err := s.GetTotalInvested(ctx, "L1")
+	require.NoError(t, err)
+	assert.Zero(t, total)
+}
+
+func TestStore_TransactionsAreSerialised(t *testing.T) {
+	s := NewStore()
+	seed(t, s)
+	ctx := context.Background()
+
+	// Each transaction reads the total and invests only if the loan is
+	// not fully funded, like LoanService.InvestInLoan.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = s.Transaction(ctx, func(ctx context.Context) error {
+				loan, err := s.GetLoanForUpdate(ctx, "L1")
+				if err != nil {
+					return err
+				}
+				total, err := s.GetTotalInvested(ctx, loan.ID)
+				if err != nil {
+					return err
+				}
+				if total+100 > loan.Principal {
+					return errors.New("overfunded")
+				}
+				return s.CreateInvestment(ctx, &domain.Investment{
+					ID: string(rune('a' + i)), LoanID: loan.ID, InvestorID: "I1", Amount: 100,
+				})
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	total, err := s.GetTotalInvested(ctx, "L1")
+	require.NoError(t, err)
+	assert.Equal(t, 1000.0, total)
+}
+
+func TestStore_Events(t *testing.T) {
+	s := NewStore()
+	seed(t, s)
+	ctx := context.Background()
+	require.NoError(t, s.CreateLoan(ctx, &domain.Loan{ID: "L2"}))
+
+	for _, loanID := range []string{"L1", "L2", "L1"} {
+		require.NoError(t, s.AppendEvent(ctx, &domain.LoanEvent{LoanID: loanID}))
+	}
+	assert.ErrorIs(t, s.AppendEvent(ctx, &domain.LoanEvent{LoanID: "L3"}), repository.ErrForeignKey)
+
+	events, err := s.ListEventsAfter(ctx, "L1", 1, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(3), events[0].ID)
+
+	events, err = s.ListEventsAfter(ctx, "", 0, 2)
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+}
+
+func TestStore_Ledger(t *testing.T) {
+	s := NewStore()
+	ctx := context.Background()
+
+	wallet, err := s.EnsureAccount(ctx, domain.InvestorWallet("I1"))
+	require.NoError(t, err)
+	again, err := s.EnsureAccount(ctx, domain.InvestorWallet("I1"))
+	require.NoError(t, err)
+	assert.Equal(t, wallet.ID, again.ID)
+	external, err := s.EnsureAccount(ctx, domain.ExternalAccount)
+	require.NoError(t, err)
+
+	require.NoError(t, s.CreateJournalEntry(ctx, &domain.JournalEntry{
+		Kind:     domain.JournalKindDeposit,
+		Postings: []domain.Posting{{AccountID: external.ID, Debit: 50}, {AccountID: wallet.ID, Credit: 50}},
+	}))
+	assert.ErrorIs(t, s.CreateJournalEntry(ctx, &domain.JournalEntry{
+		Postings: []domain.Posting{{AccountID: "missing", Credit: 50}},
+	}), repository.ErrForeignKey)
+
+	bal, err := s.GetAccountBalance(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 50.0, bal.Balance)
+	_, err = s.GetAccountBalance(ctx, "missing")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	entries, err := s.ListAccountEntries(ctx, external.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, -50.0, entries[0].Amount)
+	entries, err = s.ListAccountEntries(ctx, external.ID, 0)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no limit")
+
+	unbalanced := &domain.JournalEntry{Postings: []domain.Posting{{AccountID: wallet.ID, Debit: 1}}}
+	require.NoError(t, s.CreateJournalEntry(ctx, unbalanced))
+	check, err := s.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.False(t, check.Balanced())
+	assert.Equal(t, []string{unbalanced.ID}, check.UnbalancedEntries)
+	assert.Empty(t, check.MismatchedAccounts, "running balances follow the postings")
+	bal, err = s.GetAccountBalance(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 49.0, bal.Balance)
+}
+
+func TestStore_Products(t *testing.T) {
+	s := NewStore()
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateProduct(ctx, &domain.LoanProduct{ID: "P1", Code: "MICRO", Version: 1, TenorMonths: []int{6}}))
+	require.NoError(t, s.CreateProduct(ctx, &domain.LoanProduct{ID: "P2", Code: "MICRO", Version: 2, TenorMonths: []int{12}}))
+	require.NoError(t, s.CreateProduct(ctx, &domain.LoanProduct{ID: "P3", Code: "AGRI", Version: 1}))
+	assert.ErrorIs(t, s.CreateProduct(ctx, &domain.LoanProduct{ID: "P4", Code: "MICRO", Version: 2}), repository.ErrDuplicate)
+
+	latest, err := s.FindProduct(ctx, "MICRO", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "P2", latest.ID)
+	latest.TenorMonths[0] = 99
+	first, err := s.GetProductByID(ctx, "P1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, first.Version)
+	again, err := s.FindProduct(ctx, "MICRO", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{12}, again.TenorMonths, "returned products share no state with the store")
+	missing, err := s.FindProduct(ctx, "NONE", 0)
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+	_, err = s.GetProductByID(ctx, "P9")
+	assert.Equal(t, repository.ErrNotFound, err)
+
+	products, err := s.ListProducts(ctx)
+	require.NoError(t, err)
+	require.Len(t, products, 2)
+	assert.Equal(t, "P3", products[0].ID)
+	assert.Equal(t, "P2", products[1].ID)
+	versions, err := s.ListProductVersions(ctx, "MICRO")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, "P1", versions[0].ID)
+
+	missingID := "P9"
+	assert.ErrorIs(t, s.CreateLoan(ctx, &domain.Loan{ID: "L9", ProductID: &missingID}), repository.ErrForeignKey)
+}
+
+func TestStore_DocumentAttachedOnce(t *testing.T) {
+	s := NewStore()
+	seed(t, s)
+	ctx := context.Background()
+	require.NoError(t, s.CreateLoan(ctx, &domain.Loan{ID: "L2", State: domain.LoanStateProposed}))
+
+	attached, err := s.DocumentAttached(ctx, "D1")
+	require.NoError(t, err)
+	assert.False(t, attached)
+	require.NoError(t, s.CreateApproval(ctx, &domain.Approval{ID: "A2", LoanID: "L2", PictureDocumentID: "D1"}))
+	attached, err = s.DocumentAttached(ctx, "D1")
+	require.NoError(t, err)
+	assert.True(t, attached)
+	assert.ErrorIs(t, s.CreateDisbursement(ctx, &domain.Disbursement{ID: "B1", LoanID: "L1", AgreementDocumentID: "D1"}), repository.ErrDuplicate)
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"loan_service/internal/docgen"
+	"loan_service/internal/domain"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// AgreementRenderer renders agreement templates to PDF. The concrete
+// implementation is docgen.Generator.
+type AgreementRenderer interface {
+	Render(kind domain.DocumentKind, version string, data docgen.AgreementData) ([]byte, error)
+}
+
+// AgreementService generates the borrower agreement and one investor
+// agreement per investment for a fully funded loan, stores them as
+// documents and links them from the loan and its investments.
+type AgreementService struct {
+	repo     LoanRepo
+	docs     *DocumentService
+	renderer AgreementRenderer
+	version  string
+}
+
+// NewAgreementService constructs a new AgreementService rendering
+// agreements from the given template version, unless the loan's
+// product names another.
+func NewAgreementService(repo LoanRepo, docs *DocumentService, renderer AgreementRenderer, version string) *AgreementService {
+	return &AgreementService{repo: repo, docs: docs, renderer: renderer, version: version}
+}
+
+// GenerateAgreements renders and stores all agreements for the loan,
+// whose Investments must be loaded. The loan's AgreementLetterURL and
+// each investment's AgreementURL are updated and persisted.
+func (s *AgreementService) GenerateAgreements(ctx context.Context, loan *domain.Loan) (err error) {
+	ctx, span := startSpan(ctx, "AgreementService.GenerateAgreements", attribute.String("loan.id", loan.ID))
+	defer func() { endSpan(span, err) }()
+
+	version, err := s.templateVersion(ctx, loan)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	investors := make(map[string]bool)
+	for _, inv := range loan.Investments {
+		investors[inv.InvestorID] = true
+	}
+
+	borrower, err := s.render(ctx, domain.DocumentKindBorrowerAgreement, version, "borrower-agreement-"+loan.ID+".pdf", docgen.AgreementData{
+		Loan:           *loan,
+		InvestorCount:  len(investors),
+		TotalRepayable: loan.Principal * (1 + loan.Rate/100),
+		GeneratedAt:    now,
+	})
+	if err != nil {
+		return err
+	}
+	loan.AgreementLetterURL = borrower.ContentPath()
+	if err := s.repo.UpdateLoan(ctx, loan); err != nil {
+		return err
+	}
+
+	for i := range loan.Investments {
+		inv := &loan.Investments[i]
+		investor, err := s.repo.GetInvestorByID(ctx, inv.InvestorID)
+		if err != nil {
+			return fmt.Errorf("load investor %s: %w", inv.InvestorID, err)
+		}
+		doc, err := s.render(ctx, domain.DocumentKindInvestorAgreement, version, "investor-agreement-"+inv.ID+".pdf", docgen.AgreementData{
+			Loan:           *loan,
+			Investor:       investor,
+			Investment:     inv,
+			InvestorCount:  len(investors),
+			Share:          inv.Amount / loan.Principal * 100,
+			ExpectedReturn: inv.Amount * loan.ROI / 100,
+			GeneratedAt:    now,
+		})
+		if err != nil {
+			return err
+		}
+		inv.AgreementURL = doc.ContentPath()
+		if err := s.repo.UpdateInvestment(ctx, inv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templateVersion returns the agreement template version of the loan's
+// product, or the configured version when the loan has no product or
+// its product does not name one.
+func (s *AgreementService) templateVersion(ctx context.Context, loan *domain.Loan) (string, error) {
+	if loan.ProductID == nil {
+		return s.version, nil
+	}
+	product, err := s.repo.GetProductByID(ctx, *loan.ProductID)
+	if err != nil {
+		return "", fmt.Errorf("load product %s: %w", *loan.ProductID, err)
+	}
+	if product.AgreementTemplate == "" {
+		return s.version, nil
+	}
+	return product.AgreementTemplate, nil
+}
+
+func (s *AgreementService) render(ctx context.Context, kind domain.DocumentKind, version, fileName string, data docgen.AgreementData) (*domain.Document, error) {
+	// The loan is copied into the template data; drop its nested
+	// records so templates cannot depend on them.
+	data.Loan.Approval, data.Loan.Investments, data.Loan.Disbursement = nil, nil, nil
+	pdf, err := s.renderer.Render(kind, version, data)
+	if err != nil {
+		return nil, err
+	}
+	return s.docs.StoreGenerated(ctx, kind, fileName, "application/pdf", docgen.TemplateName(kind, version), pdf)
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"loan_service/internal/docgen"
+	"loan_service/internal/domain"
+	mock_loan_repo "loan_service/internal/service/mocks"
+	"loan_service/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAgreements_LinksBorrowerAndInvestorAgreements(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	docRepo := new(mock_loan_repo.MockDocumentRepo)
+	blobs, err := storage.NewFSStore(t.TempDir())
+	require.NoError(t, err)
+	generator, err := docgen.NewGenerator()
+	require.NoError(t, err)
+	docs := NewDocumentService(docRepo, blobs)
+	svc := NewAgreementService(repo, docs, generator, "v1")
+
+	loan := &domain.Loan{
+		ID: "L1", BorrowerID: "B1", Principal: 1000, Rate: 10, ROI: 8, State: domain.LoanStateInvested,
+		Investments: []domain.Investment{
+			{ID: "INV1", LoanID: "L1", InvestorID: "I1", Amount: 600},
+			{ID: "INV2", LoanID: "L1", InvestorID: "I2", Amount: 400},
+		},
+	}
+	var stored []*domain.Document
+	docRepo.On("CreateDocument", mock.Anything, mock.AnythingOfType("*domain.Document")).
+		Run(func(args mock.Arguments) { stored = append(stored, args.Get(1).(*domain.Document)) }).
+		Return(nil)
+	repo.On("UpdateLoan", mock.Anything, loan).Return(nil).Once()
+	repo.On("GetInvestorByID", mock.Anything, "I1").Return(&domain.Investor{ID: "I1", Name: "Alice"}, nil)
+	repo.On("GetInvestorByID", mock.Anything, "I2").Return(&domain.Investor{ID: "I2"}, nil)
+	repo.On("UpdateInvestment", mock.Anything, mock.AnythingOfType("*domain.Investment")).Return(nil).Twice()
+
+	require.NoError(t, svc.GenerateAgreements(context.Background(), loan))
+
+	require.Len(t, stored, 3)
+	assert.Equal(t, domain.DocumentKindBorrowerAgreement, stored[0].Kind)
+	assert.Equal(t, "borrower_agreement/v1", stored[0].Template)
+	assert.Equal(t, stored[0].ContentPath(), loan.AgreementLetterURL)
+	for i, inv := range loan.Investments {
+		doc := stored[i+1]
+		assert.Equal(t, domain.DocumentKindInvestorAgreement, doc.Kind)
+		assert.Equal(t, doc.ContentPath(), inv.AgreementURL)
+		rc, err := blobs.Get(context.Background(), doc.StorageKey)
+		require.NoError(t, err)
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		assert.True(t, bytes.HasPrefix(content, []byte("%PDF-")))
+		assert.Equal(t, int64(len(content)), doc.Size)
+	}
+	repo.AssertExpectations(t)
+}
+
+func TestGenerateAgreements_RenderErrorStopsBeforeUpdates(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	docRepo := new(mock_loan_repo.MockDocumentRepo)
+	blobs, err := storage.NewFSStore(t.TempDir())
+	require.NoError(t, err)
+	generator, err := docgen.NewGenerator()
+	require.NoError(t, err)
+	svc := NewAgreementService(repo, NewDocumentService(docRepo, blobs), generator, "v999")
+
+	err = svc.GenerateAgreements(context.Background(), &domain.Loan{ID: "L1", Principal: 1000})
+	assert.Error(t, err)
+	repo.AssertNotCalled(t, "UpdateLoan", mock.Anything, mock.Anything)
+}
+
+func TestGenerateAgreements_UsesProductTemplate(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	docRepo := new(mock_loan_repo.MockDocumentRepo)
+	blobs, err := storage.NewFSStore(t.TempDir())
+	require.NoError(t, err)
+	generator, err := docgen.NewGenerator()
+	require.NoError(t, err)
+	// The configured version does not exist; the product's is used.
+	svc := NewAgreementService(repo, NewDocumentService(docRepo, blobs), generator, "v999")
+
+	productID := "P1"
+	loan := &domain.Loan{ID: "L1", BorrowerID: "B1", Principal: 1000, ProductID: &productID}
+	var stored []*domain.Document
+	repo.On("GetProductByID", mock.Anything, "P1").Return(&domain.LoanProduct{ID: "P1", AgreementTemplate: "v1"}, nil)
+	docRepo.On("CreateDocument", mock.Anything, mock.AnythingOfType("*domain.Document")).
+		Run(func(args mock.Arguments) { stored = append(stored, args.Get(1).(*domain.Document)) }).
+		Return(nil)
+	repo.On("UpdateLoan", mock.Anything, loan).Return(nil).Once()
+
+	require.NoError(t, svc.GenerateAgreements(context.Background(), loan))
+	require.Len(t, stored, 1)
+	assert.Equal(t, "borrower_agreement/v1", stored[0].Template)
+}
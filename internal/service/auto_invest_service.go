@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"loan_service/internal/domain"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// AutoInvestRepo abstracts persistence of auto-invest rules. The
+// concrete implementations are repository.LoanRepository and
+// memory.Store.
+type AutoInvestRepo interface {
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+	GetInvestorByID(ctx context.Context, id string) (*domain.Investor, error)
+	CreateAutoInvestRule(ctx context.Context, rule *domain.AutoInvestRule) error
+	UpdateAutoInvestRule(ctx context.Context, rule *domain.AutoInvestRule) error
+	// FindAutoInvestRule returns nil and a nil error if the investor
+	// has no rule.
+	FindAutoInvestRule(ctx context.Context, investorID string) (*domain.AutoInvestRule, error)
+	ListActiveAutoInvestRules(ctx context.Context) ([]domain.AutoInvestRule, error)
+	// GetAutoInvestedSince returns the sum of the investments placed by
+	// the rule at or after the given time.
+	GetAutoInvestedSince(ctx context.Context, ruleID string, since time.Time) (float64, error)
+}
+
+// ErrAutoInvestRuleNotFound is returned when an investor has no
+// auto-invest rule.
+var ErrAutoInvestRuleNotFound = errors.New("auto-invest rule not found")
+
+// AutoInvestService manages the auto-invest rules of investors. The
+// rules are applied by LoanService when a loan is approved.
+type AutoInvestService struct {
+	repo AutoInvestRepo
+}
+
+// NewAutoInvestService constructs a new AutoInvestService.
+func NewAutoInvestService(repo AutoInvestRepo) *AutoInvestService {
+	return &AutoInvestService{repo: repo}
+}
+
+// SetRule creates or replaces the auto-invest rule of the investor
+// rule.InvestorID and activates it. A replaced rule keeps its ID and
+// its place in the rotation.
+func (s *AutoInvestService) SetRule(ctx context.Context, rule domain.AutoInvestRule) (_ *domain.AutoInvestRule, err error) {
+	ctx, span := startSpan(ctx, "AutoInvestService.SetRule", attribute.String("investor.id", rule.InvestorID))
+	defer func() { endSpan(span, err) }()
+
+	if domain.Cents(rule.MaxPerLoan) <= 0 {
+		return nil, errors.New("max per loan amount must be positive")
+	}
+	if rule.MinROI < 0 || rule.MaxPrincipal < 0 || rule.DailyBudget < 0 {
+		return nil, errors.New("min ROI, max principal and daily budget must not be negative")
+	}
+	if rule.MaxRiskGrade != "" && !rule.MaxRiskGrade.Valid() {
+		return nil, fmt.Errorf("unknown risk grade %q; must be A to E", rule.MaxRiskGrade)
+	}
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := s.repo.GetInvestorByID(ctx, rule.InvestorID); err != nil {
+			return err
+		}
+		existing, err := s.repo.FindAutoInvestRule(ctx, rule.InvestorID)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		rule.Active = true
+		rule.UpdatedAt = now
+		if existing == nil {
+			rule.ID = uuid.New().String()
+			rule.LastPlacedAt = nil
+			rule.CreatedAt = now
+			return s.repo.CreateAutoInvestRule(ctx, &rule)
+		}
+		rule.ID = existing.ID
+		rule.LastPlacedAt = existing.LastPlacedAt
+		rule.CreatedAt = existing.CreatedAt
+		return s.repo.UpdateAutoInvestRule(ctx, &rule)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// GetRule returns the auto-invest rule of the investor, or
+// ErrAutoInvestRuleNotFound.
+func (s *AutoInvestService) GetRule(ctx context.Context, investorID string) (_ *domain.AutoInvestRule, err error) {
+	ctx, span := startSpan(ctx, "AutoInvestService.GetRule", attribute.String("investor.id", investorID))
+	defer func() { endSpan(span, err) }()
+
+	if _, err := s.repo.GetInvestorByID(ctx, investorID); err != nil {
+		return nil, err
+	}
+	rule, err := s.repo.FindAutoInvestRule(ctx, investorID)
+	if err != nil {
+		return nil, err
+	}
+	if rule == nil {
+		return nil, ErrAutoInvestRuleNotFound
+	}
+	return rule, nil
+}
+
+// DisableRule deactivates the auto-invest rule of the investor. The
+// rule is kept, so that the investments it placed still reference it,
+// and SetRule activates it again.
+func (s *AutoInvestService) DisableRule(ctx context.Context, investorID string) (_ *domain.AutoInvestRule, err error) {
+	ctx, span := startSpan(ctx, "AutoInvestService.DisableRule", attribute.String("investor.id", investorID))
+	defer func() { endSpan(span, err) }()
+
+	var rule *domain.AutoInvestRule
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := s.repo.GetInvestorByID(ctx, investorID); err != nil {
+			return err
+		}
+		var err error
+		if rule, err = s.repo.FindAutoInvestRule(ctx, investorID); err != nil {
+			return err
+		}
+		if rule == nil {
+			return ErrAutoInvestRuleNotFound
+		}
+		rule.Active = false
+		rule.UpdatedAt = time.Now().UTC()
+		return s.repo.UpdateAutoInvestRule(ctx, rule)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
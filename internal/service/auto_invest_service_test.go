@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/repository"
+	"loan_service/internal/repository/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoInvestService_Rules(t *testing.T) {
+	store := memory.NewStore()
+	svc := NewAutoInvestService(store)
+	ctx := context.Background()
+	require.NoError(t, store.CreateInvestor(ctx, &domain.Investor{ID: "I1"}))
+
+	_, err := svc.GetRule(ctx, "I1")
+	assert.ErrorIs(t, err, ErrAutoInvestRuleNotFound)
+	_, err = svc.SetRule(ctx, domain.AutoInvestRule{InvestorID: "I1"})
+	assert.ErrorContains(t, err, "max per loan amount must be positive")
+	_, err = svc.SetRule(ctx, domain.AutoInvestRule{InvestorID: "I1", MaxPerLoan: 100, MaxRiskGrade: "F"})
+	assert.ErrorContains(t, err, "unknown risk grade")
+	_, err = svc.SetRule(ctx, domain.AutoInvestRule{InvestorID: "missing", MaxPerLoan: 100})
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	rule, err := svc.SetRule(ctx, domain.AutoInvestRule{InvestorID: "I1", MinROI: 8, MaxPerLoan: 100})
+	require.NoError(t, err)
+	assert.True(t, rule.Active)
+	replaced, err := svc.SetRule(ctx, domain.AutoInvestRule{InvestorID: "I1", MaxPerLoan: 250, DailyBudget: 1000, MaxRiskGrade: "B"})
+	require.NoError(t, err)
+	assert.Equal(t, rule.ID, replaced.ID, "replacing a rule keeps its ID")
+	assert.Equal(t, rule.CreatedAt, replaced.CreatedAt)
+
+	disabled, err := svc.DisableRule(ctx, "I1")
+	require.NoError(t, err)
+	assert.False(t, disabled.Active)
+	got, err := svc.GetRule(ctx, "I1")
+	require.NoError(t, err)
+	assert.False(t, got.Active)
+	assert.Equal(t, 250.0, got.MaxPerLoan)
+	active, err := store.ListActiveAutoInvestRules(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, active)
+}
+
+func TestAutoInvestRule_Matches(t *testing.T) {
+	loan := &domain.Loan{Principal: 5000, ROI: 10, RiskGrade: "B"}
+	for name, tc := range map[string]struct {
+		rule domain.AutoInvestRule
+		want bool
+	}{
+		"any loan":          {domain.AutoInvestRule{Active: true}, true},
+		"inactive":          {domain.AutoInvestRule{}, false},
+		"ROI too low":       {domain.AutoInvestRule{Active: true, MinROI: 10.5}, false},
+		"principal too big": {domain.AutoInvestRule{Active: true, MaxPrincipal: 4000}, false},
+		"grade allowed":     {domain.AutoInvestRule{Active: true, MaxRiskGrade: "B"}, true},
+		"grade too risky":   {domain.AutoInvestRule{Active: true, MaxRiskGrade: "A"}, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.rule.Matches(loan))
+		})
+	}
+	assert.False(t, domain.AutoInvestRule{Active: true, MaxRiskGrade: "E"}.Matches(&domain.Loan{}),
+		"ungraded loans do not match a rule requiring a grade")
+}
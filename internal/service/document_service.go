@@ -0,0 +1,157 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// DocumentRepo abstracts persistence of document metadata. The
+// concrete implementation is repository.LoanRepository.
+type DocumentRepo interface {
+	CreateDocument(ctx context.Context, doc *domain.Document) error
+	GetDocumentByID(ctx context.Context, id string) (*domain.Document, error)
+}
+
+// allowedContentTypes lists the content types accepted per document
+// kind. Content types are sniffed from the uploaded bytes rather than
+// taken from the client supplied header.
+var allowedContentTypes = map[domain.DocumentKind][]string{
+	domain.DocumentKindApprovalProof:    {"image/jpeg", "image/png"},
+	domain.DocumentKindSignedAgreement:  {"application/pdf", "image/jpeg", "image/png"},
+	domain.DocumentKindIdentityDocument: {"application/pdf", "image/jpeg", "image/png"},
+}
+
+// ErrInvalidDocument is wrapped by errors returned when an upload is
+// rejected: a kind that cannot be uploaded, an empty file or a content
+// type not allowed for the kind.
+var ErrInvalidDocument = errors.New("invalid document")
+
+// DocumentService stores uploaded documents in a blob store and
+// records their metadata so that approvals and disbursements can
+// reference them by ID.
+type DocumentService struct {
+	repo  DocumentRepo
+	blobs storage.BlobStore
+}
+
+// NewDocumentService constructs a new DocumentService.
+func NewDocumentService(repo DocumentRepo, blobs storage.BlobStore) *DocumentService {
+	return &DocumentService{repo: repo, blobs: blobs}
+}
+
+// Upload stores the content read from r as a new document of the given
+// kind. size is the length of the content if known or -1; passing it
+// lets the blob store upload small documents in a single request. The
+// content type is detected from the first bytes of the upload and must
+// be acceptable for the kind. The size and SHA-256 checksum are
+// computed while the content streams into the blob store, so the
+// upload is never buffered in memory as a whole.
+func (s *DocumentService) Upload(ctx context.Context, kind domain.DocumentKind, fileName string, r io.Reader, size int64) (*domain.Document, error) {
+	if !kind.Uploadable() {
+		return nil, fmt.Errorf("%w: documents of kind %q cannot be uploaded", ErrInvalidDocument, kind)
+	}
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(head) == 0 {
+		return nil, fmt.Errorf("%w: document is empty", ErrInvalidDocument)
+	}
+	contentType := http.DetectContentType(head)
+	if !contentTypeAllowed(kind, contentType) {
+		return nil, fmt.Errorf("%w: content type %s is not allowed for %s documents", ErrInvalidDocument, contentType, kind)
+	}
+
+	return s.store(ctx, kind, fileName, contentType, "", br, size)
+}
+
+// StoreGenerated stores a document rendered by the service itself,
+// such as an agreement letter. template records the template and
+// version the content was rendered from.
+func (s *DocumentService) StoreGenerated(ctx context.Context, kind domain.DocumentKind, fileName, contentType, template string, content []byte) (*domain.Document, error) {
+	return s.store(ctx, kind, fileName, contentType, template, bytes.NewReader(content), int64(len(content)))
+}
+
+// store streams r, of the given size or -1, into the blob store while
+// computing its size and SHA-256 checksum, then records the document
+// metadata.
+func (s *DocumentService) store(ctx context.Context, kind domain.DocumentKind, fileName, contentType, template string, r io.Reader, size int64) (*domain.Document, error) {
+	doc := &domain.Document{
+		ID:          uuid.New().String(),
+		Kind:        kind,
+		FileName:    fileName,
+		ContentType: contentType,
+		Template:    template,
+		CreatedAt:   time.Now().UTC(),
+	}
+	doc.StorageKey = string(kind) + "/" + doc.ID
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	body := io.TeeReader(r, io.MultiWriter(hash, counter))
+	if err := s.blobs.Put(ctx, doc.StorageKey, body, size, contentType); err != nil {
+		return nil, fmt.Errorf("store document: %w", err)
+	}
+	doc.Size = counter.n
+	doc.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	if err := s.repo.CreateDocument(ctx, doc); err != nil {
+		// Do not leave orphaned blobs behind when the metadata cannot
+		// be recorded.
+		if delErr := s.blobs.Delete(ctx, doc.StorageKey); delErr != nil {
+			slog.ErrorContext(ctx, "failed to delete orphaned blob", "key", doc.StorageKey, "error", delErr)
+		}
+		return nil, err
+	}
+	return doc, nil
+}
+
+// GetDocument returns the metadata of a document.
+func (s *DocumentService) GetDocument(ctx context.Context, id string) (*domain.Document, error) {
+	return s.repo.GetDocumentByID(ctx, id)
+}
+
+// OpenDocument returns the metadata of a document together with a
+// reader for its content. The caller must close the reader.
+func (s *DocumentService) OpenDocument(ctx context.Context, id string) (*domain.Document, io.ReadCloser, error) {
+	doc, err := s.repo.GetDocumentByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	rc, err := s.blobs.Get(ctx, doc.StorageKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open document content: %w", err)
+	}
+	return doc, rc, nil
+}
+
+func contentTypeAllowed(kind domain.DocumentKind, contentType string) bool {
+	for _, ct := range allowedContentTypes[kind] {
+		if ct == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct{ n int64 }
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
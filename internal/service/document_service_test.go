@@ -0,0 +1,73 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"loan_service/internal/domain"
+	mock_loan_repo "loan_service/internal/service/mocks"
+	"loan_service/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// pngHeader is enough of a PNG file for content sniffing.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestUploadDocument_RecordsChecksumAndSize(t *testing.T) {
+	repo := new(mock_loan_repo.MockDocumentRepo)
+	blobs, err := storage.NewFSStore(t.TempDir())
+	require.NoError(t, err)
+	svc := NewDocumentService(repo, blobs)
+	content := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte("x"), 2000)...)
+	repo.On("CreateDocument", mock.Anything, mock.AnythingOfType("*domain.Document")).Return(nil)
+
+	doc, err := svc.Upload(context.Background(), domain.DocumentKindApprovalProof, "proof.png", bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	sum := sha256.Sum256(content)
+	assert.Equal(t, hex.EncodeToString(sum[:]), doc.SHA256)
+	assert.Equal(t, int64(len(content)), doc.Size)
+	assert.Equal(t, "image/png", doc.ContentType)
+	assert.Equal(t, "approval_proof/"+doc.ID, doc.StorageKey)
+
+	repo.On("GetDocumentByID", mock.Anything, doc.ID).Return(doc, nil)
+	_, rc, err := svc.OpenDocument(context.Background(), doc.ID)
+	require.NoError(t, err)
+	stored, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, content, stored)
+}
+
+func TestUploadDocument_RejectsDisallowedContentType(t *testing.T) {
+	repo := new(mock_loan_repo.MockDocumentRepo)
+	blobs, err := storage.NewFSStore(t.TempDir())
+	require.NoError(t, err)
+	svc := NewDocumentService(repo, blobs)
+
+	_, err = svc.Upload(context.Background(), domain.DocumentKindApprovalProof, "proof.pdf", bytes.NewReader([]byte("%PDF-1.4 agreement")), -1)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not allowed")
+	repo.AssertNotCalled(t, "CreateDocument", mock.Anything, mock.Anything)
+}
+
+func TestUploadDocument_DeletesBlobWhenMetadataFails(t *testing.T) {
+	repo := new(mock_loan_repo.MockDocumentRepo)
+	blobs, err := storage.NewFSStore(t.TempDir())
+	require.NoError(t, err)
+	svc := NewDocumentService(repo, blobs)
+	var key string
+	repo.On("CreateDocument", mock.Anything, mock.AnythingOfType("*domain.Document")).
+		Run(func(args mock.Arguments) { key = args.Get(1).(*domain.Document).StorageKey }).
+		Return(assert.AnError)
+
+	_, err = svc.Upload(context.Background(), domain.DocumentKindSignedAgreement, "signed.pdf", bytes.NewReader([]byte("%PDF-1.4 agreement")), -1)
+	assert.ErrorIs(t, err, assert.AnError)
+	_, err = blobs.Get(context.Background(), key)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
@@ -0,0 +1,525 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"loan_service/internal/domain"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// InvestorRepo abstracts persistence of investors. The concrete
+// implementations are repository.LoanRepository and memory.Store.
+type InvestorRepo interface {
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+	CreateInvestor(ctx context.Context, inv *domain.Investor) error
+	GetInvestorByID(ctx context.Context, id string) (*domain.Investor, error)
+	FindInvestorByEmail(ctx context.Context, email string) (*domain.Investor, error)
+	UpdateInvestor(ctx context.Context, inv *domain.Investor) error
+	GetDocumentByID(ctx context.Context, id string) (*domain.Document, error)
+	// ListInvestorLoans returns the loans the investor has invested in
+	// with their open investments.
+	ListInvestorLoans(ctx context.Context, investorID string) ([]domain.Loan, error)
+	ListRefunds(ctx context.Context, loanID string) ([]domain.Refund, error)
+}
+
+// ErrEmailTaken is returned when an investor is registered with an
+// email address that already belongs to another investor.
+var ErrEmailTaken = errors.New("email address already registered")
+
+// ErrInvalidAmount is returned when a wallet top-up or withdrawal is
+// requested for an amount that is not positive.
+var ErrInvalidAmount = errors.New("amount must be positive")
+
+// ErrInvalidKYC is wrapped by errors returned when a KYC submission or
+// review is rejected, such as incomplete identity data or a review of
+// an investor who has not submitted any.
+var ErrInvalidKYC = errors.New("invalid KYC request")
+
+// InvestorService registers investors and manages their wallets. A
+// wallet holds the funds an investor has topped up and not yet
+// invested or withdrawn; it is the investor's investor_wallet account
+// in the ledger.
+type InvestorService struct {
+	repo   InvestorRepo
+	ledger *LedgerService
+}
+
+// NewInvestorService constructs a new InvestorService. The repository
+// must store the ledger of ledger, so that wallet operations and the
+// investor lookups guarding them share transactions.
+func NewInvestorService(repo InvestorRepo, ledger *LedgerService) *InvestorService {
+	return &InvestorService{repo: repo, ledger: ledger}
+}
+
+// CreateInvestor registers a new investor. The email address must not
+// belong to another investor.
+func (s *InvestorService) CreateInvestor(ctx context.Context, name, email string) (_ *domain.Investor, err error) {
+	ctx, span := startSpan(ctx, "InvestorService.CreateInvestor")
+	defer func() { endSpan(span, err) }()
+
+	inv := &domain.Investor{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Email:     email,
+		KYC:       domain.KYC{Status: domain.KYCStatusPending},
+		CreatedAt: time.Now().UTC(),
+	}
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		existing, err := s.repo.FindInvestorByEmail(ctx, email)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return ErrEmailTaken
+		}
+		return s.repo.CreateInvestor(ctx, inv)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// GetInvestor returns the investor with the given ID.
+func (s *InvestorService) GetInvestor(ctx context.Context, id string) (_ *domain.Investor, err error) {
+	ctx, span := startSpan(ctx, "InvestorService.GetInvestor", attribute.String("investor.id", id))
+	defer func() { endSpan(span, err) }()
+
+	return s.repo.GetInvestorByID(ctx, id)
+}
+
+// KYCSubmission is the identity data an investor submits for
+// verification. DocumentID references an identity_document uploaded
+// through the document service.
+type KYCSubmission struct {
+	FullName    string
+	IDNumber    string
+	DateOfBirth time.Time
+	Address     string
+	DocumentID  string
+}
+
+// SubmitKYC records the identity data of an investor for review and
+// sets their KYC status to pending. Investors may submit again after a
+// rejection, replacing the earlier data, but not once verified.
+func (s *InvestorService) SubmitKYC(ctx context.Context, investorID string, sub KYCSubmission) (_ *domain.Investor, err error) {
+	ctx, span := startSpan(ctx, "InvestorService.SubmitKYC", attribute.String("investor.id", investorID))
+	defer func() { endSpan(span, err) }()
+
+	if sub.FullName == "" || sub.IDNumber == "" || sub.DateOfBirth.IsZero() || sub.Address == "" {
+		return nil, fmt.Errorf("%w: full name, ID number, date of birth and address are required", ErrInvalidKYC)
+	}
+	if !sub.DateOfBirth.Before(time.Now()) {
+		return nil, fmt.Errorf("%w: date of birth must be in the past", ErrInvalidKYC)
+	}
+	var inv *domain.Investor
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		if inv, err = s.repo.GetInvestorByID(ctx, investorID); err != nil {
+			return err
+		}
+		if inv.Verified() {
+			return fmt.Errorf("%w: investor is already verified", ErrInvalidKYC)
+		}
+		doc, err := s.repo.GetDocumentByID(ctx, sub.DocumentID)
+		if err != nil {
+			return fmt.Errorf("identity document %s: %w", sub.DocumentID, err)
+		}
+		if doc.Kind != domain.DocumentKindIdentityDocument {
+			return fmt.Errorf("%w: document %s is a %s, expected %s", ErrInvalidKYC, doc.ID, doc.Kind, domain.DocumentKindIdentityDocument)
+		}
+		dob := sub.DateOfBirth.UTC().Truncate(24 * time.Hour)
+		now := time.Now().UTC()
+		inv.KYC = domain.KYC{
+			Status:      domain.KYCStatusPending,
+			FullName:    sub.FullName,
+			IDNumber:    sub.IDNumber,
+			DateOfBirth: &dob,
+			Address:     sub.Address,
+			DocumentID:  &doc.ID,
+			SubmittedAt: &now,
+		}
+		return s.repo.UpdateInvestor(ctx, inv)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// ReviewKYC records the outcome of reviewing an investor's submitted
+// identity data: status is domain.KYCStatusVerified or
+// domain.KYCStatusRejected, and a rejection requires a reason. Only a
+// pending submission can be reviewed.
+func (s *InvestorService) ReviewKYC(ctx context.Context, investorID string, status domain.KYCStatus, reviewerID, reason string) (_ *domain.Investor, err error) {
+	ctx, span := startSpan(ctx, "InvestorService.ReviewKYC",
+		attribute.String("investor.id", investorID), attribute.String("kyc.status", string(status)))
+	defer func() { endSpan(span, err) }()
+
+	switch status {
+	case domain.KYCStatusVerified:
+		reason = ""
+	case domain.KYCStatusRejected:
+		if reason == "" {
+			return nil, fmt.Errorf("%w: a rejection requires a reason", ErrInvalidKYC)
+		}
+	default:
+		return nil, fmt.Errorf("%w: status must be %s or %s", ErrInvalidKYC, domain.KYCStatusVerified, domain.KYCStatusRejected)
+	}
+	if reviewerID == "" {
+		return nil, fmt.Errorf("%w: reviewer ID is required", ErrInvalidKYC)
+	}
+	var inv *domain.Investor
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		if inv, err = s.repo.GetInvestorByID(ctx, investorID); err != nil {
+			return err
+		}
+		if inv.KYC.SubmittedAt == nil {
+			return fmt.Errorf("%w: investor has not submitted KYC data", ErrInvalidKYC)
+		}
+		if inv.KYC.Status != domain.KYCStatusPending {
+			return fmt.Errorf("%w: KYC is already %s", ErrInvalidKYC, inv.KYC.Status)
+		}
+		now := time.Now().UTC()
+		inv.KYC.Status = status
+		inv.KYC.ReviewedBy = reviewerID
+		inv.KYC.ReviewedAt = &now
+		inv.KYC.RejectionReason = reason
+		return s.repo.UpdateInvestor(ctx, inv)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Wallet returns the wallet balance of the investor.
+func (s *InvestorService) Wallet(ctx context.Context, investorID string) (_ *domain.Wallet, err error) {
+	ctx, span := startSpan(ctx, "InvestorService.Wallet", attribute.String("investor.id", investorID))
+	defer func() { endSpan(span, err) }()
+
+	if _, err := s.repo.GetInvestorByID(ctx, investorID); err != nil {
+		return nil, err
+	}
+	balance, err := s.ledger.Balance(ctx, domain.InvestorWallet(investorID))
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Wallet{InvestorID: investorID, Balance: balance}, nil
+}
+
+// TopUp credits the investor's wallet with funds received from outside
+// the platform and returns the new balance. reference identifies the
+// incoming payment, such as a bank transfer ID, and is recorded in the
+// journal entry.
+func (s *InvestorService) TopUp(ctx context.Context, investorID string, amount float64, reference string) (_ *domain.Wallet, err error) {
+	ctx, span := startSpan(ctx, "InvestorService.TopUp", attribute.String("investor.id", investorID))
+	defer func() { endSpan(span, err) }()
+
+	return s.move(ctx, investorID, amount, func(ctx context.Context, wallet domain.AccountRef, balance float64) error {
+		_, err := s.ledger.Post(ctx, domain.JournalKindDeposit, "", describe("top-up", reference),
+			domain.Transfer{From: domain.ExternalAccount, To: wallet, Amount: amount})
+		return err
+	})
+}
+
+// Withdraw pays funds out of the investor's wallet and returns the new
+// balance. It fails with domain.ErrInsufficientFunds when the amount
+// exceeds the balance.
+func (s *InvestorService) Withdraw(ctx context.Context, investorID string, amount float64, reference string) (_ *domain.Wallet, err error) {
+	ctx, span := startSpan(ctx, "InvestorService.Withdraw", attribute.String("investor.id", investorID))
+	defer func() { endSpan(span, err) }()
+
+	return s.move(ctx, investorID, amount, func(ctx context.Context, wallet domain.AccountRef, balance float64) error {
+		if domain.Cents(balance) < domain.Cents(amount) {
+			return fmt.Errorf("%w: wallet balance %.2f is less than %.2f", domain.ErrInsufficientFunds, balance, amount)
+		}
+		_, err := s.ledger.Post(ctx, domain.JournalKindWithdrawal, "", describe("withdrawal", reference),
+			domain.Transfer{From: wallet, To: domain.ExternalAccount, Amount: amount})
+		return err
+	})
+}
+
+// move runs fn with the investor's wallet locked and its balance, and
+// returns the balance after fn has posted its entry.
+func (s *InvestorService) move(ctx context.Context, investorID string, amount float64, fn func(ctx context.Context, wallet domain.AccountRef, balance float64) error) (*domain.Wallet, error) {
+	if domain.Cents(amount) <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	wallet := domain.InvestorWallet(investorID)
+	var balance float64
+	err := s.repo.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := s.repo.GetInvestorByID(ctx, investorID); err != nil {
+			return err
+		}
+		current, err := s.ledger.LockBalance(ctx, wallet)
+		if err != nil {
+			return err
+		}
+		if err := fn(ctx, wallet, current); err != nil {
+			return err
+		}
+		balance, err = s.ledger.Balance(ctx, wallet)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &domain.Wallet{InvestorID: investorID, Balance: balance}, nil
+}
+
+// WalletHistory returns up to limit movements of the investor's
+// wallet, newest first: top-ups, withdrawals, investments, refunds and
+// payouts.
+func (s *InvestorService) WalletHistory(ctx context.Context, investorID string, limit int) (_ []domain.AccountEntry, err error) {
+	ctx, span := startSpan(ctx, "InvestorService.WalletHistory", attribute.String("investor.id", investorID))
+	defer func() { endSpan(span, err) }()
+
+	if _, err := s.repo.GetInvestorByID(ctx, investorID); err != nil {
+		return nil, err
+	}
+	return s.ledger.History(ctx, domain.InvestorWallet(investorID), limit)
+}
+
+// portfolioStates orders the breakdown of a portfolio by loan state.
+var portfolioStates = []domain.LoanState{
+	domain.LoanStateApproved,
+	domain.LoanStateInvested,
+	domain.LoanStateDisbursed,
+	domain.LoanStateRepaid,
+	domain.LoanStateCancelled,
+	domain.LoanStateExpired,
+}
+
+// Portfolio summarises the investor's positions across all loans. The
+// amounts paid, the realized payouts and the IRR are taken from the
+// movements of the investor's wallet in the ledger: investments,
+// refunds, payouts and secondary market sales. The principal of
+// refunded loans is reported separately from the principal deployed.
+func (s *InvestorService) Portfolio(ctx context.Context, investorID string) (_ *domain.Portfolio, err error) {
+	ctx, span := startSpan(ctx, "InvestorService.Portfolio", attribute.String("investor.id", investorID))
+	defer func() { endSpan(span, err) }()
+
+	// The positions and the wallet movements are read in one
+	// transaction, so that they come from the primary and an investment
+	// is never seen without the payment posted with it.
+	var loans []domain.Loan
+	var entries []domain.AccountEntry
+	// refunded is the principal returned to the investor from each loan
+	// that was cancelled or expired.
+	refunded := make(map[string]int64)
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := s.repo.GetInvestorByID(ctx, investorID); err != nil {
+			return err
+		}
+		var err error
+		if loans, err = s.repo.ListInvestorLoans(ctx, investorID); err != nil {
+			return err
+		}
+		for _, loan := range loans {
+			if loan.State != domain.LoanStateCancelled && loan.State != domain.LoanStateExpired {
+				continue
+			}
+			refunds, err := s.repo.ListRefunds(ctx, loan.ID)
+			if err != nil {
+				return err
+			}
+			for _, r := range refunds {
+				if r.InvestorID == investorID && r.Reason != domain.RefundReasonInvestmentCancelled {
+					refunded[loan.ID] += domain.Cents(r.Amount)
+				}
+			}
+		}
+		entries, err = s.ledger.History(ctx, domain.InvestorWallet(investorID), 0)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	payouts := make(map[string]int64)
+	// paid is the net amount the investor paid into each loan.
+	paid := make(map[string]int64)
+	var flows []cashFlow
+	for _, e := range entries {
+		switch e.Kind {
+		case domain.JournalKindPayout:
+			payouts[e.LoanID] += domain.Cents(e.Amount)
+		case domain.JournalKindInvestment, domain.JournalKindRefund, domain.JournalKindTransfer:
+			paid[e.LoanID] -= domain.Cents(e.Amount)
+		default:
+			continue
+		}
+		flows = append(flows, cashFlow{at: e.CreatedAt, amount: e.Amount})
+	}
+
+	p := &domain.Portfolio{
+		InvestorID: investorID,
+		ByState:    []domain.PortfolioStateSummary{},
+		Positions:  []domain.PortfolioPosition{},
+		AsOf:       time.Now().UTC(),
+	}
+	var total portfolioCents
+	// held is the amount paid for the positions still at risk.
+	var held int64
+	byState := make(map[domain.LoanState]*stateCents)
+	for _, loan := range loans {
+		var pos portfolioCents
+		var principal, payout int64
+		for _, inv := range loan.Investments {
+			if inv.InvestorID != investorID {
+				continue
+			}
+			principal += domain.Cents(inv.Amount)
+			// As paid out by LoanService.RepayLoan.
+			payout += domain.Cents(inv.Amount * (1 + loan.ROI/100))
+		}
+		if loan.State == domain.LoanStateCancelled || loan.State == domain.LoanStateExpired {
+			// The investments were closed when they were refunded.
+			pos.refunded = refunded[loan.ID]
+		} else {
+			pos.principal = principal
+			pos.paid = paid[loan.ID]
+			pos.expected = payout - pos.paid
+		}
+		if pos.principal == 0 && pos.refunded == 0 {
+			// The investor has sold their position.
+			continue
+		}
+		pos.realized = payouts[loan.ID]
+		if slices.Contains(domain.OutstandingLoanStates, loan.State) {
+			pos.outstanding = principal
+			held += pos.paid
+		}
+		p.Positions = append(p.Positions, domain.PortfolioPosition{
+			LoanID:           loan.ID,
+			State:            loan.State,
+			ROI:              loan.ROI,
+			PortfolioAmounts: pos.amounts(),
+		})
+		total.add(pos)
+		sc := byState[loan.State]
+		if sc == nil {
+			sc = &stateCents{}
+			byState[loan.State] = sc
+		}
+		sc.loans++
+		sc.add(pos)
+	}
+	for _, state := range portfolioStates {
+		if sc := byState[state]; sc != nil {
+			p.ByState = append(p.ByState, domain.PortfolioStateSummary{State: state, Loans: sc.loans, PortfolioAmounts: sc.amounts()})
+		}
+	}
+	p.PrincipalDeployed = domain.FromCents(total.principal)
+	p.AmountPaid = domain.FromCents(total.paid)
+	p.ExpectedReturn = domain.FromCents(total.expected)
+	p.RealizedPayouts = domain.FromCents(total.realized)
+	p.OutstandingPrincipal = domain.FromCents(total.outstanding)
+	p.PrincipalRefunded = domain.FromCents(total.refunded)
+	if held > 0 {
+		flows = append(flows, cashFlow{at: p.AsOf, amount: domain.FromCents(held)})
+	}
+	p.IRR = moneyWeightedReturn(flows)
+	return p, nil
+}
+
+// portfolioCents accumulates the amounts of portfolio positions in
+// cents.
+type portfolioCents struct {
+	principal, paid, expected, realized, outstanding, refunded int64
+}
+
+func (c *portfolioCents) add(o portfolioCents) {
+	c.principal += o.principal
+	c.paid += o.paid
+	c.expected += o.expected
+	c.realized += o.realized
+	c.outstanding += o.outstanding
+	c.refunded += o.refunded
+}
+
+func (c portfolioCents) amounts() domain.PortfolioAmounts {
+	return domain.PortfolioAmounts{
+		Principal:            domain.FromCents(c.principal),
+		AmountPaid:           domain.FromCents(c.paid),
+		ExpectedReturn:       domain.FromCents(c.expected),
+		RealizedPayouts:      domain.FromCents(c.realized),
+		OutstandingPrincipal: domain.FromCents(c.outstanding),
+		Refunded:             domain.FromCents(c.refunded),
+	}
+}
+
+// stateCents accumulates the positions in the loans in one state.
+type stateCents struct {
+	loans int
+	portfolioCents
+}
+
+// cashFlow is money received by an investor, or paid when negative.
+type cashFlow struct {
+	at     time.Time
+	amount float64
+}
+
+// moneyWeightedReturn returns the annual rate in percent, rounded to
+// two decimals, at which the net present value of the cash flows is
+// zero. It returns nil when the flows span less than a day, since
+// annualising a shorter period is meaningless, or when there is no
+// such rate between -99% and 1,000,000%.
+func moneyWeightedReturn(flows []cashFlow) *float64 {
+	if len(flows) == 0 {
+		return nil
+	}
+	first, last := flows[0].at, flows[0].at
+	for _, f := range flows {
+		if f.at.Before(first) {
+			first = f.at
+		}
+		if f.at.After(last) {
+			last = f.at
+		}
+	}
+	if last.Sub(first) < 24*time.Hour {
+		return nil
+	}
+	npv := func(rate float64) float64 {
+		var v float64
+		for _, f := range flows {
+			years := f.at.Sub(first).Hours() / (24 * 365)
+			v += f.amount / math.Pow(1+rate, years)
+		}
+		return v
+	}
+	lo, hi := -0.99, 10000.0
+	vlo, vhi := npv(lo), npv(hi)
+	if math.Signbit(vlo) == math.Signbit(vhi) {
+		return nil
+	}
+	for i := 0; i < 200 && hi-lo > 1e-9; i++ {
+		mid := (lo + hi) / 2
+		vmid := npv(mid)
+		if math.Signbit(vmid) == math.Signbit(vlo) {
+			lo, vlo = mid, vmid
+		} else {
+			hi = mid
+		}
+	}
+	rate := math.Round((lo+hi)/2*10000) / 100
+	return &rate
+}
+
+// describe returns the description of a wallet journal entry.
+func describe(what, reference string) string {
+	if reference == "" {
+		return what
+	}
+	return what + " " + reference
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/repository"
+	"loan_service/internal/repository/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvestorService_Wallet(t *testing.T) {
+	store := memory.NewStore()
+	ledger := NewLedgerService(store)
+	svc := NewInvestorService(store, ledger)
+	ctx := context.Background()
+
+	inv, err := svc.CreateInvestor(ctx, "Ann", "ann@example.com")
+	require.NoError(t, err)
+	_, err = svc.CreateInvestor(ctx, "Another Ann", "ann@example.com")
+	assert.ErrorIs(t, err, ErrEmailTaken)
+
+	wallet, err := svc.Wallet(ctx, inv.ID)
+	require.NoError(t, err)
+	assert.Zero(t, wallet.Balance)
+
+	wallet, err = svc.TopUp(ctx, inv.ID, 500, "TRX-1")
+	require.NoError(t, err)
+	assert.Equal(t, 500.0, wallet.Balance)
+	wallet, err = svc.Withdraw(ctx, inv.ID, 120.5, "")
+	require.NoError(t, err)
+	assert.Equal(t, 379.5, wallet.Balance)
+
+	_, err = svc.Withdraw(ctx, inv.ID, 379.51, "")
+	assert.ErrorIs(t, err, domain.ErrInsufficientFunds)
+	_, err = svc.TopUp(ctx, inv.ID, 0, "")
+	assert.ErrorContains(t, err, "amount must be positive")
+	_, err = svc.TopUp(ctx, "missing", 10, "")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	history, err := svc.WalletHistory(ctx, inv.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, domain.JournalKindWithdrawal, history[0].Kind)
+	assert.Equal(t, -120.5, history[0].Amount)
+	assert.Equal(t, domain.JournalKindDeposit, history[1].Kind)
+	assert.Equal(t, "top-up TRX-1", history[1].Description)
+
+	check, err := ledger.Check(ctx)
+	require.NoError(t, err)
+	assert.True(t, check.Balanced())
+}
+
+func TestInvestorService_InvestingSpendsWallet(t *testing.T) {
+	store := memory.NewStore()
+	ledger := NewLedgerService(store)
+	investors := NewInvestorService(store, ledger)
+	loans := NewLoanService(store, WithLedger(ledger))
+	ctx := context.Background()
+
+	inv, err := investors.CreateInvestor(ctx, "Ann", "ann@example.com")
+	require.NoError(t, err)
+	loan := &domain.Loan{ID: "L1", BorrowerID: "B1", State: domain.LoanStateApproved, Principal: 1000, Rate: 10, ROI: 8}
+	require.NoError(t, store.CreateLoan(ctx, loan))
+
+	_, err = loans.InvestInLoan(ctx, "L1", inv.ID, "", "", 300)
+	assert.ErrorIs(t, err, domain.ErrInsufficientFunds)
+
+	_, err = investors.TopUp(ctx, inv.ID, 500, "")
+	require.NoError(t, err)
+	_, err = loans.InvestInLoan(ctx, "L1", inv.ID, "", "", 300)
+	require.NoError(t, err)
+	wallet, err := investors.Wallet(ctx, inv.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 200.0, wallet.Balance)
+
+	cancelled, err := loans.CancelLoan(ctx, "L1")
+	require.NoError(t, err)
+	assert.Equal(t, domain.LoanStateCancelled, cancelled.State)
+	wallet, err = investors.Wallet(ctx, inv.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 500.0, wallet.Balance, "the investment is refunded")
+	escrow, err := ledger.Balance(ctx, domain.LoanEscrow("L1"))
+	require.NoError(t, err)
+	assert.Zero(t, escrow)
+}
+
+func TestInvestorService_KYC(t *testing.T) {
+	store := memory.NewStore()
+	svc := NewInvestorService(store, NewLedgerService(store))
+	ctx := context.Background()
+
+	inv, err := svc.CreateInvestor(ctx, "Ann", "ann@example.com")
+	require.NoError(t, err)
+	require.NoError(t, store.CreateDocument(ctx, &domain.Document{ID: "D1", Kind: domain.DocumentKindIdentityDocument}))
+	require.NoError(t, store.CreateDocument(ctx, &domain.Document{ID: "D2", Kind: domain.DocumentKindApprovalProof}))
+	sub := KYCSubmission{
+		FullName:    "Ann Smith",
+		IDNumber:    "3171234567890001",
+		DateOfBirth: time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC),
+		Address:     "Jl. Sudirman 1, Jakarta",
+		DocumentID:  "D1",
+	}
+
+	_, err = svc.ReviewKYC(ctx, inv.ID, domain.KYCStatusVerified, "E1", "")
+	assert.ErrorContains(t, err, "has not submitted")
+	_, err = svc.SubmitKYC(ctx, inv.ID, KYCSubmission{FullName: "Ann Smith"})
+	assert.ErrorContains(t, err, "are required")
+	bad := sub
+	bad.DocumentID = "D2"
+	_, err = svc.SubmitKYC(ctx, inv.ID, bad)
+	assert.ErrorContains(t, err, "expected identity_document")
+
+	inv, err = svc.SubmitKYC(ctx, inv.ID, sub)
+	require.NoError(t, err)
+	assert.Equal(t, domain.KYCStatusPending, inv.KYC.Status)
+	assert.NotNil(t, inv.KYC.SubmittedAt)
+
+	_, err = svc.ReviewKYC(ctx, inv.ID, domain.KYCStatusRejected, "E1", "")
+	assert.ErrorContains(t, err, "requires a reason")
+	inv, err = svc.ReviewKYC(ctx, inv.ID, domain.KYCStatusRejected, "E1", "document is blurred")
+	require.NoError(t, err)
+	assert.Equal(t, domain.KYCStatusRejected, inv.KYC.Status)
+	_, err = svc.ReviewKYC(ctx, inv.ID, domain.KYCStatusVerified, "E1", "")
+	assert.ErrorContains(t, err, "already rejected")
+
+	// A rejected investor submits again and is verified.
+	_, err = svc.SubmitKYC(ctx, inv.ID, sub)
+	require.NoError(t, err)
+	_, err = svc.ReviewKYC(ctx, inv.ID, domain.KYCStatusVerified, "E2", "")
+	require.NoError(t, err)
+	inv, err = svc.GetInvestor(ctx, inv.ID)
+	require.NoError(t, err)
+	assert.True(t, inv.Verified())
+	assert.Equal(t, "E2", inv.KYC.ReviewedBy)
+	assert.Empty(t, inv.KYC.RejectionReason)
+	_, err = svc.SubmitKYC(ctx, inv.ID, sub)
+	assert.ErrorContains(t, err, "already verified")
+}
+
+func TestInvestorService_Portfolio(t *testing.T) {
+	store := memory.NewStore()
+	ledger := NewLedgerService(store)
+	investors := NewInvestorService(store, ledger)
+	loans := NewLoanService(store, WithLedger(ledger))
+	ctx := context.Background()
+
+	ann, err := investors.CreateInvestor(ctx, "Ann", "ann@example.com")
+	require.NoError(t, err)
+	bob, err := investors.CreateInvestor(ctx, "Bob", "bob@example.com")
+	require.NoError(t, err)
+	for _, inv := range []*domain.Investor{ann, bob} {
+		_, err = investors.TopUp(ctx, inv.ID, 3000, "")
+		require.NoError(t, err)
+	}
+	empty, err := investors.Portfolio(ctx, ann.ID)
+	require.NoError(t, err)
+	assert.Empty(t, empty.Positions)
+	assert.Nil(t, empty.IRR)
+
+	invest := func(loanID, investorID string, amount float64) *domain.Investment {
+		t.Helper()
+		res, err := loans.Invest(ctx, InvestRequest{LoanID: loanID, InvestorID: investorID, Amount: amount})
+		require.NoError(t, err)
+		return res.Investment
+	}
+	disburse := func(loanID string) {
+		t.Helper()
+		require.NoError(t, store.CreateDocument(ctx, &domain.Document{ID: "A" + loanID, Kind: domain.DocumentKindSignedAgreement}))
+		_, err := loans.DisburseLoan(ctx, loanID, "A"+loanID, "E1", time.Now())
+		require.NoError(t, err)
+	}
+	for _, l := range []domain.Loan{
+		{ID: "L1", Principal: 1000, Rate: 12, ROI: 10},
+		{ID: "L2", Principal: 500, Rate: 10, ROI: 8},
+		{ID: "L3", Principal: 1000, Rate: 10, ROI: 9},
+		{ID: "L4", Principal: 1000, Rate: 10, ROI: 9},
+	} {
+		l.BorrowerID = "B1"
+		l.State = domain.LoanStateApproved
+		require.NoError(t, store.CreateLoan(ctx, &l))
+	}
+	// L1 is repaid, 60% of it to Ann.
+	invest("L1", ann.ID, 600)
+	invest("L1", bob.ID, 400)
+	disburse("L1")
+	_, err = loans.RepayLoan(ctx, "L1", 1120)
+	require.NoError(t, err)
+	// Ann sells 200 of her 500 in L2 to Bob.
+	sold := invest("L2", ann.ID, 500)
+	disburse("L2")
+	listing, err := loans.ListInvestment(ctx, "L2", sold.ID, 200, 190)
+	require.NoError(t, err)
+	_, err = loans.BuyListing(ctx, listing.ID, bob.ID)
+	require.NoError(t, err)
+	// L3 is still being funded and L4 was cancelled.
+	invest("L3", ann.ID, 200)
+	invest("L4", ann.ID, 100)
+	_, err = loans.CancelLoan(ctx, "L4")
+	require.NoError(t, err)
+
+	p, err := investors.Portfolio(ctx, ann.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1100.0, p.PrincipalDeployed, "refunded principal is not deployed")
+	assert.Equal(t, 100.0, p.PrincipalRefunded)
+	assert.Equal(t, 600+310+200.0, p.AmountPaid)
+	// Ann sold 200 of L2 at a loss of 10, which lowers its return.
+	assert.Equal(t, 60+14+18.0, p.ExpectedReturn)
+	assert.Equal(t, 660.0, p.RealizedPayouts)
+	assert.Equal(t, 500.0, p.OutstandingPrincipal)
+	assert.Nil(t, p.IRR, "the cash flows span less than a day")
+	require.Len(t, p.Positions, 4)
+	assert.Equal(t, domain.PortfolioPosition{LoanID: "L2", State: domain.LoanStateDisbursed, ROI: 8, PortfolioAmounts: domain.PortfolioAmounts{
+		Principal: 300, AmountPaid: 310, ExpectedReturn: 14, OutstandingPrincipal: 300,
+	}}, p.Positions[1])
+	var states []domain.LoanState
+	for _, s := range p.ByState {
+		states = append(states, s.State)
+		assert.Equal(t, 1, s.Loans)
+	}
+	assert.Equal(t, []domain.LoanState{domain.LoanStateApproved, domain.LoanStateDisbursed, domain.LoanStateRepaid, domain.LoanStateCancelled}, states)
+	assert.Equal(t, domain.PortfolioAmounts{Principal: 600, AmountPaid: 600, ExpectedReturn: 60, RealizedPayouts: 660}, p.ByState[2].PortfolioAmounts)
+	assert.Equal(t, domain.PortfolioAmounts{Refunded: 100}, p.ByState[3].PortfolioAmounts)
+
+	// Bob bought 200 of L2 for 190, so he earns 26 on it rather than 16.
+	p, err = investors.Portfolio(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 600.0, p.PrincipalDeployed)
+	assert.Equal(t, 590.0, p.AmountPaid)
+	assert.Equal(t, 40+26.0, p.ExpectedReturn)
+	assert.Equal(t, 200.0, p.OutstandingPrincipal)
+	_, err = investors.Portfolio(ctx, "missing")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestMoneyWeightedReturn(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	year := start.AddDate(0, 0, 365)
+	irr := moneyWeightedReturn([]cashFlow{{start, -1000}, {year, 1100}})
+	require.NotNil(t, irr)
+	assert.Equal(t, 10.0, *irr)
+
+	// Half the money is returned after half a year at the same rate.
+	half := start.AddDate(0, 0, 365/2)
+	irr = moneyWeightedReturn([]cashFlow{{start, -1000}, {half, 500 * math.Pow(1.1, 182.0/365)}, {year, 550}})
+	require.NotNil(t, irr)
+	assert.Equal(t, 10.0, *irr)
+
+	irr = moneyWeightedReturn([]cashFlow{{start, -1000}, {year, 900}})
+	require.NotNil(t, irr)
+	assert.Equal(t, -10.0, *irr)
+
+	assert.Nil(t, moneyWeightedReturn(nil))
+	assert.Nil(t, moneyWeightedReturn([]cashFlow{{start, -1000}, {start.Add(time.Hour), 1100}}))
+	assert.Nil(t, moneyWeightedReturn([]cashFlow{{start, -1000}, {year, -100}}))
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"loan_service/internal/domain"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// LedgerRepo persists the double-entry ledger. The concrete
+// implementations are repository.LoanRepository and memory.Store,
+// which store the ledger next to the loans so that entries take part
+// in the transactions of loan operations.
+type LedgerRepo interface {
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+	EnsureAccount(ctx context.Context, ref domain.AccountRef) (*domain.LedgerAccount, error)
+	// LockAccount ensures the account exists and locks it until the
+	// surrounding transaction ends.
+	LockAccount(ctx context.Context, ref domain.AccountRef) (*domain.LedgerAccount, error)
+	CreateJournalEntry(ctx context.Context, entry *domain.JournalEntry) error
+	GetAccountBalance(ctx context.Context, id string) (*domain.AccountBalance, error)
+	ListAccountBalances(ctx context.Context, filter domain.AccountRef) ([]domain.AccountBalance, error)
+	ListAccountEntries(ctx context.Context, accountID string, limit int) ([]domain.AccountEntry, error)
+	CheckLedger(ctx context.Context) (*domain.LedgerCheck, error)
+}
+
+// LedgerService records money movements as balanced journal entries
+// and reports account balances.
+type LedgerService struct {
+	repo LedgerRepo
+}
+
+// NewLedgerService constructs a new LedgerService.
+func NewLedgerService(repo LedgerRepo) *LedgerService {
+	return &LedgerService{repo: repo}
+}
+
+// Post records the transfers as a single journal entry of the given
+// kind, creating the accounts involved as needed. Every transfer must
+// move a positive amount between two different accounts. When ctx
+// carries a transaction the entry is part of it, so it is committed or
+// rolled back together with the operation it records.
+func (s *LedgerService) Post(ctx context.Context, kind domain.JournalKind, loanID, description string, transfers ...domain.Transfer) (_ *domain.JournalEntry, err error) {
+	ctx, span := startSpan(ctx, "LedgerService.Post", attribute.String("ledger.kind", string(kind)))
+	defer func() { endSpan(span, err) }()
+
+	if len(transfers) == 0 {
+		return nil, errors.New("journal entry has no transfers")
+	}
+	for _, t := range transfers {
+		if domain.Cents(t.Amount) <= 0 {
+			return nil, fmt.Errorf("transfer amount must be positive, got %.2f", t.Amount)
+		}
+		if t.From == t.To {
+			return nil, fmt.Errorf("transfer from %s %s to itself", t.From.Type, t.From.OwnerID)
+		}
+	}
+
+	entry := &domain.JournalEntry{
+		Kind:        kind,
+		LoanID:      loanID,
+		Description: description,
+		CreatedAt:   time.Now().UTC(),
+	}
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		accounts := make(map[domain.AccountRef]string)
+		account := func(ref domain.AccountRef) (string, error) {
+			if id, ok := accounts[ref]; ok {
+				return id, nil
+			}
+			acct, err := s.repo.EnsureAccount(ctx, ref)
+			if err != nil {
+				return "", err
+			}
+			accounts[ref] = acct.ID
+			return acct.ID, nil
+		}
+		for _, t := range transfers {
+			from, err := account(t.From)
+			if err != nil {
+				return err
+			}
+			to, err := account(t.To)
+			if err != nil {
+				return err
+			}
+			amount := domain.FromCents(domain.Cents(t.Amount))
+			entry.Postings = append(entry.Postings,
+				domain.Posting{AccountID: from, Debit: amount},
+				domain.Posting{AccountID: to, Credit: amount},
+			)
+		}
+		return s.repo.CreateJournalEntry(ctx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GetAccount returns the ledger account with the given ID and its
+// balance.
+func (s *LedgerService) GetAccount(ctx context.Context, id string) (_ *domain.AccountBalance, err error) {
+	ctx, span := startSpan(ctx, "LedgerService.GetAccount", attribute.String("ledger.account_id", id))
+	defer func() { endSpan(span, err) }()
+
+	return s.repo.GetAccountBalance(ctx, id)
+}
+
+// ListBalances returns the ledger accounts matching filter with their
+// balances. An empty filter type or owner matches any.
+func (s *LedgerService) ListBalances(ctx context.Context, filter domain.AccountRef) (_ []domain.AccountBalance, err error) {
+	ctx, span := startSpan(ctx, "LedgerService.ListBalances")
+	defer func() { endSpan(span, err) }()
+
+	return s.repo.ListAccountBalances(ctx, filter)
+}
+
+// Balance returns the balance of the account with the given type and
+// owner, which is zero for an account that has never been used.
+func (s *LedgerService) Balance(ctx context.Context, ref domain.AccountRef) (float64, error) {
+	rows, err := s.repo.ListAccountBalances(ctx, ref)
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		if row.Ref() == ref {
+			return row.Balance, nil
+		}
+	}
+	return 0, nil
+}
+
+// LockBalance returns the balance of the account with the given type
+// and owner and locks the account until the transaction carried by ctx
+// ends, so that funds checked against the balance cannot be spent
+// concurrently. It must be called within a transaction of the ledger
+// repository.
+func (s *LedgerService) LockBalance(ctx context.Context, ref domain.AccountRef) (float64, error) {
+	acct, err := s.repo.LockAccount(ctx, ref)
+	if err != nil {
+		return 0, err
+	}
+	bal, err := s.repo.GetAccountBalance(ctx, acct.ID)
+	if err != nil {
+		return 0, err
+	}
+	return bal.Balance, nil
+}
+
+// History returns up to limit journal entries of the account with the
+// given type and owner, newest first, or every entry when limit is
+// zero. An account that has never been used has no history.
+func (s *LedgerService) History(ctx context.Context, ref domain.AccountRef, limit int) (_ []domain.AccountEntry, err error) {
+	ctx, span := startSpan(ctx, "LedgerService.History")
+	defer func() { endSpan(span, err) }()
+
+	rows, err := s.repo.ListAccountBalances(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row.Ref() == ref {
+			return s.repo.ListAccountEntries(ctx, row.ID, limit)
+		}
+	}
+	return nil, nil
+}
+
+// Check verifies the ledger invariant that debits equal credits, in
+// total and within every journal entry.
+func (s *LedgerService) Check(ctx context.Context) (_ *domain.LedgerCheck, err error) {
+	ctx, span := startSpan(ctx, "LedgerService.Check")
+	defer func() { endSpan(span, err) }()
+
+	return s.repo.CheckLedger(ctx)
+}
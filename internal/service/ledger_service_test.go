@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"loan_service/internal/domain"
+	"loan_service/internal/repository/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedgerService_Post(t *testing.T) {
+	store := memory.NewStore()
+	svc := NewLedgerService(store)
+	ctx := context.Background()
+	wallet := domain.InvestorWallet("I1")
+
+	entry, err := svc.Post(ctx, domain.JournalKindDeposit, "", "top-up",
+		domain.Transfer{From: domain.ExternalAccount, To: wallet, Amount: 100.004})
+	require.NoError(t, err)
+	require.Len(t, entry.Postings, 2)
+	assert.True(t, entry.Balanced())
+	assert.Equal(t, 100.0, entry.Postings[0].Debit, "amounts are rounded to cents")
+
+	_, err = svc.Post(ctx, domain.JournalKindInvestment, "L1", "",
+		domain.Transfer{From: wallet, To: domain.LoanEscrow("L1"), Amount: 60},
+		domain.Transfer{From: wallet, To: domain.LoanEscrow("L2"), Amount: 15.5})
+	require.NoError(t, err)
+
+	balance, err := svc.Balance(ctx, wallet)
+	require.NoError(t, err)
+	assert.Equal(t, 24.5, balance)
+	balance, err = svc.Balance(ctx, domain.ExternalAccount)
+	require.NoError(t, err)
+	assert.Equal(t, -100.0, balance)
+	balance, err = svc.Balance(ctx, domain.InvestorWallet("unused"))
+	require.NoError(t, err)
+	assert.Zero(t, balance)
+
+	escrows, err := svc.ListBalances(ctx, domain.AccountRef{Type: domain.AccountTypeLoanEscrow})
+	require.NoError(t, err)
+	require.Len(t, escrows, 2)
+	assert.Equal(t, 60.0, escrows[0].Balance)
+
+	check, err := svc.Check(ctx)
+	require.NoError(t, err)
+	assert.True(t, check.Balanced())
+	assert.Equal(t, 175.5, check.Debits)
+}
+
+func TestLedgerService_PostRejectsInvalidTransfers(t *testing.T) {
+	svc := NewLedgerService(memory.NewStore())
+	ctx := context.Background()
+	wallet := domain.InvestorWallet("I1")
+
+	_, err := svc.Post(ctx, domain.JournalKindDeposit, "", "")
+	assert.Error(t, err)
+	_, err = svc.Post(ctx, domain.JournalKindDeposit, "", "", domain.Transfer{From: domain.ExternalAccount, To: wallet, Amount: 0.001})
+	assert.ErrorContains(t, err, "must be positive")
+	_, err = svc.Post(ctx, domain.JournalKindDeposit, "", "", domain.Transfer{From: wallet, To: wallet, Amount: 10})
+	assert.ErrorContains(t, err, "to itself")
+}
+
+func TestLedgerService_PostRollsBackWithTransaction(t *testing.T) {
+	store := memory.NewStore()
+	svc := NewLedgerService(store)
+	ctx := context.Background()
+	boom := errors.New("boom")
+
+	err := store.Transaction(ctx, func(ctx context.Context) error {
+		_, err := svc.Post(ctx, domain.JournalKindDeposit, "", "",
+			domain.Transfer{From: domain.ExternalAccount, To: domain.InvestorWallet("I1"), Amount: 10})
+		require.NoError(t, err)
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+
+	accounts, err := svc.ListBalances(ctx, domain.AccountRef{})
+	require.NoError(t, err)
+	assert.Empty(t, accounts)
+}
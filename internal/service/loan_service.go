@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"sort"
 	"time"
 
 	"loan_service/internal/domain"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // LoanRepo abstracts the persistence layer for easier testing (can be mocked in unit tests).
@@ -16,17 +20,101 @@ import (
 //
 //go:generate mockery --name=LoanRepo --output=./mocks --outpkg=mocks --case=underscore
 type LoanRepo interface {
+	// Transaction runs fn in a database transaction; repository calls
+	// made with the context passed to fn take part in it.
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
 	CreateLoan(ctx context.Context, loan *domain.Loan) error
 	GetLoanByID(ctx context.Context, id string) (*domain.Loan, error)
+	// GetLoanForUpdate reads a loan from the primary and locks it until
+	// the surrounding transaction ends.
+	GetLoanForUpdate(ctx context.Context, id string) (*domain.Loan, error)
 	UpdateLoan(ctx context.Context, loan *domain.Loan) error
 	CreateApproval(ctx context.Context, appr *domain.Approval) error
 	CreateInvestment(ctx context.Context, inv *domain.Investment) error
+	UpdateInvestment(ctx context.Context, inv *domain.Investment) error
+	CreateRefund(ctx context.Context, refund *domain.Refund) error
+	ListRefunds(ctx context.Context, loanID string) ([]domain.Refund, error)
 	FindInvestorByEmail(ctx context.Context, email string) (*domain.Investor, error)
 	CreateDisbursement(ctx context.Context, disb *domain.Disbursement) error
 	ListLoans(ctx context.Context) ([]domain.Loan, error)
+	ListLoansByState(ctx context.Context, state domain.LoanState) ([]domain.Loan, error)
+	// GetTotalInvested returns the sum of the loan's open investments.
 	GetTotalInvested(ctx context.Context, loanID string) (float64, error)
+	// GetInvestorExposure returns the sum of the investor's open
+	// investments in loans in one of domain.OutstandingLoanStates.
+	GetInvestorExposure(ctx context.Context, investorID string) (float64, error)
+	CreateReservation(ctx context.Context, res *domain.Reservation) error
+	// FindReservation returns nil and a nil error if the reservation
+	// does not exist.
+	FindReservation(ctx context.Context, id string) (*domain.Reservation, error)
+	UpdateReservation(ctx context.Context, res *domain.Reservation) error
+	// GetTotalReserved returns the sum of the loan's reservations that
+	// are still held at the given time.
+	GetTotalReserved(ctx context.Context, loanID string, at time.Time) (float64, error)
+	// ExpireReservations marks the held reservations that expired at or
+	// before the given time as expired and returns their number.
+	ExpireReservations(ctx context.Context, at time.Time) (int, error)
+	CreateListing(ctx context.Context, listing *domain.Listing) error
+	// FindListing returns nil and a nil error if the listing does not
+	// exist.
+	FindListing(ctx context.Context, id string) (*domain.Listing, error)
+	UpdateListing(ctx context.Context, listing *domain.Listing) error
+	// ListListings returns the listings of the loan in the given state;
+	// an empty loan ID or state matches any.
+	ListListings(ctx context.Context, loanID string, state domain.ListingState) ([]domain.Listing, error)
+	// CancelOpenListings cancels the open listings of the loan and
+	// returns their number.
+	CancelOpenListings(ctx context.Context, loanID string, at time.Time) (int, error)
+	// FindProduct returns the given version of a product, or its latest
+	// version when version is zero; it returns nil and a nil error if
+	// there is no such version.
+	FindProduct(ctx context.Context, code string, version int) (*domain.LoanProduct, error)
+	GetProductByID(ctx context.Context, id string) (*domain.LoanProduct, error)
 	GetInvestorByID(ctx context.Context, id string) (*domain.Investor, error)
 	CreateInvestor(ctx context.Context, inv *domain.Investor) error
+	GetDocumentByID(ctx context.Context, id string) (*domain.Document, error)
+	// DocumentAttached reports whether an approval or a disbursement
+	// references the document.
+	DocumentAttached(ctx context.Context, id string) (bool, error)
+}
+
+// EventPublisher receives loan events emitted by the service after
+// each successful state change or investment. The concrete
+// implementation is events.Bus.
+type EventPublisher interface {
+	Publish(ctx context.Context, ev domain.LoanEvent) error
+}
+
+// AgreementGenerator produces the agreement letters of a fully funded
+// loan and links them from the loan and its investments. The concrete
+// implementation is AgreementService.
+type AgreementGenerator interface {
+	GenerateAgreements(ctx context.Context, loan *domain.Loan) error
+}
+
+// Metrics records business metrics about loans and investments. The
+// concrete implementation is metrics.Metrics.
+type Metrics interface {
+	// LoanStateChanged records a state transition; from is empty for
+	// newly created loans.
+	LoanStateChanged(from, to domain.LoanState)
+	// InvestmentAccepted records an investment and its amount.
+	InvestmentAccepted(amount float64)
+	// OverfundingRejected records an investment refused because it
+	// would exceed the loan principal.
+	OverfundingRejected()
+	// LoanFunded records the time a loan took from approval to being
+	// fully funded.
+	LoanFunded(elapsed time.Duration)
+}
+
+// Ledger records the money movements of loan operations. The concrete
+// implementation is LedgerService.
+type Ledger interface {
+	Post(ctx context.Context, kind domain.JournalKind, loanID, description string, transfers ...domain.Transfer) (*domain.JournalEntry, error)
+	// LockBalance returns the balance of an account and locks it until
+	// the surrounding transaction ends.
+	LockBalance(ctx context.Context, ref domain.AccountRef) (float64, error)
 }
 
 // LoanService orchestrates business logic for loans. It sits
@@ -34,12 +122,129 @@ type LoanRepo interface {
 // computing derived data such as the total invested amount. Errors
 // returned from this service are suitable for consumption by HTTP
 // handlers.
-type LoanService struct{ repo LoanRepo }
+type LoanService struct {
+	repo       LoanRepo
+	events     EventPublisher
+	agreements AgreementGenerator
+	metrics    Metrics
+	ledger     Ledger
+	limits     Limits
+	autoInvest AutoInvestRepo
+}
+
+// Limits are business limits enforced by the service. A zero value
+// disables the corresponding limit.
+type Limits struct {
+	// MinInvestmentAmount and MaxInvestmentAmount are the smallest and
+	// largest amounts accepted for a single investment.
+	MinInvestmentAmount float64
+	MaxInvestmentAmount float64
+	// MaxLoanShare is the largest share of a loan's principal, as a
+	// percentage, that one investor may hold.
+	MaxLoanShare float64
+	// MaxInvestorExposure is the largest total one investor may have
+	// invested in loans that are not yet repaid, cancelled or expired.
+	MaxInvestorExposure float64
+	// KYCThreshold is the largest total an investor whose identity has
+	// not been verified may have invested in outstanding loans.
+	KYCThreshold float64
+	// RequireVerifiedInvestors restricts investing to existing
+	// investors whose identity has been verified, instead of creating
+	// investors on the fly from a name and email address.
+	RequireVerifiedInvestors bool
+	// MaxLoanPrincipal is the largest principal a loan may be
+	// proposed with.
+	MaxLoanPrincipal float64
+	// FundingPeriod is how long an approved loan may take to be fully
+	// funded. ExpireLoans expires loans approved longer ago.
+	FundingPeriod time.Duration
+	// CancellationWindow is the cooling-off period after an investment
+	// during which the investor may cancel it. Zero allows cancelling
+	// until the loan is fully funded.
+	CancellationWindow time.Duration
+	// ReservationTTL is how long a reservation holds its amount by
+	// default, and the longest hold that may be requested. Zero means
+	// DefaultReservationTTL.
+	ReservationTTL time.Duration
+}
+
+// DefaultReservationTTL is the reservation hold time used when
+// Limits.ReservationTTL is zero.
+const DefaultReservationTTL = 15 * time.Minute
+
+// ErrInvestmentNotFound is returned when an investment to cancel does
+// not exist or belongs to another loan.
+var ErrInvestmentNotFound = errors.New("investment not found")
+
+// ErrReservationNotFound is returned when a reservation does not exist
+// or belongs to another loan.
+var ErrReservationNotFound = errors.New("reservation not found")
+
+// ErrListingNotFound is returned when a secondary market listing does
+// not exist.
+var ErrListingNotFound = errors.New("listing not found")
+
+// ErrInvestmentRejected is wrapped by errors returned when an
+// investment is refused because of the loan's state or the amount
+// requested, such as an amount that would exceed the principal.
+// Business limits are reported as *domain.LimitError instead.
+var ErrInvestmentRejected = errors.New("investment rejected")
+
+// Option configures optional collaborators of a LoanService.
+type Option func(*LoanService)
+
+// WithEventPublisher makes the service emit loan events to p. Without
+// it no events are emitted.
+func WithEventPublisher(p EventPublisher) Option {
+	return func(s *LoanService) { s.events = p }
+}
+
+// WithAgreementGenerator makes the service generate agreement letters
+// when a loan becomes fully funded. Without it no agreements are
+// generated.
+func WithAgreementGenerator(g AgreementGenerator) Option {
+	return func(s *LoanService) { s.agreements = g }
+}
+
+// WithMetrics makes the service record business metrics to m.
+// Without it no metrics are recorded.
+func WithMetrics(m Metrics) Option {
+	return func(s *LoanService) { s.metrics = m }
+}
+
+// WithLimits makes the service enforce the given business limits.
+func WithLimits(l Limits) Option {
+	return func(s *LoanService) { s.limits = l }
+}
+
+// WithAutoInvest makes the service place investments on behalf of the
+// investors whose auto-invest rules, stored in repo, match a loan when
+// it is approved. Without it auto-invest rules are not applied. The
+// repository must be the one the service stores loans in, so that the
+// daily budgets are checked in the investment's transaction.
+func WithAutoInvest(repo AutoInvestRepo) Option {
+	return func(s *LoanService) { s.autoInvest = repo }
+}
+
+// WithLedger makes the service record investments, disbursements,
+// repayments, payouts, fees and refunds in the ledger, in the same
+// transaction as the operation itself, and makes investments draw on
+// the investor's wallet. Without it no money movements are recorded
+// and investments are not checked against a balance.
+func WithLedger(l Ledger) Option {
+	return func(s *LoanService) { s.ledger = l }
+}
 
 // NewLoanService constructs a new LoanService using the given
 // repository. Typically there is a single instance of the service
 // created during application startup.
-func NewLoanService(repo LoanRepo) *LoanService { return &LoanService{repo: repo} }
+func NewLoanService(repo LoanRepo, opts ...Option) *LoanService {
+	s := &LoanService{repo: repo}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
 
 // Repo returns the underlying repository. It is exposed to allow
 // handlers to perform read‑only operations not encapsulated by the
@@ -49,9 +254,36 @@ func NewLoanService(repo LoanRepo) *LoanService { return &LoanService{repo: repo
 func (s *LoanService) Repo() LoanRepo { return s.repo }
 
 // CreateLoan creates a new loan with initial state `proposed`. It
-// populates the ID with a new UUID. The loan is persisted via the
-// repository and returned with default timestamps.
-func (s *LoanService) CreateLoan(ctx context.Context, input domain.Loan) (*domain.Loan, error) {
+// populates the ID with a new UUID. The loan is offered under the
+// latest version of the product input.ProductCode, which it references,
+// and its principal, rate, ROI and tenor must meet the terms of that
+// version; it fails with ErrProductNotFound if there is no such
+// product. The loan is persisted via the repository and returned with
+// default timestamps.
+func (s *LoanService) CreateLoan(ctx context.Context, input domain.Loan) (_ *domain.Loan, err error) {
+	ctx, span := startSpan(ctx, "LoanService.CreateLoan", attribute.String("product.code", input.ProductCode))
+	defer func() { endSpan(span, err) }()
+
+	if max := s.limits.MaxLoanPrincipal; max > 0 && input.Principal > max {
+		return nil, &domain.LimitError{
+			Rule:    domain.LimitMaxPrincipal,
+			Message: fmt.Sprintf("principal %.2f exceeds the maximum of %.2f", input.Principal, max),
+		}
+	}
+	if input.ProductCode == "" {
+		return nil, errors.New("product code is required")
+	}
+	product, err := s.repo.FindProduct(ctx, input.ProductCode, 0)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+	if err := checkProductTerms(product, &input); err != nil {
+		return nil, err
+	}
+	input.ProductID = &product.ID
 	// Generate a new UUID for the loan.
 	input.ID = uuid.New().String()
 	input.State = domain.LoanStateProposed
@@ -61,185 +293,1273 @@ func (s *LoanService) CreateLoan(ctx context.Context, input domain.Loan) (*domai
 	if err := s.repo.CreateLoan(ctx, &input); err != nil {
 		return nil, err
 	}
+	s.publishStateChange(ctx, &input, "", 0)
 	return &input, nil
 }
 
-// ApproveLoan approves the loan with the given ID. It requires a
-// picture proof URL, the employee ID of the validator and the
-// approval date. The loan must currently be in the `proposed` state
-// and must not already have an approval record. On success the loan
-// state transitions to `approved` and the Approval record is
-// persisted.
-func (s *LoanService) ApproveLoan(ctx context.Context, loanID, pictureURL, employeeID string, approvalDate time.Time) (*domain.Loan, error) {
-	loan, err := s.repo.GetLoanByID(ctx, loanID)
+// checkProductTerms returns a *domain.LimitError when the terms of the
+// loan fall outside those of the product.
+func checkProductTerms(product *domain.LoanProduct, loan *domain.Loan) error {
+	var msg string
+	switch {
+	case loan.Principal < product.MinPrincipal || loan.Principal > product.MaxPrincipal:
+		msg = fmt.Sprintf("principal %.2f is outside the range %.2f to %.2f", loan.Principal, product.MinPrincipal, product.MaxPrincipal)
+	case loan.Rate < product.MinRate || loan.Rate > product.MaxRate:
+		msg = fmt.Sprintf("rate %.2f is outside the band %.2f to %.2f", loan.Rate, product.MinRate, product.MaxRate)
+	case loan.ROI < product.MinROI || loan.ROI > product.MaxROI:
+		msg = fmt.Sprintf("ROI %.2f is outside the band %.2f to %.2f", loan.ROI, product.MinROI, product.MaxROI)
+	case !product.OffersTenor(loan.TenorMonths):
+		msg = fmt.Sprintf("tenor of %d months is not offered; must be one of %v", loan.TenorMonths, product.TenorMonths)
+	default:
+		return nil
+	}
+	return &domain.LimitError{
+		Rule:    domain.LimitProductTerms,
+		Message: fmt.Sprintf("%s for product %s version %d", msg, product.Code, product.Version),
+	}
+}
+
+// ApproveLoan approves the loan with the given ID. It requires the ID
+// of an uploaded approval proof picture, the employee ID of the
+// validator and the approval date. The loan must currently be in the
+// `proposed` state and must not already have an approval record. On
+// success the loan state transitions to `approved` and the Approval
+// record is persisted. With WithAutoInvest the matching auto-invest
+// rules then invest in the loan, and the returned loan includes their
+// investments.
+func (s *LoanService) ApproveLoan(ctx context.Context, loanID, pictureDocumentID, employeeID string, approvalDate time.Time) (_ *domain.Loan, err error) {
+	ctx, span := startSpan(ctx, "LoanService.ApproveLoan", attribute.String("loan.id", loanID))
+	defer func() { endSpan(span, err) }()
+
+	var loan *domain.Loan
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		loan, err = s.repo.GetLoanForUpdate(ctx, loanID)
+		if err != nil {
+			return err
+		}
+		// Validate current state
+		if loan.State != domain.LoanStateProposed {
+			return fmt.Errorf("loan must be in proposed state to approve, current state: %s", loan.State)
+		}
+		// Check if already approved
+		if loan.Approval != nil {
+			return errors.New("loan already approved")
+		}
+		picture, err := s.requireDocument(ctx, pictureDocumentID, domain.DocumentKindApprovalProof)
+		if err != nil {
+			return err
+		}
+		// Create approval record
+		approval := &domain.Approval{
+			ID:                uuid.New().String(),
+			LoanID:            loan.ID,
+			PictureDocumentID: picture.ID,
+			PictureURL:        picture.ContentPath(),
+			EmployeeID:        employeeID,
+			ApprovalDate:      approvalDate,
+			CreatedAt:         time.Now().UTC(),
+		}
+		// Update loan state
+		loan.State = domain.LoanStateApproved
+		loan.UpdatedAt = time.Now().UTC()
+		if err := s.repo.CreateApproval(ctx, approval); err != nil {
+			return err
+		}
+		if err := s.repo.UpdateLoan(ctx, loan); err != nil {
+			return err
+		}
+		// Reload loan with approval for return
+		loan.Approval = approval
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	// Validate current state
-	if loan.State != domain.LoanStateProposed {
-		return nil, fmt.Errorf("loan must be in proposed state to approve, current state: %s", loan.State)
+	s.publishStateChange(ctx, loan, domain.LoanStateProposed, 0)
+	if s.autoInvest != nil {
+		loan = s.placeAutoInvestments(ctx, loan)
 	}
-	// Check if already approved
-	if loan.Approval != nil {
-		return nil, errors.New("loan already approved")
-	}
-	// Create approval record
-	approval := &domain.Approval{
-		ID:           uuid.New().String(),
-		LoanID:       loan.ID,
-		PictureURL:   pictureURL,
-		EmployeeID:   employeeID,
-		ApprovalDate: approvalDate,
-		CreatedAt:    time.Now().UTC(),
+	return loan, nil
+}
+
+// placeAutoInvestments invests in a newly approved loan on behalf of
+// the investors whose auto-invest rules match it. The rules take turns
+// in round-robin order: the rule that has waited longest since it last
+// placed an investment goes first, and each places one investment of
+// its per-loan amount, less what its daily budget no longer allows.
+// The investments go through invest like any other, in partial fill
+// mode so that the last one is reduced to what the loan still needs.
+// A rule whose investment is refused, for example by a limit or for
+// lack of funds in the wallet, is skipped. The approval has already
+// succeeded, so failures are logged rather than returned; the loan is
+// returned as it is after the investments.
+func (s *LoanService) placeAutoInvestments(ctx context.Context, loan *domain.Loan) *domain.Loan {
+	rules, err := s.autoInvest.ListActiveAutoInvestRules(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list auto-invest rules", "loan_id", loan.ID, "error", err)
+		return loan
 	}
-	// Update loan state
-	loan.State = domain.LoanStateApproved
-	loan.UpdatedAt = time.Now().UTC()
-	if err := s.repo.CreateApproval(ctx, approval); err != nil {
-		return nil, err
+	var matching []domain.AutoInvestRule
+	for _, rule := range rules {
+		if rule.Matches(loan) {
+			matching = append(matching, rule)
+		}
 	}
-	if err := s.repo.UpdateLoan(ctx, loan); err != nil {
-		return nil, err
+	sort.SliceStable(matching, func(i, j int) bool {
+		return waitedLonger(matching[i].LastPlacedAt, matching[j].LastPlacedAt)
+	})
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for i := range matching {
+		rule := &matching[i]
+		amount := rule.MaxPerLoan
+		if rule.DailyBudget > 0 {
+			spent, err := s.autoInvest.GetAutoInvestedSince(ctx, rule.ID, today)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to read auto-invest budget", "rule_id", rule.ID, "error", err)
+				continue
+			}
+			left := domain.Cents(rule.DailyBudget) - domain.Cents(spent)
+			if left <= 0 {
+				continue
+			}
+			amount = min(amount, domain.FromCents(left))
+		}
+		res, err := s.invest(ctx, InvestRequest{
+			LoanID:         loan.ID,
+			InvestorID:     rule.InvestorID,
+			Amount:         amount,
+			FillMode:       domain.FillModePartial,
+			autoInvestRule: rule,
+		})
+		if err != nil {
+			slog.InfoContext(ctx, "auto-invest rule skipped", "loan_id", loan.ID, "rule_id", rule.ID, "error", err)
+			continue
+		}
+		loan = res.Loan
+		if err := s.markAutoInvestPlaced(ctx, rule, res.Investment.CreatedAt); err != nil {
+			slog.ErrorContext(ctx, "failed to update auto-invest rule", "rule_id", rule.ID, "error", err)
+		}
+		if loan.State != domain.LoanStateApproved {
+			break
+		}
 	}
-	// Reload loan with approval for return
-	loan.Approval = approval
-	return loan, nil
+	return loan
 }
 
-// InvestInLoan records a new investment in the specified loan. It
-// accepts optional investor details. If an investor ID is provided it
-// must exist; otherwise a new investor will be created using the
-// provided name and email. The loan must be in the `approved` state
-// and the total investment after this call must not exceed the
-// principal amount. When the total invested equals the principal the
-// loan state transitions to `invested`. A slice of investments is
-// returned for convenience.
-func (s *LoanService) InvestInLoan(ctx context.Context, loanID, investorID, investorName, investorEmail string, amount float64) (*domain.Loan, error) {
-	if amount <= 0 {
-		return nil, fmt.Errorf("amount must be positive")
+// waitedLonger reports whether a rule last served at a has waited
+// longer than one last served at b. Rules never served come first.
+func waitedLonger(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b != nil
 	}
-	loan, err := s.repo.GetLoanByID(ctx, loanID)
+	return a.Before(*b)
+}
+
+// markAutoInvestPlaced records when the rule placed an investment,
+// which moves it to the back of the rotation. The rule is read again
+// so that a concurrent change to its criteria is not overwritten.
+func (s *LoanService) markAutoInvestPlaced(ctx context.Context, rule *domain.AutoInvestRule, at time.Time) error {
+	return s.autoInvest.Transaction(ctx, func(ctx context.Context) error {
+		current, err := s.autoInvest.FindAutoInvestRule(ctx, rule.InvestorID)
+		if err != nil || current == nil || current.ID != rule.ID {
+			return err
+		}
+		current.LastPlacedAt = &at
+		return s.autoInvest.UpdateAutoInvestRule(ctx, current)
+	})
+}
+
+// InvestRequest describes an investment made through Invest. The
+// investor is identified by InvestorID or, when it is empty, by
+// InvestorEmail, creating a new investor named InvestorName if no
+// investor has that email address.
+type InvestRequest struct {
+	LoanID        string
+	InvestorID    string
+	InvestorName  string
+	InvestorEmail string
+	Amount        float64
+	// FillMode selects what happens when Amount exceeds the amount the
+	// loan still needs; empty means domain.FillModeExact.
+	FillMode domain.FillMode
+
+	// reservationID is the reservation confirmed by the investment.
+	reservationID string
+	// autoInvestRule is the auto-invest rule placing the investment.
+	autoInvestRule *domain.AutoInvestRule
+}
+
+// InvestResult is the outcome of an accepted investment.
+type InvestResult struct {
+	Loan       *domain.Loan
+	Investment *domain.Investment
+	// RequestedAmount is the amount asked for and AcceptedAmount the
+	// amount invested, which is smaller for a partial fill.
+	RequestedAmount float64
+	AcceptedAmount  float64
+}
+
+// InvestInLoan records a new investment of exactly amount in the
+// specified loan, as Invest with domain.FillModeExact, and returns the
+// loan.
+func (s *LoanService) InvestInLoan(ctx context.Context, loanID, investorID, investorName, investorEmail string, amount float64) (_ *domain.Loan, err error) {
+	ctx, span := startSpan(ctx, "LoanService.InvestInLoan", attribute.String("loan.id", loanID))
+	defer func() { endSpan(span, err) }()
+
+	res, err := s.invest(ctx, InvestRequest{
+		LoanID:        loanID,
+		InvestorID:    investorID,
+		InvestorName:  investorName,
+		InvestorEmail: investorEmail,
+		Amount:        amount,
+	})
 	if err != nil {
 		return nil, err
 	}
+	return res.Loan, nil
+}
 
-	if loan.State == domain.LoanStateInvested {
-		return nil, fmt.Errorf("loan already fully funded")
-	}
+// Invest records a new investment in a loan. It accepts optional
+// investor details. If an investor ID is provided it must exist;
+// otherwise a new investor will be created using the provided name and
+// email, unless Limits.RequireVerifiedInvestors is set, in which case
+// the investor must already exist and be verified. Unverified
+// investors may not have more than Limits.KYCThreshold outstanding.
+// The loan must be in the `approved` state. When the amount
+// exceeds what the loan still needs, the investment is rejected in
+// exact fill mode and reduced to the remaining amount in partial fill
+// mode; the ticket size limits apply to the requested amount, so the
+// reduced amount may be below Limits.MinInvestmentAmount since it
+// completes the loan. The investor's share of the loan and outstanding
+// exposure are checked against the limits with the accepted amount.
+// When the total invested equals the
+// principal the loan state transitions to `invested`. The amount held
+// by active reservations is not available to the investment.
+//
+// With a ledger the amount is moved from the investor's wallet into
+// the loan's escrow, and the investment fails with
+// domain.ErrInsufficientFunds when the wallet balance is too low.
+//
+// The loan row, and the wallet, are locked while the investment is
+// checked and recorded, so concurrent investments in the same loan
+// cannot over-fund it and concurrent spending cannot overdraw the
+// wallet.
+func (s *LoanService) Invest(ctx context.Context, req InvestRequest) (_ *InvestResult, err error) {
+	ctx, span := startSpan(ctx, "LoanService.Invest",
+		attribute.String("loan.id", req.LoanID), attribute.String("investment.fill_mode", string(req.FillMode)))
+	defer func() { endSpan(span, err) }()
 
-	if loan.State != domain.LoanStateApproved {
-		return nil, fmt.Errorf("loan must be approved to invest, current state: %s", loan.State)
+	return s.invest(ctx, req)
+}
+
+// invest implements Invest.
+func (s *LoanService) invest(ctx context.Context, req InvestRequest) (*InvestResult, error) {
+	amount := req.Amount
+	fill := req.FillMode
+	if fill == "" {
+		fill = domain.FillModeExact
+	}
+	if !fill.Valid() {
+		return nil, fmt.Errorf("%w: unknown fill mode %q", ErrInvestmentRejected, fill)
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvestmentRejected)
+	}
+	if err := s.checkTicket(amount); err != nil {
+		return nil, err
 	}
 
-	// Retrieve or create investor
-	var investor *domain.Investor
-	if investorID != "" {
-		investor, err = s.repo.GetInvestorByID(ctx, investorID)
+	var (
+		loan        *domain.Loan
+		investor    *domain.Investor
+		invRec      *domain.Investment
+		reservation *domain.Reservation
+		accepted    float64
+		newTotal    float64
+	)
+	err := s.repo.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		loan, err = s.repo.GetLoanForUpdate(ctx, req.LoanID)
 		if err != nil {
-			return nil, err
+			return err
 		}
-	} else {
-		// Try to find by email if provided
-		if investorEmail != "" {
-			existing, err := s.repo.FindInvestorByEmail(ctx, investorEmail)
+
+		if loan.State == domain.LoanStateInvested {
+			return fmt.Errorf("%w: loan already fully funded", ErrInvestmentRejected)
+		}
+
+		if loan.State != domain.LoanStateApproved {
+			return fmt.Errorf("%w: loan must be approved to invest, current state: %s", ErrInvestmentRejected, loan.State)
+		}
+		now := time.Now().UTC()
+		if req.reservationID != "" {
+			reservation, err = s.heldReservation(ctx, loan.ID, req.reservationID, now)
 			if err != nil {
-				return nil, err
+				return err
 			}
-			if existing != nil {
-				investor = existing
+		}
+
+		// Retrieve or create investor
+		if req.InvestorID != "" {
+			investor, err = s.repo.GetInvestorByID(ctx, req.InvestorID)
+			if err != nil {
+				return fmt.Errorf("investor %s: %w", req.InvestorID, err)
+			}
+		} else {
+			// Try to find by email if provided
+			if req.InvestorEmail != "" {
+				existing, err := s.repo.FindInvestorByEmail(ctx, req.InvestorEmail)
+				if err != nil {
+					return err
+				}
+				if existing != nil {
+					investor = existing
+				}
 			}
+			if investor == nil {
+				if s.limits.RequireVerifiedInvestors {
+					return &domain.LimitError{
+						Rule:    domain.LimitKYCRequired,
+						Message: "investing requires the investor_id of a verified investor",
+					}
+				}
+				investor = &domain.Investor{
+					ID:        uuid.New().String(),
+					Name:      req.InvestorName,
+					Email:     req.InvestorEmail,
+					KYC:       domain.KYC{Status: domain.KYCStatusPending},
+					CreatedAt: time.Now().UTC(),
+				}
+				if err := s.repo.CreateInvestor(ctx, investor); err != nil {
+					return err
+				}
+			}
+		}
+		// Check that investment will not exceed principal, less the
+		// amount held by reservations other than the one confirmed.
+		currentTotal, err := s.repo.GetTotalInvested(ctx, loan.ID)
+		if err != nil {
+			return err
+		}
+		reserved, err := s.repo.GetTotalReserved(ctx, loan.ID, now)
+		if err != nil {
+			return err
 		}
-		if investor == nil {
-			investor = &domain.Investor{
-				ID:        uuid.New().String(),
-				Name:      investorName,
-				Email:     investorEmail,
-				CreatedAt: time.Now().UTC(),
+		if reservation != nil {
+			reserved = domain.FromCents(domain.Cents(reserved) - domain.Cents(reservation.Amount))
+		}
+		remaining := domain.Cents(loan.Principal) - domain.Cents(currentTotal) - domain.Cents(reserved)
+		accepted = amount
+		if domain.Cents(amount) > remaining {
+			if fill != domain.FillModePartial || remaining <= 0 {
+				if s.metrics != nil {
+					s.metrics.OverfundingRejected()
+				}
+				if reserved > 0 {
+					return fmt.Errorf("%w: investment would exceed principal; current invested %.2f + reserved %.2f + new %.2f > principal %.2f", ErrInvestmentRejected, currentTotal, reserved, amount, loan.Principal)
+				}
+				return fmt.Errorf("%w: investment would exceed principal; current invested %.2f + new %.2f > principal %.2f", ErrInvestmentRejected, currentTotal, amount, loan.Principal)
 			}
-			if err := s.repo.CreateInvestor(ctx, investor); err != nil {
-				return nil, err
+			accepted = domain.FromCents(remaining)
+		}
+		wallet := domain.InvestorWallet(investor.ID)
+		var balance float64
+		if s.ledger != nil {
+			if balance, err = s.ledger.LockBalance(ctx, wallet); err != nil {
+				return err
 			}
 		}
-	}
-	// Check that investment will not exceed principal
-	currentTotal, err := s.repo.GetTotalInvested(ctx, loan.ID)
+		if err := s.checkExposure(ctx, loan, investor.ID, accepted); err != nil {
+			return err
+		}
+		if err := s.checkKYC(ctx, investor, accepted); err != nil {
+			return err
+		}
+		if err := s.checkAutoInvestBudget(ctx, req.autoInvestRule, accepted); err != nil {
+			return err
+		}
+		if s.ledger != nil && domain.Cents(balance) < domain.Cents(accepted) {
+			return fmt.Errorf("%w: wallet balance %.2f is less than %.2f", domain.ErrInsufficientFunds, balance, accepted)
+		}
+		// Create investment record
+		invRec = &domain.Investment{
+			ID:         uuid.New().String(),
+			LoanID:     loan.ID,
+			InvestorID: investor.ID,
+			Amount:     accepted,
+			CreatedAt:  time.Now().UTC(),
+		}
+		if req.autoInvestRule != nil {
+			invRec.AutoInvestRuleID = &req.autoInvestRule.ID
+		}
+		if err := s.repo.CreateInvestment(ctx, invRec); err != nil {
+			return err
+		}
+		if reservation != nil {
+			reservation.State = domain.ReservationStateConfirmed
+			reservation.InvestmentID = &invRec.ID
+			reservation.UpdatedAt = invRec.CreatedAt
+			if err := s.repo.UpdateReservation(ctx, reservation); err != nil {
+				return err
+			}
+		}
+		// The funds are held in the loan's escrow until disbursement.
+		if err := s.post(ctx, domain.JournalKindInvestment, loan.ID, "investment "+invRec.ID,
+			domain.Transfer{From: wallet, To: domain.LoanEscrow(loan.ID), Amount: accepted}); err != nil {
+			return err
+		}
+		loan.Investments = append(loan.Investments, *invRec)
+		// Update state if fully funded
+		newTotal = domain.FromCents(domain.Cents(currentTotal) + domain.Cents(accepted))
+		if domain.Cents(newTotal) == domain.Cents(loan.Principal) {
+			loan.State = domain.LoanStateInvested
+			loan.UpdatedAt = time.Now().UTC()
+			if err := s.repo.UpdateLoan(ctx, loan); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	if currentTotal+amount > loan.Principal {
-		return nil, fmt.Errorf("investment would exceed principal; current invested %.2f + new %.2f > principal %.2f", currentTotal, amount, loan.Principal)
-	}
-	// Create investment record
-	invRec := &domain.Investment{
-		ID:         uuid.New().String(),
-		LoanID:     loan.ID,
-		InvestorID: investor.ID,
-		Amount:     amount,
-		CreatedAt:  time.Now().UTC(),
-	}
-	if err := s.repo.CreateInvestment(ctx, invRec); err != nil {
-		return nil, err
+
+	if s.metrics != nil {
+		s.metrics.InvestmentAccepted(accepted)
 	}
-	// Update state if fully funded
-	newTotal := currentTotal + amount
-	if newTotal == loan.Principal {
-		loan.State = domain.LoanStateInvested
-		loan.UpdatedAt = time.Now().UTC()
-		if err := s.repo.UpdateLoan(ctx, loan); err != nil {
-			return nil, err
+	s.publish(ctx, domain.LoanEvent{
+		LoanID:        loan.ID,
+		Type:          domain.LoanEventInvestmentAdded,
+		State:         domain.LoanStateApproved,
+		InvestmentID:  invRec.ID,
+		InvestorID:    investor.ID,
+		Amount:        accepted,
+		TotalInvested: newTotal,
+		Principal:     loan.Principal,
+	})
+	if loan.State == domain.LoanStateInvested {
+		s.publishStateChange(ctx, loan, domain.LoanStateApproved, newTotal)
+		if s.metrics != nil && loan.Approval != nil {
+			s.metrics.LoanFunded(loan.UpdatedAt.Sub(loan.Approval.CreatedAt))
+		}
+		// The loan is already invested at this point, so a failure to
+		// generate agreements is logged rather than returned; they can
+		// be generated again through RegenerateAgreements.
+		if err := s.generateAgreements(ctx, loan); err != nil {
+			slog.ErrorContext(ctx, "failed to generate agreements", "loan_id", loan.ID, "error", err)
 		}
 		// In a real system we would asynchronously send emails to
 		// investors here. To preserve simplicity and avoid external
 		// dependencies this implementation just logs the event.
-		fmt.Printf("Loan %s fully funded. Total invested: %.2f. Sending agreement link to investors...\n", loan.ID, newTotal)
+		slog.InfoContext(ctx, "loan fully funded; sending agreement links to investors",
+			"loan_id", loan.ID, "total_invested", newTotal, "investments", len(loan.Investments))
 	}
-	// Reload investments
-	// Instead of reloading from database, append to loan's slice for return
-	loan.Investments = append(loan.Investments, *invRec)
-	return loan, nil
+	return &InvestResult{Loan: loan, Investment: invRec, RequestedAmount: amount, AcceptedAmount: accepted}, nil
 }
 
 // DisburseLoan finalises the loan by marking it as disbursed. The
-// caller must supply a URL pointing to the signed agreement letter,
+// caller must supply the ID of the uploaded signed agreement letter,
 // the employee responsible for the disbursement and the date. The
 // loan must be in the `invested` state and must not already have a
 // disbursement record. On success the state is set to `disbursed`.
-func (s *LoanService) DisburseLoan(ctx context.Context, loanID, agreementURL, employeeID string, disbursementDate time.Time) (*domain.Loan, error) {
-	loan, err := s.repo.GetLoanByID(ctx, loanID)
+func (s *LoanService) DisburseLoan(ctx context.Context, loanID, agreementDocumentID, employeeID string, disbursementDate time.Time) (_ *domain.Loan, err error) {
+	ctx, span := startSpan(ctx, "LoanService.DisburseLoan", attribute.String("loan.id", loanID))
+	defer func() { endSpan(span, err) }()
+
+	var loan *domain.Loan
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		loan, err = s.repo.GetLoanForUpdate(ctx, loanID)
+		if err != nil {
+			return err
+		}
+		if loan.State != domain.LoanStateInvested {
+			return fmt.Errorf("loan must be invested to disburse, current state: %s", loan.State)
+		}
+		if loan.Disbursement != nil {
+			return errors.New("loan already disbursed")
+		}
+		agreement, err := s.requireDocument(ctx, agreementDocumentID, domain.DocumentKindSignedAgreement)
+		if err != nil {
+			return err
+		}
+		disb := &domain.Disbursement{
+			ID:                  uuid.New().String(),
+			LoanID:              loan.ID,
+			AgreementDocumentID: agreement.ID,
+			AgreementURL:        agreement.ContentPath(),
+			EmployeeID:          employeeID,
+			DisbursementDate:    disbursementDate,
+			CreatedAt:           time.Now().UTC(),
+		}
+		loan.State = domain.LoanStateDisbursed
+		loan.UpdatedAt = time.Now().UTC()
+		if err := s.repo.CreateDisbursement(ctx, disb); err != nil {
+			return err
+		}
+		if err := s.post(ctx, domain.JournalKindDisbursement, loan.ID, "disbursement "+disb.ID,
+			domain.Transfer{From: domain.LoanEscrow(loan.ID), To: domain.BorrowerAccount(loan.BorrowerID), Amount: loan.Principal}); err != nil {
+			return err
+		}
+		if err := s.repo.UpdateLoan(ctx, loan); err != nil {
+			return err
+		}
+		loan.Disbursement = disb
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.publishStateChange(ctx, loan, domain.LoanStateInvested, loan.Principal)
+	return loan, nil
+}
+
+// RepayLoan records the borrower's repayment of a disbursed loan. The
+// amount must equal the principal plus interest at the loan's rate.
+// The repayment is paid out to the investors, each receiving their
+// investment plus the return at the loan's ROI, and the remainder is
+// the platform's fee. Open listings of the loan are cancelled. On
+// success the state is set to `repaid`.
+func (s *LoanService) RepayLoan(ctx context.Context, loanID string, amount float64) (_ *domain.Loan, err error) {
+	ctx, span := startSpan(ctx, "LoanService.RepayLoan", attribute.String("loan.id", loanID))
+	defer func() { endSpan(span, err) }()
+
+	var loan *domain.Loan
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		loan, err = s.repo.GetLoanForUpdate(ctx, loanID)
+		if err != nil {
+			return err
+		}
+		if loan.State != domain.LoanStateDisbursed {
+			return fmt.Errorf("loan must be disbursed to repay, current state: %s", loan.State)
+		}
+		due := domain.Cents(loan.Principal * (1 + loan.Rate/100))
+		if domain.Cents(amount) != due {
+			return fmt.Errorf("repayment must equal the amount due of %.2f", domain.FromCents(due))
+		}
+		escrow := domain.LoanEscrow(loan.ID)
+		payouts := make([]domain.Transfer, 0, len(loan.Investments))
+		fee := due
+		for _, inv := range loan.Investments {
+			payout := domain.Cents(inv.Amount * (1 + loan.ROI/100))
+			payouts = append(payouts, domain.Transfer{From: escrow, To: domain.InvestorWallet(inv.InvestorID), Amount: domain.FromCents(payout)})
+			fee -= payout
+		}
+		if fee < 0 {
+			return fmt.Errorf("investor returns exceed the repayment by %.2f", domain.FromCents(-fee))
+		}
+
+		loan.State = domain.LoanStateRepaid
+		loan.UpdatedAt = time.Now().UTC()
+		if err := s.repo.UpdateLoan(ctx, loan); err != nil {
+			return err
+		}
+		// Positions of a repaid loan can no longer be sold.
+		if _, err := s.repo.CancelOpenListings(ctx, loan.ID, loan.UpdatedAt); err != nil {
+			return err
+		}
+		if err := s.post(ctx, domain.JournalKindRepayment, loan.ID, "repayment of loan "+loan.ID,
+			domain.Transfer{From: domain.BorrowerAccount(loan.BorrowerID), To: escrow, Amount: domain.FromCents(due)}); err != nil {
+			return err
+		}
+		if len(payouts) > 0 {
+			if err := s.post(ctx, domain.JournalKindPayout, loan.ID, "payout of loan "+loan.ID, payouts...); err != nil {
+				return err
+			}
+		}
+		if fee > 0 {
+			if err := s.post(ctx, domain.JournalKindFee, loan.ID, "fee of loan "+loan.ID,
+				domain.Transfer{From: escrow, To: domain.PlatformRevenueAccount, Amount: domain.FromCents(fee)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	if loan.State != domain.LoanStateInvested {
-		return nil, fmt.Errorf("loan must be invested to disburse, current state: %s", loan.State)
+	s.publishStateChange(ctx, loan, domain.LoanStateDisbursed, loan.Principal)
+	return loan, nil
+}
+
+// CancelLoan withdraws a loan that is not yet fully funded. The loan
+// must be `proposed` or `approved`; its investments, if any, are
+// refunded to the investors' wallets and the state is set to
+// `cancelled`.
+func (s *LoanService) CancelLoan(ctx context.Context, loanID string) (_ *domain.Loan, err error) {
+	ctx, span := startSpan(ctx, "LoanService.CancelLoan", attribute.String("loan.id", loanID))
+	defer func() { endSpan(span, err) }()
+
+	var (
+		loan     *domain.Loan
+		previous domain.LoanState
+	)
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		loan, err = s.repo.GetLoanForUpdate(ctx, loanID)
+		if err != nil {
+			return err
+		}
+		if loan.State != domain.LoanStateProposed && loan.State != domain.LoanStateApproved {
+			return fmt.Errorf("loan must be proposed or approved to cancel, current state: %s", loan.State)
+		}
+		previous = loan.State
+		return s.closeLoan(ctx, loan, domain.LoanStateCancelled, domain.RefundReasonLoanCancelled)
+	})
+	if err != nil {
+		return nil, err
 	}
-	if loan.Disbursement != nil {
-		return nil, errors.New("loan already disbursed")
+	s.publishStateChange(ctx, loan, previous, 0)
+	return loan, nil
+}
+
+// ExpireLoans expires the approved loans that were not fully funded
+// within Limits.FundingPeriod, refunding their investments, and
+// returns the number of loans expired. It does nothing without a
+// funding period. Each loan is expired in its own transaction; a
+// failure is logged and the remaining loans are still processed.
+func (s *LoanService) ExpireLoans(ctx context.Context) (_ int, err error) {
+	period := s.limits.FundingPeriod
+	if period <= 0 {
+		return 0, nil
 	}
-	disb := &domain.Disbursement{
-		ID:               uuid.New().String(),
-		LoanID:           loan.ID,
-		AgreementURL:     agreementURL,
-		EmployeeID:       employeeID,
-		DisbursementDate: disbursementDate,
-		CreatedAt:        time.Now().UTC(),
+	ctx, span := startSpan(ctx, "LoanService.ExpireLoans")
+	defer func() { endSpan(span, err) }()
+
+	approved, err := s.repo.ListLoansByState(ctx, domain.LoanStateApproved)
+	if err != nil {
+		return 0, err
 	}
-	loan.State = domain.LoanStateDisbursed
+	cutoff := time.Now().UTC().Add(-period)
+	var (
+		expired int
+		errs    []error
+	)
+	for _, candidate := range approved {
+		if candidate.Approval == nil || !candidate.Approval.CreatedAt.Before(cutoff) {
+			continue
+		}
+		var loan *domain.Loan
+		err := s.repo.Transaction(ctx, func(ctx context.Context) error {
+			var err error
+			loan, err = s.repo.GetLoanForUpdate(ctx, candidate.ID)
+			if err != nil {
+				return err
+			}
+			// The loan may have been funded or cancelled since it was
+			// listed.
+			if loan.State != domain.LoanStateApproved {
+				loan = nil
+				return nil
+			}
+			return s.closeLoan(ctx, loan, domain.LoanStateExpired, domain.RefundReasonLoanExpired)
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to expire loan", "loan_id", candidate.ID, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		if loan != nil {
+			expired++
+			s.publishStateChange(ctx, loan, domain.LoanStateApproved, 0)
+		}
+	}
+	return expired, errors.Join(errs...)
+}
+
+// closeLoan moves a loan that did not go ahead to the given final
+// state, closes its investments and refunds them from the loan's
+// escrow to the investors' wallets, recording a refund with the given
+// reason for each. It must be called within a transaction holding the
+// loan lock.
+func (s *LoanService) closeLoan(ctx context.Context, loan *domain.Loan, state domain.LoanState, reason domain.RefundReason) error {
+	loan.State = state
 	loan.UpdatedAt = time.Now().UTC()
-	if err := s.repo.CreateDisbursement(ctx, disb); err != nil {
+	if err := s.repo.UpdateLoan(ctx, loan); err != nil {
+		return err
+	}
+	if len(loan.Investments) == 0 {
+		return nil
+	}
+	escrow := domain.LoanEscrow(loan.ID)
+	now := time.Now().UTC()
+	refunds := make([]domain.Transfer, 0, len(loan.Investments))
+	for i := range loan.Investments {
+		inv := &loan.Investments[i]
+		inv.CancelledAt = &now
+		if err := s.repo.UpdateInvestment(ctx, inv); err != nil {
+			return err
+		}
+		if err := s.repo.CreateRefund(ctx, newRefund(loan.ID, *inv, reason)); err != nil {
+			return err
+		}
+		refunds = append(refunds, domain.Transfer{From: escrow, To: domain.InvestorWallet(inv.InvestorID), Amount: inv.Amount})
+	}
+	return s.post(ctx, domain.JournalKindRefund, loan.ID, fmt.Sprintf("refund of %s loan %s", state, loan.ID), refunds...)
+}
+
+// newRefund returns the refund record of an investment in the loan.
+func newRefund(loanID string, inv domain.Investment, reason domain.RefundReason) *domain.Refund {
+	return &domain.Refund{
+		ID:           uuid.New().String(),
+		LoanID:       loanID,
+		InvestmentID: inv.ID,
+		InvestorID:   inv.InvestorID,
+		Amount:       inv.Amount,
+		Reason:       reason,
+		CreatedAt:    time.Now().UTC(),
+	}
+}
+
+// CancelInvestment cancels an investment at the investor's request
+// while the loan is still `approved`, closing the investment and
+// refunding its amount from the loan's escrow to the investor's
+// wallet. With a Limits.CancellationWindow the investment must have
+// been made within the window. The funding total is recomputed under
+// the loan lock and published with the cancellation, so that the freed
+// amount can be invested again at once.
+func (s *LoanService) CancelInvestment(ctx context.Context, loanID, investmentID string) (_ *domain.Refund, err error) {
+	ctx, span := startSpan(ctx, "LoanService.CancelInvestment",
+		attribute.String("loan.id", loanID), attribute.String("investment.id", investmentID))
+	defer func() { endSpan(span, err) }()
+
+	var (
+		loan   *domain.Loan
+		refund *domain.Refund
+		total  float64
+	)
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		loan, err = s.repo.GetLoanForUpdate(ctx, loanID)
+		if err != nil {
+			return err
+		}
+		// The state is checked first: the investments of a cancelled or
+		// expired loan are closed and no longer found.
+		if loan.State != domain.LoanStateApproved {
+			return fmt.Errorf("investments can only be cancelled while the loan is approved, current state: %s", loan.State)
+		}
+		inv := findInvestment(loan, investmentID)
+		if inv == nil {
+			return ErrInvestmentNotFound
+		}
+		if window := s.limits.CancellationWindow; window > 0 && time.Since(inv.CreatedAt) > window {
+			return fmt.Errorf("the cancellation window of %s after investing has passed", window)
+		}
+		now := time.Now().UTC()
+		inv.CancelledAt = &now
+		if err := s.repo.UpdateInvestment(ctx, inv); err != nil {
+			return err
+		}
+		refund = newRefund(loan.ID, *inv, domain.RefundReasonInvestmentCancelled)
+		if err := s.repo.CreateRefund(ctx, refund); err != nil {
+			return err
+		}
+		if err := s.post(ctx, domain.JournalKindRefund, loan.ID, "cancelled investment "+inv.ID,
+			domain.Transfer{From: domain.LoanEscrow(loan.ID), To: domain.InvestorWallet(inv.InvestorID), Amount: inv.Amount}); err != nil {
+			return err
+		}
+		total, err = s.repo.GetTotalInvested(ctx, loan.ID)
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
-	if err := s.repo.UpdateLoan(ctx, loan); err != nil {
+	s.publish(ctx, domain.LoanEvent{
+		LoanID:        loan.ID,
+		Type:          domain.LoanEventInvestmentCancelled,
+		State:         loan.State,
+		InvestmentID:  refund.InvestmentID,
+		InvestorID:    refund.InvestorID,
+		Amount:        refund.Amount,
+		TotalInvested: total,
+		Principal:     loan.Principal,
+	})
+	return refund, nil
+}
+
+// ListRefunds returns the refunds made from the loan, oldest first.
+func (s *LoanService) ListRefunds(ctx context.Context, loanID string) (_ []domain.Refund, err error) {
+	ctx, span := startSpan(ctx, "LoanService.ListRefunds", attribute.String("loan.id", loanID))
+	defer func() { endSpan(span, err) }()
+
+	if _, err := s.repo.GetLoanByID(ctx, loanID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListRefunds(ctx, loanID)
+}
+
+// Reserve holds amount of an approved loan for an existing investor
+// for ttl, or Limits.ReservationTTL when ttl is zero, while they
+// complete payment. The hold counts against the principal like an
+// investment, so the reservation fails when the loan does not have
+// the amount left. The investment limits are checked as for Invest,
+// and again on confirmation since holds do not count towards an
+// investor's exposure; the wallet is not checked until then.
+func (s *LoanService) Reserve(ctx context.Context, loanID, investorID string, amount float64, ttl time.Duration) (_ *domain.Reservation, err error) {
+	ctx, span := startSpan(ctx, "LoanService.Reserve", attribute.String("loan.id", loanID))
+	defer func() { endSpan(span, err) }()
+
+	maxTTL := s.limits.ReservationTTL
+	if maxTTL <= 0 {
+		maxTTL = DefaultReservationTTL
+	}
+	if ttl == 0 {
+		ttl = maxTTL
+	}
+	if ttl < 0 || ttl > maxTTL {
+		return nil, fmt.Errorf("reservations can be held for at most %s", maxTTL)
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+	if err := s.checkTicket(amount); err != nil {
+		return nil, err
+	}
+
+	var res *domain.Reservation
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		loan, err := s.repo.GetLoanForUpdate(ctx, loanID)
+		if err != nil {
+			return err
+		}
+		if loan.State != domain.LoanStateApproved {
+			return fmt.Errorf("loan must be approved to reserve, current state: %s", loan.State)
+		}
+		investor, err := s.repo.GetInvestorByID(ctx, investorID)
+		if err != nil {
+			return err
+		}
+		if err := s.checkExposure(ctx, loan, investorID, amount); err != nil {
+			return err
+		}
+		if err := s.checkKYC(ctx, investor, amount); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		invested, err := s.repo.GetTotalInvested(ctx, loan.ID)
+		if err != nil {
+			return err
+		}
+		reserved, err := s.repo.GetTotalReserved(ctx, loan.ID, now)
+		if err != nil {
+			return err
+		}
+		if domain.Cents(invested)+domain.Cents(reserved)+domain.Cents(amount) > domain.Cents(loan.Principal) {
+			return fmt.Errorf("reservation would exceed principal; current invested %.2f + reserved %.2f + new %.2f > principal %.2f", invested, reserved, amount, loan.Principal)
+		}
+		res = &domain.Reservation{
+			ID:         uuid.New().String(),
+			LoanID:     loan.ID,
+			InvestorID: investorID,
+			Amount:     amount,
+			State:      domain.ReservationStateHeld,
+			ExpiresAt:  now.Add(ttl),
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		return s.repo.CreateReservation(ctx, res)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ConfirmReservation converts a held reservation into an investment of
+// its amount by its investor, through the same checks as Invest. The
+// reservation must not have expired. Its own hold is available to the
+// investment, so confirming cannot fail for lack of principal.
+func (s *LoanService) ConfirmReservation(ctx context.Context, loanID, reservationID string) (_ *InvestResult, err error) {
+	ctx, span := startSpan(ctx, "LoanService.ConfirmReservation",
+		attribute.String("loan.id", loanID), attribute.String("reservation.id", reservationID))
+	defer func() { endSpan(span, err) }()
+
+	res, err := s.reservation(ctx, loanID, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	return s.invest(ctx, InvestRequest{
+		LoanID:        loanID,
+		InvestorID:    res.InvestorID,
+		Amount:        res.Amount,
+		reservationID: res.ID,
+	})
+}
+
+// ReleaseReservation gives up a held reservation before it expires,
+// making its amount available to other investors at once.
+func (s *LoanService) ReleaseReservation(ctx context.Context, loanID, reservationID string) (_ *domain.Reservation, err error) {
+	ctx, span := startSpan(ctx, "LoanService.ReleaseReservation",
+		attribute.String("loan.id", loanID), attribute.String("reservation.id", reservationID))
+	defer func() { endSpan(span, err) }()
+
+	var res *domain.Reservation
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := s.repo.GetLoanForUpdate(ctx, loanID); err != nil {
+			return err
+		}
+		var err error
+		res, err = s.heldReservation(ctx, loanID, reservationID, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		res.State = domain.ReservationStateReleased
+		res.UpdatedAt = time.Now().UTC()
+		return s.repo.UpdateReservation(ctx, res)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ExpireReservations marks the held reservations past their expiry
+// time as expired and returns their number. Expired reservations no
+// longer count against the principal even before they are swept; the
+// sweep records that they ended.
+func (s *LoanService) ExpireReservations(ctx context.Context) (_ int, err error) {
+	ctx, span := startSpan(ctx, "LoanService.ExpireReservations")
+	defer func() { endSpan(span, err) }()
+
+	return s.repo.ExpireReservations(ctx, time.Now().UTC())
+}
+
+// reservation loads a reservation of the loan, returning
+// ErrReservationNotFound when it does not exist or belongs to another
+// loan.
+func (s *LoanService) reservation(ctx context.Context, loanID, reservationID string) (*domain.Reservation, error) {
+	res, err := s.repo.FindReservation(ctx, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil || res.LoanID != loanID {
+		return nil, ErrReservationNotFound
+	}
+	return res, nil
+}
+
+// heldReservation loads a reservation of the loan and checks that it
+// still holds its amount at the given time. It must be called within
+// a transaction holding the loan lock.
+func (s *LoanService) heldReservation(ctx context.Context, loanID, reservationID string, at time.Time) (*domain.Reservation, error) {
+	res, err := s.reservation(ctx, loanID, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	if res.State != domain.ReservationStateHeld {
+		return nil, fmt.Errorf("reservation is %s", res.State)
+	}
+	if !res.Active(at) {
+		return nil, fmt.Errorf("reservation expired at %s", res.ExpiresAt.Format(time.RFC3339))
+	}
+	return res, nil
+}
+
+// ListInvestment offers amount of an open investment in a disbursed
+// loan for sale on the secondary market at price. The amount may be
+// all or part of the investment, which may have only one open listing
+// at a time.
+func (s *LoanService) ListInvestment(ctx context.Context, loanID, investmentID string, amount, price float64) (_ *domain.Listing, err error) {
+	ctx, span := startSpan(ctx, "LoanService.ListInvestment",
+		attribute.String("loan.id", loanID), attribute.String("investment.id", investmentID))
+	defer func() { endSpan(span, err) }()
+
+	if domain.Cents(amount) <= 0 || domain.Cents(price) <= 0 {
+		return nil, errors.New("amount and price must be positive")
+	}
+	var listing *domain.Listing
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		loan, err := s.repo.GetLoanForUpdate(ctx, loanID)
+		if err != nil {
+			return err
+		}
+		inv := findInvestment(loan, investmentID)
+		if inv == nil {
+			return ErrInvestmentNotFound
+		}
+		if loan.State != domain.LoanStateDisbursed {
+			return fmt.Errorf("investments can only be listed while the loan is disbursed, current state: %s", loan.State)
+		}
+		if domain.Cents(amount) > domain.Cents(inv.Amount) {
+			return fmt.Errorf("amount %.2f exceeds the investment of %.2f", amount, inv.Amount)
+		}
+		open, err := s.repo.ListListings(ctx, loan.ID, domain.ListingStateOpen)
+		if err != nil {
+			return err
+		}
+		for _, l := range open {
+			if l.InvestmentID == inv.ID {
+				return fmt.Errorf("investment %s is already listed as %s", inv.ID, l.ID)
+			}
+		}
+		now := time.Now().UTC()
+		listing = &domain.Listing{
+			ID:           uuid.New().String(),
+			LoanID:       loan.ID,
+			InvestmentID: inv.ID,
+			SellerID:     inv.InvestorID,
+			Amount:       amount,
+			Price:        price,
+			State:        domain.ListingStateOpen,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		return s.repo.CreateListing(ctx, listing)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+// BuyListing buys an open listing for the investor buyerID. The buyer
+// pays the price from their wallet to the seller's, and the position
+// moves to a new investment of the buyer linked to the listed one,
+// which is closed; after a partial sale the seller keeps the rest as
+// another linked investment. Later payouts of the loan go to the new
+// investments. The buyer is subject to the exposure and KYC limits as
+// when investing.
+func (s *LoanService) BuyListing(ctx context.Context, listingID, buyerID string) (_ *domain.Listing, err error) {
+	ctx, span := startSpan(ctx, "LoanService.BuyListing",
+		attribute.String("listing.id", listingID), attribute.String("investor.id", buyerID))
+	defer func() { endSpan(span, err) }()
+
+	var (
+		loan    *domain.Loan
+		listing *domain.Listing
+		bought  *domain.Investment
+		total   float64
+	)
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		if listing, err = s.listing(ctx, listingID); err != nil {
+			return err
+		}
+		if loan, err = s.repo.GetLoanForUpdate(ctx, listing.LoanID); err != nil {
+			return err
+		}
+		// Read the listing again under the loan lock, which serialises
+		// the purchases and cancellations of the loan's listings.
+		if listing, err = s.listing(ctx, listingID); err != nil {
+			return err
+		}
+		if listing.State != domain.ListingStateOpen {
+			return fmt.Errorf("listing is %s", listing.State)
+		}
+		if loan.State != domain.LoanStateDisbursed {
+			return fmt.Errorf("listings can only be bought while the loan is disbursed, current state: %s", loan.State)
+		}
+		if buyerID == listing.SellerID {
+			return errors.New("investors cannot buy their own listing")
+		}
+		original := findInvestment(loan, listing.InvestmentID)
+		if original == nil {
+			return fmt.Errorf("investment %s is no longer held", listing.InvestmentID)
+		}
+		buyer, err := s.repo.GetInvestorByID(ctx, buyerID)
+		if err != nil {
+			return err
+		}
+		wallet := domain.InvestorWallet(buyer.ID)
+		var balance float64
+		if s.ledger != nil {
+			if balance, err = s.ledger.LockBalance(ctx, wallet); err != nil {
+				return err
+			}
+		}
+		if err := s.checkExposure(ctx, loan, buyer.ID, listing.Amount); err != nil {
+			return err
+		}
+		if err := s.checkKYC(ctx, buyer, listing.Amount); err != nil {
+			return err
+		}
+		if s.ledger != nil && domain.Cents(balance) < domain.Cents(listing.Price) {
+			return fmt.Errorf("%w: wallet balance %.2f is less than %.2f", domain.ErrInsufficientFunds, balance, listing.Price)
+		}
+
+		now := time.Now().UTC()
+		original.TransferredAt = &now
+		if err := s.repo.UpdateInvestment(ctx, original); err != nil {
+			return err
+		}
+		bought = &domain.Investment{
+			ID:         uuid.New().String(),
+			LoanID:     loan.ID,
+			InvestorID: buyer.ID,
+			Amount:     listing.Amount,
+			OriginID:   &original.ID,
+			CreatedAt:  now,
+		}
+		if err := s.repo.CreateInvestment(ctx, bought); err != nil {
+			return err
+		}
+		if rest := domain.Cents(original.Amount) - domain.Cents(listing.Amount); rest > 0 {
+			if err := s.repo.CreateInvestment(ctx, &domain.Investment{
+				ID:         uuid.New().String(),
+				LoanID:     loan.ID,
+				InvestorID: original.InvestorID,
+				Amount:     domain.FromCents(rest),
+				OriginID:   &original.ID,
+				CreatedAt:  now,
+			}); err != nil {
+				return err
+			}
+		}
+		if err := s.post(ctx, domain.JournalKindTransfer, loan.ID, "transfer of investment "+original.ID,
+			domain.Transfer{From: wallet, To: domain.InvestorWallet(listing.SellerID), Amount: listing.Price}); err != nil {
+			return err
+		}
+		listing.State = domain.ListingStateSold
+		listing.BuyerID = &buyer.ID
+		listing.BuyerInvestmentID = &bought.ID
+		listing.SoldAt = &now
+		listing.UpdatedAt = now
+		if err := s.repo.UpdateListing(ctx, listing); err != nil {
+			return err
+		}
+		total, err = s.repo.GetTotalInvested(ctx, loan.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.publish(ctx, domain.LoanEvent{
+		LoanID:        loan.ID,
+		Type:          domain.LoanEventInvestmentTransferred,
+		State:         loan.State,
+		InvestmentID:  bought.ID,
+		InvestorID:    bought.InvestorID,
+		Amount:        bought.Amount,
+		TotalInvested: total,
+		Principal:     loan.Principal,
+	})
+	return listing, nil
+}
+
+// CancelListing withdraws an open listing.
+func (s *LoanService) CancelListing(ctx context.Context, listingID string) (_ *domain.Listing, err error) {
+	ctx, span := startSpan(ctx, "LoanService.CancelListing", attribute.String("listing.id", listingID))
+	defer func() { endSpan(span, err) }()
+
+	var listing *domain.Listing
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		if listing, err = s.listing(ctx, listingID); err != nil {
+			return err
+		}
+		if _, err := s.repo.GetLoanForUpdate(ctx, listing.LoanID); err != nil {
+			return err
+		}
+		if listing, err = s.listing(ctx, listingID); err != nil {
+			return err
+		}
+		if listing.State != domain.ListingStateOpen {
+			return fmt.Errorf("listing is %s", listing.State)
+		}
+		listing.State = domain.ListingStateCancelled
+		listing.UpdatedAt = time.Now().UTC()
+		return s.repo.UpdateListing(ctx, listing)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+// GetListing returns a listing, or ErrListingNotFound.
+func (s *LoanService) GetListing(ctx context.Context, listingID string) (_ *domain.Listing, err error) {
+	ctx, span := startSpan(ctx, "LoanService.GetListing", attribute.String("listing.id", listingID))
+	defer func() { endSpan(span, err) }()
+
+	return s.listing(ctx, listingID)
+}
+
+// ListListings returns the listings of the loan in the given state,
+// oldest first. An empty loan ID or state matches every loan or state.
+func (s *LoanService) ListListings(ctx context.Context, loanID string, state domain.ListingState) (_ []domain.Listing, err error) {
+	ctx, span := startSpan(ctx, "LoanService.ListListings", attribute.String("loan.id", loanID))
+	defer func() { endSpan(span, err) }()
+
+	if state != "" && !state.Valid() {
+		return nil, fmt.Errorf("unknown listing state %q", state)
+	}
+	return s.repo.ListListings(ctx, loanID, state)
+}
+
+// listing loads a listing, returning ErrListingNotFound if it does
+// not exist.
+func (s *LoanService) listing(ctx context.Context, listingID string) (*domain.Listing, error) {
+	listing, err := s.repo.FindListing(ctx, listingID)
+	if err != nil {
+		return nil, err
+	}
+	if listing == nil {
+		return nil, ErrListingNotFound
+	}
+	return listing, nil
+}
+
+// findInvestment returns the open investment of the loan with the
+// given ID, or nil.
+func findInvestment(loan *domain.Loan, investmentID string) *domain.Investment {
+	for i := range loan.Investments {
+		if loan.Investments[i].ID == investmentID {
+			return &loan.Investments[i]
+		}
+	}
+	return nil
+}
+
+// RegenerateAgreements generates the agreement letters of a funded
+// loan again, replacing the links on the loan and its investments. It
+// is used to recover from a failed generation when the loan became
+// invested. The loan must be `invested` or `disbursed`.
+func (s *LoanService) RegenerateAgreements(ctx context.Context, loanID string) (_ *domain.Loan, err error) {
+	ctx, span := startSpan(ctx, "LoanService.RegenerateAgreements", attribute.String("loan.id", loanID))
+	defer func() { endSpan(span, err) }()
+
+	var loan *domain.Loan
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		loan, err = s.repo.GetLoanForUpdate(ctx, loanID)
+		if err != nil {
+			return err
+		}
+		if loan.State != domain.LoanStateInvested && loan.State != domain.LoanStateDisbursed {
+			return fmt.Errorf("loan must be invested to generate agreements, current state: %s", loan.State)
+		}
+		return s.generateAgreements(ctx, loan)
+	})
+	if err != nil {
 		return nil, err
 	}
-	loan.Disbursement = disb
 	return loan, nil
 }
 
+// generateAgreements runs the configured agreement generator, if any.
+// It runs in a transaction so that the links on the loan and its
+// investments are updated together and every read, including that of
+// an investor created moments ago, is served by the primary.
+func (s *LoanService) generateAgreements(ctx context.Context, loan *domain.Loan) error {
+	if s.agreements == nil {
+		return nil
+	}
+	return s.repo.Transaction(ctx, func(ctx context.Context) error {
+		return s.agreements.GenerateAgreements(ctx, loan)
+	})
+}
+
 // ListLoans retrieves all loans from the repository. It returns
 // loans with their nested Approval, Investments and Disbursement
 // records. In a production system this method should support
 // pagination and filtering.
-func (s *LoanService) ListLoans(ctx context.Context) ([]domain.Loan, error) {
+func (s *LoanService) ListLoans(ctx context.Context) (_ []domain.Loan, err error) {
+	ctx, span := startSpan(ctx, "LoanService.ListLoans")
+	defer func() { endSpan(span, err) }()
+
 	loans, err := s.repo.ListLoans(ctx)
 	if err != nil {
 		return nil, err
@@ -249,10 +1569,220 @@ func (s *LoanService) ListLoans(ctx context.Context) ([]domain.Loan, error) {
 
 // GetLoanByID retrieves a single loan by its ID. It returns the loan
 // with its nested Approval, Investments and Disbursement records.
-func (s *LoanService) GetLoanByID(ctx context.Context, id string) (*domain.Loan, error) {
+func (s *LoanService) GetLoanByID(ctx context.Context, id string) (_ *domain.Loan, err error) {
+	ctx, span := startSpan(ctx, "LoanService.GetLoanByID", attribute.String("loan.id", id))
+	defer func() { endSpan(span, err) }()
+
 	loan, err := s.repo.GetLoanByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	return loan, nil
 }
+
+// GetFunding returns how far the loan is funded: the total invested,
+// the amount held by reservations, the amount remaining, the number of distinct investors and the
+// percentage of the principal raised. Like GetLoanByID it may read
+// from a replica, so the figures are a quote rather than a guarantee;
+// use domain.FillModePartial to invest whatever remains.
+func (s *LoanService) GetFunding(ctx context.Context, loanID string) (_ *domain.Funding, err error) {
+	ctx, span := startSpan(ctx, "LoanService.GetFunding", attribute.String("loan.id", loanID))
+	defer func() { endSpan(span, err) }()
+
+	loan, err := s.repo.GetLoanByID(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	investors := make(map[string]struct{})
+	for _, inv := range loan.Investments {
+		total += domain.Cents(inv.Amount)
+		investors[inv.InvestorID] = struct{}{}
+	}
+	reserved, err := s.repo.GetTotalReserved(ctx, loan.ID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	principal := domain.Cents(loan.Principal)
+	funding := &domain.Funding{
+		LoanID:        loan.ID,
+		State:         loan.State,
+		Principal:     loan.Principal,
+		TotalInvested: domain.FromCents(total),
+		Reserved:      reserved,
+		Remaining:     domain.FromCents(max(principal-total-domain.Cents(reserved), 0)),
+		InvestorCount: len(investors),
+	}
+	if principal > 0 {
+		funding.PercentFunded = math.Round(float64(total)*10000/float64(principal)) / 100
+	}
+	return funding, nil
+}
+
+// checkTicket checks the amount of a single investment against the
+// minimum and maximum ticket size.
+func (s *LoanService) checkTicket(amount float64) error {
+	if min := s.limits.MinInvestmentAmount; min > 0 && amount < min {
+		return &domain.LimitError{
+			Rule:    domain.LimitMinTicket,
+			Message: fmt.Sprintf("amount %.2f is below the minimum investment of %.2f", amount, min),
+		}
+	}
+	if max := s.limits.MaxInvestmentAmount; max > 0 && amount > max {
+		return &domain.LimitError{
+			Rule:    domain.LimitMaxTicket,
+			Message: fmt.Sprintf("amount %.2f exceeds the maximum investment of %.2f", amount, max),
+		}
+	}
+	return nil
+}
+
+// checkExposure checks that investing amount in the loan keeps the
+// investor within the maximum share of the loan and the maximum
+// outstanding exposure. It must be called within a transaction holding
+// the loan lock and, with a ledger, the investor's wallet lock, which
+// serialises the investor's investments in different loans.
+func (s *LoanService) checkExposure(ctx context.Context, loan *domain.Loan, investorID string, amount float64) error {
+	if share := s.limits.MaxLoanShare; share > 0 {
+		held := domain.Cents(amount)
+		for _, inv := range loan.Investments {
+			if inv.InvestorID == investorID {
+				held += domain.Cents(inv.Amount)
+			}
+		}
+		if allowed := domain.Cents(loan.Principal * share / 100); held > allowed {
+			return &domain.LimitError{
+				Rule: domain.LimitMaxLoanShare,
+				Message: fmt.Sprintf("holding %.2f of the loan would exceed the maximum share of %g%%, %.2f",
+					domain.FromCents(held), share, domain.FromCents(allowed)),
+			}
+		}
+	}
+	if max := s.limits.MaxInvestorExposure; max > 0 {
+		exposure, err := s.repo.GetInvestorExposure(ctx, investorID)
+		if err != nil {
+			return err
+		}
+		if total := domain.Cents(exposure) + domain.Cents(amount); total > domain.Cents(max) {
+			return &domain.LimitError{
+				Rule: domain.LimitMaxExposure,
+				Message: fmt.Sprintf("outstanding investments of %.2f would exceed the maximum exposure of %.2f",
+					domain.FromCents(total), max),
+			}
+		}
+	}
+	return nil
+}
+
+// checkKYC checks that an investor whose identity has not been
+// verified may invest amount: not at all with
+// Limits.RequireVerifiedInvestors, and otherwise while their
+// outstanding investments stay within Limits.KYCThreshold. Like
+// checkExposure it must be called with the investor's investments
+// serialised.
+func (s *LoanService) checkKYC(ctx context.Context, investor *domain.Investor, amount float64) error {
+	if investor.Verified() {
+		return nil
+	}
+	if s.limits.RequireVerifiedInvestors {
+		return &domain.LimitError{
+			Rule:    domain.LimitKYCRequired,
+			Message: fmt.Sprintf("investor %s must be verified to invest", investor.ID),
+		}
+	}
+	if threshold := s.limits.KYCThreshold; threshold > 0 {
+		exposure, err := s.repo.GetInvestorExposure(ctx, investor.ID)
+		if err != nil {
+			return err
+		}
+		if total := domain.Cents(exposure) + domain.Cents(amount); total > domain.Cents(threshold) {
+			return &domain.LimitError{
+				Rule: domain.LimitKYCRequired,
+				Message: fmt.Sprintf("outstanding investments of %.2f exceed %.2f; the investor must be verified to invest more",
+					domain.FromCents(total), threshold),
+			}
+		}
+	}
+	return nil
+}
+
+// checkAutoInvestBudget checks that an investment placed by an
+// auto-invest rule keeps the investments the rule placed during the
+// current UTC day within its daily budget. placeAutoInvestments sizes
+// investments to the budget; this check, made with the investor's
+// wallet locked, stops concurrent approvals from overspending it.
+func (s *LoanService) checkAutoInvestBudget(ctx context.Context, rule *domain.AutoInvestRule, amount float64) error {
+	if rule == nil || rule.DailyBudget <= 0 {
+		return nil
+	}
+	spent, err := s.autoInvest.GetAutoInvestedSince(ctx, rule.ID, time.Now().UTC().Truncate(24*time.Hour))
+	if err != nil {
+		return err
+	}
+	if domain.Cents(spent)+domain.Cents(amount) > domain.Cents(rule.DailyBudget) {
+		return fmt.Errorf("%w: auto-invest daily budget of %.2f would be exceeded; %.2f already placed today", ErrInvestmentRejected, rule.DailyBudget, spent)
+	}
+	return nil
+}
+
+// post records a journal entry in the configured ledger, if any.
+func (s *LoanService) post(ctx context.Context, kind domain.JournalKind, loanID, description string, transfers ...domain.Transfer) error {
+	if s.ledger == nil {
+		return nil
+	}
+	_, err := s.ledger.Post(ctx, kind, loanID, description, transfers...)
+	return err
+}
+
+// requireDocument loads an uploaded document and checks that it was
+// uploaded for the workflow step that references it and is not
+// attached to a loan yet, so that one upload cannot serve as the proof
+// or agreement of several loans.
+func (s *LoanService) requireDocument(ctx context.Context, id string, kind domain.DocumentKind) (*domain.Document, error) {
+	doc, err := s.repo.GetDocumentByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s document %s: %w", kind, id, err)
+	}
+	if doc.Kind != kind {
+		return nil, fmt.Errorf("document %s is a %s, expected %s", id, doc.Kind, kind)
+	}
+	attached, err := s.repo.DocumentAttached(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if attached {
+		return nil, fmt.Errorf("document %s is already attached to a loan", id)
+	}
+	return doc, nil
+}
+
+// publishStateChange records and emits a state change event for the
+// loan, which has just moved from the previous state to its current
+// one.
+func (s *LoanService) publishStateChange(ctx context.Context, loan *domain.Loan, previous domain.LoanState, totalInvested float64) {
+	if s.metrics != nil {
+		s.metrics.LoanStateChanged(previous, loan.State)
+	}
+	s.publish(ctx, domain.LoanEvent{
+		LoanID:        loan.ID,
+		Type:          domain.LoanEventStateChanged,
+		State:         loan.State,
+		PreviousState: previous,
+		TotalInvested: totalInvested,
+		Principal:     loan.Principal,
+	})
+}
+
+// publish hands the event to the configured publisher. Events are a
+// best-effort notification mechanism: the state change they describe
+// has already been persisted, so a publishing failure is logged rather
+// than reported to the caller.
+func (s *LoanService) publish(ctx context.Context, ev domain.LoanEvent) {
+	if s.events == nil {
+		return
+	}
+	ev.CreatedAt = time.Now().UTC()
+	if err := s.events.Publish(ctx, ev); err != nil {
+		slog.ErrorContext(ctx, "failed to publish loan event", "type", ev.Type, "loan_id", ev.LoanID, "error", err)
+	}
+}
@@ -2,24 +2,48 @@ package service
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"loan_service/internal/domain"
+	"loan_service/internal/repository/memory"
 
 	mock_loan_repo "loan_service/internal/service/mocks"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// testProduct returns a product offering loans of 500 to 5000 at a rate
+// of 8 to 15% and an ROI of 6 to 12% over 6 or 12 months.
+func testProduct() *domain.LoanProduct {
+	return &domain.LoanProduct{
+		ID: "P1", Code: "MICRO", Version: 2, Name: "Micro loan",
+		TenorMonths: []int{6, 12}, RepaymentFrequency: domain.RepaymentWeekly,
+		MinPrincipal: 500, MaxPrincipal: 5000, MinRate: 8, MaxRate: 15, MinROI: 6, MaxROI: 12,
+	}
+}
+
 func TestCreateLoan(t *testing.T) {
 	repo := new(mock_loan_repo.MockLoanRepo)
 	svc := NewLoanService(repo)
 	input := domain.Loan{
-		Principal: 1000,
+		Principal:   1000,
+		Rate:        10,
+		ROI:         8,
+		ProductCode: "MICRO",
+		TenorMonths: 12,
 	}
+	repo.On("FindProduct", mock.Anything, "MICRO", 0).Return(testProduct(), nil)
 	repo.On("CreateLoan", mock.Anything, mock.AnythingOfType("*domain.Loan")).Return(nil)
 
 	loan, err := svc.CreateLoan(context.Background(), input)
@@ -27,6 +51,55 @@ func TestCreateLoan(t *testing.T) {
 	assert.NotEmpty(t, loan.ID)
 	assert.Equal(t, domain.LoanStateProposed, loan.State)
 	assert.WithinDuration(t, time.Now().UTC(), loan.CreatedAt, time.Second)
+	require.NotNil(t, loan.ProductID)
+	assert.Equal(t, "P1", *loan.ProductID)
+}
+
+func TestCreateLoan_ProductTerms(t *testing.T) {
+	valid := domain.Loan{Principal: 1000, Rate: 10, ROI: 8, ProductCode: "MICRO", TenorMonths: 6}
+	for name, tc := range map[string]struct {
+		change func(*domain.Loan)
+		want   string
+	}{
+		"principal too small": {func(l *domain.Loan) { l.Principal = 499 }, "principal 499.00 is outside the range 500.00 to 5000.00"},
+		"principal too big":   {func(l *domain.Loan) { l.Principal = 5000.01 }, "principal"},
+		"rate too low":        {func(l *domain.Loan) { l.Rate = 7.5 }, "rate 7.50 is outside the band 8.00 to 15.00"},
+		"ROI too high":        {func(l *domain.Loan) { l.ROI = 12.5 }, "ROI 12.50 is outside the band 6.00 to 12.00"},
+		"tenor not offered":   {func(l *domain.Loan) { l.TenorMonths = 9 }, "tenor of 9 months is not offered; must be one of [6 12] for product MICRO version 2"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo := new(mock_loan_repo.MockLoanRepo)
+			svc := NewLoanService(repo)
+			repo.On("FindProduct", mock.Anything, "MICRO", 0).Return(testProduct(), nil)
+			input := valid
+			tc.change(&input)
+
+			_, err := svc.CreateLoan(context.Background(), input)
+			var limit *domain.LimitError
+			require.ErrorAs(t, err, &limit)
+			assert.Equal(t, domain.LimitProductTerms, limit.Rule)
+			assert.ErrorContains(t, err, tc.want)
+			repo.AssertNotCalled(t, "CreateLoan", mock.Anything, mock.Anything)
+		})
+	}
+
+	t.Run("unknown product", func(t *testing.T) {
+		repo := new(mock_loan_repo.MockLoanRepo)
+		svc := NewLoanService(repo)
+		repo.On("FindProduct", mock.Anything, "NONE", 0).Return(nil, nil)
+		input := valid
+		input.ProductCode = "NONE"
+		_, err := svc.CreateLoan(context.Background(), input)
+		assert.ErrorIs(t, err, ErrProductNotFound)
+	})
+
+	t.Run("no product", func(t *testing.T) {
+		svc := NewLoanService(new(mock_loan_repo.MockLoanRepo))
+		input := valid
+		input.ProductCode = ""
+		_, err := svc.CreateLoan(context.Background(), input)
+		assert.ErrorContains(t, err, "product code is required")
+	})
 }
 
 func TestApproveLoan_Success(t *testing.T) {
@@ -37,14 +110,36 @@ func TestApproveLoan_Success(t *testing.T) {
 		ID:    loanID,
 		State: domain.LoanStateProposed,
 	}
-	repo.On("GetLoanByID", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetDocumentByID", mock.Anything, "doc-pic").Return(&domain.Document{ID: "doc-pic", Kind: domain.DocumentKindApprovalProof}, nil)
+	repo.On("DocumentAttached", mock.Anything, "doc-pic").Return(false, nil)
 	repo.On("CreateApproval", mock.Anything, mock.AnythingOfType("*domain.Approval")).Return(nil)
 	repo.On("UpdateLoan", mock.Anything, loan).Return(nil)
 
-	result, err := svc.ApproveLoan(context.Background(), loanID, "pic.jpg", "emp1", time.Now())
+	result, err := svc.ApproveLoan(context.Background(), loanID, "doc-pic", "emp1", time.Now())
 	assert.NoError(t, err)
 	assert.Equal(t, domain.LoanStateApproved, result.State)
 	assert.NotNil(t, result.Approval)
+	assert.Equal(t, "doc-pic", result.Approval.PictureDocumentID)
+	assert.Equal(t, "/documents/doc-pic/content", result.Approval.PictureURL)
+}
+
+func TestApproveLoan_WrongDocumentKind(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	svc := NewLoanService(repo)
+	loanID := uuid.New().String()
+	loan := &domain.Loan{
+		ID:    loanID,
+		State: domain.LoanStateProposed,
+	}
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetDocumentByID", mock.Anything, "doc-agreement").Return(&domain.Document{ID: "doc-agreement", Kind: domain.DocumentKindSignedAgreement}, nil)
+	repo.On("DocumentAttached", mock.Anything, "doc-agreement").Return(false, nil)
+
+	_, err := svc.ApproveLoan(context.Background(), loanID, "doc-agreement", "emp1", time.Now())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "expected approval_proof")
+	repo.AssertNotCalled(t, "CreateApproval", mock.Anything, mock.Anything)
 }
 
 func TestApproveLoan_AlreadyApproved(t *testing.T) {
@@ -56,9 +151,9 @@ func TestApproveLoan_AlreadyApproved(t *testing.T) {
 		State:    domain.LoanStateProposed,
 		Approval: &domain.Approval{ID: "appr1"},
 	}
-	repo.On("GetLoanByID", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
 
-	_, err := svc.ApproveLoan(context.Background(), loanID, "pic.jpg", "emp1", time.Now())
+	_, err := svc.ApproveLoan(context.Background(), loanID, "doc-pic", "emp1", time.Now())
 	assert.Error(t, err)
 	assert.Equal(t, "loan already approved", err.Error())
 }
@@ -72,10 +167,11 @@ func TestInvestInLoan_NewInvestor_Success(t *testing.T) {
 		State:     domain.LoanStateApproved,
 		Principal: 1000,
 	}
-	repo.On("GetLoanByID", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
 	repo.On("FindInvestorByEmail", mock.Anything, "test@investor.com").Return(nil, nil)
 	repo.On("CreateInvestor", mock.Anything, mock.AnythingOfType("*domain.Investor")).Return(nil)
 	repo.On("GetTotalInvested", mock.Anything, loanID).Return(float64(0), nil)
+	repo.On("GetTotalReserved", mock.Anything, loanID, mock.Anything).Return(float64(0), nil)
 	repo.On("CreateInvestment", mock.Anything, mock.AnythingOfType("*domain.Investment")).Return(nil)
 
 	result, err := svc.InvestInLoan(context.Background(), loanID, "", "Test Investor", "test@investor.com", 500)
@@ -92,11 +188,13 @@ func TestDisburseLoan_Success(t *testing.T) {
 		ID:    loanID,
 		State: domain.LoanStateInvested,
 	}
-	repo.On("GetLoanByID", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetDocumentByID", mock.Anything, "doc-agreement").Return(&domain.Document{ID: "doc-agreement", Kind: domain.DocumentKindSignedAgreement}, nil)
+	repo.On("DocumentAttached", mock.Anything, "doc-agreement").Return(false, nil)
 	repo.On("CreateDisbursement", mock.Anything, mock.AnythingOfType("*domain.Disbursement")).Return(nil)
 	repo.On("UpdateLoan", mock.Anything, loan).Return(nil)
 
-	result, err := svc.DisburseLoan(context.Background(), loanID, "agreement.pdf", "emp2", time.Now())
+	result, err := svc.DisburseLoan(context.Background(), loanID, "doc-agreement", "emp2", time.Now())
 	assert.NoError(t, err)
 	assert.Equal(t, domain.LoanStateDisbursed, result.State)
 	assert.NotNil(t, result.Disbursement)
@@ -111,9 +209,9 @@ func TestDisburseLoan_AlreadyDisbursed(t *testing.T) {
 		State:        domain.LoanStateInvested,
 		Disbursement: &domain.Disbursement{ID: "disb1"},
 	}
-	repo.On("GetLoanByID", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
 
-	_, err := svc.DisburseLoan(context.Background(), loanID, "agreement.pdf", "emp2", time.Now())
+	_, err := svc.DisburseLoan(context.Background(), loanID, "doc-agreement", "emp2", time.Now())
 	assert.Error(t, err)
 	assert.Equal(t, "loan already disbursed", err.Error())
 }
@@ -159,9 +257,9 @@ func TestApproveLoan_InvalidState(t *testing.T) {
 		ID:    loanID,
 		State: domain.LoanStateApproved,
 	}
-	repo.On("GetLoanByID", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
 
-	_, err := svc.ApproveLoan(context.Background(), loanID, "pic.jpg", "emp1", time.Now())
+	_, err := svc.ApproveLoan(context.Background(), loanID, "doc-pic", "emp1", time.Now())
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "loan must be in proposed state to approve")
 }
@@ -174,9 +272,844 @@ func TestDisburseLoan_InvalidState(t *testing.T) {
 		ID:    loanID,
 		State: domain.LoanStateApproved,
 	}
-	repo.On("GetLoanByID", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
 
-	_, err := svc.DisburseLoan(context.Background(), loanID, "agreement.pdf", "emp2", time.Now())
+	_, err := svc.DisburseLoan(context.Background(), loanID, "doc-agreement", "emp2", time.Now())
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "loan must be invested to disburse")
 }
+
+func TestInvestInLoan_PublishesEvents(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	pub := new(mock_loan_repo.MockEventPublisher)
+	svc := NewLoanService(repo, WithEventPublisher(pub))
+	loanID := uuid.New().String()
+	investorID := uuid.New().String()
+	loan := &domain.Loan{
+		ID:        loanID,
+		State:     domain.LoanStateApproved,
+		Principal: 1000,
+	}
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetInvestorByID", mock.Anything, investorID).Return(&domain.Investor{ID: investorID}, nil)
+	repo.On("GetTotalInvested", mock.Anything, loanID).Return(float64(600), nil)
+	repo.On("GetTotalReserved", mock.Anything, loanID, mock.Anything).Return(float64(0), nil)
+	repo.On("CreateInvestment", mock.Anything, mock.AnythingOfType("*domain.Investment")).Return(nil)
+	repo.On("UpdateLoan", mock.Anything, loan).Return(nil)
+	pub.On("Publish", mock.Anything, mock.MatchedBy(func(ev domain.LoanEvent) bool {
+		return ev.Type == domain.LoanEventInvestmentAdded && ev.Amount == 400 && ev.TotalInvested == 1000 && ev.InvestorID == investorID
+	})).Return(nil).Once()
+	pub.On("Publish", mock.Anything, mock.MatchedBy(func(ev domain.LoanEvent) bool {
+		return ev.Type == domain.LoanEventStateChanged && ev.State == domain.LoanStateInvested && ev.PreviousState == domain.LoanStateApproved
+	})).Return(nil).Once()
+
+	_, err := svc.InvestInLoan(context.Background(), loanID, investorID, "", "", 400)
+	assert.NoError(t, err)
+	pub.AssertExpectations(t)
+}
+
+func TestApproveLoan_PublishFailureDoesNotFail(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	pub := new(mock_loan_repo.MockEventPublisher)
+	svc := NewLoanService(repo, WithEventPublisher(pub))
+	loanID := uuid.New().String()
+	loan := &domain.Loan{
+		ID:    loanID,
+		State: domain.LoanStateProposed,
+	}
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetDocumentByID", mock.Anything, "doc-pic").Return(&domain.Document{ID: "doc-pic", Kind: domain.DocumentKindApprovalProof}, nil)
+	repo.On("DocumentAttached", mock.Anything, "doc-pic").Return(false, nil)
+	repo.On("CreateApproval", mock.Anything, mock.AnythingOfType("*domain.Approval")).Return(nil)
+	repo.On("UpdateLoan", mock.Anything, loan).Return(nil)
+	pub.On("Publish", mock.Anything, mock.AnythingOfType("domain.LoanEvent")).Return(assert.AnError).Once()
+
+	result, err := svc.ApproveLoan(context.Background(), loanID, "doc-pic", "emp1", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, domain.LoanStateApproved, result.State)
+	pub.AssertExpectations(t)
+}
+
+func TestInvestInLoan_FullyFundedGeneratesAgreements(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	gen := new(mock_loan_repo.MockAgreementGenerator)
+	svc := NewLoanService(repo, WithAgreementGenerator(gen))
+	loanID := uuid.New().String()
+	investorID := uuid.New().String()
+	loan := &domain.Loan{
+		ID:          loanID,
+		State:       domain.LoanStateApproved,
+		Principal:   1000,
+		Investments: []domain.Investment{{ID: "INV0", Amount: 600}},
+	}
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetInvestorByID", mock.Anything, investorID).Return(&domain.Investor{ID: investorID}, nil)
+	repo.On("GetTotalInvested", mock.Anything, loanID).Return(float64(600), nil)
+	repo.On("GetTotalReserved", mock.Anything, loanID, mock.Anything).Return(float64(0), nil)
+	repo.On("CreateInvestment", mock.Anything, mock.AnythingOfType("*domain.Investment")).Return(nil)
+	repo.On("UpdateLoan", mock.Anything, loan).Return(nil)
+	gen.On("GenerateAgreements", mock.Anything, mock.MatchedBy(func(l *domain.Loan) bool {
+		return l.State == domain.LoanStateInvested && len(l.Investments) == 2
+	})).Return(nil).Once()
+
+	result, err := svc.InvestInLoan(context.Background(), loanID, investorID, "", "", 400)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.LoanStateInvested, result.State)
+	gen.AssertExpectations(t)
+}
+
+func TestInvestInLoan_PartialFundingSkipsAgreements(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	gen := new(mock_loan_repo.MockAgreementGenerator)
+	svc := NewLoanService(repo, WithAgreementGenerator(gen))
+	loanID := uuid.New().String()
+	investorID := uuid.New().String()
+	loan := &domain.Loan{ID: loanID, State: domain.LoanStateApproved, Principal: 1000}
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetInvestorByID", mock.Anything, investorID).Return(&domain.Investor{ID: investorID}, nil)
+	repo.On("GetTotalInvested", mock.Anything, loanID).Return(float64(0), nil)
+	repo.On("GetTotalReserved", mock.Anything, loanID, mock.Anything).Return(float64(0), nil)
+	repo.On("CreateInvestment", mock.Anything, mock.AnythingOfType("*domain.Investment")).Return(nil)
+
+	_, err := svc.InvestInLoan(context.Background(), loanID, investorID, "", "", 400)
+	assert.NoError(t, err)
+	gen.AssertNotCalled(t, "GenerateAgreements", mock.Anything, mock.Anything)
+}
+
+func TestRegenerateAgreements_RequiresFundedLoan(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	gen := new(mock_loan_repo.MockAgreementGenerator)
+	svc := NewLoanService(repo, WithAgreementGenerator(gen))
+	loan := &domain.Loan{ID: "loan1", State: domain.LoanStateApproved}
+	repo.On("GetLoanForUpdate", mock.Anything, "loan1").Return(loan, nil)
+
+	_, err := svc.RegenerateAgreements(context.Background(), "loan1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "loan must be invested")
+	gen.AssertNotCalled(t, "GenerateAgreements", mock.Anything, mock.Anything)
+}
+
+func TestInvestInLoan_RecordsMetrics(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	metrics := new(mock_loan_repo.MockMetrics)
+	svc := NewLoanService(repo, WithMetrics(metrics))
+	loanID := uuid.New().String()
+	investorID := uuid.New().String()
+	loan := &domain.Loan{
+		ID:        loanID,
+		State:     domain.LoanStateApproved,
+		Principal: 1000,
+		Approval:  &domain.Approval{CreatedAt: time.Now().UTC().Add(-time.Hour)},
+	}
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetInvestorByID", mock.Anything, investorID).Return(&domain.Investor{ID: investorID}, nil)
+	repo.On("GetTotalInvested", mock.Anything, loanID).Return(float64(600), nil)
+	repo.On("GetTotalReserved", mock.Anything, loanID, mock.Anything).Return(float64(0), nil)
+	repo.On("CreateInvestment", mock.Anything, mock.AnythingOfType("*domain.Investment")).Return(nil)
+	repo.On("UpdateLoan", mock.Anything, loan).Return(nil)
+	metrics.On("InvestmentAccepted", 400.0).Once()
+	metrics.On("LoanStateChanged", domain.LoanStateApproved, domain.LoanStateInvested).Once()
+	metrics.On("LoanFunded", mock.MatchedBy(func(d time.Duration) bool {
+		return d >= time.Hour && d < time.Hour+time.Minute
+	})).Once()
+
+	_, err := svc.InvestInLoan(context.Background(), loanID, investorID, "", "", 400)
+	assert.NoError(t, err)
+	metrics.AssertExpectations(t)
+}
+
+func TestInvestInLoan_OverfundingRecordsMetric(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	metrics := new(mock_loan_repo.MockMetrics)
+	svc := NewLoanService(repo, WithMetrics(metrics))
+	loanID := uuid.New().String()
+	investorID := uuid.New().String()
+	loan := &domain.Loan{ID: loanID, State: domain.LoanStateApproved, Principal: 1000}
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(loan, nil)
+	repo.On("GetInvestorByID", mock.Anything, investorID).Return(&domain.Investor{ID: investorID}, nil)
+	repo.On("GetTotalInvested", mock.Anything, loanID).Return(float64(900), nil)
+	repo.On("GetTotalReserved", mock.Anything, loanID, mock.Anything).Return(float64(0), nil)
+	metrics.On("OverfundingRejected").Once()
+
+	_, err := svc.InvestInLoan(context.Background(), loanID, investorID, "", "", 200)
+	assert.Error(t, err)
+	metrics.AssertExpectations(t)
+	repo.AssertNotCalled(t, "CreateInvestment", mock.Anything, mock.Anything)
+}
+
+func TestInvestInLoan_RecordsSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(trace.NewNoopTracerProvider()) })
+
+	repo := new(mock_loan_repo.MockLoanRepo)
+	svc := NewLoanService(repo)
+	loanID := uuid.New().String()
+	repo.On("GetLoanForUpdate", mock.Anything, loanID).Return(&domain.Loan{ID: loanID, State: domain.LoanStateProposed}, nil)
+
+	_, err := svc.InvestInLoan(context.Background(), loanID, "", "", "", 100)
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "LoanService.InvestInLoan", spans[0].Name())
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+		assert.Contains(t, spans[0].Attributes(), attribute.String("loan.id", loanID))
+	}
+}
+
+func TestLimits(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	svc := NewLoanService(repo, WithLimits(Limits{MinInvestmentAmount: 100, MaxLoanPrincipal: 1000}))
+
+	_, err := svc.CreateLoan(context.Background(), domain.Loan{Principal: 1500})
+	assert.ErrorIs(t, err, domain.ErrLimitExceeded)
+	repo.AssertNotCalled(t, "CreateLoan", mock.Anything, mock.Anything)
+
+	var limit *domain.LimitError
+	if assert.ErrorAs(t, err, &limit) {
+		assert.Equal(t, domain.LimitMaxPrincipal, limit.Rule)
+	}
+
+	_, err = svc.InvestInLoan(context.Background(), "L1", "I1", "", "", 50)
+	assert.ErrorIs(t, err, domain.ErrLimitExceeded)
+	repo.AssertNotCalled(t, "GetLoanForUpdate", mock.Anything, mock.Anything)
+}
+
+func TestExposureLimits(t *testing.T) {
+	store := memory.NewStore()
+	ledger := NewLedgerService(store)
+	investors := NewInvestorService(store, ledger)
+	svc := NewLoanService(store, WithLedger(ledger), WithLimits(Limits{
+		MinInvestmentAmount: 100,
+		MaxInvestmentAmount: 600,
+		MaxLoanShare:        50,
+		MaxInvestorExposure: 900,
+	}))
+	ctx := context.Background()
+
+	ann, err := investors.CreateInvestor(ctx, "Ann", "ann@example.com")
+	require.NoError(t, err)
+	_, err = investors.TopUp(ctx, ann.ID, 5000, "")
+	require.NoError(t, err)
+	for _, id := range []string{"L1", "L2", "L3"} {
+		require.NoError(t, store.CreateLoan(ctx, &domain.Loan{ID: id, BorrowerID: "B1", State: domain.LoanStateApproved, Principal: 1000}))
+	}
+	rule := func(err error) domain.LimitRule {
+		var limit *domain.LimitError
+		if !errors.As(err, &limit) {
+			return ""
+		}
+		return limit.Rule
+	}
+
+	_, err = svc.InvestInLoan(ctx, "L1", ann.ID, "", "", 50)
+	assert.Equal(t, domain.LimitMinTicket, rule(err))
+	_, err = svc.InvestInLoan(ctx, "L1", ann.ID, "", "", 700)
+	assert.Equal(t, domain.LimitMaxTicket, rule(err))
+	_, err = svc.InvestInLoan(ctx, "L1", ann.ID, "", "", 400)
+	require.NoError(t, err)
+	_, err = svc.InvestInLoan(ctx, "L1", ann.ID, "", "", 200)
+	assert.Equal(t, domain.LimitMaxLoanShare, rule(err))
+	assert.ErrorContains(t, err, "holding 600.00 of the loan would exceed the maximum share of 50%, 500.00")
+	_, err = svc.Reserve(ctx, "L1", ann.ID, 200, 0)
+	assert.Equal(t, domain.LimitMaxLoanShare, rule(err))
+	_, err = svc.InvestInLoan(ctx, "L1", ann.ID, "", "", 100)
+	require.NoError(t, err)
+
+	_, err = svc.InvestInLoan(ctx, "L2", ann.ID, "", "", 500)
+	assert.Equal(t, domain.LimitMaxExposure, rule(err))
+	assert.ErrorIs(t, err, domain.ErrLimitExceeded)
+	_, err = svc.InvestInLoan(ctx, "L2", ann.ID, "", "", 400)
+	require.NoError(t, err)
+
+	// Refunded investments no longer count towards the exposure.
+	_, err = svc.CancelLoan(ctx, "L2")
+	require.NoError(t, err)
+	_, err = svc.InvestInLoan(ctx, "L3", ann.ID, "", "", 400)
+	assert.NoError(t, err)
+}
+
+func TestKYCLimits(t *testing.T) {
+	store := memory.NewStore()
+	ledger := NewLedgerService(store)
+	investors := NewInvestorService(store, ledger)
+	ctx := context.Background()
+	for _, id := range []string{"L1", "L2"} {
+		require.NoError(t, store.CreateLoan(ctx, &domain.Loan{ID: id, BorrowerID: "B1", State: domain.LoanStateApproved, Principal: 1000}))
+	}
+	ann, err := investors.CreateInvestor(ctx, "Ann", "ann@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, domain.KYCStatusPending, ann.KYC.Status)
+	_, err = investors.TopUp(ctx, ann.ID, 1000, "")
+	require.NoError(t, err)
+
+	svc := NewLoanService(store, WithLedger(ledger), WithLimits(Limits{KYCThreshold: 300}))
+	_, err = svc.InvestInLoan(ctx, "L1", ann.ID, "", "", 200)
+	require.NoError(t, err)
+	_, err = svc.InvestInLoan(ctx, "L1", ann.ID, "", "", 150)
+	var limit *domain.LimitError
+	require.ErrorAs(t, err, &limit)
+	assert.Equal(t, domain.LimitKYCRequired, limit.Rule)
+	_, err = svc.Reserve(ctx, "L2", ann.ID, 150, 0)
+	require.ErrorAs(t, err, &limit)
+
+	strict := NewLoanService(store, WithLedger(ledger), WithLimits(Limits{RequireVerifiedInvestors: true}))
+	_, err = strict.InvestInLoan(ctx, "L1", "", "Bob", "bob@example.com", 100)
+	require.ErrorAs(t, err, &limit)
+	assert.Equal(t, domain.LimitKYCRequired, limit.Rule)
+	found, err := store.FindInvestorByEmail(ctx, "bob@example.com")
+	require.NoError(t, err)
+	assert.Nil(t, found, "no investor is created on the fly")
+	_, err = strict.InvestInLoan(ctx, "L1", ann.ID, "", "", 100)
+	require.ErrorAs(t, err, &limit)
+
+	ann.KYC.Status = domain.KYCStatusVerified
+	require.NoError(t, store.UpdateInvestor(ctx, ann))
+	_, err = svc.InvestInLoan(ctx, "L1", ann.ID, "", "", 150)
+	require.NoError(t, err)
+	_, err = strict.InvestInLoan(ctx, "L2", "", "", "ann@example.com", 100)
+	assert.NoError(t, err)
+}
+
+func TestAutoInvest(t *testing.T) {
+	store := memory.NewStore()
+	ledger := NewLedgerService(store)
+	investors := NewInvestorService(store, ledger)
+	rules := NewAutoInvestService(store)
+	svc := NewLoanService(store, WithLedger(ledger), WithAutoInvest(store))
+	ctx := context.Background()
+
+	invest := map[string]domain.AutoInvestRule{
+		"Ann":  {MaxPerLoan: 400, DailyBudget: 450},
+		"Bob":  {MaxPerLoan: 400, MinROI: 8},
+		"Cat":  {MaxPerLoan: 400, MinROI: 12},
+		"Dave": {MaxPerLoan: 400, MaxRiskGrade: "A"},
+	}
+	ids := map[string]string{}
+	for _, name := range []string{"Ann", "Bob", "Cat", "Dave"} {
+		inv, err := investors.CreateInvestor(ctx, name, name+"@example.com")
+		require.NoError(t, err)
+		_, err = investors.TopUp(ctx, inv.ID, 2000, "")
+		require.NoError(t, err)
+		rule := invest[name]
+		rule.InvestorID = inv.ID
+		_, err = rules.SetRule(ctx, rule)
+		require.NoError(t, err)
+		ids[inv.ID] = name
+	}
+	approve := func(id string, principal float64) *domain.Loan {
+		t.Helper()
+		require.NoError(t, store.CreateDocument(ctx, &domain.Document{ID: "P" + id, Kind: domain.DocumentKindApprovalProof}))
+		require.NoError(t, store.CreateLoan(ctx, &domain.Loan{ID: id, BorrowerID: "B1", State: domain.LoanStateProposed, Principal: principal, ROI: 10, RiskGrade: "C"}))
+		loan, err := svc.ApproveLoan(ctx, id, "P"+id, "E1", time.Now())
+		require.NoError(t, err)
+		return loan
+	}
+	placed := func(loan *domain.Loan) map[string]float64 {
+		got := map[string]float64{}
+		for _, inv := range loan.Investments {
+			require.NotNil(t, inv.AutoInvestRuleID)
+			got[ids[inv.InvestorID]] += inv.Amount
+		}
+		return got
+	}
+
+	// Ann's rule is the oldest and goes first; the loan is funded
+	// before Bob's turn. Cat's ROI and Dave's risk grade do not match.
+	loan := approve("L1", 400)
+	assert.Equal(t, domain.LoanStateInvested, loan.State)
+	assert.Equal(t, map[string]float64{"Ann": 400}, placed(loan))
+
+	// Bob has waited longest now. Ann only has 50 of her daily budget
+	// left.
+	loan = approve("L2", 1000)
+	assert.Equal(t, domain.LoanStateApproved, loan.State)
+	assert.Equal(t, map[string]float64{"Bob": 400, "Ann": 50}, placed(loan))
+	assert.Equal(t, "Bob", ids[loan.Investments[0].InvestorID])
+
+	// Bob's turn again; his investment is reduced to the principal.
+	loan = approve("L3", 300)
+	assert.Equal(t, domain.LoanStateInvested, loan.State)
+	assert.Equal(t, map[string]float64{"Bob": 300}, placed(loan))
+	stored, err := store.GetLoanByID(ctx, "L3")
+	require.NoError(t, err)
+	assert.Equal(t, loan.Investments, stored.Investments)
+}
+
+func TestInvestInLoan_PostsToLedger(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	ledger := new(mock_loan_repo.MockLedger)
+	svc := NewLoanService(repo, WithLedger(ledger))
+	loan := &domain.Loan{ID: "L1", State: domain.LoanStateApproved, Principal: 1000}
+	repo.On("GetLoanForUpdate", mock.Anything, "L1").Return(loan, nil)
+	repo.On("GetInvestorByID", mock.Anything, "I1").Return(&domain.Investor{ID: "I1"}, nil)
+	repo.On("GetTotalInvested", mock.Anything, "L1").Return(float64(0), nil)
+	repo.On("GetTotalReserved", mock.Anything, "L1", mock.Anything).Return(float64(0), nil)
+	repo.On("CreateInvestment", mock.Anything, mock.AnythingOfType("*domain.Investment")).Return(nil)
+	ledger.On("LockBalance", mock.Anything, domain.InvestorWallet("I1")).Return(float64(500), nil)
+	ledger.On("Post", mock.Anything, domain.JournalKindInvestment, "L1", mock.Anything,
+		[]domain.Transfer{{From: domain.InvestorWallet("I1"), To: domain.LoanEscrow("L1"), Amount: 400}}).Return(&domain.JournalEntry{}, nil).Once()
+
+	_, err := svc.InvestInLoan(context.Background(), "L1", "I1", "", "", 400)
+	assert.NoError(t, err)
+	ledger.AssertExpectations(t)
+}
+
+func TestInvestInLoan_LedgerFailureFails(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	ledger := new(mock_loan_repo.MockLedger)
+	svc := NewLoanService(repo, WithLedger(ledger))
+	loan := &domain.Loan{ID: "L1", State: domain.LoanStateApproved, Principal: 1000}
+	repo.On("GetLoanForUpdate", mock.Anything, "L1").Return(loan, nil)
+	repo.On("GetInvestorByID", mock.Anything, "I1").Return(&domain.Investor{ID: "I1"}, nil)
+	repo.On("GetTotalInvested", mock.Anything, "L1").Return(float64(0), nil)
+	repo.On("GetTotalReserved", mock.Anything, "L1", mock.Anything).Return(float64(0), nil)
+	repo.On("CreateInvestment", mock.Anything, mock.AnythingOfType("*domain.Investment")).Return(nil)
+	ledger.On("LockBalance", mock.Anything, domain.InvestorWallet("I1")).Return(float64(500), nil)
+	ledger.On("Post", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, assert.AnError)
+
+	_, err := svc.InvestInLoan(context.Background(), "L1", "I1", "", "", 400)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestInvestInLoan_InsufficientFunds(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	ledger := new(mock_loan_repo.MockLedger)
+	svc := NewLoanService(repo, WithLedger(ledger))
+	loan := &domain.Loan{ID: "L1", State: domain.LoanStateApproved, Principal: 1000}
+	repo.On("GetLoanForUpdate", mock.Anything, "L1").Return(loan, nil)
+	repo.On("GetInvestorByID", mock.Anything, "I1").Return(&domain.Investor{ID: "I1"}, nil)
+	repo.On("GetTotalInvested", mock.Anything, "L1").Return(float64(0), nil)
+	repo.On("GetTotalReserved", mock.Anything, "L1", mock.Anything).Return(float64(0), nil)
+	ledger.On("LockBalance", mock.Anything, domain.InvestorWallet("I1")).Return(399.99, nil)
+
+	_, err := svc.InvestInLoan(context.Background(), "L1", "I1", "", "", 400)
+	assert.ErrorIs(t, err, domain.ErrInsufficientFunds)
+	repo.AssertNotCalled(t, "CreateInvestment", mock.Anything, mock.Anything)
+	ledger.AssertNotCalled(t, "Post", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCancelLoan_RefundsInvestments(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	ledger := new(mock_loan_repo.MockLedger)
+	svc := NewLoanService(repo, WithLedger(ledger))
+	loan := &domain.Loan{
+		ID:        "L1",
+		State:     domain.LoanStateApproved,
+		Principal: 1000,
+		Investments: []domain.Investment{
+			{ID: "V1", InvestorID: "I1", Amount: 300},
+			{ID: "V2", InvestorID: "I2", Amount: 200},
+		},
+	}
+	escrow := domain.LoanEscrow("L1")
+	repo.On("GetLoanForUpdate", mock.Anything, "L1").Return(loan, nil)
+	repo.On("GetLoanForUpdate", mock.Anything, "L2").Return(&domain.Loan{ID: "L2", State: domain.LoanStateInvested}, nil)
+	repo.On("UpdateLoan", mock.Anything, loan).Return(nil)
+	repo.On("UpdateInvestment", mock.Anything, mock.MatchedBy(func(inv *domain.Investment) bool {
+		return inv.CancelledAt != nil
+	})).Return(nil).Twice()
+	repo.On("CreateRefund", mock.Anything, mock.MatchedBy(func(r *domain.Refund) bool {
+		return r.LoanID == "L1" && r.Reason == domain.RefundReasonLoanCancelled
+	})).Return(nil).Twice()
+	ledger.On("Post", mock.Anything, domain.JournalKindRefund, "L1", mock.Anything, []domain.Transfer{
+		{From: escrow, To: domain.InvestorWallet("I1"), Amount: 300},
+		{From: escrow, To: domain.InvestorWallet("I2"), Amount: 200},
+	}).Return(&domain.JournalEntry{}, nil).Once()
+
+	result, err := svc.CancelLoan(context.Background(), "L1")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.LoanStateCancelled, result.State)
+	for _, inv := range loan.Investments {
+		assert.NotNil(t, inv.CancelledAt, "refunded investments are closed")
+	}
+	ledger.AssertExpectations(t)
+
+	_, err = svc.CancelLoan(context.Background(), "L2")
+	assert.ErrorContains(t, err, "loan must be proposed or approved to cancel")
+	repo.AssertExpectations(t)
+}
+
+func TestExpireLoans(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	svc := NewLoanService(repo, WithLimits(Limits{FundingPeriod: 24 * time.Hour}))
+	now := time.Now().UTC()
+	stale := domain.Loan{ID: "L1", State: domain.LoanStateApproved, Approval: &domain.Approval{CreatedAt: now.Add(-48 * time.Hour)},
+		Investments: []domain.Investment{{ID: "V1", InvestorID: "I1", Amount: 300}}}
+	funded := domain.Loan{ID: "L2", State: domain.LoanStateApproved, Approval: &domain.Approval{CreatedAt: now.Add(-48 * time.Hour)}}
+	fresh := domain.Loan{ID: "L3", State: domain.LoanStateApproved, Approval: &domain.Approval{CreatedAt: now.Add(-time.Hour)}}
+	repo.On("ListLoansByState", mock.Anything, domain.LoanStateApproved).Return([]domain.Loan{stale, funded, fresh}, nil)
+	locked := stale
+	locked.Investments = append([]domain.Investment(nil), stale.Investments...)
+	repo.On("GetLoanForUpdate", mock.Anything, "L1").Return(&locked, nil)
+	// L2 was funded after it was listed and must be left alone.
+	repo.On("GetLoanForUpdate", mock.Anything, "L2").Return(&domain.Loan{ID: "L2", State: domain.LoanStateInvested}, nil)
+	repo.On("UpdateLoan", mock.Anything, &locked).Return(nil).Once()
+	repo.On("UpdateInvestment", mock.Anything, &locked.Investments[0]).Return(nil).Once()
+	repo.On("CreateRefund", mock.Anything, mock.MatchedBy(func(r *domain.Refund) bool {
+		return r.InvestmentID == "V1" && r.Reason == domain.RefundReasonLoanExpired
+	})).Return(nil).Once()
+
+	n, err := svc.ExpireLoans(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, domain.LoanStateExpired, locked.State)
+	assert.NotNil(t, locked.Investments[0].CancelledAt, "refunded investments are closed")
+	repo.AssertNotCalled(t, "GetLoanForUpdate", mock.Anything, "L3")
+	repo.AssertExpectations(t)
+
+	n, err = NewLoanService(repo).ExpireLoans(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestRepayLoan_PaysOutInvestors(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	ledger := new(mock_loan_repo.MockLedger)
+	svc := NewLoanService(repo, WithLedger(ledger))
+	loan := &domain.Loan{
+		ID:         "L1",
+		BorrowerID: "B1",
+		State:      domain.LoanStateDisbursed,
+		Principal:  1000,
+		Rate:       10,
+		ROI:        8,
+		Investments: []domain.Investment{
+			{ID: "V1", InvestorID: "I1", Amount: 600},
+			{ID: "V2", InvestorID: "I2", Amount: 400},
+		},
+	}
+	escrow := domain.LoanEscrow("L1")
+	repo.On("GetLoanForUpdate", mock.Anything, "L1").Return(loan, nil)
+	repo.On("UpdateLoan", mock.Anything, loan).Return(nil)
+	repo.On("CancelOpenListings", mock.Anything, "L1", mock.Anything).Return(0, nil)
+	ledger.On("Post", mock.Anything, domain.JournalKindRepayment, "L1", mock.Anything,
+		[]domain.Transfer{{From: domain.BorrowerAccount("B1"), To: escrow, Amount: 1100}}).Return(&domain.JournalEntry{}, nil).Once()
+	ledger.On("Post", mock.Anything, domain.JournalKindPayout, "L1", mock.Anything, []domain.Transfer{
+		{From: escrow, To: domain.InvestorWallet("I1"), Amount: 648},
+		{From: escrow, To: domain.InvestorWallet("I2"), Amount: 432},
+	}).Return(&domain.JournalEntry{}, nil).Once()
+	ledger.On("Post", mock.Anything, domain.JournalKindFee, "L1", mock.Anything,
+		[]domain.Transfer{{From: escrow, To: domain.PlatformRevenueAccount, Amount: 20}}).Return(&domain.JournalEntry{}, nil).Once()
+
+	result, err := svc.RepayLoan(context.Background(), "L1", 1100)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.LoanStateRepaid, result.State)
+	ledger.AssertExpectations(t)
+}
+
+func TestRepayLoan_Validation(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	svc := NewLoanService(repo)
+	repo.On("GetLoanForUpdate", mock.Anything, "L1").Return(&domain.Loan{ID: "L1", State: domain.LoanStateInvested}, nil)
+	repo.On("GetLoanForUpdate", mock.Anything, "L2").Return(&domain.Loan{ID: "L2", State: domain.LoanStateDisbursed, Principal: 1000, Rate: 10}, nil)
+	repo.On("GetLoanForUpdate", mock.Anything, "L3").Return(&domain.Loan{
+		ID: "L3", State: domain.LoanStateDisbursed, Principal: 1000, Rate: 5, ROI: 8,
+		Investments: []domain.Investment{{InvestorID: "I1", Amount: 1000}},
+	}, nil)
+
+	_, err := svc.RepayLoan(context.Background(), "L1", 1100)
+	assert.ErrorContains(t, err, "loan must be disbursed to repay")
+	_, err = svc.RepayLoan(context.Background(), "L2", 1000)
+	assert.ErrorContains(t, err, "amount due of 1100.00")
+	_, err = svc.RepayLoan(context.Background(), "L3", 1050)
+	assert.ErrorContains(t, err, "investor returns exceed the repayment by 30.00")
+	repo.AssertNotCalled(t, "UpdateLoan", mock.Anything, mock.Anything)
+}
+
+func TestCancelInvestment(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	ledger := new(mock_loan_repo.MockLedger)
+	pub := new(mock_loan_repo.MockEventPublisher)
+	svc := NewLoanService(repo, WithLedger(ledger), WithEventPublisher(pub), WithLimits(Limits{CancellationWindow: time.Hour}))
+	now := time.Now().UTC()
+	loan := &domain.Loan{
+		ID:        "L1",
+		State:     domain.LoanStateApproved,
+		Principal: 1000,
+		Investments: []domain.Investment{
+			{ID: "V1", LoanID: "L1", InvestorID: "I1", Amount: 300, CreatedAt: now.Add(-time.Minute)},
+			{ID: "V2", LoanID: "L1", InvestorID: "I2", Amount: 200, CreatedAt: now.Add(-2 * time.Hour)},
+		},
+	}
+	repo.On("GetLoanForUpdate", mock.Anything, "L1").Return(loan, nil)
+	repo.On("UpdateInvestment", mock.Anything, mock.MatchedBy(func(inv *domain.Investment) bool {
+		return inv.ID == "V1" && inv.CancelledAt != nil
+	})).Return(nil).Once()
+	repo.On("CreateRefund", mock.Anything, mock.AnythingOfType("*domain.Refund")).Return(nil).Once()
+	repo.On("GetTotalInvested", mock.Anything, "L1").Return(float64(200), nil)
+	ledger.On("Post", mock.Anything, domain.JournalKindRefund, "L1", mock.Anything,
+		[]domain.Transfer{{From: domain.LoanEscrow("L1"), To: domain.InvestorWallet("I1"), Amount: 300}}).Return(&domain.JournalEntry{}, nil).Once()
+	pub.On("Publish", mock.Anything, mock.MatchedBy(func(ev domain.LoanEvent) bool {
+		return ev.Type == domain.LoanEventInvestmentCancelled && ev.InvestmentID == "V1" && ev.TotalInvested == 200
+	})).Return(nil).Once()
+
+	refund, err := svc.CancelInvestment(context.Background(), "L1", "V1")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.RefundReasonInvestmentCancelled, refund.Reason)
+	assert.Equal(t, "I1", refund.InvestorID)
+	assert.Equal(t, 300.0, refund.Amount)
+	repo.AssertExpectations(t)
+	ledger.AssertExpectations(t)
+	pub.AssertExpectations(t)
+
+	_, err = svc.CancelInvestment(context.Background(), "L1", "V2")
+	assert.ErrorContains(t, err, "cancellation window of 1h0m0s")
+	_, err = svc.CancelInvestment(context.Background(), "L1", "missing")
+	assert.ErrorIs(t, err, ErrInvestmentNotFound)
+
+	loan.State = domain.LoanStateInvested
+	_, err = svc.CancelInvestment(context.Background(), "L1", "V2")
+	assert.ErrorContains(t, err, "only be cancelled while the loan is approved")
+}
+
+func TestInvest_PartialFill(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	ledger := new(mock_loan_repo.MockLedger)
+	svc := NewLoanService(repo, WithLedger(ledger), WithLimits(Limits{MinInvestmentAmount: 100}))
+	loan := &domain.Loan{ID: "L1", State: domain.LoanStateApproved, Principal: 1000}
+	repo.On("GetLoanForUpdate", mock.Anything, "L1").Return(loan, nil)
+	repo.On("GetInvestorByID", mock.Anything, "I1").Return(&domain.Investor{ID: "I1"}, nil)
+	repo.On("GetTotalInvested", mock.Anything, "L1").Return(949.5, nil)
+	repo.On("GetTotalReserved", mock.Anything, "L1", mock.Anything).Return(float64(0), nil)
+	ledger.On("LockBalance", mock.Anything, domain.InvestorWallet("I1")).Return(float64(500), nil)
+
+	_, err := svc.Invest(context.Background(), InvestRequest{LoanID: "L1", InvestorID: "I1", Amount: 200})
+	assert.ErrorContains(t, err, "investment would exceed principal", "exact is the default")
+
+	repo.On("CreateInvestment", mock.Anything, mock.AnythingOfType("*domain.Investment")).Return(nil).Once()
+	repo.On("UpdateLoan", mock.Anything, loan).Return(nil).Once()
+	ledger.On("Post", mock.Anything, domain.JournalKindInvestment, "L1", mock.Anything,
+		[]domain.Transfer{{From: domain.InvestorWallet("I1"), To: domain.LoanEscrow("L1"), Amount: 50.5}}).Return(&domain.JournalEntry{}, nil).Once()
+
+	res, err := svc.Invest(context.Background(), InvestRequest{LoanID: "L1", InvestorID: "I1", Amount: 200, FillMode: domain.FillModePartial})
+	assert.NoError(t, err)
+	assert.Equal(t, 200.0, res.RequestedAmount)
+	assert.Equal(t, 50.5, res.AcceptedAmount, "the remainder is accepted below the minimum investment")
+	assert.Equal(t, 50.5, res.Investment.Amount)
+	assert.Equal(t, domain.LoanStateInvested, res.Loan.State)
+	repo.AssertExpectations(t)
+	ledger.AssertExpectations(t)
+
+	_, err = svc.Invest(context.Background(), InvestRequest{LoanID: "L1", InvestorID: "I1", Amount: 200, FillMode: "most"})
+	assert.ErrorContains(t, err, `unknown fill mode "most"`)
+}
+
+func TestGetFunding(t *testing.T) {
+	repo := new(mock_loan_repo.MockLoanRepo)
+	svc := NewLoanService(repo)
+	repo.On("GetLoanByID", mock.Anything, "L1").Return(&domain.Loan{
+		ID:        "L1",
+		State:     domain.LoanStateApproved,
+		Principal: 3000,
+		Investments: []domain.Investment{
+			{InvestorID: "I1", Amount: 500},
+			{InvestorID: "I2", Amount: 250.25},
+			{InvestorID: "I1", Amount: 250},
+		},
+	}, nil)
+	repo.On("GetTotalReserved", mock.Anything, "L1", mock.Anything).Return(float64(500), nil)
+
+	funding, err := svc.GetFunding(context.Background(), "L1")
+	assert.NoError(t, err)
+	assert.Equal(t, &domain.Funding{
+		LoanID:        "L1",
+		State:         domain.LoanStateApproved,
+		Principal:     3000,
+		TotalInvested: 1000.25,
+		Reserved:      500,
+		Remaining:     1499.75,
+		InvestorCount: 2,
+		PercentFunded: 33.34,
+	}, funding)
+}
+
+func TestReservations(t *testing.T) {
+	store := memory.NewStore()
+	ledger := NewLedgerService(store)
+	investors := NewInvestorService(store, ledger)
+	svc := NewLoanService(store, WithLedger(ledger), WithLimits(Limits{ReservationTTL: 10 * time.Minute}))
+	ctx := context.Background()
+
+	ann, err := investors.CreateInvestor(ctx, "Ann", "ann@example.com")
+	require.NoError(t, err)
+	bob, err := investors.CreateInvestor(ctx, "Bob", "bob@example.com")
+	require.NoError(t, err)
+	_, err = investors.TopUp(ctx, bob.ID, 1000, "")
+	require.NoError(t, err)
+	require.NoError(t, store.CreateLoan(ctx, &domain.Loan{ID: "L1", BorrowerID: "B1", State: domain.LoanStateApproved, Principal: 1000}))
+
+	_, err = svc.Reserve(ctx, "L1", ann.ID, 600, time.Hour)
+	assert.ErrorContains(t, err, "at most 10m0s")
+	held, err := svc.Reserve(ctx, "L1", ann.ID, 600, 0)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReservationStateHeld, held.State)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), held.ExpiresAt, time.Minute)
+
+	// The hold counts against the principal for everyone else.
+	_, err = svc.Reserve(ctx, "L1", bob.ID, 500, time.Minute)
+	assert.ErrorContains(t, err, "reservation would exceed principal")
+	_, err = svc.InvestInLoan(ctx, "L1", bob.ID, "", "", 500)
+	assert.ErrorContains(t, err, "reserved 600.00")
+	res, err := svc.Invest(ctx, InvestRequest{LoanID: "L1", InvestorID: bob.ID, Amount: 500, FillMode: domain.FillModePartial})
+	require.NoError(t, err)
+	assert.Equal(t, 400.0, res.AcceptedAmount)
+	funding, err := svc.GetFunding(ctx, "L1")
+	require.NoError(t, err)
+	assert.Equal(t, 600.0, funding.Reserved)
+	assert.Zero(t, funding.Remaining)
+
+	// Confirming draws on the wallet, which Ann has not topped up yet.
+	_, err = svc.ConfirmReservation(ctx, "L1", held.ID)
+	assert.ErrorIs(t, err, domain.ErrInsufficientFunds)
+	_, err = investors.TopUp(ctx, ann.ID, 600, "")
+	require.NoError(t, err)
+	res, err = svc.ConfirmReservation(ctx, "L1", held.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 600.0, res.AcceptedAmount)
+	assert.Equal(t, ann.ID, res.Investment.InvestorID)
+	assert.Equal(t, domain.LoanStateInvested, res.Loan.State)
+	confirmed, err := store.FindReservation(ctx, held.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReservationStateConfirmed, confirmed.State)
+	assert.Equal(t, res.Investment.ID, *confirmed.InvestmentID)
+	_, err = svc.ConfirmReservation(ctx, "L1", held.ID)
+	assert.ErrorContains(t, err, "loan already fully funded")
+	_, err = svc.ConfirmReservation(ctx, "L2", held.ID)
+	assert.ErrorIs(t, err, ErrReservationNotFound)
+	_, err = svc.ReleaseReservation(ctx, "L1", "missing")
+	assert.ErrorIs(t, err, ErrReservationNotFound)
+}
+
+func TestReservations_ReleaseAndExpire(t *testing.T) {
+	store := memory.NewStore()
+	ledger := NewLedgerService(store)
+	investors := NewInvestorService(store, ledger)
+	svc := NewLoanService(store, WithLedger(ledger))
+	ctx := context.Background()
+
+	ann, err := investors.CreateInvestor(ctx, "Ann", "ann@example.com")
+	require.NoError(t, err)
+	_, err = investors.TopUp(ctx, ann.ID, 1000, "")
+	require.NoError(t, err)
+	require.NoError(t, store.CreateLoan(ctx, &domain.Loan{ID: "L1", BorrowerID: "B1", State: domain.LoanStateApproved, Principal: 1000}))
+
+	first, err := svc.Reserve(ctx, "L1", ann.ID, 700, time.Minute)
+	require.NoError(t, err)
+	released, err := svc.ReleaseReservation(ctx, "L1", first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ReservationStateReleased, released.State)
+	_, err = svc.ConfirmReservation(ctx, "L1", first.ID)
+	assert.ErrorContains(t, err, "reservation is released")
+
+	second, err := svc.Reserve(ctx, "L1", ann.ID, 700, 0)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(DefaultReservationTTL), second.ExpiresAt, time.Minute)
+	second.ExpiresAt = time.Now().Add(-time.Second)
+	require.NoError(t, store.UpdateReservation(ctx, second))
+
+	// An expired hold no longer counts, even before it is swept.
+	_, err = svc.InvestInLoan(ctx, "L1", ann.ID, "", "", 400)
+	assert.NoError(t, err)
+	_, err = svc.ConfirmReservation(ctx, "L1", second.ID)
+	assert.ErrorContains(t, err, "reservation expired at")
+	n, err := svc.ExpireReservations(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = svc.ExpireReservations(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	_, err = svc.ConfirmReservation(ctx, "L1", second.ID)
+	assert.ErrorContains(t, err, "reservation is expired")
+}
+
+func TestSecondaryMarket(t *testing.T) {
+	store := memory.NewStore()
+	ledger := NewLedgerService(store)
+	investors := NewInvestorService(store, ledger)
+	pub := new(mock_loan_repo.MockEventPublisher)
+	pub.On("Publish", mock.Anything, mock.Anything).Return(nil)
+	svc := NewLoanService(store, WithLedger(ledger), WithEventPublisher(pub))
+	ctx := context.Background()
+
+	ids := map[string]string{}
+	for _, name := range []string{"Ann", "Bob", "Cat"} {
+		inv, err := investors.CreateInvestor(ctx, name, name+"@example.com")
+		require.NoError(t, err)
+		_, err = investors.TopUp(ctx, inv.ID, 2000, "")
+		require.NoError(t, err)
+		ids[name] = inv.ID
+	}
+	require.NoError(t, store.CreateLoan(ctx, &domain.Loan{ID: "L1", BorrowerID: "B1", State: domain.LoanStateApproved, Principal: 1000, Rate: 12, ROI: 10}))
+	res, err := svc.Invest(ctx, InvestRequest{LoanID: "L1", InvestorID: ids["Ann"], Amount: 600})
+	require.NoError(t, err)
+	annInvestment := res.Investment.ID
+	_, err = svc.ListInvestment(ctx, "L1", annInvestment, 200, 210)
+	assert.ErrorContains(t, err, "only be listed while the loan is disbursed")
+	res, err = svc.Invest(ctx, InvestRequest{LoanID: "L1", InvestorID: ids["Bob"], Amount: 400})
+	require.NoError(t, err)
+	bobInvestment := res.Investment.ID
+	require.NoError(t, store.CreateDocument(ctx, &domain.Document{ID: "A1", Kind: domain.DocumentKindSignedAgreement}))
+	_, err = svc.DisburseLoan(ctx, "L1", "A1", "E1", time.Now())
+	require.NoError(t, err)
+
+	_, err = svc.ListInvestment(ctx, "L1", annInvestment, 700, 700)
+	assert.ErrorContains(t, err, "exceeds the investment of 600.00")
+	_, err = svc.ListInvestment(ctx, "L1", "missing", 100, 100)
+	assert.ErrorIs(t, err, ErrInvestmentNotFound)
+	listing, err := svc.ListInvestment(ctx, "L1", annInvestment, 200, 210)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ListingStateOpen, listing.State)
+	assert.Equal(t, ids["Ann"], listing.SellerID)
+	_, err = svc.ListInvestment(ctx, "L1", annInvestment, 100, 100)
+	assert.ErrorContains(t, err, "already listed")
+	_, err = svc.BuyListing(ctx, listing.ID, ids["Ann"])
+	assert.ErrorContains(t, err, "cannot buy their own listing")
+
+	// Cat buys 200 of Ann's 600; Ann keeps the other 400.
+	sold, err := svc.BuyListing(ctx, listing.ID, ids["Cat"])
+	require.NoError(t, err)
+	assert.Equal(t, domain.ListingStateSold, sold.State)
+	assert.Equal(t, ids["Cat"], *sold.BuyerID)
+	pub.AssertCalled(t, "Publish", mock.Anything, mock.MatchedBy(func(ev domain.LoanEvent) bool {
+		return ev.Type == domain.LoanEventInvestmentTransferred && ev.Amount == 200 && ev.TotalInvested == 1000
+	}))
+	_, err = svc.BuyListing(ctx, listing.ID, ids["Bob"])
+	assert.ErrorContains(t, err, "listing is sold")
+	loan, err := svc.GetLoanByID(ctx, "L1")
+	require.NoError(t, err)
+	held := map[string]float64{}
+	for _, inv := range loan.Investments {
+		held[inv.InvestorID] += inv.Amount
+		if inv.InvestorID != ids["Bob"] {
+			assert.Equal(t, annInvestment, *inv.OriginID)
+		}
+	}
+	assert.Equal(t, map[string]float64{ids["Ann"]: 400, ids["Bob"]: 400, ids["Cat"]: 200}, held)
+	bought := findInvestment(loan, *sold.BuyerInvestmentID)
+	require.NotNil(t, bought)
+	assert.Equal(t, ids["Cat"], bought.InvestorID)
+	_, err = svc.ListInvestment(ctx, "L1", annInvestment, 100, 100)
+	assert.ErrorIs(t, err, ErrInvestmentNotFound)
+
+	open, err := svc.ListInvestment(ctx, "L1", bobInvestment, 400, 390)
+	require.NoError(t, err)
+	_, err = svc.RepayLoan(ctx, "L1", 1120)
+	require.NoError(t, err)
+	open, err = svc.GetListing(ctx, open.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ListingStateCancelled, open.State)
+	_, err = svc.GetListing(ctx, "missing")
+	assert.ErrorIs(t, err, ErrListingNotFound)
+
+	// Payouts of 110% go to the current holders.
+	for name, want := range map[string]float64{"Ann": 2000 - 600 + 210 + 440, "Bob": 2000 - 400 + 440, "Cat": 2000 - 210 + 220} {
+		wallet, err := investors.Wallet(ctx, ids[name])
+		require.NoError(t, err)
+		assert.Equal(t, want, wallet.Balance, name)
+	}
+	check, err := ledger.Check(ctx)
+	require.NoError(t, err)
+	assert.True(t, check.Balanced())
+}
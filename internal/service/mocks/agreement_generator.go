@@ -0,0 +1,17 @@
+package mocks
+
+import (
+	"context"
+	"loan_service/internal/domain"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAgreementGenerator struct {
+	mock.Mock
+}
+
+func (m *MockAgreementGenerator) GenerateAgreements(ctx context.Context, loan *domain.Loan) error {
+	args := m.Called(ctx, loan)
+	return args.Error(0)
+}
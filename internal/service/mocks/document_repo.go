@@ -0,0 +1,25 @@
+package mocks
+
+import (
+	"context"
+	"loan_service/internal/domain"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type MockDocumentRepo struct {
+	mock.Mock
+}
+
+func (m *MockDocumentRepo) CreateDocument(ctx context.Context, doc *domain.Document) error {
+	args := m.Called(ctx, doc)
+	return args.Error(0)
+}
+
+func (m *MockDocumentRepo) GetDocumentByID(ctx context.Context, id string) (*domain.Document, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Document), args.Error(1)
+}
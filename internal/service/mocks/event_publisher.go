@@ -0,0 +1,17 @@
+package mocks
+
+import (
+	"context"
+	"loan_service/internal/domain"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type MockEventPublisher struct {
+	mock.Mock
+}
+
+func (m *MockEventPublisher) Publish(ctx context.Context, ev domain.LoanEvent) error {
+	args := m.Called(ctx, ev)
+	return args.Error(0)
+}
@@ -0,0 +1,23 @@
+package mocks
+
+import (
+	"context"
+	"loan_service/internal/domain"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type MockLedger struct {
+	mock.Mock
+}
+
+func (m *MockLedger) Post(ctx context.Context, kind domain.JournalKind, loanID, description string, transfers ...domain.Transfer) (*domain.JournalEntry, error) {
+	args := m.Called(ctx, kind, loanID, description, transfers)
+	entry, _ := args.Get(0).(*domain.JournalEntry)
+	return entry, args.Error(1)
+}
+
+func (m *MockLedger) LockBalance(ctx context.Context, ref domain.AccountRef) (float64, error) {
+	args := m.Called(ctx, ref)
+	return args.Get(0).(float64), args.Error(1)
+}
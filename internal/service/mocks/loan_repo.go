@@ -3,6 +3,7 @@ package mocks
 import (
 	"context"
 	"loan_service/internal/domain"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -11,6 +12,19 @@ type MockLoanRepo struct {
 	mock.Mock
 }
 
+// Transaction runs fn directly; the mock has no transactional state.
+func (m *MockLoanRepo) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (m *MockLoanRepo) GetLoanForUpdate(ctx context.Context, id string) (*domain.Loan, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Loan), args.Error(1)
+}
+
 func (m *MockLoanRepo) CreateLoan(ctx context.Context, loan *domain.Loan) error {
 	args := m.Called(ctx, loan)
 	return args.Error(0)
@@ -21,6 +35,12 @@ func (m *MockLoanRepo) GetLoanByID(ctx context.Context, id string) (*domain.Loan
 	return args.Get(0).(*domain.Loan), args.Error(1)
 }
 
+func (m *MockLoanRepo) ListLoansByState(ctx context.Context, state domain.LoanState) ([]domain.Loan, error) {
+	args := m.Called(ctx, state)
+	loans, _ := args.Get(0).([]domain.Loan)
+	return loans, args.Error(1)
+}
+
 func (m *MockLoanRepo) UpdateLoan(ctx context.Context, loan *domain.Loan) error {
 	args := m.Called(ctx, loan)
 	return args.Error(0)
@@ -36,6 +56,75 @@ func (m *MockLoanRepo) CreateInvestment(ctx context.Context, inv *domain.Investm
 	return args.Error(0)
 }
 
+func (m *MockLoanRepo) UpdateInvestment(ctx context.Context, inv *domain.Investment) error {
+	args := m.Called(ctx, inv)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepo) CreateRefund(ctx context.Context, refund *domain.Refund) error {
+	args := m.Called(ctx, refund)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepo) ListRefunds(ctx context.Context, loanID string) ([]domain.Refund, error) {
+	args := m.Called(ctx, loanID)
+	refunds, _ := args.Get(0).([]domain.Refund)
+	return refunds, args.Error(1)
+}
+
+func (m *MockLoanRepo) CreateReservation(ctx context.Context, res *domain.Reservation) error {
+	args := m.Called(ctx, res)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepo) FindReservation(ctx context.Context, id string) (*domain.Reservation, error) {
+	args := m.Called(ctx, id)
+	res, _ := args.Get(0).(*domain.Reservation)
+	return res, args.Error(1)
+}
+
+func (m *MockLoanRepo) UpdateReservation(ctx context.Context, res *domain.Reservation) error {
+	args := m.Called(ctx, res)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepo) GetTotalReserved(ctx context.Context, loanID string, at time.Time) (float64, error) {
+	args := m.Called(ctx, loanID, at)
+	return args.Get(0).(float64), args.Error(1)
+}
+
+func (m *MockLoanRepo) ExpireReservations(ctx context.Context, at time.Time) (int, error) {
+	args := m.Called(ctx, at)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockLoanRepo) CreateListing(ctx context.Context, listing *domain.Listing) error {
+	args := m.Called(ctx, listing)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepo) FindListing(ctx context.Context, id string) (*domain.Listing, error) {
+	args := m.Called(ctx, id)
+	listing, _ := args.Get(0).(*domain.Listing)
+	return listing, args.Error(1)
+}
+
+func (m *MockLoanRepo) UpdateListing(ctx context.Context, listing *domain.Listing) error {
+	args := m.Called(ctx, listing)
+	return args.Error(0)
+}
+
+func (m *MockLoanRepo) ListListings(ctx context.Context, loanID string, state domain.ListingState) ([]domain.Listing, error) {
+	args := m.Called(ctx, loanID, state)
+	listings, _ := args.Get(0).([]domain.Listing)
+	return listings, args.Error(1)
+}
+
+func (m *MockLoanRepo) CancelOpenListings(ctx context.Context, loanID string, at time.Time) (int, error) {
+	args := m.Called(ctx, loanID, at)
+	return args.Int(0), args.Error(1)
+}
+
 func (m *MockLoanRepo) FindInvestorByEmail(ctx context.Context, email string) (*domain.Investor, error) {
 	args := m.Called(ctx, email)
 	if args.Get(0) == nil {
@@ -59,6 +148,23 @@ func (m *MockLoanRepo) GetTotalInvested(ctx context.Context, loanID string) (flo
 	return args.Get(0).(float64), args.Error(1)
 }
 
+func (m *MockLoanRepo) GetInvestorExposure(ctx context.Context, investorID string) (float64, error) {
+	args := m.Called(ctx, investorID)
+	return args.Get(0).(float64), args.Error(1)
+}
+
+func (m *MockLoanRepo) FindProduct(ctx context.Context, code string, version int) (*domain.LoanProduct, error) {
+	args := m.Called(ctx, code, version)
+	product, _ := args.Get(0).(*domain.LoanProduct)
+	return product, args.Error(1)
+}
+
+func (m *MockLoanRepo) GetProductByID(ctx context.Context, id string) (*domain.LoanProduct, error) {
+	args := m.Called(ctx, id)
+	product, _ := args.Get(0).(*domain.LoanProduct)
+	return product, args.Error(1)
+}
+
 func (m *MockLoanRepo) GetInvestorByID(ctx context.Context, id string) (*domain.Investor, error) {
 	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
@@ -71,3 +177,16 @@ func (m *MockLoanRepo) CreateInvestor(ctx context.Context, inv *domain.Investor)
 	args := m.Called(ctx, inv)
 	return args.Error(0)
 }
+
+func (m *MockLoanRepo) DocumentAttached(ctx context.Context, id string) (bool, error) {
+	args := m.Called(ctx, id)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockLoanRepo) GetDocumentByID(ctx context.Context, id string) (*domain.Document, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Document), args.Error(1)
+}
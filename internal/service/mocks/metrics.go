@@ -0,0 +1,28 @@
+package mocks
+
+import (
+	"loan_service/internal/domain"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type MockMetrics struct {
+	mock.Mock
+}
+
+func (m *MockMetrics) LoanStateChanged(from, to domain.LoanState) {
+	m.Called(from, to)
+}
+
+func (m *MockMetrics) InvestmentAccepted(amount float64) {
+	m.Called(amount)
+}
+
+func (m *MockMetrics) OverfundingRejected() {
+	m.Called()
+}
+
+func (m *MockMetrics) LoanFunded(elapsed time.Duration) {
+	m.Called(elapsed)
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"loan_service/internal/domain"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ProductRepo abstracts persistence of the loan product catalog. The
+// concrete implementations are repository.LoanRepository and
+// memory.Store.
+type ProductRepo interface {
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+	CreateProduct(ctx context.Context, product *domain.LoanProduct) error
+	// FindProduct returns the given version of a product, or its latest
+	// version when version is zero; it returns nil and a nil error if
+	// there is no such version.
+	FindProduct(ctx context.Context, code string, version int) (*domain.LoanProduct, error)
+	// ListProducts returns the latest version of every product.
+	ListProducts(ctx context.Context) ([]domain.LoanProduct, error)
+	ListProductVersions(ctx context.Context, code string) ([]domain.LoanProduct, error)
+}
+
+// TemplateChecker reports whether an agreement template exists. The
+// concrete implementation is docgen.Generator.
+type TemplateChecker interface {
+	Has(kind domain.DocumentKind, version string) bool
+}
+
+// ErrProductNotFound is returned when a loan product, or the requested
+// version of it, does not exist.
+var ErrProductNotFound = errors.New("product not found")
+
+// ErrProductExists is returned when creating a product whose code is
+// already taken; changes to a product are published as new versions.
+var ErrProductExists = errors.New("product already exists")
+
+// ProductService manages the loan product catalog. Products are
+// versioned: a version is never modified once created, so that the
+// loans created under it keep their terms.
+type ProductService struct {
+	repo      ProductRepo
+	templates TemplateChecker
+}
+
+// NewProductService constructs a new ProductService. When templates
+// is not nil, the agreement template named by a product must exist.
+func NewProductService(repo ProductRepo, templates TemplateChecker) *ProductService {
+	return &ProductService{repo: repo, templates: templates}
+}
+
+// CreateProduct creates version 1 of a new product. It fails with
+// ErrProductExists if a product with the same code exists.
+func (s *ProductService) CreateProduct(ctx context.Context, product domain.LoanProduct) (_ *domain.LoanProduct, err error) {
+	ctx, span := startSpan(ctx, "ProductService.CreateProduct", attribute.String("product.code", product.Code))
+	defer func() { endSpan(span, err) }()
+
+	if err := s.validate(&product); err != nil {
+		return nil, err
+	}
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		existing, err := s.repo.FindProduct(ctx, product.Code, 0)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return ErrProductExists
+		}
+		return s.create(ctx, &product, 1)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// PublishVersion publishes the terms in product as the next version of
+// the product with the given code, which must exist. Loans created
+// afterwards use the new version; existing loans keep theirs.
+func (s *ProductService) PublishVersion(ctx context.Context, code string, product domain.LoanProduct) (_ *domain.LoanProduct, err error) {
+	ctx, span := startSpan(ctx, "ProductService.PublishVersion", attribute.String("product.code", code))
+	defer func() { endSpan(span, err) }()
+
+	product.Code = code
+	if err := s.validate(&product); err != nil {
+		return nil, err
+	}
+	err = s.repo.Transaction(ctx, func(ctx context.Context) error {
+		latest, err := s.repo.FindProduct(ctx, code, 0)
+		if err != nil {
+			return err
+		}
+		if latest == nil {
+			return ErrProductNotFound
+		}
+		return s.create(ctx, &product, latest.Version+1)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (s *ProductService) create(ctx context.Context, product *domain.LoanProduct, version int) error {
+	product.ID = uuid.New().String()
+	product.Version = version
+	product.CreatedAt = time.Now().UTC()
+	return s.repo.CreateProduct(ctx, product)
+}
+
+// GetProduct returns the given version of the product with the given
+// code, or its latest version when version is zero. It fails with
+// ErrProductNotFound if there is no such version.
+func (s *ProductService) GetProduct(ctx context.Context, code string, version int) (_ *domain.LoanProduct, err error) {
+	ctx, span := startSpan(ctx, "ProductService.GetProduct", attribute.String("product.code", code), attribute.Int("product.version", version))
+	defer func() { endSpan(span, err) }()
+
+	product, err := s.repo.FindProduct(ctx, code, version)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+	return product, nil
+}
+
+// ListProducts returns the latest version of every product, ordered by
+// code.
+func (s *ProductService) ListProducts(ctx context.Context) (_ []domain.LoanProduct, err error) {
+	ctx, span := startSpan(ctx, "ProductService.ListProducts")
+	defer func() { endSpan(span, err) }()
+
+	return s.repo.ListProducts(ctx)
+}
+
+// ListVersions returns every version of the product with the given
+// code, oldest first, or ErrProductNotFound.
+func (s *ProductService) ListVersions(ctx context.Context, code string) (_ []domain.LoanProduct, err error) {
+	ctx, span := startSpan(ctx, "ProductService.ListVersions", attribute.String("product.code", code))
+	defer func() { endSpan(span, err) }()
+
+	versions, err := s.repo.ListProductVersions(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, ErrProductNotFound
+	}
+	return versions, nil
+}
+
+// validate checks the terms of a product and sorts its tenors,
+// dropping duplicates.
+func (s *ProductService) validate(p *domain.LoanProduct) error {
+	if !validProductCode(p.Code) {
+		return fmt.Errorf("invalid product code %q; must be 1 to 50 letters, digits, '-' or '_'", p.Code)
+	}
+	if p.Name == "" {
+		return errors.New("product name is required")
+	}
+	if len(p.TenorMonths) == 0 {
+		return errors.New("at least one tenor is required")
+	}
+	p.TenorMonths = slices.Clone(p.TenorMonths)
+	slices.Sort(p.TenorMonths)
+	p.TenorMonths = slices.Compact(p.TenorMonths)
+	if p.TenorMonths[0] <= 0 {
+		return errors.New("tenors must be positive")
+	}
+	if !p.RepaymentFrequency.Valid() {
+		return fmt.Errorf("unknown repayment frequency %q; must be weekly, monthly or bullet", p.RepaymentFrequency)
+	}
+	if domain.Cents(p.MinPrincipal) <= 0 || p.MinPrincipal > p.MaxPrincipal {
+		return errors.New("principal range must be positive with the minimum not above the maximum")
+	}
+	if p.MinRate < 0 || p.MinRate > p.MaxRate {
+		return errors.New("rate band must not be negative with the minimum not above the maximum")
+	}
+	if p.MinROI < 0 || p.MinROI > p.MaxROI {
+		return errors.New("ROI band must not be negative with the minimum not above the maximum")
+	}
+	if p.OriginationFee < 0 || p.OriginationFee > 100 || p.LateFee < 0 {
+		return errors.New("origination fee must be a percentage from 0 to 100 and late fee must not be negative")
+	}
+	if p.AgreementTemplate != "" && s.templates != nil {
+		for _, kind := range []domain.DocumentKind{domain.DocumentKindBorrowerAgreement, domain.DocumentKindInvestorAgreement} {
+			if !s.templates.Has(kind, p.AgreementTemplate) {
+				return fmt.Errorf("no %s template of version %q", kind, p.AgreementTemplate)
+			}
+		}
+	}
+	return nil
+}
+
+// validProductCode reports whether code can be used as a product code,
+// which appears in URL paths.
+func validProductCode(code string) bool {
+	if code == "" || len(code) > 50 {
+		return false
+	}
+	for _, c := range code {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
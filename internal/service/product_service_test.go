@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"loan_service/internal/docgen"
+	"loan_service/internal/domain"
+	"loan_service/internal/repository/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductService_Versions(t *testing.T) {
+	store := memory.NewStore()
+	generator, err := docgen.NewGenerator()
+	require.NoError(t, err)
+	svc := NewProductService(store, generator)
+	ctx := context.Background()
+	terms := domain.LoanProduct{
+		Code: "MICRO", Name: "Micro loan", TenorMonths: []int{12, 6, 12},
+		RepaymentFrequency: domain.RepaymentWeekly,
+		MinPrincipal:       500, MaxPrincipal: 5000, MinRate: 8, MaxRate: 15, MinROI: 6, MaxROI: 12,
+		OriginationFee: 2, LateFee: 10, AgreementTemplate: "v1",
+	}
+
+	_, err = svc.PublishVersion(ctx, "MICRO", terms)
+	assert.ErrorIs(t, err, ErrProductNotFound)
+	v1, err := svc.CreateProduct(ctx, terms)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v1.Version)
+	assert.Equal(t, []int{6, 12}, v1.TenorMonths, "tenors are sorted and deduplicated")
+	_, err = svc.CreateProduct(ctx, terms)
+	assert.ErrorIs(t, err, ErrProductExists)
+
+	terms.MaxPrincipal = 10000
+	terms.TenorMonths = []int{24}
+	v2, err := svc.PublishVersion(ctx, "MICRO", terms)
+	require.NoError(t, err)
+	assert.Equal(t, 2, v2.Version)
+	assert.NotEqual(t, v1.ID, v2.ID)
+
+	latest, err := svc.GetProduct(ctx, "MICRO", 0)
+	require.NoError(t, err)
+	assert.Equal(t, v2.ID, latest.ID)
+	first, err := svc.GetProduct(ctx, "MICRO", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 5000.0, first.MaxPrincipal, "publishing a version leaves the earlier ones unchanged")
+	_, err = svc.GetProduct(ctx, "MICRO", 3)
+	assert.ErrorIs(t, err, ErrProductNotFound)
+
+	versions, err := svc.ListVersions(ctx, "MICRO")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, 1, versions[0].Version)
+	_, err = svc.ListVersions(ctx, "NONE")
+	assert.ErrorIs(t, err, ErrProductNotFound)
+	products, err := svc.ListProducts(ctx)
+	require.NoError(t, err)
+	require.Len(t, products, 1)
+	assert.Equal(t, 2, products[0].Version)
+}
+
+func TestProductService_Validation(t *testing.T) {
+	generator, err := docgen.NewGenerator()
+	require.NoError(t, err)
+	svc := NewProductService(memory.NewStore(), generator)
+	valid := domain.LoanProduct{
+		Code: "MICRO", Name: "Micro loan", TenorMonths: []int{6},
+		RepaymentFrequency: domain.RepaymentMonthly, MinPrincipal: 500, MaxPrincipal: 5000,
+	}
+	for name, tc := range map[string]struct {
+		change func(*domain.LoanProduct)
+		want   string
+	}{
+		"code with a slash":  {func(p *domain.LoanProduct) { p.Code = "A/B" }, "invalid product code"},
+		"no name":            {func(p *domain.LoanProduct) { p.Name = "" }, "product name is required"},
+		"no tenor":           {func(p *domain.LoanProduct) { p.TenorMonths = nil }, "at least one tenor is required"},
+		"zero tenor":         {func(p *domain.LoanProduct) { p.TenorMonths = []int{0, 6} }, "tenors must be positive"},
+		"unknown frequency":  {func(p *domain.LoanProduct) { p.RepaymentFrequency = "daily" }, "unknown repayment frequency"},
+		"inverted principal": {func(p *domain.LoanProduct) { p.MinPrincipal = 6000 }, "principal range"},
+		"inverted rate band": {func(p *domain.LoanProduct) { p.MinRate = 10 }, "rate band"},
+		"negative ROI":       {func(p *domain.LoanProduct) { p.MinROI = -1 }, "ROI band"},
+		"fee over 100%":      {func(p *domain.LoanProduct) { p.OriginationFee = 101 }, "origination fee"},
+		"unknown template":   {func(p *domain.LoanProduct) { p.AgreementTemplate = "v999" }, `no borrower_agreement template of version "v999"`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := valid
+			tc.change(&p)
+			_, err := svc.CreateProduct(context.Background(), p)
+			assert.ErrorContains(t, err, tc.want)
+		})
+	}
+}
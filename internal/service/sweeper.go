@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RunPeriodically calls fn every interval until ctx is cancelled. It
+// is used for background sweeps, such as expiring loans, that are safe
+// to run on every instance at once because each change is made under
+// the row lock of the affected record. Failures are logged and the
+// sweep is tried again at the next tick.
+func RunPeriodically(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := fn(ctx); err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "background sweep failed", "sweep", name, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+// Package storage provides blob storage backends for uploaded and
+// generated documents. Callers depend on the BlobStore interface so
+// that the local filesystem implementation used in development can be
+// swapped for an S3-compatible object store in production.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when no blob exists under the requested key.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores opaque binary content under string keys. Keys are
+// slash separated paths chosen by the caller, for example
+// "approval_proof/<document id>".
+type BlobStore interface {
+	// Put stores the content read from r under key, replacing any
+	// existing blob. size is the content length if known or -1.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the blob stored under key. The caller must close the
+	// returned reader. ErrNotFound is returned for unknown keys.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a missing
+	// blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
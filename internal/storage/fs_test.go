@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSStore_PutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewFSStore(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, s.Put(ctx, "approval_proof/doc1", strings.NewReader("hello"), 5, "text/plain"))
+	rc, err := s.Get(ctx, "approval_proof/doc1")
+	require.NoError(t, err)
+	b, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "hello", string(b))
+
+	require.NoError(t, s.Delete(ctx, "approval_proof/doc1"))
+	require.NoError(t, s.Delete(ctx, "approval_proof/doc1"))
+	_, err = s.Get(ctx, "approval_proof/doc1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFSStore_RejectsKeysOutsideRoot(t *testing.T) {
+	s, err := NewFSStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"", "../escape", "a/../../escape", "/etc/passwd"} {
+		err := s.Put(context.Background(), key, strings.NewReader("x"), 1, "text/plain")
+		assert.Error(t, err, key)
+	}
+}
@@ -0,0 +1,22 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetup_Exporters(t *testing.T) {
+	for _, exporter := range []string{"none", "stdout", "otlp"} {
+		shutdown, err := Setup(context.Background(), Config{Exporter: exporter, SampleRatio: 1})
+		require.NoError(t, err, exporter)
+		assert.NoError(t, shutdown(context.Background()), exporter)
+	}
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), Config{Exporter: "zipkin"})
+	assert.ErrorContains(t, err, `unknown trace exporter "zipkin"`)
+}
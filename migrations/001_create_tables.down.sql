@@ -0,0 +1,6 @@
+-- revert: drop initial schema
+DROP TABLE IF EXISTS disbursements;
+DROP TABLE IF EXISTS investments;
+DROP TABLE IF EXISTS investors;
+DROP TABLE IF EXISTS approvals;
+DROP TABLE IF EXISTS loans;
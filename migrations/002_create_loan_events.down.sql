@@ -0,0 +1,2 @@
+-- revert: drop loan event log
+DROP TABLE IF EXISTS loan_events;
@@ -0,0 +1,19 @@
+-- migration: create loan event log
+-- Loan events back the real-time event stream. The BIGSERIAL id is
+-- the SSE event identifier, which lets reconnecting clients replay
+-- everything after the last event they received.
+
+CREATE TABLE IF NOT EXISTS loan_events (
+    id             BIGSERIAL PRIMARY KEY,
+    loan_id        UUID NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    type           VARCHAR(50) NOT NULL,
+    state          VARCHAR(20) NOT NULL,
+    previous_state VARCHAR(20),
+    investment_id  VARCHAR(36),
+    investor_id    VARCHAR(36),
+    amount         NUMERIC(12,2),
+    total_invested NUMERIC(12,2),
+    principal      NUMERIC(12,2),
+    created_at     TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_loan_events_loan_id ON loan_events (loan_id, id);
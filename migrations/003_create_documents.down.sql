@@ -0,0 +1,4 @@
+-- revert: drop uploaded documents
+ALTER TABLE disbursements DROP COLUMN IF EXISTS agreement_document_id;
+ALTER TABLE approvals DROP COLUMN IF EXISTS picture_document_id;
+DROP TABLE IF EXISTS documents;
@@ -0,0 +1,19 @@
+-- migration: store uploaded documents
+-- Approval proofs and signed agreements are uploaded through the API
+-- and kept in a blob store. This table records their metadata, and
+-- approvals and disbursements reference the uploaded document instead
+-- of an arbitrary client supplied URL.
+
+CREATE TABLE IF NOT EXISTS documents (
+    id           UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    kind         VARCHAR(30) NOT NULL,
+    file_name    VARCHAR(255),
+    content_type VARCHAR(100) NOT NULL,
+    size         BIGINT NOT NULL,
+    sha256       CHAR(64) NOT NULL,
+    storage_key  TEXT NOT NULL,
+    created_at   TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE approvals ADD COLUMN IF NOT EXISTS picture_document_id UUID REFERENCES documents(id);
+ALTER TABLE disbursements ADD COLUMN IF NOT EXISTS agreement_document_id UUID REFERENCES documents(id);
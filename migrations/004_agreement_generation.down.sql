@@ -0,0 +1,3 @@
+-- revert: generated agreement letters
+ALTER TABLE investments DROP COLUMN IF EXISTS agreement_url;
+ALTER TABLE documents DROP COLUMN IF EXISTS template;
@@ -0,0 +1,8 @@
+-- migration: generated agreement letters
+-- Agreement letters are rendered by the service from versioned
+-- templates when a loan becomes fully funded. Generated documents
+-- record the template they were rendered from, and every investment
+-- links to the investor agreement generated for it.
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS template VARCHAR(100);
+ALTER TABLE investments ADD COLUMN IF NOT EXISTS agreement_url TEXT;
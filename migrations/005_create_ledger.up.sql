@@ -0,0 +1,34 @@
+-- migration: double-entry ledger
+-- Every movement of money is recorded as a journal entry made of
+-- postings that debit one account and credit another. Accounts are
+-- created on first use and are unique per type and owner; the owner
+-- is an investor, loan or borrower ID, or empty for the single
+-- external and platform revenue accounts. Entries are never updated.
+
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id         UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    type       VARCHAR(30) NOT NULL,
+    owner_id   VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (type, owner_id)
+);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id          UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    kind        VARCHAR(30) NOT NULL,
+    loan_id     VARCHAR(36) NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_journal_entries_loan_id ON journal_entries (loan_id);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id         UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    entry_id   UUID NOT NULL REFERENCES journal_entries(id) ON DELETE CASCADE,
+    account_id UUID NOT NULL REFERENCES ledger_accounts(id),
+    debit      NUMERIC(14,2) NOT NULL DEFAULT 0,
+    credit     NUMERIC(14,2) NOT NULL DEFAULT 0,
+    CHECK ((debit > 0 AND credit = 0) OR (debit = 0 AND credit > 0))
+);
+CREATE INDEX IF NOT EXISTS idx_postings_entry_id ON postings (entry_id);
+CREATE INDEX IF NOT EXISTS idx_postings_account_id ON postings (account_id);
@@ -0,0 +1,2 @@
+-- revert: refunds
+DROP TABLE IF EXISTS refunds;
@@ -0,0 +1,18 @@
+-- migration: refunds
+-- A refund records invested funds returned to an investor's wallet,
+-- either because the investor cancelled the investment before the loan
+-- was funded or because the loan itself was cancelled or expired. A
+-- cancelled investment is deleted, so its ID is kept here without a
+-- foreign key.
+
+CREATE TABLE IF NOT EXISTS refunds (
+    id            UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    loan_id       UUID NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    investment_id UUID NOT NULL,
+    investor_id   UUID NOT NULL REFERENCES investors(id) ON DELETE CASCADE,
+    amount        NUMERIC(12,2) NOT NULL,
+    reason        VARCHAR(30) NOT NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_refunds_loan_id ON refunds (loan_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_investor_id ON refunds (investor_id);
@@ -0,0 +1,18 @@
+-- migration: reservations
+-- A reservation holds an amount of an approved loan for an investor
+-- while they complete payment. Held reservations that have not expired
+-- count against the principal; confirming one creates an investment.
+
+CREATE TABLE IF NOT EXISTS reservations (
+    id            UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    loan_id       UUID NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    investor_id   UUID NOT NULL REFERENCES investors(id) ON DELETE CASCADE,
+    amount        NUMERIC(12,2) NOT NULL,
+    state         VARCHAR(20) NOT NULL,
+    expires_at    TIMESTAMP NOT NULL,
+    investment_id UUID REFERENCES investments(id) ON DELETE SET NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_reservations_loan_id ON reservations (loan_id, state);
+CREATE INDEX IF NOT EXISTS idx_reservations_expires_at ON reservations (expires_at) WHERE state = 'held';
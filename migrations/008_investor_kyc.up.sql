@@ -0,0 +1,17 @@
+-- migration: investor KYC
+-- Investors submit identity data and an identity document for
+-- verification, which staff then verify or reject. Existing investors
+-- start pending. Unverified investors may be limited in how much they
+-- can invest.
+
+ALTER TABLE investors ADD COLUMN IF NOT EXISTS kyc_status VARCHAR(20) NOT NULL DEFAULT 'pending';
+ALTER TABLE investors ADD COLUMN IF NOT EXISTS kyc_full_name VARCHAR(200);
+ALTER TABLE investors ADD COLUMN IF NOT EXISTS kyc_id_number VARCHAR(50);
+ALTER TABLE investors ADD COLUMN IF NOT EXISTS kyc_date_of_birth DATE;
+ALTER TABLE investors ADD COLUMN IF NOT EXISTS kyc_address TEXT;
+ALTER TABLE investors ADD COLUMN IF NOT EXISTS kyc_document_id UUID REFERENCES documents(id);
+ALTER TABLE investors ADD COLUMN IF NOT EXISTS kyc_submitted_at TIMESTAMP;
+ALTER TABLE investors ADD COLUMN IF NOT EXISTS kyc_reviewed_by VARCHAR(50);
+ALTER TABLE investors ADD COLUMN IF NOT EXISTS kyc_reviewed_at TIMESTAMP;
+ALTER TABLE investors ADD COLUMN IF NOT EXISTS kyc_rejection_reason TEXT;
+CREATE INDEX IF NOT EXISTS idx_investors_kyc_status ON investors (kyc_status);
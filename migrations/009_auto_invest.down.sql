@@ -0,0 +1,5 @@
+-- revert: auto-invest rules
+DROP INDEX IF EXISTS idx_investments_auto_invest_rule_id;
+ALTER TABLE investments DROP COLUMN IF EXISTS auto_invest_rule_id;
+DROP TABLE IF EXISTS auto_invest_rules;
+ALTER TABLE loans DROP COLUMN IF EXISTS risk_grade;
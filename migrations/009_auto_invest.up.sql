@@ -0,0 +1,24 @@
+-- migration: auto-invest rules
+-- Investors may set a rule to invest automatically in loans approved
+-- with a minimum ROI, a maximum principal and, when the borrower has
+-- been graded, a maximum risk grade. Investments placed by a rule
+-- reference it, so that its daily budget can be enforced.
+
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS risk_grade VARCHAR(1);
+
+CREATE TABLE IF NOT EXISTS auto_invest_rules (
+    id             UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    investor_id    UUID NOT NULL UNIQUE REFERENCES investors(id) ON DELETE CASCADE,
+    min_roi        NUMERIC(6,2) NOT NULL,
+    max_principal  NUMERIC(12,2) NOT NULL,
+    max_per_loan   NUMERIC(12,2) NOT NULL,
+    daily_budget   NUMERIC(12,2) NOT NULL,
+    max_risk_grade VARCHAR(1),
+    active         BOOLEAN NOT NULL,
+    last_placed_at TIMESTAMP,
+    created_at     TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE investments ADD COLUMN IF NOT EXISTS auto_invest_rule_id UUID REFERENCES auto_invest_rules(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_investments_auto_invest_rule_id ON investments (auto_invest_rule_id, created_at);
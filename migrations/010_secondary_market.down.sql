@@ -0,0 +1,4 @@
+-- revert: secondary market
+DROP TABLE IF EXISTS listings;
+ALTER TABLE investments DROP COLUMN IF EXISTS transferred_at;
+ALTER TABLE investments DROP COLUMN IF EXISTS origin_id;
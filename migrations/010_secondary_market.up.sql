@@ -0,0 +1,27 @@
+-- migration: secondary market
+-- Investors may list all or part of an investment in a disbursed loan
+-- for sale. A sale closes the investment (transferred_at) and creates
+-- new investments for the buyer and for any remainder, linked to it by
+-- origin_id; only open investments count towards the loan and receive
+-- payouts.
+
+ALTER TABLE investments ADD COLUMN IF NOT EXISTS origin_id UUID REFERENCES investments(id);
+ALTER TABLE investments ADD COLUMN IF NOT EXISTS transferred_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS listings (
+    id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    loan_id             UUID NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    investment_id       UUID NOT NULL REFERENCES investments(id),
+    seller_id           UUID NOT NULL REFERENCES investors(id),
+    amount              NUMERIC(12,2) NOT NULL,
+    price               NUMERIC(12,2) NOT NULL,
+    state               VARCHAR(20) NOT NULL,
+    buyer_id            UUID REFERENCES investors(id),
+    buyer_investment_id UUID REFERENCES investments(id),
+    sold_at             TIMESTAMP,
+    created_at          TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_listings_loan_id ON listings (loan_id, state);
+-- An investment may be offered by one open listing at a time.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_listings_open_investment ON listings (investment_id) WHERE state = 'open';
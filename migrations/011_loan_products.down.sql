@@ -0,0 +1,5 @@
+-- revert: loan products
+ALTER TABLE loans DROP COLUMN IF EXISTS tenor_months;
+ALTER TABLE loans DROP COLUMN IF EXISTS product_code;
+ALTER TABLE loans DROP COLUMN IF EXISTS product_id;
+DROP TABLE IF EXISTS loan_products;
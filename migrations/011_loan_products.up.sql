@@ -0,0 +1,31 @@
+-- migration: loan products
+-- Loans are offered under a version of a loan product, which sets the
+-- tenors, principal range, rate and ROI bands, fees and agreement
+-- template of its loans. Product versions are never updated; a change
+-- adds a version with the next number, so existing loans keep the
+-- terms they were created under. Loans created before the catalog
+-- have no product.
+
+CREATE TABLE IF NOT EXISTS loan_products (
+    id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    code                VARCHAR(50) NOT NULL,
+    version             INTEGER NOT NULL,
+    name                TEXT NOT NULL,
+    tenor_months        TEXT NOT NULL,
+    repayment_frequency VARCHAR(20) NOT NULL,
+    min_principal       NUMERIC(12,2) NOT NULL,
+    max_principal       NUMERIC(12,2) NOT NULL,
+    min_rate            NUMERIC(6,2) NOT NULL,
+    max_rate            NUMERIC(6,2) NOT NULL,
+    min_roi             NUMERIC(6,2) NOT NULL,
+    max_roi             NUMERIC(6,2) NOT NULL,
+    origination_fee     NUMERIC(6,2) NOT NULL,
+    late_fee            NUMERIC(12,2) NOT NULL,
+    agreement_template  VARCHAR(50),
+    created_at          TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (code, version)
+);
+
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS product_id UUID REFERENCES loan_products(id);
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS product_code VARCHAR(50);
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS tenor_months INTEGER;
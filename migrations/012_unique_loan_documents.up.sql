@@ -0,0 +1,7 @@
+-- migration: unique loan documents
+-- An uploaded approval proof or signed agreement belongs to a single
+-- loan. The service checks this before attaching a document; the
+-- indexes also reject concurrent attempts to attach one to two loans.
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_approvals_picture_document_id ON approvals (picture_document_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_disbursements_agreement_document_id ON disbursements (agreement_document_id);
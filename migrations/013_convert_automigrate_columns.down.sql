@@ -0,0 +1,4 @@
+-- revert: convert AutoMigrate columns
+-- The converted types are the ones 001 creates, so there is nothing to
+-- restore.
+SELECT 1;
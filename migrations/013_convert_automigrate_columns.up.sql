@@ -0,0 +1,42 @@
+-- migration: convert AutoMigrate columns
+-- Databases created by the service before the migration runner existed
+-- were built by GORM AutoMigrate, which gave money columns an
+-- unbounded numeric type and dates and timestamps a time zone. 001
+-- creates tables only if they are missing, so such a database kept
+-- those types. Convert every column whose type differs from 001; on a
+-- database created by 001 this changes nothing. Stored timestamps are
+-- UTC, so they are converted at UTC.
+
+DO $$
+DECLARE
+    col RECORD;
+BEGIN
+    FOR col IN
+        SELECT t.tbl, t.name, t.want, format_type(a.atttypid, NULL) AS have
+        FROM (VALUES
+            ('loans', 'principal', 'numeric(12,2)'),
+            ('loans', 'rate', 'numeric(6,2)'),
+            ('loans', 'roi', 'numeric(6,2)'),
+            ('loans', 'created_at', 'timestamp without time zone'),
+            ('loans', 'updated_at', 'timestamp without time zone'),
+            ('approvals', 'approval_date', 'date'),
+            ('approvals', 'created_at', 'timestamp without time zone'),
+            ('investors', 'created_at', 'timestamp without time zone'),
+            ('investments', 'amount', 'numeric(12,2)'),
+            ('investments', 'created_at', 'timestamp without time zone'),
+            ('disbursements', 'disbursement_date', 'date'),
+            ('disbursements', 'created_at', 'timestamp without time zone')
+        ) AS t(tbl, name, want)
+        JOIN pg_attribute a
+            ON a.attrelid = to_regclass(t.tbl) AND a.attname = t.name AND NOT a.attisdropped
+        WHERE format_type(a.atttypid, a.atttypmod) <> t.want
+    LOOP
+        IF col.have = 'timestamp with time zone' THEN
+            EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE %s USING (%I AT TIME ZONE ''UTC'')::%s',
+                col.tbl, col.name, col.want, col.name, col.want);
+        ELSE
+            EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE %s USING %I::%s',
+                col.tbl, col.name, col.want, col.name, col.want);
+        END IF;
+    END LOOP;
+END $$;
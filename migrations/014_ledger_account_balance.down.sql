@@ -0,0 +1,2 @@
+-- revert: ledger account balance
+ALTER TABLE ledger_accounts DROP COLUMN IF EXISTS balance;
@@ -0,0 +1,12 @@
+-- migration: ledger account balance
+-- Each account keeps its running balance, updated in the same
+-- transaction as the postings, so that reading a balance does not sum
+-- every posting of the account. The ledger check compares the stored
+-- balances with the postings.
+
+ALTER TABLE ledger_accounts ADD COLUMN IF NOT EXISTS balance NUMERIC(14,2) NOT NULL DEFAULT 0;
+
+UPDATE ledger_accounts SET balance = (
+    SELECT COALESCE(SUM(credit), 0) - COALESCE(SUM(debit), 0)
+    FROM postings WHERE postings.account_id = ledger_accounts.id
+);
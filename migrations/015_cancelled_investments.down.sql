@@ -0,0 +1,4 @@
+-- revert: cancelled investments
+ALTER TABLE refunds DROP CONSTRAINT IF EXISTS refunds_investment_id_fkey;
+DELETE FROM investments WHERE cancelled_at IS NOT NULL;
+ALTER TABLE investments DROP COLUMN IF EXISTS cancelled_at;
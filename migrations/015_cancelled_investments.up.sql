@@ -0,0 +1,16 @@
+-- migration: cancelled investments
+-- A cancelled investment is no longer deleted but closed with
+-- cancelled_at, like a transferred one, so that its refund can
+-- reference it. Investments cancelled before this migration were
+-- deleted; they are restored from their refunds as cancelled
+-- investments before the foreign key is added.
+
+ALTER TABLE investments ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
+
+INSERT INTO investments (id, loan_id, investor_id, amount, cancelled_at, created_at)
+SELECT r.investment_id, r.loan_id, r.investor_id, r.amount, r.created_at, r.created_at
+FROM refunds r
+WHERE NOT EXISTS (SELECT 1 FROM investments i WHERE i.id = r.investment_id);
+
+ALTER TABLE refunds ADD CONSTRAINT refunds_investment_id_fkey
+    FOREIGN KEY (investment_id) REFERENCES investments(id);
@@ -0,0 +1,37 @@
+// Package migrations embeds the SQL schema migrations so that they
+// ship inside the service binary. Each migration consists of a
+// NNN_name.up.sql file and a matching NNN_name.down.sql file that
+// reverts it. Migrations are applied by internal/migrate.
+//
+// The Postgres migrations live in this directory and the SQLite
+// migrations in sqlite/. Both sets have the same versions, so that a
+// schema version means the same thing on either database; every new
+// migration must be written for both.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+// FS holds the Postgres migration files.
+//
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+// ForDialect returns the migration files for the named database
+// dialect, "postgres" or "sqlite".
+func ForDialect(dialect string) (fs.FS, error) {
+	switch dialect {
+	case "postgres":
+		return FS, nil
+	case "sqlite":
+		return fs.Sub(sqliteFS, "sqlite")
+	default:
+		return nil, fmt.Errorf("no migrations for dialect %q", dialect)
+	}
+}
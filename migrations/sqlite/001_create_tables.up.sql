@@ -0,0 +1,52 @@
+-- migration: create initial schema for Amartha loan service (SQLite)
+-- Mirrors the Postgres migration of the same version. IDs are UUIDs
+-- generated by the service and stored as text; amounts are REAL.
+-- Foreign keys are enforced when the connection enables
+-- PRAGMA foreign_keys, which the service always does.
+
+CREATE TABLE IF NOT EXISTS loans (
+    id                   TEXT PRIMARY KEY,
+    borrower_id          VARCHAR(50) NOT NULL,
+    principal            REAL NOT NULL,
+    rate                 REAL NOT NULL,
+    roi                  REAL NOT NULL,
+    agreement_letter_url TEXT,
+    state                VARCHAR(20) NOT NULL,
+    created_at           TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at           TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS approvals (
+    id            TEXT PRIMARY KEY,
+    loan_id       TEXT NOT NULL UNIQUE REFERENCES loans(id) ON DELETE CASCADE,
+    picture_url   TEXT NOT NULL,
+    employee_id   VARCHAR(50) NOT NULL,
+    approval_date DATE NOT NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS investors (
+    id         TEXT PRIMARY KEY,
+    name       VARCHAR(100),
+    email      VARCHAR(100),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS investments (
+    id          TEXT PRIMARY KEY,
+    loan_id     TEXT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    investor_id TEXT NOT NULL REFERENCES investors(id) ON DELETE CASCADE,
+    amount      REAL NOT NULL,
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_investments_loan_id ON investments (loan_id);
+CREATE INDEX IF NOT EXISTS idx_investments_investor_id ON investments (investor_id);
+
+CREATE TABLE IF NOT EXISTS disbursements (
+    id                TEXT PRIMARY KEY,
+    loan_id           TEXT NOT NULL UNIQUE REFERENCES loans(id) ON DELETE CASCADE,
+    agreement_url     TEXT NOT NULL,
+    employee_id       VARCHAR(50) NOT NULL,
+    disbursement_date DATE NOT NULL,
+    created_at        TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,18 @@
+-- migration: create loan event log (SQLite)
+-- The AUTOINCREMENT id is the SSE event identifier; unlike a plain
+-- rowid it is never reused, so replay positions stay valid.
+
+CREATE TABLE IF NOT EXISTS loan_events (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    loan_id        TEXT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    type           VARCHAR(50) NOT NULL,
+    state          VARCHAR(20) NOT NULL,
+    previous_state VARCHAR(20),
+    investment_id  VARCHAR(36),
+    investor_id    VARCHAR(36),
+    amount         REAL,
+    total_invested REAL,
+    principal      REAL,
+    created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_loan_events_loan_id ON loan_events (loan_id, id);
@@ -0,0 +1,19 @@
+-- migration: store uploaded documents (SQLite)
+-- SQLite cannot drop a column that takes part in a foreign key, so
+-- the document references added to approvals and disbursements are
+-- plain columns here; the service only stores IDs of documents it
+-- has just looked up.
+
+CREATE TABLE IF NOT EXISTS documents (
+    id           TEXT PRIMARY KEY,
+    kind         VARCHAR(30) NOT NULL,
+    file_name    VARCHAR(255),
+    content_type VARCHAR(100) NOT NULL,
+    size         INTEGER NOT NULL,
+    sha256       CHAR(64) NOT NULL,
+    storage_key  TEXT NOT NULL,
+    created_at   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE approvals ADD COLUMN picture_document_id TEXT;
+ALTER TABLE disbursements ADD COLUMN agreement_document_id TEXT;
@@ -0,0 +1,4 @@
+-- migration: generated agreement letters (SQLite)
+
+ALTER TABLE documents ADD COLUMN template VARCHAR(100);
+ALTER TABLE investments ADD COLUMN agreement_url TEXT;
@@ -0,0 +1,4 @@
+-- revert: double-entry ledger
+DROP TABLE IF EXISTS postings;
+DROP TABLE IF EXISTS journal_entries;
+DROP TABLE IF EXISTS ledger_accounts;
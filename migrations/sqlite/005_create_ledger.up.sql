@@ -0,0 +1,29 @@
+-- migration: double-entry ledger (SQLite)
+
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id         TEXT PRIMARY KEY,
+    type       VARCHAR(30) NOT NULL,
+    owner_id   VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (type, owner_id)
+);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id          TEXT PRIMARY KEY,
+    kind        VARCHAR(30) NOT NULL,
+    loan_id     VARCHAR(36) NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_journal_entries_loan_id ON journal_entries (loan_id);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id         TEXT PRIMARY KEY,
+    entry_id   TEXT NOT NULL REFERENCES journal_entries(id) ON DELETE CASCADE,
+    account_id TEXT NOT NULL REFERENCES ledger_accounts(id),
+    debit      REAL NOT NULL DEFAULT 0,
+    credit     REAL NOT NULL DEFAULT 0,
+    CHECK ((debit > 0 AND credit = 0) OR (debit = 0 AND credit > 0))
+);
+CREATE INDEX IF NOT EXISTS idx_postings_entry_id ON postings (entry_id);
+CREATE INDEX IF NOT EXISTS idx_postings_account_id ON postings (account_id);
@@ -0,0 +1,13 @@
+-- migration: refunds (SQLite)
+
+CREATE TABLE IF NOT EXISTS refunds (
+    id            TEXT PRIMARY KEY,
+    loan_id       TEXT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    investment_id TEXT NOT NULL,
+    investor_id   TEXT NOT NULL REFERENCES investors(id) ON DELETE CASCADE,
+    amount        REAL NOT NULL,
+    reason        VARCHAR(30) NOT NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_refunds_loan_id ON refunds (loan_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_investor_id ON refunds (investor_id);
@@ -0,0 +1,2 @@
+-- revert: reservations
+DROP TABLE IF EXISTS reservations;
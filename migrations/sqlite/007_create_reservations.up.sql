@@ -0,0 +1,15 @@
+-- migration: reservations (SQLite)
+
+CREATE TABLE IF NOT EXISTS reservations (
+    id            TEXT PRIMARY KEY,
+    loan_id       TEXT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    investor_id   TEXT NOT NULL REFERENCES investors(id) ON DELETE CASCADE,
+    amount        REAL NOT NULL,
+    state         VARCHAR(20) NOT NULL,
+    expires_at    TIMESTAMP NOT NULL,
+    investment_id TEXT REFERENCES investments(id) ON DELETE SET NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_reservations_loan_id ON reservations (loan_id, state);
+CREATE INDEX IF NOT EXISTS idx_reservations_expires_at ON reservations (expires_at) WHERE state = 'held';
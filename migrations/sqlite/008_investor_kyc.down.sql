@@ -0,0 +1,12 @@
+-- revert: investor KYC
+DROP INDEX IF EXISTS idx_investors_kyc_status;
+ALTER TABLE investors DROP COLUMN kyc_rejection_reason;
+ALTER TABLE investors DROP COLUMN kyc_reviewed_at;
+ALTER TABLE investors DROP COLUMN kyc_reviewed_by;
+ALTER TABLE investors DROP COLUMN kyc_submitted_at;
+ALTER TABLE investors DROP COLUMN kyc_document_id;
+ALTER TABLE investors DROP COLUMN kyc_address;
+ALTER TABLE investors DROP COLUMN kyc_date_of_birth;
+ALTER TABLE investors DROP COLUMN kyc_id_number;
+ALTER TABLE investors DROP COLUMN kyc_full_name;
+ALTER TABLE investors DROP COLUMN kyc_status;
@@ -0,0 +1,13 @@
+-- migration: investor KYC (SQLite)
+
+ALTER TABLE investors ADD COLUMN kyc_status VARCHAR(20) NOT NULL DEFAULT 'pending';
+ALTER TABLE investors ADD COLUMN kyc_full_name VARCHAR(200);
+ALTER TABLE investors ADD COLUMN kyc_id_number VARCHAR(50);
+ALTER TABLE investors ADD COLUMN kyc_date_of_birth DATE;
+ALTER TABLE investors ADD COLUMN kyc_address TEXT;
+ALTER TABLE investors ADD COLUMN kyc_document_id TEXT;
+ALTER TABLE investors ADD COLUMN kyc_submitted_at TIMESTAMP;
+ALTER TABLE investors ADD COLUMN kyc_reviewed_by VARCHAR(50);
+ALTER TABLE investors ADD COLUMN kyc_reviewed_at TIMESTAMP;
+ALTER TABLE investors ADD COLUMN kyc_rejection_reason TEXT;
+CREATE INDEX IF NOT EXISTS idx_investors_kyc_status ON investors (kyc_status);
@@ -0,0 +1,20 @@
+-- migration: auto-invest rules (SQLite)
+
+ALTER TABLE loans ADD COLUMN risk_grade VARCHAR(1);
+
+CREATE TABLE IF NOT EXISTS auto_invest_rules (
+    id             TEXT PRIMARY KEY,
+    investor_id    TEXT NOT NULL UNIQUE REFERENCES investors(id) ON DELETE CASCADE,
+    min_roi        REAL NOT NULL,
+    max_principal  REAL NOT NULL,
+    max_per_loan   REAL NOT NULL,
+    daily_budget   REAL NOT NULL,
+    max_risk_grade VARCHAR(1),
+    active         BOOLEAN NOT NULL,
+    last_placed_at TIMESTAMP,
+    created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE investments ADD COLUMN auto_invest_rule_id TEXT;
+CREATE INDEX IF NOT EXISTS idx_investments_auto_invest_rule_id ON investments (auto_invest_rule_id, created_at);
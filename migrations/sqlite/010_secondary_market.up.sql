@@ -0,0 +1,21 @@
+-- migration: secondary market (SQLite)
+
+ALTER TABLE investments ADD COLUMN origin_id TEXT;
+ALTER TABLE investments ADD COLUMN transferred_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS listings (
+    id                  TEXT PRIMARY KEY,
+    loan_id             TEXT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    investment_id       TEXT NOT NULL REFERENCES investments(id),
+    seller_id           TEXT NOT NULL REFERENCES investors(id),
+    amount              REAL NOT NULL,
+    price               REAL NOT NULL,
+    state               VARCHAR(20) NOT NULL,
+    buyer_id            TEXT REFERENCES investors(id),
+    buyer_investment_id TEXT REFERENCES investments(id),
+    sold_at             TIMESTAMP,
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_listings_loan_id ON listings (loan_id, state);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_listings_open_investment ON listings (investment_id) WHERE state = 'open';
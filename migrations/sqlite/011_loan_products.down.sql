@@ -0,0 +1,5 @@
+-- revert: loan products
+ALTER TABLE loans DROP COLUMN tenor_months;
+ALTER TABLE loans DROP COLUMN product_code;
+ALTER TABLE loans DROP COLUMN product_id;
+DROP TABLE IF EXISTS loan_products;
@@ -0,0 +1,25 @@
+-- migration: loan products (SQLite)
+
+CREATE TABLE IF NOT EXISTS loan_products (
+    id                  TEXT PRIMARY KEY,
+    code                VARCHAR(50) NOT NULL,
+    version             INTEGER NOT NULL,
+    name                TEXT NOT NULL,
+    tenor_months        TEXT NOT NULL,
+    repayment_frequency VARCHAR(20) NOT NULL,
+    min_principal       REAL NOT NULL,
+    max_principal       REAL NOT NULL,
+    min_rate            REAL NOT NULL,
+    max_rate            REAL NOT NULL,
+    min_roi             REAL NOT NULL,
+    max_roi             REAL NOT NULL,
+    origination_fee     REAL NOT NULL,
+    late_fee            REAL NOT NULL,
+    agreement_template  VARCHAR(50),
+    created_at          TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (code, version)
+);
+
+ALTER TABLE loans ADD COLUMN product_id TEXT;
+ALTER TABLE loans ADD COLUMN product_code VARCHAR(50);
+ALTER TABLE loans ADD COLUMN tenor_months INTEGER;
@@ -0,0 +1,3 @@
+-- revert: unique loan documents
+DROP INDEX IF EXISTS idx_disbursements_agreement_document_id;
+DROP INDEX IF EXISTS idx_approvals_picture_document_id;
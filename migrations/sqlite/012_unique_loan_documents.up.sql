@@ -0,0 +1,4 @@
+-- migration: unique loan documents (SQLite)
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_approvals_picture_document_id ON approvals (picture_document_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_disbursements_agreement_document_id ON disbursements (agreement_document_id);
@@ -0,0 +1,2 @@
+-- revert: convert AutoMigrate columns
+SELECT 1;
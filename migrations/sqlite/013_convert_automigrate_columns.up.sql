@@ -0,0 +1,4 @@
+-- migration: convert AutoMigrate columns (SQLite)
+-- SQLite columns have no fixed storage type, so there is nothing to
+-- convert; the version exists to match the Postgres migrations.
+SELECT 1;
@@ -0,0 +1,8 @@
+-- migration: ledger account balance (SQLite)
+
+ALTER TABLE ledger_accounts ADD COLUMN balance REAL NOT NULL DEFAULT 0;
+
+UPDATE ledger_accounts SET balance = (
+    SELECT TOTAL(credit) - TOTAL(debit)
+    FROM postings WHERE postings.account_id = ledger_accounts.id
+);
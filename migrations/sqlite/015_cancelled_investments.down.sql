@@ -0,0 +1,18 @@
+-- revert: cancelled investments
+CREATE TABLE refunds_old (
+    id            TEXT PRIMARY KEY,
+    loan_id       TEXT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    investment_id TEXT NOT NULL,
+    investor_id   TEXT NOT NULL REFERENCES investors(id) ON DELETE CASCADE,
+    amount        REAL NOT NULL,
+    reason        VARCHAR(30) NOT NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO refunds_old SELECT id, loan_id, investment_id, investor_id, amount, reason, created_at FROM refunds;
+DROP TABLE refunds;
+ALTER TABLE refunds_old RENAME TO refunds;
+CREATE INDEX IF NOT EXISTS idx_refunds_loan_id ON refunds (loan_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_investor_id ON refunds (investor_id);
+
+DELETE FROM investments WHERE cancelled_at IS NOT NULL;
+ALTER TABLE investments DROP COLUMN cancelled_at;
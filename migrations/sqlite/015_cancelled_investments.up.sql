@@ -0,0 +1,25 @@
+-- migration: cancelled investments (SQLite)
+-- SQLite cannot add a foreign key to an existing column, so the
+-- refunds table is rebuilt with it.
+
+ALTER TABLE investments ADD COLUMN cancelled_at TIMESTAMP;
+
+INSERT INTO investments (id, loan_id, investor_id, amount, cancelled_at, created_at)
+SELECT r.investment_id, r.loan_id, r.investor_id, r.amount, r.created_at, r.created_at
+FROM refunds r
+WHERE NOT EXISTS (SELECT 1 FROM investments i WHERE i.id = r.investment_id);
+
+CREATE TABLE refunds_new (
+    id            TEXT PRIMARY KEY,
+    loan_id       TEXT NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    investment_id TEXT NOT NULL REFERENCES investments(id),
+    investor_id   TEXT NOT NULL REFERENCES investors(id) ON DELETE CASCADE,
+    amount        REAL NOT NULL,
+    reason        VARCHAR(30) NOT NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO refunds_new SELECT id, loan_id, investment_id, investor_id, amount, reason, created_at FROM refunds;
+DROP TABLE refunds;
+ALTER TABLE refunds_new RENAME TO refunds;
+CREATE INDEX IF NOT EXISTS idx_refunds_loan_id ON refunds (loan_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_investor_id ON refunds (investor_id);